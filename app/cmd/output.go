@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// textOutput is implemented by results of commands with a human readable
+// form other than their default formatting
+type textOutput interface {
+	Text() string
+}
+
+// printResult writes the result of a command to w, as text or as JSON for
+// scripts depending on format
+func printResult(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "", outputText:
+		if t, ok := v.(textOutput); ok {
+			_, err := fmt.Fprintln(w, t.Text())
+			return err
+		}
+
+		_, err := fmt.Fprintln(w, v)
+		return err
+	}
+
+	return fmt.Errorf("unknown output format: %s", format)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+func TestVersionOutput(t *testing.T) {
+	tt := []struct {
+		name   string
+		format string
+		err    bool
+	}{
+		{name: "text", format: outputText},
+		{name: "json", format: outputJSON},
+		{name: "unknown", format: "xml", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() { outputFormat = outputText }()
+
+			var out bytes.Buffer
+			RootCmd.SetOutput(&out)
+			RootCmd.SetArgs([]string{"--output", tc.format, "version"})
+			defer RootCmd.SetOutput(nil)
+
+			err := RootCmd.Execute()
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error for output format: %s", tc.format)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unable to execute command: %s", err)
+			}
+
+			if tc.format == outputText {
+				if !strings.HasPrefix(out.String(), "krl "+Version) {
+					t.Fatalf("unexpected text output: %s", out.String())
+				}
+				return
+			}
+
+			var v map[string]string
+			if err := json.Unmarshal(out.Bytes(), &v); err != nil {
+				t.Fatalf("unable to parse json output (%s): %s", out.String(), err)
+			}
+
+			for _, field := range []string{"version", "go", "os", "arch"} {
+				if v[field] == "" {
+					t.Fatalf("expected field %s in json output: %s", field, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSummaryOutput(t *testing.T) {
+	rs := kraaler.RunSummary{
+		Sessions:  10,
+		Successes: 7,
+		Errors:    2,
+		Timeouts:  1,
+		Bytes:     2048,
+		Hosts:     3,
+		Duration:  time.Minute,
+		Providers: kraaler.ProviderStats{Emitted: 12, Errors: 1},
+	}
+
+	var out bytes.Buffer
+	if err := printResult(&out, outputJSON, summaryOutput{rs}); err != nil {
+		t.Fatalf("unable to print summary: %s", err)
+	}
+
+	var parsed kraaler.RunSummary
+	if err := json.Unmarshal(out.Bytes(), &parsed); err != nil {
+		t.Fatalf("unable to parse json output (%s): %s", out.String(), err)
+	}
+
+	if parsed != rs {
+		t.Fatalf("expected summary %+v, but received: %+v", rs, parsed)
+	}
+
+	out.Reset()
+	if err := printResult(&out, outputText, summaryOutput{rs}); err != nil {
+		t.Fatalf("unable to print summary: %s", err)
+	}
+
+	for _, str := range []string{"crawled 10 session(s) of 3 host(s)", "providers still providing: emitted 12 url(s), 1 error(s)"} {
+		if !strings.Contains(out.String(), str) {
+			t.Fatalf("expected text summary to contain %q: %s", str, out.String())
+		}
+	}
+}
@@ -1,13 +1,30 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/spf13/cobra"
 )
 
+// outputFormat is the format commands print their results in
+var outputFormat string
+
 var RootCmd = &cobra.Command{
 	Use:   "krl",
 	Short: "Kraaler is an extendable user-perspective web crawler",
 	Long:  "Kraaler is an extendable user-perspective web crawler based on Chromium",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		switch outputFormat {
+		case outputText, outputJSON:
+			return nil
+		}
+
+		return fmt.Errorf("unknown output format: %s", outputFormat)
+	},
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output", outputText, "Format of the results printed by commands, text or json")
 }
 
 // func getDataPath(name string) string {
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCommandFlags(t *testing.T) {
+	for _, c := range RootCmd.Commands() {
+		t.Run(c.Name(), func(t *testing.T) {
+			var out bytes.Buffer
+			RootCmd.SetOutput(&out)
+			RootCmd.SetArgs([]string{c.Name(), "--help"})
+			defer RootCmd.SetOutput(nil)
+
+			// flags of a command colliding with the persistent flags of
+			// the root panic once they are merged
+			if err := RootCmd.Execute(); err != nil {
+				t.Fatalf("unable to execute %s --help: %s", c.Name(), err)
+			}
+
+			if out.Len() == 0 {
+				t.Fatalf("expected usage of %s", c.Name())
+			}
+		})
+	}
+}
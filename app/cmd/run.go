@@ -3,38 +3,129 @@ package cmd
 import (
 	"context"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/aau-network-security/kraaler"
+	"github.com/aau-network-security/kraaler/har"
 	"github.com/aau-network-security/kraaler/store"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
 var (
-	workerAmount  int
-	samplerName   string
-	noResampling  bool
-	dataDirectory string
+	workerAmount       int
+	warmContainers     int
+	dockerConnections  int
+	egressIPs          []string
+	cacheProxyAddr     string
+	cacheProxyMaxBytes int64
+	samplerName        string
+	noResampling       bool
+	maxFailures        int
+	prioritize         bool
+	maxRedirects       int
+	clickSelector      string
+	dnsRecords         bool
+	dnsServer          string
+	clickWait          time.Duration
+	maxInMemory        int
+	bloomURLs          uint
+	onlyDomain         string
+	excludeDomains     []string
+	urlInclude         []string
+	urlExclude         []string
+	maxDuration        time.Duration
+	summaryFile        string
+	dataDirectory      string
+	drainTimeout       time.Duration
+	politeness         time.Duration
+	politenessJitter   time.Duration
+	respectRobots      bool
+	maxRetries         int
+	maxDepth           int
+	waitForStatus      int
+	performanceMetrics bool
+	warmVisit          bool
+	waitEvent          string
+	waitUntil          string
+	networkQuiet       time.Duration
+	captureDOM         bool
+	preCaptureScript   string
+	autoScroll         bool
+	traceURLs          []string
+	hostLookupTimeout  time.Duration
+	reverseDNS         bool
+	asnLookup          bool
+	cookies            []string
+	screenshotFormat   string
+	followLinks        string
 
 	filterRespBodies string
+	trackerListPath  string
+	inlineBodySize   int
+	bodyCompression  string
+	bodyKeyPath      string
+	s3Endpoint       string
+	s3Region         string
+	s3Bucket         string
+	s3Prefix         string
+
+	logLevel  string
+	logFormat string
+	logOutput string
 
 	providerDomainFiles []string
+	providerStdin       bool
+	providerSitemaps    []string
+	providerHTTP        []string
+	providerHTTPToken   string
+	providerWeights     []int
+	pageStoreNames      []string
+	harDirectory        string
 )
 
 var (
-	samplersByName = map[string]store.Sampler{
-		"uni": store.UniformSampler(),
-		"pw":  store.PairSampler(2000),
+	linkPoliciesByName = map[string]kraaler.LinkPolicyKind{
+		"all":       kraaler.FollowAll,
+		"same-site": kraaler.FollowSameSite,
+		"none":      kraaler.FollowNone,
+	}
+
+	waitConditionsByName = map[string]kraaler.WaitUntil{
+		"domcontentloaded": kraaler.WaitDOMContentLoaded,
+		"load":             kraaler.WaitLoad,
+		"networkidle":      kraaler.WaitNetworkIdle,
+	}
+
+	compressionsByName = map[string]store.Compressor{
+		"none": store.NoCompression,
+		"gzip": store.GzipCompression,
+		"zstd": store.ZstdCompression,
 	}
 )
 
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+
+	return false
+}
+
 func ensureDir(dir string) error {
 	if _, err := os.Stat(dir); !os.IsNotExist(err) {
 		return err
@@ -57,9 +148,32 @@ var runCmd = &cobra.Command{
 			zap.WrapCore(ui.Wrapper),
 		)
 
-		smpl, ok := samplersByName[samplerName]
+		smpl, err := store.LookupSampler(samplerName)
+		if err != nil {
+			stopWithErr(err)
+		}
+
+		follow, ok := linkPoliciesByName[followLinks]
 		if !ok {
-			stopWithErr(fmt.Errorf("unknown sampler: %s", samplerName))
+			stopWithErr(fmt.Errorf("unknown link policy: %s", followLinks))
+		}
+
+		if waitEvent != "" && !containsString(kraaler.LifecycleEvents, waitEvent) {
+			stopWithErr(fmt.Errorf("unknown lifecycle event: %s", waitEvent))
+		}
+
+		if !containsString(kraaler.ScreenshotFormats, screenshotFormat) {
+			stopWithErr(fmt.Errorf("unknown screenshot format: %s", screenshotFormat))
+		}
+
+		until, ok := waitConditionsByName[waitUntil]
+		if !ok {
+			stopWithErr(fmt.Errorf("unknown wait condition: %s", waitUntil))
+		}
+
+		comp, ok := compressionsByName[bodyCompression]
+		if !ok {
+			stopWithErr(fmt.Errorf("unknown compression: %s", bodyCompression))
 		}
 
 		urlOpts := []store.URLStoreOpt{store.WithSampler(smpl)}
@@ -68,6 +182,41 @@ var runCmd = &cobra.Command{
 			urlOpts = append(urlOpts, store.WithNoResampling())
 		}
 
+		if maxFailures > 0 {
+			urlOpts = append(urlOpts, store.WithFailureThreshold(maxFailures))
+		}
+
+		if prioritize {
+			urlOpts = append(urlOpts, store.WithPrioritySampling())
+		}
+
+		if maxInMemory > 0 {
+			urlOpts = append(urlOpts, store.WithMaxInMemory(maxInMemory))
+		}
+
+		if bloomURLs > 0 {
+			if maxInMemory <= 0 {
+				stopWithErr(fmt.Errorf("--bloom-filter-urls requires --max-urls-in-memory"))
+			}
+			urlOpts = append(urlOpts, store.WithBloomFilter(bloomURLs, 0.01))
+		}
+
+		if onlyDomain != "" {
+			urlOpts = append(urlOpts, store.WithURLFilters(store.OnlyDomain(onlyDomain)))
+		}
+
+		if len(excludeDomains) > 0 {
+			urlOpts = append(urlOpts, store.WithURLFilters(store.ExcludeDomains(excludeDomains...)))
+		}
+
+		if len(urlInclude) > 0 || len(urlExclude) > 0 {
+			f, err := kraaler.URLRegexpFilter(urlInclude, urlExclude)
+			if err != nil {
+				stopWithErr(err)
+			}
+			urlOpts = append(urlOpts, store.WithURLFilters(f))
+		}
+
 		screenshotDir := filepath.Join(dataDirectory, "screenshots")
 		bodiesDir := filepath.Join(dataDirectory, "response_bodies")
 		for _, dir := range []string{
@@ -80,7 +229,15 @@ var runCmd = &cobra.Command{
 			}
 		}
 
-		logger, err := newLogger(logOpts...)
+		if logOutput == "" {
+			logOutput = filepath.Join(dataDirectory, "log")
+		}
+
+		logger, err := newLogger(logConfig{
+			Level:  logLevel,
+			Format: logFormat,
+			Output: logOutput,
+		}, logOpts...)
 		if err != nil {
 			stopWithErr(err)
 		}
@@ -98,6 +255,26 @@ var runCmd = &cobra.Command{
 			providers = append(providers, p)
 		}
 
+		if providerStdin {
+			providers = append(providers, kraaler.NewStdinProvider(&kraaler.StdinProviderConfig{
+				Logger: logger,
+			}))
+		}
+
+		for _, endpoint := range providerSitemaps {
+			providers = append(providers, kraaler.NewSitemapProvider(kraaler.SitemapProviderConfig{
+				Endpoint: endpoint,
+			}))
+		}
+
+		for _, endpoint := range providerHTTP {
+			providers = append(providers, kraaler.NewHTTPProvider(kraaler.HTTPProviderConfig{
+				Endpoint: endpoint,
+				Token:    providerHTTPToken,
+				Logger:   logger,
+			}))
+		}
+
 		if len(providers) == 0 {
 			stopWithErr(fmt.Errorf("need one or more providers"))
 		}
@@ -113,19 +290,198 @@ var runCmd = &cobra.Command{
 			stopWithErr(err)
 		}
 
-		for _, p := range providers {
-			us.Consume(p)
+		if len(providerWeights) > 0 {
+			if len(providerWeights) != len(providers) {
+				stopWithErr(fmt.Errorf("expected one weight per provider"))
+			}
+
+			var quotas []kraaler.ProviderQuota
+			for i, p := range providers {
+				quotas = append(quotas, kraaler.ProviderQuota{Provider: p, Weight: providerWeights[i]})
+			}
+
+			us.Consume(kraaler.NewWeightedProvider(kraaler.WeightedProviderConfig{Quotas: quotas}))
+		} else {
+			us.Consume(kraaler.MergeProviders(providers...))
+		}
+
+		storeOpts := []store.StoreOpt{
+			store.WithInlineBodySize(inlineBodySize),
+			store.WithBodyCompression(comp),
+		}
+
+		if filterRespBodies != "" {
+			m, err := kraaler.MatcherByRegexp(filterRespBodies)
+			if err != nil {
+				stopWithErr(err)
+			}
+			storeOpts = append(storeOpts, store.WithBodyMimeTypes(m))
+		}
+		if bodyKeyPath != "" {
+			raw, err := ioutil.ReadFile(bodyKeyPath)
+			if err != nil {
+				stopWithErr(err)
+			}
+
+			key, err := hex.DecodeString(strings.TrimSpace(string(raw)))
+			if err != nil {
+				stopWithErr(fmt.Errorf("body key must be hex encoded: %s", err))
+			}
+
+			storeOpts = append(storeOpts, store.WithBodyEncryption(key))
+		}
+
+		// every worker and warm container may create or remove a
+		// container at the same time
+		if dockerConnections == 0 {
+			dockerConnections = workerAmount + warmContainers
+		}
+
+		var seeded []kraaler.Cookie
+		for _, c := range cookies {
+			parts := strings.SplitN(c, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				stopWithErr(fmt.Errorf("cookie must be on the form name=value: %s", c))
+			}
+
+			seeded = append(seeded, kraaler.Cookie{Name: parts[0], Value: parts[1]})
+		}
+
+		var script string
+		if preCaptureScript != "" {
+			raw, err := ioutil.ReadFile(preCaptureScript)
+			if err != nil {
+				stopWithErr(err)
+			}
+			script = string(raw)
+		}
+
+		if s3Bucket != "" {
+			storeOpts = append(storeOpts, store.WithS3(store.S3Config{
+				Endpoint:  s3Endpoint,
+				Region:    s3Region,
+				Bucket:    s3Bucket,
+				Prefix:    s3Prefix,
+				AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+				SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			}))
 		}
 
-		ps, err := store.NewStore(db, bodiesDir, screenshotDir)
+		ps, err := store.NewPageStore(store.PageStoreConfig{
+			DB:             db,
+			BodyPath:       bodiesDir,
+			ScreenshotPath: screenshotDir,
+			StoreOpts:      storeOpts,
+		}, pageStoreNames...)
 		if err != nil {
 			stopWithErr(err)
 		}
 
+		if harDirectory != "" {
+			if err := ensureDir(harDirectory); err != nil {
+				stopWithErr(err)
+			}
+
+			ps = store.MultiStore{ps, har.NewStore(harDirectory)}
+		}
+
+		var hrl *kraaler.HostRateLimiter
+		if politeness > 0 || politenessJitter > 0 {
+			hrl = kraaler.NewHostRateLimiter(politeness, kraaler.WithJitter(politenessJitter))
+		}
+
+		var trackers kraaler.TrackerList
+		if trackerListPath != "" {
+			trackers, err = kraaler.LoadTrackerList(trackerListPath)
+			if err != nil {
+				stopWithErr(err)
+			}
+		}
+
+		var robots *kraaler.RobotsCache
+		if respectRobots {
+			robots = kraaler.NewRobotsCache("kraaler")
+		}
+
+		var traced func(*url.URL) bool
+		if len(traceURLs) > 0 {
+			traced, err = kraaler.URLRegexpFilter(traceURLs, nil)
+			if err != nil {
+				stopWithErr(err)
+			}
+		}
+
+		linkPolicy := func(*url.URL) kraaler.LinkPolicy {
+			return kraaler.LinkPolicy{Kind: follow}
+		}
+
+		var asns kraaler.ASNResolver
+		if asnLookup {
+			asns = kraaler.CymruASNResolver{}
+		}
+
+		if !dnsRecords {
+			dnsServer = ""
+		} else if dnsServer == "" {
+			if dnsServer = kraaler.SystemNameServer(); dnsServer == "" {
+				stopWithErr(fmt.Errorf("no name server to query for dns records"))
+			}
+		}
+
+		for _, ip := range egressIPs {
+			if net.ParseIP(ip) == nil {
+				stopWithErr(fmt.Errorf("invalid egress ip: %s", ip))
+			}
+		}
+
+		var cacheProxy *kraaler.CacheProxy
+		if cacheProxyAddr != "" {
+			cacheProxy, err = kraaler.NewCacheProxy(cacheProxyAddr, kraaler.WithCacheMaxBytes(cacheProxyMaxBytes))
+			if err != nil {
+				stopWithErr(err)
+			}
+			defer cacheProxy.Close()
+		}
+
+		var clickAfterLoad *kraaler.Click
+		if clickSelector != "" {
+			clickAfterLoad = &kraaler.Click{Selector: clickSelector, Wait: clickWait}
+		}
+
 		wc, err := kraaler.NewWorkerController(context.Background(), kraaler.WorkerControllerConfig{
-			URLStore:  us,
-			PageStore: ps,
-			Logger:    logger,
+			URLStore:           us,
+			URLProviders:       providers,
+			PageStore:          ps,
+			Logger:             logger,
+			DrainTimeout:       drainTimeout,
+			MaxRetries:         maxRetries,
+			MaxDepth:           maxDepth,
+			LinkPolicy:         linkPolicy,
+			HostRateLimiter:    hrl,
+			Robots:             robots,
+			Trackers:           trackers,
+			WaitForStatus:      waitForStatus,
+			WarmContainers:     warmContainers,
+			DockerConnections:  dockerConnections,
+			EgressIPs:          egressIPs,
+			CacheProxy:         cacheProxy,
+			PerformanceMetrics: performanceMetrics,
+			WarmVisit:          warmVisit,
+			WaitEvent:          waitEvent,
+			WaitUntil:          until,
+			NetworkQuiet:       networkQuiet,
+			CaptureDOM:         captureDOM,
+			PreCaptureScript:   script,
+			AutoScroll:         autoScroll,
+			Trace:              traced,
+			MaxRedirects:       maxRedirects,
+			Click:              clickAfterLoad,
+			HostLookupTimeout:  hostLookupTimeout,
+			ReverseDNS:         reverseDNS,
+			ASNResolver:        asns,
+			DNSNameServer:      dnsServer,
+			Cookies:            seeded,
+			ScreenshotFormat:   screenshotFormat,
 		})
 		if err != nil {
 			stopWithErr(err)
@@ -148,33 +504,162 @@ var runCmd = &cobra.Command{
 		done := make(chan struct{}, 1)
 		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+		var deadline <-chan time.Time
+		if maxDuration > 0 {
+			deadline = time.After(maxDuration)
+		}
+
 		go func() {
-			<-sigs
+			select {
+			case <-sigs:
+			case <-deadline:
+			}
 			wc.Close()
 			done <- struct{}{}
 		}()
 
 		<-done
+
+		summary := wc.Summary()
+		if summaryFile != "" {
+			if err := writeSummary(summaryFile, summary); err != nil {
+				stopWithErr(err)
+			}
+		}
+
+		if err := printResult(cmd.OutOrStdout(), outputFormat, summaryOutput{summary}); err != nil {
+			stopWithErr(err)
+		}
 	},
 }
 
-func newLogger(opts ...zap.Option) (*zap.Logger, error) {
+// summaryOutput is the summary of a run printed when it ends
+type summaryOutput struct {
+	kraaler.RunSummary
+}
+
+func (so summaryOutput) Text() string {
+	rs := so.RunSummary
+	state := "still providing"
+	if rs.Providers.Done {
+		state = "done"
+	}
+
+	return fmt.Sprintf("crawled %d session(s) of %d host(s) in %s: %d succeeded, %d failed, %d timed out (%d bytes)\nproviders %s: emitted %d url(s), %d error(s)",
+		rs.Sessions, rs.Hosts, rs.Duration.Round(time.Second), rs.Successes, rs.Errors, rs.Timeouts, rs.Bytes,
+		state, rs.Providers.Emitted, rs.Providers.Errors)
+}
+
+// writeSummary writes the summary of a run as JSON to path
+func writeSummary(path string, rs kraaler.RunSummary) error {
+	raw, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, raw, 0644)
+}
+
+type logConfig struct {
+	Level  string
+	Format string
+	Output string
+}
+
+func newLogger(conf logConfig, opts ...zap.Option) (*zap.Logger, error) {
 	cfg := zap.NewProductionConfig()
+
+	if conf.Level != "" {
+		if err := cfg.Level.UnmarshalText([]byte(conf.Level)); err != nil {
+			return nil, err
+		}
+	}
+
+	switch conf.Format {
+	case "", "json":
+	case "console":
+		cfg.Encoding = "console"
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", conf.Format)
+	}
+
 	cfg.OutputPaths = []string{
-		"./crawled-data/log",
+		conf.Output,
 	}
 	return cfg.Build(opts...)
 }
 
 func init() {
 	runCmd.Flags().IntVarP(&workerAmount, "workers", "n", 1, "Amount of workers in the pool")
-	runCmd.Flags().StringVar(&samplerName, "sampler", "uni", "The type of sampler used for prioritizing URLs")
+	runCmd.Flags().StringVar(&samplerName, "sampler", "uni", fmt.Sprintf("The type of sampler used for prioritizing URLs (%s)", strings.Join(store.Samplers(), ",")))
 	runCmd.Flags().BoolVarP(&noResampling, "unique", "u", false, "Only crawl URLs once")
+	runCmd.Flags().IntVar(&maxFailures, "max-failures", 0, "Stop crawling URLs failing this many times in a row (0 never stops)")
+	runCmd.Flags().BoolVar(&prioritize, "prioritize", false, "Crawl URLs of the highest priority, e.g. fresh phishing reports, before other URLs")
+	runCmd.Flags().IntVar(&maxInMemory, "max-urls-in-memory", 0, "Amount of URLs kept in memory before visited URLs are evicted to the database (0 keeps every URL)")
+	runCmd.Flags().UintVar(&bloomURLs, "bloom-filter-urls", 0, "Expected amount of URLs of a bloom filter checking whether URLs evicted from memory are known, requires --max-urls-in-memory (0 disables it)")
+	runCmd.Flags().StringVar(&onlyDomain, "only-domain", "", "Only crawl URLs of this registered domain and its subdomains")
+	runCmd.Flags().StringArrayVar(&excludeDomains, "exclude-domain", []string{}, "Skip URLs of this domain and its subdomains, can be repeated")
+	runCmd.Flags().StringArrayVar(&urlInclude, "url-include", []string{}, "Only crawl URLs matching this regexp, or any of them when repeated")
+	runCmd.Flags().StringArrayVar(&urlExclude, "url-exclude", []string{}, "Skip URLs matching this regexp, can be repeated")
 	runCmd.Flags().StringVarP(&dataDirectory, "data-dir", "o", "crawled-data", "Directory to output crawled information")
-
-	runCmd.Flags().StringVar(&filterRespBodies, "filter-resp-bodies-ct", "", "Filter response bodies using regexp on content type")
+	runCmd.Flags().DurationVar(&politeness, "politeness", 0, "Minimum delay between crawls of the same domain")
+	runCmd.Flags().DurationVar(&politenessJitter, "politeness-jitter", 0, "Maximum random delay added to the delay between crawls of the same domain")
+	runCmd.Flags().BoolVar(&respectRobots, "respect-robots", false, "Skip URLs disallowed by the robots.txt of their host")
+	runCmd.Flags().IntVar(&maxRetries, "max-retries", 0, "Amount of times to retry a crawl failing with a transient network error")
+	runCmd.Flags().IntVar(&maxDepth, "max-depth", 0, "Maximum amount of links followed from a seed URL (0 means unlimited)")
+	runCmd.Flags().IntVar(&dockerConnections, "docker-connections", 0, "Amount of concurrent connections to the docker daemon, defaults to the amount of workers and warm containers")
+	runCmd.Flags().IntVar(&warmContainers, "warm-containers", 0, "Amount of browser containers kept started for workers resetting their browser")
+	runCmd.Flags().StringSliceVar(&egressIPs, "egress-ip", []string{}, "Source addresses of the host assigned to workers round-robin, each worker reaching the internet from its own")
+	runCmd.Flags().StringVar(&cacheProxyAddr, "cache-proxy", "", "Serve a proxy caching the plain HTTP assets fetched by the browsers on this address (e.g. 172.17.0.1:3128), which must be reachable from the containers")
+	runCmd.Flags().Int64Var(&cacheProxyMaxBytes, "cache-proxy-max-bytes", kraaler.DefaultCacheProxyMaxBytes, "Total size of the assets cached by --cache-proxy")
+	runCmd.Flags().IntVar(&maxRedirects, "max-redirects", 0, "Stop the navigation of pages redirected more than this many times (0 means unlimited)")
+	runCmd.Flags().IntVar(&waitForStatus, "wait-for-status", 0, "Follow the navigations of each page until its document is served with this status (0 disables it)")
+	runCmd.Flags().BoolVar(&performanceMetrics, "performance-metrics", false, "Store the performance metrics reported by the browser for every page")
+	runCmd.Flags().BoolVar(&warmVisit, "warm-visit", false, "Load every page a second time with the cache of the first visit, storing both visits")
+	runCmd.Flags().StringVar(&waitUntil, "wait-until", "domcontentloaded", "Condition after which a page is considered loaded (domcontentloaded, load, networkidle)")
+	runCmd.Flags().DurationVar(&networkQuiet, "network-quiet", kraaler.DefaultNetworkQuiet, "Time without requests in flight for the network to be idle when using --wait-until networkidle")
+	runCmd.Flags().StringVar(&waitEvent, "wait-event", "", fmt.Sprintf("Lifecycle event after which a page is considered loaded (%s), defaults to DOMContentLoaded", strings.Join(kraaler.LifecycleEvents, ", ")))
+	runCmd.Flags().BoolVar(&captureDOM, "capture-dom", false, "Store the HTML serialized from the DOM of every page after it has loaded")
+	runCmd.Flags().StringVar(&screenshotFormat, "screenshot-format", kraaler.DefaultScreenshotFormat, fmt.Sprintf("Image format of screenshots (%s)", strings.Join(kraaler.ScreenshotFormats, ", ")))
+	runCmd.Flags().StringArrayVar(&cookies, "cookie", []string{}, "Cookie (name=value) set for every page before navigating to it, can be repeated")
+	runCmd.Flags().BoolVar(&autoScroll, "auto-scroll", false, "Scroll through every page after it has loaded, such that lazily loaded content is fetched")
+	runCmd.Flags().DurationVar(&hostLookupTimeout, "host-lookup-timeout", kraaler.DefaultHostLookupTimeout, "Time given to look up the name servers and addresses of a host")
+	runCmd.Flags().BoolVar(&reverseDNS, "reverse-dns", false, "Look up the PTR record of the address of every host")
+	runCmd.Flags().BoolVar(&asnLookup, "asn-lookup", false, "Look up the autonomous system of the address of every host using the Team Cymru DNS service")
+	runCmd.Flags().BoolVar(&dnsRecords, "dns-records", false, "Record the address records of every host and their TTLs, as answered by --dns-server")
+	runCmd.Flags().StringVar(&dnsServer, "dns-server", "", "Name server (host:port) queried for --dns-records, defaults to the first name server of /etc/resolv.conf")
+	runCmd.Flags().StringArrayVar(&traceURLs, "trace-url", []string{}, "Record a trace of loading the pages of URLs matching this regexp, viewable in chrome://tracing (heavy, meant for few pages), can be repeated")
+	runCmd.Flags().StringVar(&clickSelector, "click-selector", "", "CSS selector of an element clicked in every page after it has loaded, e.g. an \"enter site\" button")
+	runCmd.Flags().DurationVar(&clickWait, "click-wait", kraaler.DefaultClickWait, "Time waited after clicking before a page is captured when using --click-selector")
+	runCmd.Flags().StringVar(&preCaptureScript, "pre-capture-script", "", "Path to a JavaScript file evaluated in every page after it has loaded and before screenshots are taken")
+	runCmd.Flags().StringVar(&followLinks, "follow", "all", "Which discovered links to follow (all, same-site, none)")
+	runCmd.Flags().DurationVar(&maxDuration, "max-duration", 0, "Stop the run after this long (0 runs until interrupted)")
+	runCmd.Flags().StringVar(&summaryFile, "summary-file", "", "Path to write a JSON summary of the run to once it has finished")
+	runCmd.Flags().DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "Time to wait for in-flight crawls to finish when shutting down")
+
+	runCmd.Flags().StringVar(&filterRespBodies, "filter-resp-bodies-ct", "", "Only store response bodies of which the content type matches this regexp (defaults to text/ content types)")
+	runCmd.Flags().IntVar(&inlineBodySize, "inline-body-size", 0, "Store response bodies smaller than this amount of bytes in the database instead of on disk")
+	runCmd.Flags().StringVar(&bodyCompression, "body-compression", "gzip", "Compression of response bodies stored on disk (none, gzip, zstd)")
+	runCmd.Flags().StringVar(&bodyKeyPath, "body-key-file", "", "File containing a hex encoded AES key used to encrypt response bodies stored on disk")
+	runCmd.Flags().StringVar(&s3Bucket, "s3-bucket", "", "Upload response bodies and screenshots to this S3 bucket, using the credentials of AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	runCmd.Flags().StringVar(&s3Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "Endpoint of the S3 (compatible) service used by --s3-bucket")
+	runCmd.Flags().StringVar(&s3Region, "s3-region", "us-east-1", "Region of the bucket used by --s3-bucket")
+	runCmd.Flags().StringVar(&s3Prefix, "s3-prefix", "", "Prefix of the keys uploaded to --s3-bucket")
+	runCmd.Flags().StringVar(&trackerListPath, "tracker-list", "", "File of tracker and ad domains, one per line (defaults to the bundled list)")
 
 	runCmd.Flags().StringSliceVar(&providerDomainFiles, "provider-domain-file", []string{}, "Read file and provide a series of URLs based on the domains found in the file")
+	runCmd.Flags().BoolVar(&providerStdin, "provider-stdin", false, "Read URLs from stdin, one per line")
+	runCmd.Flags().StringSliceVar(&providerSitemaps, "provider-sitemap", []string{}, "Fetch sitemap (XML) and provide the URLs found in it")
+	runCmd.Flags().StringSliceVar(&providerHTTP, "provider-http", []string{}, "Poll JSON endpoint and provide the URLs it returns")
+	runCmd.Flags().StringVar(&providerHTTPToken, "provider-http-token", "", "Bearer token sent to the JSON endpoints of --provider-http")
+	runCmd.Flags().IntSliceVar(&providerWeights, "provider-weight", []int{}, "Amount of URLs consumed from each provider per round, in the order the providers are given")
+	runCmd.Flags().StringVar(&harDirectory, "har-dir", "", "Directory to output a HAR (HTTP Archive) file per crawled session")
+	runCmd.Flags().StringSliceVar(&pageStoreNames, "store", []string{"sqlite"}, fmt.Sprintf("Page stores used for saving crawled sessions (%s)", strings.Join(store.PageStores(), ",")))
+
+	runCmd.Flags().StringVar(&logLevel, "log-level", "info", "Minimum level of log messages (debug, info, warn, error)")
+	runCmd.Flags().StringVar(&logFormat, "log-format", "json", "Format of log messages (json, console)")
+	runCmd.Flags().StringVar(&logOutput, "log-output", "", "Output of log messages, stdout, stderr or a file path (defaults to a file in the data directory)")
 
 	RootCmd.AddCommand(runCmd)
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tt := []struct {
+		name      string
+		level     string
+		format    string
+		debugSeen bool
+		err       bool
+	}{
+		{name: "default", debugSeen: false},
+		{name: "debug", level: "debug", debugSeen: true},
+		{name: "error", level: "error", debugSeen: false},
+		{name: "console", level: "debug", format: "console", debugSeen: true},
+		{name: "unknown level", level: "loud", err: true},
+		{name: "unknown format", format: "xml", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "kraaler-log")
+			if err != nil {
+				t.Fatalf("unable to create temp file: %s", err)
+			}
+			f.Close()
+			defer os.Remove(f.Name())
+
+			logger, err := newLogger(logConfig{
+				Level:  tc.level,
+				Format: tc.format,
+				Output: f.Name(),
+			})
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to create logger: %s", err)
+			}
+
+			logger.Debug("debug_msg")
+			logger.Info("info_msg")
+			logger.Sync()
+
+			out, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatalf("unable to read log: %s", err)
+			}
+
+			if seen := strings.Contains(string(out), "debug_msg"); seen != tc.debugSeen {
+				t.Fatalf("expected debug message to be emitted: %t, output: %s", tc.debugSeen, out)
+			}
+
+			if infoSeen := strings.Contains(string(out), "info_msg"); infoSeen != (tc.level != "error") {
+				t.Fatalf("unexpected info message output: %s", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+// Version is the version of kraaler, set when building through
+// -ldflags "-X github.com/aau-network-security/kraaler/app/cmd.Version=..."
+var Version = "dev"
+
+type versionOutput struct {
+	Version string `json:"version"`
+	Go      string `json:"go"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+}
+
+func (vo versionOutput) Text() string {
+	return fmt.Sprintf("krl %s (%s %s/%s)", vo.Version, vo.Go, vo.OS, vo.Arch)
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version of kraaler",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printResult(cmd.OutOrStdout(), outputFormat, versionOutput{
+			Version: Version,
+			Go:      runtime.Version(),
+			OS:      runtime.GOOS,
+			Arch:    runtime.GOARCH,
+		})
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(versionCmd)
+}
@@ -0,0 +1,134 @@
+package kraaler_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/aau-network-security/kraaler/store"
+	"go.uber.org/zap"
+)
+
+type signalingPageStore struct {
+	kraaler.PageStore
+	saved chan struct{}
+}
+
+func (sps *signalingPageStore) SaveSession(p kraaler.Page) error {
+	err := sps.PageStore.SaveSession(p)
+	sps.saved <- struct{}{}
+	return err
+}
+
+func memoryDB(b *testing.B) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		b.Fatalf("unable to open db: %s", err)
+	}
+
+	// every connection to :memory: is a separate database
+	db.SetMaxOpenConns(1)
+
+	return db
+}
+
+func BenchmarkCrawl(b *testing.B) {
+	if chromeBinary == "" {
+		b.Skip("unable to locate chrome binary")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>%s</title></head><body><p>%s</p></body></html>`, r.URL.Path, randStr(512))
+	}))
+	defer ts.Close()
+
+	port := getAvailablePort()
+	cmd := exec.Command(chromeBinary,
+		"--headless",
+		"--disable-gpu",
+		fmt.Sprintf("--remote-debugging-port=%d", port),
+		"about:blank")
+	if err := cmd.Start(); err != nil {
+		b.Fatalf("unable to start chrome: %s", err)
+	}
+	defer cmd.Process.Kill()
+
+	endpoint := fmt.Sprintf("http://localhost:%d", port)
+	kraaler.WaitForEndpoint(context.Background(), endpoint)
+
+	dir, err := ioutil.TempDir("", "kraaler-bench")
+	if err != nil {
+		b.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	us, err := store.NewURLStore(memoryDB(b), store.WithNoResampling())
+	if err != nil {
+		b.Fatalf("unable to create url store: %s", err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		u, _ := url.Parse(fmt.Sprintf("%s/%d", ts.URL, i))
+		if _, err := us.Add(u); err != nil {
+			b.Fatalf("unable to add url: %s", err)
+		}
+	}
+
+	s, err := store.NewStore(memoryDB(b), dir+"/bodies", dir+"/screenshots")
+	if err != nil {
+		b.Fatalf("unable to create store: %s", err)
+	}
+	ps := &signalingPageStore{s, make(chan struct{}, b.N)}
+
+	second := time.Second
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:  us,
+			PageStore: ps,
+			LinkPolicy: func(*url.URL) kraaler.LinkPolicy {
+				return kraaler.LinkPolicy{Kind: kraaler.FollowNone}
+			},
+			WorkerProducer: func() (kraaler.Worker, error) {
+				return kraaler.NewWorker(kraaler.WorkerConfig{
+					UseInstance: endpoint,
+					LoadTimeout: &second,
+					Logger:      zap.NewNop(),
+				})
+			},
+		},
+	)
+	if err != nil {
+		b.Fatalf("unable to create worker controller: %s", err)
+	}
+	defer wc.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+
+	if err := wc.AddWorker(); err != nil {
+		b.Fatalf("unable to add worker: %s", err)
+	}
+
+	for i := 0; i < b.N; i++ {
+		select {
+		case <-ps.saved:
+		case <-time.After(30 * time.Second):
+			b.Fatalf("timed out after %d of %d sessions", i, b.N)
+		}
+	}
+
+	b.StopTimer()
+	b.Logf("%.2f sessions/s", float64(b.N)/time.Since(start).Seconds())
+}
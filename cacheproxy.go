@@ -0,0 +1,358 @@
+package kraaler
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheProxyHeader is set on the responses passing a CacheProxy, to
+// CacheHit when served from its cache or CacheMiss when fetched upstream
+const CacheProxyHeader = "X-Kraaler-Cache"
+
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+const (
+	// DefaultCacheProxyTTL is the time assets without a max-age are cached
+	DefaultCacheProxyTTL = time.Hour
+
+	// DefaultCacheProxyMaxBytes is the total size of the cached assets
+	DefaultCacheProxyMaxBytes = 512 << 20
+
+	// cacheProxyMaxEntry is the size of the largest asset cached
+	cacheProxyMaxEntry = 16 << 20
+)
+
+// hopHeaders are only meaningful for a single connection, and are not
+// forwarded by the proxy
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+type CacheProxyOpt func(*CacheProxy)
+
+// WithCacheTTL caches assets without a max-age for ttl, defaults to
+// DefaultCacheProxyTTL
+func WithCacheTTL(ttl time.Duration) CacheProxyOpt {
+	return func(cp *CacheProxy) {
+		cp.ttl = ttl
+	}
+}
+
+// WithCacheMaxBytes bounds the total size of the cached assets, defaults to
+// DefaultCacheProxyMaxBytes
+func WithCacheMaxBytes(n int64) CacheProxyOpt {
+	return func(cp *CacheProxy) {
+		cp.maxBytes = n
+	}
+}
+
+// CacheProxy is an HTTP proxy for browsers caching the assets fetched by
+// them, such that assets shared by pages are only fetched once. Only plain
+// HTTP is cached, HTTPS is tunneled as is
+type CacheProxy struct {
+	ln        net.Listener
+	srv       *http.Server
+	transport http.RoundTripper
+	ttl       time.Duration
+	maxBytes  int64
+
+	m       sync.Mutex
+	entries map[string]*cachedResponse
+	size    int64
+}
+
+// NewCacheProxy serves the proxy on addr (host:port)
+func NewCacheProxy(addr string, opts ...CacheProxyOpt) (*CacheProxy, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &CacheProxy{
+		ln: ln,
+		transport: &http.Transport{
+			// bodies are cached as sent by the server
+			DisableCompression:  true,
+			MaxIdleConnsPerHost: 8,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		ttl:      DefaultCacheProxyTTL,
+		maxBytes: DefaultCacheProxyMaxBytes,
+		entries:  map[string]*cachedResponse{},
+	}
+
+	for _, opt := range opts {
+		opt(cp)
+	}
+
+	cp.srv = &http.Server{Handler: cp}
+	go cp.srv.Serve(ln)
+
+	return cp, nil
+}
+
+// Port is the port the proxy is listening on
+func (cp *CacheProxy) Port() int {
+	return cp.ln.Addr().(*net.TCPAddr).Port
+}
+
+// Addr is the address the proxy is listening on
+func (cp *CacheProxy) Addr() string {
+	return cp.ln.Addr().String()
+}
+
+func (cp *CacheProxy) Close() error {
+	return cp.srv.Close()
+}
+
+func (cp *CacheProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		cp.tunnel(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "only proxy requests are served", http.StatusBadRequest)
+		return
+	}
+
+	key := cacheKey(r)
+	if key != "" {
+		if cr := cp.get(key); cr != nil {
+			copyHeader(w.Header(), cr.header)
+			w.Header().Set(CacheProxyHeader, CacheHit)
+			w.WriteHeader(cr.status)
+			w.Write(cr.body)
+			return
+		}
+	}
+
+	// the header of the request is changed, the rest is shared with r
+	out := new(http.Request)
+	*out = *r
+	out.Header = http.Header{}
+	copyHeader(out.Header, r.Header)
+	out.RequestURI = ""
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := cp.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range hopHeaders {
+		resp.Header.Del(h)
+	}
+
+	var buffered []byte
+	ttl := cp.freshness(resp)
+	if key != "" && ttl > 0 && resp.ContentLength <= cacheProxyMaxEntry {
+		buffered, err = ioutil.ReadAll(io.LimitReader(resp.Body, cacheProxyMaxEntry+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		if len(buffered) <= cacheProxyMaxEntry {
+			header := http.Header{}
+			copyHeader(header, resp.Header)
+			cp.put(key, &cachedResponse{
+				status:  resp.StatusCode,
+				header:  header,
+				body:    buffered,
+				expires: time.Now().Add(ttl),
+			})
+		}
+	}
+
+	copyHeader(w.Header(), resp.Header)
+	w.Header().Set(CacheProxyHeader, CacheMiss)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, io.MultiReader(bytes.NewReader(buffered), resp.Body))
+}
+
+// tunnel connects the client to the host of r, for the TLS connections of
+// HTTPS and websockets
+func (cp *CacheProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, 10*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection cannot be tunneled", http.StatusInternalServerError)
+		return
+	}
+
+	client, rw, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	go func() {
+		io.Copy(upstream, rw)
+		upstream.Close()
+	}()
+
+	io.Copy(client, upstream)
+	client.Close()
+}
+
+func (cp *CacheProxy) get(key string) *cachedResponse {
+	cp.m.Lock()
+	defer cp.m.Unlock()
+
+	cr, ok := cp.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(cr.expires) {
+		cp.remove(key)
+		return nil
+	}
+
+	return cr
+}
+
+func (cp *CacheProxy) put(key string, cr *cachedResponse) {
+	cp.m.Lock()
+	defer cp.m.Unlock()
+
+	n := int64(len(cr.body))
+	if n > cp.maxBytes {
+		return
+	}
+
+	if _, ok := cp.entries[key]; ok {
+		cp.remove(key)
+	}
+
+	// expired assets are evicted before the ones still fresh
+	now := time.Now()
+	for k, e := range cp.entries {
+		if cp.size+n <= cp.maxBytes {
+			break
+		}
+
+		if now.After(e.expires) {
+			cp.remove(k)
+		}
+	}
+
+	for k := range cp.entries {
+		if cp.size+n <= cp.maxBytes {
+			break
+		}
+		cp.remove(k)
+	}
+
+	cp.entries[key] = cr
+	cp.size += n
+}
+
+func (cp *CacheProxy) remove(key string) {
+	cp.size -= int64(len(cp.entries[key].body))
+	delete(cp.entries, key)
+}
+
+// freshness is the time the response may be cached for, zero if it should
+// not be cached at all
+func (cp *CacheProxy) freshness(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusOK {
+		return 0
+	}
+
+	// responses of a client, or varying by more than their encoding
+	if len(resp.Header["Set-Cookie"]) > 0 {
+		return 0
+	}
+
+	for _, v := range resp.Header["Vary"] {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" && !strings.EqualFold(h, "Accept-Encoding") {
+				return 0
+			}
+		}
+	}
+
+	for _, d := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		switch {
+		case d == "no-store", d == "no-cache", d == "private":
+			return 0
+		case strings.HasPrefix(d, "max-age="):
+			secs, err := strconv.Atoi(strings.TrimPrefix(d, "max-age="))
+			if err != nil || secs <= 0 {
+				return 0
+			}
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	return cp.ttl
+}
+
+// cacheKey is the key of the cached response of r, empty if r cannot be
+// answered from the cache
+func cacheKey(r *http.Request) string {
+	if r.Method != http.MethodGet || r.URL.Scheme != "http" {
+		return ""
+	}
+
+	for _, h := range []string{"Authorization", "Cookie", "Range"} {
+		if r.Header.Get(h) != "" {
+			return ""
+		}
+	}
+
+	return r.Header.Get("Accept-Encoding") + " " + r.URL.String()
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, vs := range src {
+		for _, v := range vs {
+			dst.Add(k, v)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package kraaler_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+func TestCacheProxy(t *testing.T) {
+	var m sync.Mutex
+	fetched := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		fetched[r.URL.Path]++
+		n := fetched[r.URL.Path]
+		m.Unlock()
+
+		switch r.URL.Path {
+		case "/app.js":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/session":
+			w.Header().Set("Set-Cookie", "id=1")
+		case "/page":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		fmt.Fprintf(w, "%s %d", r.URL.Path, n)
+	}))
+	defer ts.Close()
+
+	cp, err := kraaler.NewCacheProxy("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to create cache proxy: %s", err)
+	}
+	defer cp.Close()
+
+	proxy, _ := url.Parse("http://" + cp.Addr())
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxy)}}
+
+	tt := []struct {
+		name     string
+		path     string
+		statuses []string
+		fetched  int
+	}{
+		{name: "repeated asset", path: "/app.js", statuses: []string{kraaler.CacheMiss, kraaler.CacheHit, kraaler.CacheHit}, fetched: 1},
+		{name: "no store", path: "/page", statuses: []string{kraaler.CacheMiss, kraaler.CacheMiss}, fetched: 2},
+		{name: "set cookie", path: "/session", statuses: []string{kraaler.CacheMiss, kraaler.CacheMiss}, fetched: 2},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var first string
+			for i, expected := range tc.statuses {
+				resp, err := client.Get(ts.URL + tc.path)
+				if err != nil {
+					t.Fatalf("unable to fetch through proxy: %s", err)
+				}
+
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					t.Fatalf("unable to read body: %s", err)
+				}
+
+				if status := resp.Header.Get(kraaler.CacheProxyHeader); status != expected {
+					t.Fatalf("expected fetch %d to be a cache %s, but was: %q", i+1, expected, status)
+				}
+
+				if i == 0 {
+					first = string(body)
+				}
+
+				if expected == kraaler.CacheHit && string(body) != first {
+					t.Fatalf("expected cached body (%s), but received: %s", first, body)
+				}
+			}
+
+			m.Lock()
+			defer m.Unlock()
+			if n := fetched[tc.path]; n != tc.fetched {
+				t.Fatalf("expected %s to be fetched upstream %d time(s), but was: %d", tc.path, tc.fetched, n)
+			}
+		})
+	}
+}
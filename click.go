@@ -0,0 +1,91 @@
+package kraaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/input"
+	"github.com/mafredri/cdp/protocol/runtime"
+)
+
+// DefaultClickWait is the time waited after a click before the page is
+// captured, when not given by the click
+const DefaultClickWait = time.Second
+
+var ErrNoClickTarget = errors.New("no element matches the selector of the click")
+
+// Click is a simulated click of the user after the page has loaded, either
+// on the center of the element matched by Selector or, without a selector,
+// at the coordinates X and Y of the viewport
+type Click struct {
+	Selector string
+	X        float64
+	Y        float64
+
+	// Wait is the time waited after clicking before the page is captured,
+	// defaults to DefaultClickWait
+	Wait time.Duration
+}
+
+// Interaction is a click performed on a page, at the coordinates of the
+// viewport it was dispatched at
+type Interaction struct {
+	Click
+	Time time.Time
+}
+
+const clickTarget = `(() => {
+	const el = document.querySelector(%s);
+	if (!el) return null;
+	el.scrollIntoView({block: "center", inline: "center"});
+	const r = el.getBoundingClientRect();
+	return {x: r.left + r.width / 2, y: r.top + r.height / 2};
+})()`
+
+// click dispatches the mouse events of a left click, on the element matched
+// by the selector of c if given
+func click(ctx context.Context, runt cdp.Runtime, in cdp.Input, c Click) (*Interaction, error) {
+	if c.Selector != "" {
+		sel, err := json.Marshal(c.Selector)
+		if err != nil {
+			return nil, err
+		}
+
+		args := runtime.NewEvaluateArgs(fmt.Sprintf(clickTarget, sel)).SetReturnByValue(true)
+		reply, err := runt.Evaluate(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+
+		if exc := reply.ExceptionDetails; exc != nil {
+			return nil, fmt.Errorf("unable to locate element of click: %s", exc.Text)
+		}
+
+		var pos *struct{ X, Y float64 }
+		if err := json.Unmarshal(reply.Result.Value, &pos); err != nil {
+			return nil, err
+		}
+
+		if pos == nil {
+			return nil, ErrNoClickTarget
+		}
+		c.X, c.Y = pos.X, pos.Y
+	}
+
+	for _, typ := range []string{"mouseMoved", "mousePressed", "mouseReleased"} {
+		args := input.NewDispatchMouseEventArgs(typ, c.X, c.Y)
+		if typ != "mouseMoved" {
+			args.SetButton("left").SetClickCount(1)
+		}
+
+		if err := in.DispatchMouseEvent(ctx, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Interaction{Click: c, Time: time.Now()}, nil
+}
@@ -0,0 +1,319 @@
+package kraaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Container is a started browser, reachable through its debugging endpoint
+type Container struct {
+	ID       string
+	Endpoint string
+}
+
+// ContainerRuntime starts and removes the browser containers used by workers
+type ContainerRuntime interface {
+	Start() (*Container, error)
+	Remove(*Container) error
+}
+
+// EgressRuntime is a ContainerRuntime able to start containers of which the
+// traffic leaves the host from a given source address
+type EgressRuntime interface {
+	StartFrom(egressIP string) (*Container, error)
+}
+
+var ErrNoEgressSupport = errors.New("container runtime cannot bind an egress ip")
+
+// DefaultDockerEndpoint is the socket of the local docker daemon
+const DefaultDockerEndpoint = "unix:///var/run/docker.sock"
+
+// NewDockerClient connects to the docker daemon at endpoint, keeping up to
+// conns connections open such that containers of several workers can be
+// created and removed concurrently
+func NewDockerClient(endpoint string, conns int) (*docker.Client, error) {
+	if conns <= 0 {
+		conns = 1
+	}
+
+	c, err := docker.NewClient(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	c.WithTransport(func() *http.Transport {
+		return &http.Transport{
+			MaxIdleConns:        conns,
+			MaxIdleConnsPerHost: conns,
+			MaxConnsPerHost:     conns,
+			IdleConnTimeout:     90 * time.Second,
+		}
+	})
+
+	return c, nil
+}
+
+type dockerRuntime struct {
+	client     *docker.Client
+	resolution *Resolution
+	proxyPort  int
+
+	// networks are the bridge networks created per egress ip
+	networksM sync.Mutex
+	networks  map[string]string
+}
+
+type DockerRuntimeOpt func(*dockerRuntime)
+
+// WithProxyPort makes the browsers use the proxy listening on port of the
+// host, such as a CacheProxy
+func WithProxyPort(port int) DockerRuntimeOpt {
+	return func(dr *dockerRuntime) {
+		dr.proxyPort = port
+	}
+}
+
+func NewDockerRuntime(client *docker.Client, res *Resolution, opts ...DockerRuntimeOpt) ContainerRuntime {
+	if res == nil {
+		res = DefaultResolution
+	}
+
+	dr := &dockerRuntime{client: client, resolution: res, networks: map[string]string{}}
+	for _, opt := range opts {
+		opt(dr)
+	}
+
+	return dr
+}
+
+func (dr *dockerRuntime) Start() (*Container, error) {
+	return dr.StartFrom("")
+}
+
+// egressNetwork creates, unless existing, the bridge network of which the
+// traffic is masqueraded as coming from ip
+func (dr *dockerRuntime) egressNetwork(ip string) (string, error) {
+	dr.networksM.Lock()
+	defer dr.networksM.Unlock()
+
+	if name, ok := dr.networks[ip]; ok {
+		return name, nil
+	}
+
+	name := fmt.Sprintf("kraaler-egress-%s", strings.NewReplacer(".", "-", ":", "-").Replace(ip))
+	if _, err := dr.client.NetworkInfo(name); err != nil {
+		if _, ok := err.(*docker.NoSuchNetwork); !ok {
+			return "", err
+		}
+
+		_, err := dr.client.CreateNetwork(docker.CreateNetworkOptions{
+			Name:   name,
+			Driver: "bridge",
+			Options: map[string]interface{}{
+				"com.docker.network.host_ipv4": ip,
+			},
+		})
+		if err != nil && err != docker.ErrNetworkAlreadyExists {
+			return "", err
+		}
+	}
+	dr.networks[ip] = name
+
+	return name, nil
+}
+
+// StartFrom starts a container which reaches the internet from egressIP, or
+// the default address of the host if empty
+func (dr *dockerRuntime) StartFrom(egressIP string) (*Container, error) {
+	var network string
+	if egressIP != "" {
+		var err error
+		network, err = dr.egressNetwork(egressIP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	port := GetAvailablePort()
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	img := "chromedp/headless-shell"
+	cmd := []string{fmt.Sprintf("--window-size=%s", dr.resolution), "--no-sandbox", "--disable-gpu"}
+	var hosts []string
+	if dr.proxyPort != 0 {
+		cmd = append(cmd, fmt.Sprintf("--proxy-server=http://host.docker.internal:%d", dr.proxyPort))
+		hosts = append(hosts, "host.docker.internal:host-gateway")
+	}
+
+	var swap int64 = 0
+	opts := docker.CreateContainerOptions{
+		Name: fmt.Sprintf("kraaler-worker-%s", uuid.New().String()[0:8]),
+		Config: &docker.Config{
+			Image: img,
+			Cmd:   cmd,
+		},
+		HostConfig: &docker.HostConfig{
+			MemorySwap:       0,
+			MemorySwappiness: swap,
+			Memory:           768 * 1024 * 1024,
+			CPUPeriod:        100000,
+			CPUQuota:         100000, // one core
+			DNS:              []string{"1.1.1.1"},
+			NetworkMode:      network,
+			ExtraHosts:       hosts,
+			PortBindings: map[docker.Port][]docker.PortBinding{
+				docker.Port("9222/tcp"): {{
+					HostIP:   "127.0.0.1",
+					HostPort: fmt.Sprintf("%d", port),
+				}},
+			},
+		},
+	}
+
+	c, err := dr.client.CreateContainer(opts)
+	if err != nil {
+		if err.Error() != "no such image" {
+			return nil, err
+		}
+
+		if err := PullImage(dr.client, img); err != nil {
+			return nil, err
+		}
+
+		c, err = dr.client.CreateContainer(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	container := &Container{ID: c.ID, Endpoint: endpoint}
+	stop := func(err error) (*Container, error) {
+		dr.Remove(container)
+		return nil, err
+	}
+
+	if err := dr.client.StartContainer(c.ID, nil); err != nil {
+		return stop(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := WaitForEndpoint(ctx, endpoint); err != nil {
+		return stop(err)
+	}
+
+	return container, nil
+}
+
+func (dr *dockerRuntime) Remove(c *Container) error {
+	dr.client.StopContainer(c.ID, 1)
+
+	return dr.client.RemoveContainer(
+		docker.RemoveContainerOptions{
+			ID: c.ID,
+		},
+	)
+}
+
+// ContainerPool is a ContainerRuntime keeping a number of started containers
+// warm, such that workers resetting their browser do not wait for one to start
+type ContainerPool struct {
+	runtime ContainerRuntime
+	logger  *zap.Logger
+	warm    chan *Container
+	slots   chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewContainerPool(rt ContainerRuntime, size int, logger *zap.Logger) (*ContainerPool, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("container pool size must be positive")
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	p := &ContainerPool{
+		runtime: rt,
+		logger:  logger,
+		warm:    make(chan *Container, size),
+		slots:   make(chan struct{}, size),
+		stop:    make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.fill()
+
+	return p, nil
+}
+
+// fill starts containers in the background whenever the pool is not full
+func (p *ContainerPool) fill() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case p.slots <- struct{}{}:
+		}
+
+		c, err := p.runtime.Start()
+		if err != nil {
+			p.logger.Info("container_pool_start_error", zap.String("err", err.Error()))
+			<-p.slots
+
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(time.Second):
+			}
+
+			continue
+		}
+
+		p.warm <- c
+	}
+}
+
+// Start returns a warm container, or starts a new one if the pool is empty
+func (p *ContainerPool) Start() (*Container, error) {
+	select {
+	case c := <-p.warm:
+		<-p.slots
+		return c, nil
+	default:
+	}
+
+	return p.runtime.Start()
+}
+
+func (p *ContainerPool) Remove(c *Container) error {
+	return p.runtime.Remove(c)
+}
+
+// Close stops replenishing the pool and removes its warm containers
+func (p *ContainerPool) Close() error {
+	close(p.stop)
+	p.wg.Wait()
+
+	for {
+		select {
+		case c := <-p.warm:
+			p.runtime.Remove(c)
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package kraaler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+// Cookie is a cookie of the browser, either set before navigating to a page
+// or present after it has loaded
+type Cookie struct {
+	Name     string
+	Value    string
+	Domain   string
+	Path     string
+	Expires  time.Time // zero for session cookies
+	Secure   bool
+	HTTPOnly bool
+}
+
+// cookieParams converts cookies to be set in the browser, cookies without
+// a domain are set for u
+func cookieParams(u *url.URL, cookies []Cookie) []network.CookieParam {
+	var params []network.CookieParam
+	for _, c := range cookies {
+		p := network.CookieParam{
+			Name:     c.Name,
+			Value:    c.Value,
+			Secure:   &c.Secure,
+			HTTPOnly: &c.HTTPOnly,
+		}
+
+		if c.Domain != "" {
+			p.Domain = &c.Domain
+		} else {
+			us := u.String()
+			p.URL = &us
+		}
+
+		if c.Path != "" {
+			p.Path = &c.Path
+		}
+
+		if !c.Expires.IsZero() {
+			p.Expires = network.TimeSinceEpoch(c.Expires.Unix())
+		}
+
+		params = append(params, p)
+	}
+
+	return params
+}
+
+func cookiesFromBrowser(cookies []network.Cookie) []*Cookie {
+	var res []*Cookie
+	for _, c := range cookies {
+		ck := &Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+		}
+
+		if !c.Session {
+			ck.Expires = time.Unix(int64(c.Expires), 0)
+		}
+
+		res = append(res, ck)
+	}
+
+	return res
+}
+
+// CookieStats are the cookies set by the Set-Cookie headers of responses
+type CookieStats struct {
+	Count int
+	Bytes int
+}
+
+// SetCookieStats counts the cookies set by the responses of actions per
+// host of the response
+func SetCookieStats(actions []*CrawlAction) map[string]CookieStats {
+	stats := map[string]CookieStats{}
+	for _, a := range actions {
+		u, err := url.Parse(a.Request.URL)
+		if err != nil {
+			continue
+		}
+
+		for _, c := range setCookieHeaders(a.Response) {
+			s := stats[u.Host]
+			s.Count++
+			s.Bytes += len(c)
+			stats[u.Host] = s
+		}
+	}
+
+	if len(stats) == 0 {
+		return nil
+	}
+
+	return stats
+}
+
+// setCookieHeaders are the values of the Set-Cookie headers of resp
+func setCookieHeaders(resp *network.Response) []string {
+	if resp == nil {
+		return nil
+	}
+
+	headers, err := resp.Headers.Map()
+	if err != nil {
+		return nil
+	}
+
+	var values []string
+	for k, v := range headers {
+		if !strings.EqualFold(k, "Set-Cookie") {
+			continue
+		}
+
+		// multiple Set-Cookie headers are joined by newlines
+		for _, c := range strings.Split(v, "\n") {
+			if c = strings.TrimSpace(c); c != "" {
+				values = append(values, c)
+			}
+		}
+	}
+
+	return values
+}
+
+// SetCookie is a cookie as set by the Set-Cookie header of a response
+type SetCookie struct {
+	Name    string
+	Value   string
+	Domain  string
+	Path    string
+	Expires time.Time // zero when not given
+
+	// MaxAge is the lifetime of the cookie in seconds, zero when not given
+	// and negative when the cookie is deleted
+	MaxAge int
+
+	Secure   bool
+	HTTPOnly bool
+	SameSite string // Strict, Lax or None, empty when not given
+}
+
+// ResponseCookies parses the cookies set by the response of the action,
+// invalid cookies are left out
+func (a *CrawlAction) ResponseCookies() []*SetCookie {
+	header := http.Header{}
+	for _, c := range setCookieHeaders(a.Response) {
+		header.Add("Set-Cookie", c)
+	}
+
+	var cookies []*SetCookie
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		sc := &SetCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			MaxAge:   c.MaxAge,
+			Secure:   c.Secure,
+			HTTPOnly: c.HttpOnly,
+		}
+
+		switch c.SameSite {
+		case http.SameSiteStrictMode:
+			sc.SameSite = "Strict"
+		case http.SameSiteLaxMode:
+			sc.SameSite = "Lax"
+		case http.SameSiteNoneMode:
+			sc.SameSite = "None"
+		}
+
+		cookies = append(cookies, sc)
+	}
+
+	return cookies
+}
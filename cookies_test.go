@@ -0,0 +1,77 @@
+package kraaler_test
+
+import (
+	"testing"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+func TestSetCookieStats(t *testing.T) {
+	action := func(u, headers string) *kraaler.CrawlAction {
+		return &kraaler.CrawlAction{
+			Request:  network.Request{URL: u},
+			Response: &network.Response{Headers: network.Headers([]byte(headers))},
+		}
+	}
+
+	actions := []*kraaler.CrawlAction{
+		action("http://site.com/", `{"Set-Cookie": "session=abc"}`),
+		action("http://tracker.com/pixel.gif", `{"set-cookie": "id=1\nuid=22"}`),
+		action("http://tracker.com/t.js", `{"Content-Type": "application/javascript"}`),
+		{Request: network.Request{URL: "http://failed.com/"}},
+	}
+
+	stats := kraaler.SetCookieStats(actions)
+	if len(stats) != 2 {
+		t.Fatalf("expected cookies of two hosts, but received: %v", stats)
+	}
+
+	if s := stats["site.com"]; s.Count != 1 || s.Bytes != len("session=abc") {
+		t.Fatalf("unexpected cookies of site.com: %+v", s)
+	}
+
+	if s := stats["tracker.com"]; s.Count != 2 || s.Bytes != len("id=1")+len("uid=22") {
+		t.Fatalf("unexpected cookies of tracker.com: %+v", s)
+	}
+
+	if stats := kraaler.SetCookieStats(actions[2:]); stats != nil {
+		t.Fatalf("expected no cookie stats, but received: %v", stats)
+	}
+}
+
+func TestResponseCookies(t *testing.T) {
+	a := &kraaler.CrawlAction{
+		Request: network.Request{URL: "http://aau.dk/"},
+		Response: &network.Response{Headers: network.Headers([]byte(
+			`{"Set-Cookie": "sid=42; Domain=aau.dk; Path=/; Max-Age=3600; Secure; HttpOnly; SameSite=Strict\nconsent=yes; Expires=Wed, 21 Oct 2026 07:28:00 GMT\nlogout=; Max-Age=0\ninvalid"}`,
+		))},
+	}
+
+	cookies := a.ResponseCookies()
+	if len(cookies) != 3 {
+		t.Fatalf("expected three cookies, but received: %d", len(cookies))
+	}
+
+	sid := cookies[0]
+	if sid.Name != "sid" || sid.Value != "42" || sid.Domain != "aau.dk" || sid.Path != "/" || sid.MaxAge != 3600 {
+		t.Fatalf("unexpected cookie: %+v", sid)
+	}
+
+	if !sid.Secure || !sid.HTTPOnly || sid.SameSite != "Strict" || !sid.Expires.IsZero() {
+		t.Fatalf("unexpected attributes of cookie: %+v", sid)
+	}
+
+	consent := cookies[1]
+	if consent.Expires.Unix() != 1792567680 || consent.MaxAge != 0 || consent.Secure || consent.SameSite != "" {
+		t.Fatalf("unexpected cookie: %+v", consent)
+	}
+
+	if logout := cookies[2]; logout.MaxAge >= 0 {
+		t.Fatalf("expected cookie to be deleted, but received: %+v", logout)
+	}
+
+	if cookies := (&kraaler.CrawlAction{}).ResponseCookies(); cookies != nil {
+		t.Fatalf("expected no cookies without a response, but received: %v", cookies)
+	}
+}
@@ -0,0 +1,321 @@
+// Package crawl is the stable interface for embedding kraaler. It crawls
+// single pages with a Crawler, and describes them without the browser
+// protocol and container details of the kraaler package, such that these
+// can change without breaking users of this package.
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"go.uber.org/zap"
+)
+
+// ErrClosed is returned when crawling with a closed Crawler
+var ErrClosed = errors.New("crawler is closed")
+
+// Request is a request made by the browser while loading a page
+type Request struct {
+	URL        string
+	Method     string
+	Status     int
+	StatusText string
+	MimeType   string
+	RemoteIP   string
+	FromCache  bool
+	Body       []byte
+
+	// Error is the reason the request failed, empty if it did not
+	Error string
+}
+
+// Screenshot is an image of the page taken after it has loaded
+type Screenshot struct {
+	Image  []byte
+	Format string
+	Width  int
+	Height int
+	Taken  time.Time
+}
+
+// ConsoleMessage is a message logged to the javascript console by the page
+type ConsoleMessage struct {
+	Level string
+	Text  string
+}
+
+// Result describes a crawled page
+type Result struct {
+	URL         *url.URL
+	FinalURL    *url.URL
+	Requests    []Request
+	Links       []*url.URL
+	Console     []ConsoleMessage
+	Screenshots []Screenshot
+	Cookies     []Cookie
+
+	NavigatedTime time.Time
+	LoadedTime    time.Time
+}
+
+// Cookie is a cookie of the browser after the page has loaded
+type Cookie struct {
+	Name    string
+	Value   string
+	Domain  string
+	Path    string
+	Expires time.Time
+}
+
+type config struct {
+	browser     string
+	loadTimeout time.Duration
+	screenshots []time.Duration
+	format      string
+	networkIdle bool
+	logger      *zap.Logger
+	worker      kraaler.Worker
+}
+
+// Option configures a Crawler
+type Option func(*config)
+
+// WithBrowser uses the running browser with its remote debugging endpoint
+// at endpoint (e.g. http://localhost:9222), rather than starting a docker
+// container for the browser
+func WithBrowser(endpoint string) Option {
+	return func(c *config) {
+		c.browser = endpoint
+	}
+}
+
+// WithLoadTimeout is the time given for a page to load
+func WithLoadTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.loadTimeout = d
+	}
+}
+
+// WithScreenshots takes a screenshot after each of the delays, counted
+// from when the page has loaded
+func WithScreenshots(delays ...time.Duration) Option {
+	return func(c *config) {
+		c.screenshots = delays
+	}
+}
+
+// WithScreenshotFormat is the image format of screenshots, one of png,
+// jpeg or webp
+func WithScreenshotFormat(format string) Option {
+	return func(c *config) {
+		c.format = format
+	}
+}
+
+// WithNetworkIdle waits for the network of the page to be idle, rather
+// than for its DOM content to be loaded
+func WithNetworkIdle() Option {
+	return func(c *config) {
+		c.networkIdle = true
+	}
+}
+
+// WithLogger logs the crawls of the browser to logger, nothing is logged
+// by default
+func WithLogger(logger *zap.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// Crawler crawls pages one at a time in a single browser
+type Crawler struct {
+	m       sync.Mutex
+	conf    config
+	worker  kraaler.Worker
+	queue   chan kraaler.CrawlRequest
+	results chan kraaler.Page
+	closed  bool
+
+	// stale is the amount of results of abandoned crawls, which are
+	// discarded before waiting for the result of a crawl
+	stale int
+}
+
+// New starts a Crawler, along with a docker container for its browser
+// unless WithBrowser is given. The Crawler must be closed once done.
+func New(opts ...Option) (*Crawler, error) {
+	conf := config{
+		loadTimeout: 10 * time.Second,
+		format:      kraaler.DefaultScreenshotFormat,
+		logger:      zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
+	w := conf.worker
+	if w == nil {
+		wconf := kraaler.WorkerConfig{
+			UseInstance: conf.browser,
+			LoadTimeout: &conf.loadTimeout,
+			Logger:      conf.logger,
+		}
+
+		if conf.browser == "" {
+			client, err := kraaler.NewDockerClient(kraaler.DefaultDockerEndpoint, 1)
+			if err != nil {
+				return nil, err
+			}
+			wconf.Runtime = kraaler.NewDockerRuntime(client, nil)
+		}
+
+		var err error
+		w, err = kraaler.NewWorker(wconf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Crawler{
+		conf:    conf,
+		worker:  w,
+		queue:   make(chan kraaler.CrawlRequest),
+		results: make(chan kraaler.Page, 1),
+	}
+	go w.Run(c.queue, c.results)
+
+	return c, nil
+}
+
+// Crawl loads the page at rawurl, the result is returned along with the
+// error if the page could only partially be crawled
+func (c *Crawler) Crawl(ctx context.Context, rawurl string) (*Result, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unable to crawl url with scheme: %s", u.Scheme)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return nil, ErrClosed
+	}
+
+	for ; c.stale > 0; c.stale-- {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.results:
+		}
+	}
+
+	req := kraaler.CrawlRequest{
+		Url:              u,
+		Screenshots:      c.conf.screenshots,
+		ScreenshotFormat: c.conf.format,
+		QueuedTime:       time.Now(),
+	}
+	if c.conf.networkIdle {
+		req.WaitUntil = kraaler.WaitNetworkIdle
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case c.queue <- req:
+	}
+
+	select {
+	case <-ctx.Done():
+		c.stale++
+		return nil, ctx.Err()
+	case p := <-c.results:
+		return resultFromPage(p), p.Error
+	}
+}
+
+// Close stops the browser of the Crawler, after which crawling returns
+// ErrClosed. Closing it again does nothing.
+func (c *Crawler) Close() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	return c.worker.Close()
+}
+
+func resultFromPage(p kraaler.Page) *Result {
+	res := &Result{
+		URL:           p.InitialURL,
+		FinalURL:      p.FinalURL,
+		Links:         p.DocumentURLs,
+		NavigatedTime: p.NavigateTime,
+		LoadedTime:    p.LoadedTime,
+	}
+
+	for _, a := range p.Actions {
+		r := Request{
+			URL:       a.Request.URL,
+			Method:    a.Request.Method,
+			RemoteIP:  a.RemoteIP,
+			FromCache: a.FromCache,
+		}
+
+		if resp := a.Response; resp != nil {
+			r.Status = resp.Status
+			r.StatusText = resp.StatusText
+			r.MimeType = resp.MimeType
+		}
+
+		if a.Body != nil {
+			r.Body = a.Body.Body
+		}
+
+		if a.Error != nil {
+			r.Error = *a.Error
+		}
+
+		res.Requests = append(res.Requests, r)
+	}
+
+	for _, msg := range p.Console {
+		res.Console = append(res.Console, ConsoleMessage{Level: msg.Level, Text: msg.Msg})
+	}
+
+	for _, s := range p.Screenshots {
+		res.Screenshots = append(res.Screenshots, Screenshot{
+			Image:  s.Screenshot,
+			Format: s.Kind,
+			Width:  s.Resolution.Width,
+			Height: s.Resolution.Height,
+			Taken:  s.Taken,
+		})
+	}
+
+	for _, ck := range p.Cookies {
+		res.Cookies = append(res.Cookies, Cookie{
+			Name:    ck.Name,
+			Value:   ck.Value,
+			Domain:  ck.Domain,
+			Path:    ck.Path,
+			Expires: ck.Expires,
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,107 @@
+package crawl
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+// fakeWorker answers every request with a page of a single action, after
+// waiting for delay
+type fakeWorker struct {
+	delay time.Duration
+	stop  chan struct{}
+}
+
+func (fw *fakeWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-fw.stop:
+			return nil
+		case req := <-queue:
+			time.Sleep(fw.delay)
+
+			final, _ := url.Parse(req.Url.String() + "landing")
+			results <- kraaler.Page{
+				InitialURL: req.Url,
+				FinalURL:   final,
+				Actions: []*kraaler.CrawlAction{{
+					Request:  network.Request{URL: req.Url.String(), Method: "GET"},
+					Response: &network.Response{Status: 200, StatusText: "OK", MimeType: "text/html"},
+					Body:     &kraaler.ResponseBody{Body: []byte("meow")},
+					RemoteIP: "127.0.0.1",
+				}},
+				Screenshots: []*kraaler.BrowserScreenshot{{
+					Screenshot: []byte("webp"),
+					Kind:       req.ScreenshotFormat,
+					Resolution: kraaler.Resolution{Width: 800, Height: 600},
+				}},
+			}
+		}
+	}
+}
+
+func (fw *fakeWorker) Close() error {
+	close(fw.stop)
+	return nil
+}
+
+func withWorker(w kraaler.Worker) Option {
+	return func(c *config) {
+		c.worker = w
+	}
+}
+
+func TestCrawler(t *testing.T) {
+	fw := &fakeWorker{delay: 50 * time.Millisecond, stop: make(chan struct{})}
+	c, err := New(withWorker(fw), WithScreenshotFormat("webp"))
+	if err != nil {
+		t.Fatalf("unable to create crawler: %s", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Crawl(context.Background(), "ftp://test.com/"); err == nil {
+		t.Fatalf("expected error when crawling non-http url")
+	}
+
+	// the result of an abandoned crawl must not be returned by the next
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Crawl(ctx, "http://abandoned.com/"); err != context.DeadlineExceeded {
+		t.Fatalf("expected crawl to time out, but received: %v", err)
+	}
+
+	res, err := c.Crawl(context.Background(), "http://test.com/")
+	if err != nil {
+		t.Fatalf("unable to crawl: %s", err)
+	}
+
+	if res.URL.String() != "http://test.com/" || res.FinalURL.String() != "http://test.com/landing" {
+		t.Fatalf("unexpected urls of result: %s -> %s", res.URL, res.FinalURL)
+	}
+
+	if len(res.Requests) != 1 {
+		t.Fatalf("expected one request, but received: %d", len(res.Requests))
+	}
+
+	r := res.Requests[0]
+	if r.Status != 200 || r.StatusText != "OK" || r.MimeType != "text/html" || r.RemoteIP != "127.0.0.1" || string(r.Body) != "meow" {
+		t.Fatalf("unexpected request: %+v", r)
+	}
+
+	if len(res.Screenshots) != 1 || res.Screenshots[0].Format != "webp" || res.Screenshots[0].Width != 800 {
+		t.Fatalf("unexpected screenshots: %+v", res.Screenshots)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("unable to close crawler: %s", err)
+	}
+
+	if _, err := c.Crawl(context.Background(), "http://test.com/"); err != ErrClosed {
+		t.Fatalf("expected crawler to be closed, but received: %v", err)
+	}
+}
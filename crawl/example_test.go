@@ -0,0 +1,47 @@
+package crawl_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/aau-network-security/kraaler/crawl"
+)
+
+// Crawling a local server with a browser started with:
+// chromium --headless --remote-debugging-port=9222
+//
+// The example is only compiled, as its output depends on the browser.
+func Example_browser() {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/about">about</a><img src="/logo.png"/></body></html>`)
+	}))
+	defer ts.Close()
+
+	c, err := crawl.New(
+		crawl.WithBrowser("http://localhost:9222"),
+		crawl.WithLoadTimeout(5*time.Second),
+		crawl.WithScreenshots(time.Second),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	res, err := c.Crawl(context.Background(), ts.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, r := range res.Requests {
+		fmt.Println(r.Status, r.URL)
+	}
+
+	for _, l := range res.Links {
+		fmt.Println("link:", l)
+	}
+}
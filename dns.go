@@ -0,0 +1,177 @@
+package kraaler
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var ErrDNSResponse = errors.New("unexpected dns response")
+
+// DNSRecord is a record of the answer to a lookup of the addresses of a
+// host, along with the time to live it was answered with
+type DNSRecord struct {
+	Name  string
+	Type  string
+	Value string
+	TTL   uint32
+}
+
+// SystemNameServer is the first name server of /etc/resolv.conf, with its
+// port, or empty if none is configured
+func SystemNameServer() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53")
+		}
+	}
+
+	return ""
+}
+
+// LookupDNSRecords queries the name server at server (host:port) for the
+// A and AAAA records of domain, including the CNAME records leading to them
+func LookupDNSRecords(ctx context.Context, server, domain string) ([]DNSRecord, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(domain, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DNSRecord
+	seen := map[DNSRecord]bool{}
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := queryDNS(ctx, server, name, typ)
+		if err != nil {
+			return records, err
+		}
+
+		for _, r := range answers {
+			// both queries answer the CNAME records of the domain
+			if !seen[r] {
+				seen[r] = true
+				records = append(records, r)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// queryDNS sends a single question to server over UDP
+func queryDNS(ctx context.Context, server string, name dnsmessage.Name, typ dnsmessage.Type) ([]DNSRecord, error) {
+	id := uint16(rand.Intn(1 << 16))
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+
+	if err := b.Question(dnsmessage.Question{Name: name, Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(DefaultHostLookupTimeout))
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1232)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		var p dnsmessage.Parser
+		hdr, err := p.Start(buf[:n])
+		if err != nil || hdr.ID != id || !hdr.Response {
+			// not the answer to the question
+			continue
+		}
+
+		if hdr.RCode != dnsmessage.RCodeSuccess && hdr.RCode != dnsmessage.RCodeNameError {
+			return nil, ErrDNSResponse
+		}
+
+		if err := p.SkipAllQuestions(); err != nil {
+			return nil, err
+		}
+
+		return parseDNSAnswers(&p)
+	}
+}
+
+func parseDNSAnswers(p *dnsmessage.Parser) ([]DNSRecord, error) {
+	var records []DNSRecord
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return records, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		r := DNSRecord{Name: h.Name.String(), TTL: h.TTL}
+		switch h.Type {
+		case dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return nil, err
+			}
+			r.Type, r.Value = "A", net.IP(a.A[:]).String()
+		case dnsmessage.TypeAAAA:
+			aaaa, err := p.AAAAResource()
+			if err != nil {
+				return nil, err
+			}
+			r.Type, r.Value = "AAAA", net.IP(aaaa.AAAA[:]).String()
+		case dnsmessage.TypeCNAME:
+			cname, err := p.CNAMEResource()
+			if err != nil {
+				return nil, err
+			}
+			r.Type, r.Value = "CNAME", cname.CNAME.String()
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		records = append(records, r)
+	}
+}
@@ -0,0 +1,341 @@
+package har
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+const (
+	Version = "1.2"
+	pageID  = "page_1"
+)
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Pages   []Page  `json:"pages"`
+	Entries []Entry `json:"entries"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Page struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	ID              string      `json:"id"`
+	Title           string      `json:"title"`
+	PageTimings     PageTimings `json:"pageTimings"`
+}
+
+type PageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type Entry struct {
+	Pageref         string   `json:"pageref"`
+	StartedDateTime string   `json:"startedDateTime"`
+	Time            float64  `json:"time"`
+	Request         Request  `json:"request"`
+	Response        Response `json:"response"`
+	Cache           struct{} `json:"cache"`
+	Timings         Timings  `json:"timings"`
+	ServerIPAddress string   `json:"serverIPAddress,omitempty"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []NameValue `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+	Error       string      `json:"_error,omitempty"`
+
+	TransferSize int64 `json:"_transferSize,omitempty"`
+}
+
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+func PageToHAR(p kraaler.Page) ([]byte, error) {
+	var title string
+	if p.InitialURL != nil {
+		title = p.InitialURL.String()
+	}
+
+	onContentLoad := -1.0
+	if !p.LoadedTime.IsZero() && !p.NavigateTime.IsZero() {
+		onContentLoad = millis(p.LoadedTime.Sub(p.NavigateTime).Seconds())
+	}
+
+	h := HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: "kraaler"},
+			Pages: []Page{{
+				StartedDateTime: p.InitiatedTime.Format(time.RFC3339Nano),
+				ID:              pageID,
+				Title:           title,
+				PageTimings: PageTimings{
+					OnContentLoad: onContentLoad,
+					OnLoad:        -1,
+				},
+			}},
+			Entries: []Entry{},
+		},
+	}
+
+	var base float64
+	if len(p.Actions) > 0 {
+		base = p.Actions[0].Timings.StartTime
+	}
+
+	for _, a := range p.Actions {
+		e, err := entryFromAction(a)
+		if err != nil {
+			return nil, err
+		}
+
+		offset := time.Duration((a.Timings.StartTime - base) * float64(time.Second))
+		e.StartedDateTime = p.InitiatedTime.Add(offset).Format(time.RFC3339Nano)
+
+		h.Log.Entries = append(h.Log.Entries, e)
+	}
+
+	return json.Marshal(h)
+}
+
+func entryFromAction(a *kraaler.CrawlAction) (Entry, error) {
+	reqHeaders, err := headersToNameValues(a.Request.Headers)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	e := Entry{
+		Pageref: pageID,
+		Request: Request{
+			Method:      a.Request.Method,
+			URL:         a.Request.URL,
+			Cookies:     []NameValue{},
+			Headers:     reqHeaders,
+			QueryString: []NameValue{},
+			HeadersSize: -1,
+		},
+		Response: Response{
+			Cookies:     []NameValue{},
+			Headers:     []NameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		ServerIPAddress: a.Host.IPAddr(),
+		Timings:         timingsFromBrowserTimes(a.Timings),
+	}
+
+	if u, err := url.Parse(a.Request.URL); err == nil {
+		for k, vs := range u.Query() {
+			for _, v := range vs {
+				e.Request.QueryString = append(e.Request.QueryString, NameValue{k, v})
+			}
+		}
+	}
+
+	if pd := a.RequestBody(); pd != nil {
+		e.Request.BodySize = len(pd)
+		e.Request.PostData = &PostData{
+			MimeType: headerValue(reqHeaders, "Content-Type"),
+			Text:     string(pd),
+		}
+	}
+
+	if a.Timings.EndTime > a.Timings.StartTime {
+		e.Time = millis(a.Timings.EndTime - a.Timings.StartTime)
+	}
+
+	if a.Error != nil {
+		e.Response.Error = *a.Error
+	}
+
+	if resp := a.Response; resp != nil {
+		respHeaders, err := headersToNameValues(resp.Headers)
+		if err != nil {
+			return Entry{}, err
+		}
+
+		e.Response.Status = resp.Status
+		e.Response.StatusText = resp.StatusText
+		e.Response.Headers = respHeaders
+		e.Response.RedirectURL = headerValue(respHeaders, "Location")
+		e.Response.Content.MimeType = resp.MimeType
+
+		if resp.Protocol != nil {
+			e.Request.HTTPVersion = *resp.Protocol
+			e.Response.HTTPVersion = *resp.Protocol
+		}
+
+		if resp.RemoteIPAddress != nil {
+			e.ServerIPAddress = *resp.RemoteIPAddress
+		}
+	}
+
+	if b := a.Body; b != nil {
+		e.Response.BodySize = len(b.Body)
+		e.Response.Content.Size = len(b.Body)
+		e.Response.Content.Text = base64.StdEncoding.EncodeToString(b.Body)
+		e.Response.Content.Encoding = "base64"
+		e.Response.TransferSize = b.EncodedSize
+	}
+
+	return e, nil
+}
+
+func timingsFromBrowserTimes(bt kraaler.BrowserTimes) Timings {
+	span := func(start, end *float64) float64 {
+		if start == nil || end == nil || *end < *start {
+			return -1
+		}
+
+		return millis(*end - *start)
+	}
+
+	t := Timings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: span(bt.ConnectStartTime, bt.ConnectEndTime),
+		Send:    span(bt.SendStartTime, bt.SendEndTime),
+		SSL:     -1,
+	}
+
+	if t.Send < 0 {
+		t.Send = 0
+	}
+
+	if bt.EndTime > bt.StartTime {
+		t.Wait = millis(bt.EndTime-bt.StartTime) - t.Send
+		if t.Connect > 0 {
+			t.Wait -= t.Connect
+		}
+
+		if t.Wait < 0 {
+			t.Wait = 0
+		}
+	}
+
+	return t
+}
+
+func headersToNameValues(h network.Headers) ([]NameValue, error) {
+	nvs := []NameValue{}
+	if len(h) == 0 {
+		return nvs, nil
+	}
+
+	m, err := h.Map()
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range m {
+		nvs = append(nvs, NameValue{k, v})
+	}
+	sort.Slice(nvs, func(i, j int) bool { return nvs[i].Name < nvs[j].Name })
+
+	return nvs, nil
+}
+
+func headerValue(nvs []NameValue, name string) string {
+	for _, nv := range nvs {
+		if http.CanonicalHeaderKey(nv.Name) == name {
+			return nv.Value
+		}
+	}
+
+	return ""
+}
+
+func millis(secs float64) float64 {
+	return secs * 1000
+}
+
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir}
+}
+
+func (s *Store) SaveSession(p kraaler.Page) error {
+	raw, err := PageToHAR(p)
+	if err != nil {
+		return err
+	}
+
+	var host string
+	if p.InitialURL != nil {
+		host = p.InitialURL.Hostname()
+	}
+
+	filename := fmt.Sprintf("%s-%d.har", host, p.InitiatedTime.UnixNano())
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(s.dir, filename), raw, 0644)
+}
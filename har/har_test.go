@@ -0,0 +1,123 @@
+package har_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/aau-network-security/kraaler/har"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+func TestPageToHAR(t *testing.T) {
+	u, _ := url.Parse("http://aau.dk/?q=test")
+	errText := "net::ERR_CONNECTION_REFUSED"
+	page := kraaler.Page{
+		InitialURL:    u,
+		InitiatedTime: time.Now(),
+		Actions: []*kraaler.CrawlAction{
+			{
+				Request: network.Request{
+					URL:     u.String(),
+					Method:  "GET",
+					Headers: network.Headers([]byte(`{ "User-Agent": "Chrome" }`)),
+				},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					MimeType: "text/plain",
+					Headers:  network.Headers([]byte(`{ "Server": "nginx" }`)),
+				},
+				Body: &kraaler.ResponseBody{
+					Body: []byte("hello world"),
+				},
+				Timings: kraaler.BrowserTimes{
+					StartTime: 10,
+					EndTime:   10.5,
+				},
+			},
+			{
+				Request: network.Request{
+					URL:    "http://aau.dk/img",
+					Method: "GET",
+				},
+				Error: &errText,
+				Timings: kraaler.BrowserTimes{
+					StartTime: 10.6,
+					EndTime:   10.7,
+				},
+			},
+		},
+	}
+
+	raw, err := har.PageToHAR(page)
+	if err != nil {
+		t.Fatalf("unable to convert page to har: %s", err)
+	}
+
+	var h har.HAR
+	if err := json.Unmarshal(raw, &h); err != nil {
+		t.Fatalf("unable to parse har: %s", err)
+	}
+
+	if n := len(h.Log.Entries); n != len(page.Actions) {
+		t.Fatalf("expected %d entries, but received: %d", len(page.Actions), n)
+	}
+
+	first := h.Log.Entries[0]
+	if first.Response.Status != http.StatusOK {
+		t.Fatalf("unexpected status code (%d), expected: %d", first.Response.Status, http.StatusOK)
+	}
+
+	if first.Time != 500 {
+		t.Fatalf("unexpected time (%f), expected: %d", first.Time, 500)
+	}
+
+	body, err := base64.StdEncoding.DecodeString(first.Response.Content.Text)
+	if err != nil {
+		t.Fatalf("unable to decode body: %s", err)
+	}
+
+	if string(body) != "hello world" {
+		t.Fatalf("unexpected body (%s), expected: %s", body, "hello world")
+	}
+
+	if n := len(first.Request.Headers); n != 1 {
+		t.Fatalf("expected one request header, but received: %d", n)
+	}
+
+	if n := len(first.Request.QueryString); n != 1 {
+		t.Fatalf("expected one query string parameter, but received: %d", n)
+	}
+
+	if e := h.Log.Entries[1].Response.Error; e != errText {
+		t.Fatalf("unexpected error (%s), expected: %s", e, errText)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraaler-har-store-test")
+	if err != nil {
+		t.Fatalf("error when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, _ := url.Parse("http://aau.dk")
+	if err := har.NewStore(dir).SaveSession(kraaler.Page{InitialURL: u}); err != nil {
+		t.Fatalf("unable to save session: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read temp dir: %s", err)
+	}
+
+	if len(files) != 1 {
+		t.Fatalf("expected one har file to be created, but found: %d", len(files))
+	}
+}
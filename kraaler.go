@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -124,9 +125,139 @@ func ScanForServers(ctx context.Context, domains <-chan Domain) <-chan *url.URL
 	return out
 }
 
+type LinkPolicyKind int
+
+const (
+	FollowAll LinkPolicyKind = iota
+	FollowSameSite
+	FollowNone
+	FollowMatching
+)
+
+// LinkPolicy decides which of the links discovered on a page are followed
+type LinkPolicy struct {
+	Kind   LinkPolicyKind
+	Regexp *regexp.Regexp
+}
+
+func (lp LinkPolicy) Filter(origin *url.URL, links []*url.URL) []*url.URL {
+	keep := func(*url.URL) bool { return true }
+	switch lp.Kind {
+	case FollowNone:
+		return nil
+	case FollowSameSite:
+		if origin == nil {
+			return nil
+		}
+		site := siteOf(origin)
+		keep = func(u *url.URL) bool { return siteOf(u) == site }
+	case FollowMatching:
+		if lp.Regexp == nil {
+			return nil
+		}
+		keep = func(u *url.URL) bool { return lp.Regexp.MatchString(u.String()) }
+	}
+
+	var res []*url.URL
+	for _, l := range links {
+		if keep(l) {
+			res = append(res, l)
+		}
+	}
+
+	return res
+}
+
+// WaitUntil is the condition after which a page is considered loaded
+type WaitUntil int
+
+const (
+	WaitDOMContentLoaded WaitUntil = iota
+	WaitLoad
+	WaitNetworkIdle
+)
+
+// DefaultNetworkQuiet is the time without requests in flight after which
+// the network of a page is considered idle
+const DefaultNetworkQuiet = 500 * time.Millisecond
+
+// Viewport is the device metrics emulated when capturing a screenshot
+type Viewport struct {
+	Resolution  Resolution
+	ScaleFactor float64
+	Mobile      bool
+}
+
+// ScreenshotFormats are the image formats screenshots can be taken in
+var ScreenshotFormats = []string{"png", "jpeg", "webp"}
+
+// DefaultScreenshotFormat is the format of screenshots when none is given
+const DefaultScreenshotFormat = "png"
+
 type CrawlRequest struct {
 	Url         *url.URL
 	Screenshots []time.Duration
+	Viewports   []Viewport
+	QueuedTime  time.Time
+	Depth       int
+	LinkPolicy  LinkPolicy
+	Source      string
+
+	// ScreenshotFormat is the image format of the screenshots (one of
+	// ScreenshotFormats), defaults to DefaultScreenshotFormat
+	ScreenshotFormat string
+
+	// WaitForStatus follows the navigations of the document until it is
+	// served with this status, or its redirects settle (0 disables it)
+	WaitForStatus int
+
+	// PerformanceMetrics retrieves the metrics of Performance.getMetrics
+	// after loading the page
+	PerformanceMetrics bool
+
+	// WarmVisit loads the page a second time after crawling it, such that
+	// resources can be served from the cache of the first visit
+	WarmVisit bool
+
+	// WaitUntil is the condition ending the wait for the page to load,
+	// unless WaitEvent is given
+	WaitUntil WaitUntil
+
+	// NetworkQuiet is the time without requests in flight for the network
+	// to be idle when waiting for WaitNetworkIdle, defaults to
+	// DefaultNetworkQuiet
+	NetworkQuiet time.Duration
+
+	// CaptureDOM serializes the DOM of the page after it has loaded
+	CaptureDOM bool
+
+	// Cookies are set in the browser before navigating to the page
+	Cookies []Cookie
+
+	// AutoScroll scrolls through the page after it has loaded, such that
+	// lazily loaded content is fetched before screenshots are taken
+	AutoScroll bool
+
+	// WaitEvent is the lifecycle event of the document (e.g. load or
+	// networkIdle) after which the page is considered loaded, defaults
+	// to DOMContentLoaded
+	WaitEvent string
+
+	// PreCaptureScript is evaluated in the page after it has loaded and
+	// before screenshots are taken, promises returned by it are awaited
+	PreCaptureScript string
+
+	// Trace records a trace of the browser from navigating to the page
+	// until it has loaded, which is heavy and meant for few pages
+	Trace bool
+
+	// MaxRedirects is the amount of redirects of the document followed
+	// before its navigation is stopped (0 disables it)
+	MaxRedirects int
+
+	// Click is performed after the page has loaded, and after the
+	// PreCaptureScript, such that content revealed by it is captured
+	Click *Click
 }
 
 type CrawlResponse struct {
@@ -136,10 +267,12 @@ type CrawlResponse struct {
 }
 
 type BrowserScreenshot struct {
-	Screenshot []byte
-	Resolution Resolution
-	Kind       string
-	Taken      time.Time
+	Screenshot  []byte
+	Resolution  Resolution
+	ScaleFactor float64
+	Mobile      bool
+	Kind        string
+	Taken       time.Time
 }
 
 type CallFrame struct {
@@ -152,27 +285,166 @@ type CallFrame struct {
 type Initiator struct {
 	Kind  string
 	Stack *CallFrame
+
+	// URL is the document that referenced the resource, only known
+	// for requests initiated by the parser
+	URL string
 }
 
 type Page struct {
-	InitialURL   *url.URL
-	Actions      []*CrawlAction
-	Resolution   string
-	Console      []*JavaScriptConsole
-	Screenshots  []*BrowserScreenshot
-	Error        error
-	DocumentURLs []*url.URL
-
+	InitialURL      *url.URL
+	FinalURL        *url.URL
+	Actions         []*CrawlAction
+	WarmActions     []*CrawlAction
+	Resolution      string
+	Console         []*JavaScriptConsole
+	Dialogs         []*JavaScriptDialog
+	ServiceWorkers  []*ServiceWorker
+	WebSockets      []*WebSocket
+	WebSocketFrames []*WebSocketFrame
+	Screenshots     []*BrowserScreenshot
+	Error           error
+	DocumentURLs    []*url.URL
+	Depth           int
+	LinkPolicy      LinkPolicy
+	Source          string
+
+	Forms                []*Form
+	LikelyCredentialForm bool
+
+	Trackers map[string]int
+
+	// SetCookies are the cookies set by responses, per host
+	SetCookies map[string]CookieStats
+
+	// Cookies are the cookies of the browser after the page has loaded
+	Cookies []*Cookie
+
+	// RenderedHTML is the DOM of the page serialized after it has loaded
+	// and its scripts have run, when requested
+	RenderedHTML []byte
+
+	// PerformanceMetrics are the metrics reported by the browser after
+	// loading the page, when requested
+	PerformanceMetrics map[string]float64
+
+	// Trace is the trace of loading the page in the JSON format of
+	// chrome://tracing, when requested
+	Trace []byte
+
+	// WarmError is the reason the warm visit failed, the page of the first
+	// visit is kept regardless
+	WarmError error
+
+	// Interaction is the click performed on the page, when requested
+	Interaction *Interaction
+
+	// Permissions are the permissions the page requested, all of which
+	// were denied
+	Permissions []*PermissionRequest
+
+	// BeforeUnloadHandler and UnloadHandler are whether the page registered
+	// handlers for leaving it, as pages trapping their visitors do
+	BeforeUnloadHandler bool
+	UnloadHandler       bool
+
+	// Manifest is the web app manifest linked by the page, if any
+	Manifest *WebManifest
+
+	// ScriptResult is the JSON encoded result of the PreCaptureScript, or
+	// ScriptException the exception thrown by it
+	ScriptResult    string
+	ScriptException string
+
+	FinalStatus  int
+	RedirectHops int
+
+	// Redirects is the amount of redirects of the document seen when
+	// limited by MaxRedirects, and RedirectLimitExceeded whether its
+	// navigation was stopped for exceeding the limit
+	Redirects             int
+	RedirectLimitExceeded bool
+
+	// EgressIP is the source address the page was fetched from, when the
+	// worker was bound to one
+	EgressIP string
+
+	// RequestedScheme is the scheme the page was requested with, and
+	// UpgradedScheme the scheme its document was upgraded to by either
+	// HSTS or a redirect, as given by SchemeUpgrade
+	RequestedScheme string
+	UpgradedScheme  string
+	SchemeUpgrade   string
+
+	// LifecycleEvent is the lifecycle event ending the wait for the page
+	// to load, fired at the monotonic LifecycleTimestamp
+	LifecycleEvent     string
+	LifecycleTimestamp float64
+
+	// FailedRequestBytes is the intended size of the failed and blocked
+	// requests, as announced by their responses or received before failing
+	FailedRequests     int
+	BlockedRequests    int
+	FailedRequestBytes int64
+
+	Attempts int
+
+	QueuedTime     time.Time
 	InitiatedTime  time.Time
 	NavigateTime   time.Time
 	LoadedTime     time.Time
 	TerminatedTime time.Time
 }
 
+type PagePhases struct {
+	QueueWait time.Duration
+	Setup     time.Duration
+	Navigate  time.Duration
+	Terminate time.Duration
+}
+
+// Phases derives the duration of each crawl phase from the page timestamps,
+// a phase is zero if either of its timestamps are missing
+func (p *Page) Phases() PagePhases {
+	between := func(from, to time.Time) time.Duration {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+
+		return to.Sub(from)
+	}
+
+	return PagePhases{
+		QueueWait: between(p.QueuedTime, p.InitiatedTime),
+		Setup:     between(p.InitiatedTime, p.NavigateTime),
+		Navigate:  between(p.NavigateTime, p.LoadedTime),
+		Terminate: between(p.LoadedTime, p.TerminatedTime),
+	}
+}
+
 type Host struct {
 	Domain      Domain
-	IPAddr      string
+	IPAddrs     []string
 	NameServers []string
+
+	// PTR is the name of the address of the host and ASN the autonomous
+	// system announcing it, only looked up when enabled
+	PTR string
+	ASN ASN
+
+	// DNSRecords are the records answering the lookup of the addresses of
+	// the host by the name server NameServer, only looked up when enabled
+	DNSRecords []DNSRecord
+	NameServer string
+}
+
+// IPAddr is the first address of the host, empty if it has none
+func (h Host) IPAddr() string {
+	if len(h.IPAddrs) == 0 {
+		return ""
+	}
+
+	return h.IPAddrs[0]
 }
 
 type CrawlAction struct {
@@ -185,13 +457,67 @@ type CrawlAction struct {
 	Error    *string
 	Body     *ResponseBody
 
+	// PostData is the complete post data of the request, which
+	// Request.PostData may be truncated or missing, except for the file
+	// parts of multipart/form-data bodies which Chrome omits
+	PostData []byte
+
+	// FromCache is set when the response is served from a browser cache
+	FromCache bool
+
+	// ProxyCache is whether the response passed a CacheProxy, and was
+	// served from its cache (CacheHit) or fetched upstream (CacheMiss)
+	ProxyCache string
+
+	// RenderBlocking is set for requests delaying the first render of the
+	// page, see renderBlocking
+	RenderBlocking bool
+
+	// RemoteIP and RemotePort are the address the browser received the
+	// response from, unknown for cached responses
+	RemoteIP   string
+	RemotePort int
+
 	Timings BrowserTimes
 }
 
+// WebSocket is a websocket opened by the page, its upgrade handshake is
+// included in the actions of the page
+type WebSocket struct {
+	URL       string
+	Handshake *CrawlAction
+
+	requestID network.RequestID
+}
+
+// WebSocketFrame is a message sent or received on a websocket of the page
+type WebSocketFrame struct {
+	Socket        *WebSocket
+	Direction     string
+	Opcode        int
+	PayloadLength int
+	Timestamp     float64
+
+	requestID network.RequestID
+}
+
 func (ca *CrawlAction) Finished() bool {
 	return ca.Response != nil
 }
 
+// RequestBody returns the post data sent by the request, if any
+func (ca *CrawlAction) RequestBody() []byte {
+	if ca.PostData != nil {
+		return ca.PostData
+	}
+
+	if ca.Request.PostData != nil {
+		return []byte(*ca.Request.PostData)
+	}
+
+	return nil
+}
+
 // func NewCrawlActionFromParams(params map[string]interface{}) (*CrawlAction, error) {
 // 	var err error
 // 	var ca CrawlAction
@@ -373,6 +699,27 @@ type BrowserTimes struct {
 	SendEndTime      *float64
 }
 
+func (bt *BrowserTimes) read(resp *network.Response, timestamp float64) {
+	bt.EndTime = timestamp
+	if resp == nil || resp.Timing == nil {
+		return
+	}
+
+	offset := func(ms float64) *float64 {
+		if ms < 0 {
+			return nil
+		}
+
+		t := resp.Timing.RequestTime + ms/1000
+		return &t
+	}
+
+	bt.ConnectStartTime = offset(resp.Timing.ConnectStart)
+	bt.ConnectEndTime = offset(resp.Timing.ConnectEnd)
+	bt.SendStartTime = offset(resp.Timing.SendStart)
+	bt.SendEndTime = offset(resp.Timing.SendEnd)
+}
+
 func (bt *BrowserTimes) Align() {
 	bt.StartTime -= bt.StartTime
 	bt.EndTime -= bt.StartTime
@@ -0,0 +1,65 @@
+package kraaler
+
+import (
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type HostRateLimiter struct {
+	m      sync.Mutex
+	delay  time.Duration
+	jitter time.Duration
+	rand   *rand.Rand
+	next   map[string]time.Time
+	now    func() time.Time
+}
+
+type HostRateLimiterOpt func(*HostRateLimiter)
+
+// WithJitter adds a random delay of up to max to the delay between crawls
+// of a host, such that urls of a host becoming eligible at the same time
+// are spread out
+func WithJitter(max time.Duration) HostRateLimiterOpt {
+	return func(hrl *HostRateLimiter) {
+		hrl.jitter = max
+	}
+}
+
+func NewHostRateLimiter(delay time.Duration, opts ...HostRateLimiterOpt) *HostRateLimiter {
+	hrl := &HostRateLimiter{
+		delay: delay,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		next:  map[string]time.Time{},
+		now:   time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(hrl)
+	}
+
+	return hrl
+}
+
+// Allow reports whether the host of u may be crawled now, and if so marks
+// the host as visited
+func (hrl *HostRateLimiter) Allow(u *url.URL) bool {
+	key := siteOf(u)
+	now := hrl.now()
+
+	hrl.m.Lock()
+	defer hrl.m.Unlock()
+
+	if next, ok := hrl.next[key]; ok && now.Before(next) {
+		return false
+	}
+
+	wait := hrl.delay
+	if hrl.jitter > 0 {
+		wait += time.Duration(hrl.rand.Int63n(int64(hrl.jitter)))
+	}
+	hrl.next[key] = now.Add(wait)
+
+	return true
+}
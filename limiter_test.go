@@ -0,0 +1,75 @@
+package kraaler_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+func TestHostRateLimiter(t *testing.T) {
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+
+	hrl := kraaler.NewHostRateLimiter(100 * time.Millisecond)
+
+	if !hrl.Allow(parse("http://www.aau.dk/")) {
+		t.Fatalf("expected first visit to be allowed")
+	}
+
+	if hrl.Allow(parse("https://es.aau.dk/research")) {
+		t.Fatalf("expected visit to same registered domain to be limited")
+	}
+
+	if !hrl.Allow(parse("http://google.com/")) {
+		t.Fatalf("expected visit to other domain to be allowed")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if !hrl.Allow(parse("http://aau.dk/")) {
+		t.Fatalf("expected visit to be allowed after delay")
+	}
+}
+
+func TestHostRateLimiterJitter(t *testing.T) {
+	u, _ := url.Parse("http://aau.dk/")
+	delay, jitter := 20*time.Millisecond, 40*time.Millisecond
+	hrl := kraaler.NewHostRateLimiter(delay, kraaler.WithJitter(jitter))
+
+	var dispatches []time.Time
+	deadline := time.Now().Add(2 * time.Second)
+	for len(dispatches) < 6 && time.Now().Before(deadline) {
+		if hrl.Allow(u) {
+			dispatches = append(dispatches, time.Now())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(dispatches) < 6 {
+		t.Fatalf("expected six dispatches, but received: %d", len(dispatches))
+	}
+
+	min, max := time.Hour, time.Duration(0)
+	for i := 1; i < len(dispatches); i++ {
+		gap := dispatches[i].Sub(dispatches[i-1])
+		if gap < delay {
+			t.Fatalf("expected dispatches to be spaced by at least %s, but were spaced by: %s", delay, gap)
+		}
+
+		if gap < min {
+			min = gap
+		}
+
+		if gap > max {
+			max = gap
+		}
+	}
+
+	if max-min < 2*time.Millisecond {
+		t.Fatalf("expected jittered spacing of dispatches, but spacing was between %s and %s", min, max)
+	}
+}
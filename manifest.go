@@ -0,0 +1,110 @@
+package kraaler
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/mafredri/cdp"
+)
+
+// WebManifest is the web app manifest linked by a page through
+// <link rel="manifest">, with its URLs resolved against the manifest
+type WebManifest struct {
+	URL       string
+	Raw       []byte
+	Name      string
+	ShortName string
+	StartURL  string
+	Icons     []ManifestIcon
+
+	// Errors are the errors of the browser fetching or parsing the manifest
+	Errors []string
+}
+
+type ManifestIcon struct {
+	Src   string
+	Sizes string
+	Type  string
+}
+
+// ParseWebManifest parses the raw manifest found at manifestURL
+func ParseWebManifest(manifestURL string, raw []byte) (*WebManifest, error) {
+	var m struct {
+		Name      string `json:"name"`
+		ShortName string `json:"short_name"`
+		StartURL  string `json:"start_url"`
+		Icons     []struct {
+			Src   string `json:"src"`
+			Sizes string `json:"sizes"`
+			Type  string `json:"type"`
+		} `json:"icons"`
+	}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+
+	base, _ := url.Parse(manifestURL)
+	resolve := func(ref string) string {
+		if ref == "" || base == nil {
+			return ref
+		}
+
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+
+		return u.String()
+	}
+
+	wm := &WebManifest{
+		URL:       manifestURL,
+		Raw:       raw,
+		Name:      m.Name,
+		ShortName: m.ShortName,
+		StartURL:  resolve(m.StartURL),
+	}
+
+	for _, i := range m.Icons {
+		wm.Icons = append(wm.Icons, ManifestIcon{
+			Src:   resolve(i.Src),
+			Sizes: i.Sizes,
+			Type:  i.Type,
+		})
+	}
+
+	return wm, nil
+}
+
+// appManifest fetches the manifest linked by the loaded page through the
+// browser, nil if the page links none
+func appManifest(ctx context.Context, pg cdp.Page) (*WebManifest, error) {
+	reply, err := pg.GetAppManifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.URL == "" {
+		return nil, nil
+	}
+
+	var errs []string
+	for _, e := range reply.Errors {
+		errs = append(errs, e.Message)
+	}
+
+	wm := &WebManifest{URL: reply.URL}
+	if reply.Data != nil {
+		raw := []byte(*reply.Data)
+		if parsed, err := ParseWebManifest(reply.URL, raw); err == nil {
+			wm = parsed
+		} else {
+			wm.Raw = raw
+			errs = append(errs, err.Error())
+		}
+	}
+	wm.Errors = errs
+
+	return wm, nil
+}
@@ -0,0 +1,71 @@
+package kraaler_test
+
+import (
+	"testing"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+func TestParseWebManifest(t *testing.T) {
+	tt := []struct {
+		name     string
+		raw      string
+		start    string
+		icons    []string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "relative urls",
+			raw:      `{"name": "Portal", "start_url": "../start?utm=pwa", "icons": [{"src": "icons/192.png", "sizes": "192x192"}]}`,
+			expected: "Portal",
+			start:    "http://aau.dk/start?utm=pwa",
+			icons:    []string{"http://aau.dk/app/icons/192.png"},
+		},
+		{
+			name:  "absolute urls",
+			raw:   `{"short_name": "P", "start_url": "https://login.example.com/", "icons": [{"src": "https://cdn.example.com/i.png"}]}`,
+			start: "https://login.example.com/",
+			icons: []string{"https://cdn.example.com/i.png"},
+		},
+		{
+			name: "invalid",
+			raw:  `{"name": `,
+			err:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := kraaler.ParseWebManifest("http://aau.dk/app/manifest.json", []byte(tc.raw))
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error parsing manifest")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unable to parse manifest: %s", err)
+			}
+
+			if m.Name != tc.expected {
+				t.Fatalf("expected name %q, but received: %q", tc.expected, m.Name)
+			}
+
+			if m.StartURL != tc.start {
+				t.Fatalf("expected start url %s, but received: %s", tc.start, m.StartURL)
+			}
+
+			if len(m.Icons) != len(tc.icons) {
+				t.Fatalf("expected %d icon(s), but received: %d", len(tc.icons), len(m.Icons))
+			}
+
+			for i, src := range tc.icons {
+				if m.Icons[i].Src != src {
+					t.Fatalf("expected icon %s, but received: %s", src, m.Icons[i].Src)
+				}
+			}
+		})
+	}
+}
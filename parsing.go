@@ -2,18 +2,33 @@ package kraaler
 
 import (
 	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/publicsuffix"
 )
 
 func mimeIsHTML(mime string) bool {
 	return strings.HasPrefix(mime, "text/html")
 }
 
+func mimeIsXML(mime string) bool {
+	return strings.HasPrefix(mime, "text/xml") || strings.HasPrefix(mime, "application/xml")
+}
+
+func mimeIsText(mime string) bool {
+	return strings.HasPrefix(mime, "text/plain")
+}
+
 func matcherByRegexp(s string, strs ...string) (func(string) bool, error) {
 	rgx, err := regexp.Compile(s)
 	if err != nil {
@@ -41,14 +56,111 @@ func matcherByRegexp(s string, strs ...string) (func(string) bool, error) {
 	}, nil
 }
 
+// MatcherByRegexp matches strings matching any of the expressions
+func MatcherByRegexp(s string, strs ...string) (func(string) bool, error) {
+	return matcherByRegexp(s, strs...)
+}
+
+// URLRegexpFilter matches urls matching at least one of the include
+// expressions, if any are given, and none of the exclude expressions
+func URLRegexpFilter(include, exclude []string) (func(*url.URL) bool, error) {
+	included := func(string) bool { return true }
+	if len(include) > 0 {
+		m, err := matcherByRegexp(include[0], include[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		included = m
+	}
+
+	excluded := func(string) bool { return false }
+	if len(exclude) > 0 {
+		m, err := matcherByRegexp(exclude[0], exclude[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		excluded = m
+	}
+
+	return func(u *url.URL) bool {
+		s := u.String()
+		return included(s) && !excluded(s)
+	}, nil
+}
+
+var linkAttrs = []struct {
+	selector string
+	attr     string
+}{
+	{"a[href]", "href"},
+	{"img[src]", "src"},
+	{"script[src]", "src"},
+	{"link[href]", "href"},
+	{"iframe[src]", "src"},
+	{"form[action]", "action"},
+}
+
+// RetrieveLinks finds links to http(s) and relative resources
 func RetrieveLinks(host *url.URL, body []byte) ([]*url.URL, error) {
-	kind := http.DetectContentType(body)
 	m, err := matcherByRegexp("^/[a-zA-Z]+", "^http://", "^https://")
 	if err != nil {
 		return nil, err
 	}
 
+	return RetrieveLinksMatching(host, body, m)
+}
+
+var textURLRegexp = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// xmlLocations finds the contents of the <loc> elements of a sitemap (or
+// sitemap index)
+func xmlLocations(body []byte) ([]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+
+	var locs []string
+	var inLoc bool
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return locs, nil
+		}
+		if err != nil {
+			return locs, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inLoc = t.Name.Local == "loc"
+		case xml.EndElement:
+			inLoc = false
+		case xml.CharData:
+			if inLoc {
+				locs = append(locs, string(t))
+			}
+		}
+	}
+}
+
+// RetrieveLinksMatching finds links for which match returns true, a nil
+// match keeps every link. Links are found in the elements of html
+// documents, the <loc> elements of xml sitemaps and the absolute urls
+// of plain text (e.g. json) documents
+func RetrieveLinksMatching(host *url.URL, body []byte, match func(string) bool) ([]*url.URL, error) {
+	kind := http.DetectContentType(body)
+
 	urls := map[string]struct{}{}
+	add := func(link string) {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			return
+		}
+
+		if match == nil || match(link) {
+			urls[link] = struct{}{}
+		}
+	}
+
 	switch {
 	case mimeIsHTML(kind):
 		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
@@ -56,18 +168,29 @@ func RetrieveLinks(host *url.URL, body []byte) ([]*url.URL, error) {
 			return nil, err
 		}
 
-		doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
-			href, ok := s.Attr("href")
-			if !ok {
-				return
-			}
+		for _, la := range linkAttrs {
+			doc.Find(la.selector).Each(func(i int, s *goquery.Selection) {
+				if link, ok := s.Attr(la.attr); ok {
+					add(link)
+				}
+			})
+		}
+	case mimeIsXML(kind):
+		locs, err := xmlLocations(body)
+		if err != nil && len(locs) == 0 {
+			return nil, err
+		}
 
-			if m(href) {
-				urls[href] = struct{}{}
-			}
-		})
+		for _, loc := range locs {
+			add(loc)
+		}
+	case mimeIsText(kind):
+		for _, link := range textURLRegexp.FindAll(body, -1) {
+			add(strings.TrimRight(string(link), ".,;:!?)]}"))
+		}
 	}
 
+	seen := map[string]struct{}{}
 	var res []*url.URL
 	for u, _ := range urls {
 		link, err := url.Parse(u)
@@ -75,18 +198,262 @@ func RetrieveLinks(host *url.URL, body []byte) ([]*url.URL, error) {
 			continue
 		}
 
-		if link.Host == "" {
+		if link.Host == "" || link.Scheme == "" {
 			// cannot replace source with anything meaningful
 			if host.Host == "" {
 				continue
 			}
 
-			link.Host = host.Host
-			link.Scheme = host.Scheme
+			link = host.ResolveReference(link)
+		}
+
+		if _, ok := seen[link.String()]; ok {
+			continue
 		}
+		seen[link.String()] = struct{}{}
 
 		res = append(res, link)
 	}
 
 	return res, nil
 }
+
+func resolveLink(host *url.URL, s string) (*url.URL, error) {
+	link, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return host.ResolveReference(link), nil
+}
+
+// RetrieveMetaRefresh finds the target and delay of a meta refresh tag,
+// a nil url is returned if the body has no such tag
+func RetrieveMetaRefresh(host *url.URL, body []byte) (*url.URL, time.Duration, error) {
+	if !mimeIsHTML(http.DetectContentType(body)) {
+		return nil, 0, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var content string
+	doc.Find("meta[http-equiv]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		equiv, _ := s.Attr("http-equiv")
+		if !strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+			return true
+		}
+
+		content, _ = s.Attr("content")
+		return false
+	})
+
+	// content is on the form: <delay>[;,] url=<target>
+	parts := strings.SplitN(content, ";", 2)
+	if len(parts) == 1 {
+		parts = strings.SplitN(content, ",", 2)
+	}
+
+	if len(parts) != 2 {
+		return nil, 0, nil
+	}
+
+	secs, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	delay := time.Duration(secs * float64(time.Second))
+
+	target := strings.TrimSpace(parts[1])
+	if strings.HasPrefix(strings.ToLower(target), "url") {
+		target = strings.TrimSpace(target[3:])
+		target = strings.TrimSpace(strings.TrimPrefix(target, "="))
+	}
+	target = strings.Trim(target, `"'`)
+
+	if target == "" {
+		return nil, 0, nil
+	}
+
+	u, err := resolveLink(host, target)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return u, delay, nil
+}
+
+var locationRedirectRegexp = regexp.MustCompile(`(?:window\.|document\.|self\.|top\.)?location(?:\.href)?\s*=\s*["']([^"']+)["']|location\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\)`)
+
+// RetrieveLocationRedirects finds string literals assigned to the location
+// of the document by javascript
+func RetrieveLocationRedirects(host *url.URL, body []byte) []*url.URL {
+	var res []*url.URL
+	for _, m := range locationRedirectRegexp.FindAllSubmatch(body, -1) {
+		target := string(m[1])
+		if target == "" {
+			target = string(m[2])
+		}
+
+		u, err := resolveLink(host, target)
+		if err != nil {
+			continue
+		}
+
+		res = append(res, u)
+	}
+
+	return res
+}
+
+type FormInput struct {
+	Name string
+	Type string
+}
+
+type Form struct {
+	Action *url.URL
+	Method string
+	Inputs []FormInput
+}
+
+// RetrieveForms finds the forms of a html document, with the form action
+// resolved against the host
+func RetrieveForms(host *url.URL, body []byte) ([]*Form, error) {
+	if !mimeIsHTML(http.DetectContentType(body)) {
+		return nil, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var forms []*Form
+	doc.Find("form").Each(func(i int, s *goquery.Selection) {
+		method, _ := s.Attr("method")
+		f := &Form{
+			Action: host,
+			Method: strings.ToUpper(strings.TrimSpace(method)),
+		}
+		if f.Method == "" {
+			f.Method = "GET"
+		}
+
+		if action, ok := s.Attr("action"); ok && strings.TrimSpace(action) != "" {
+			if u, err := resolveLink(host, action); err == nil {
+				f.Action = u
+			}
+		}
+
+		s.Find("input").Each(func(i int, in *goquery.Selection) {
+			name, _ := in.Attr("name")
+			kind, _ := in.Attr("type")
+			kind = strings.ToLower(strings.TrimSpace(kind))
+			if kind == "" {
+				kind = "text"
+			}
+
+			f.Inputs = append(f.Inputs, FormInput{Name: name, Type: kind})
+		})
+
+		forms = append(forms, f)
+	})
+
+	return forms, nil
+}
+
+func (f *Form) hasInput(kinds ...string) bool {
+	for _, in := range f.Inputs {
+		for _, k := range kinds {
+			if in.Type == k {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// RetrieveCharset determines the charset of a body, a charset given in the
+// content type takes precedence over one declared by a meta tag of the document
+func RetrieveCharset(contentType string, body []byte) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if cs := params["charset"]; cs != "" {
+			return strings.ToLower(cs)
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var charset string
+	doc.Find("meta").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if cs, ok := s.Attr("charset"); ok {
+			charset = strings.TrimSpace(cs)
+			return false
+		}
+
+		if equiv, _ := s.Attr("http-equiv"); strings.EqualFold(equiv, "content-type") {
+			content, _ := s.Attr("content")
+			if _, params, err := mime.ParseMediaType(content); err == nil && params["charset"] != "" {
+				charset = params["charset"]
+				return false
+			}
+		}
+
+		return true
+	})
+
+	return strings.ToLower(charset)
+}
+
+func siteOf(u *url.URL) string {
+	host := u.Hostname()
+	if dom, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return dom
+	}
+
+	return host
+}
+
+// suspiciousAction reports whether a form submits its data somewhere other
+// than the site it was served from
+func (f *Form) suspiciousAction(origin *url.URL) bool {
+	if f.Action == nil {
+		return false
+	}
+
+	switch f.Action.Scheme {
+	case "http", "https":
+	default:
+		return true
+	}
+
+	if net.ParseIP(f.Action.Hostname()) != nil {
+		return true
+	}
+
+	return origin != nil && siteOf(f.Action) != siteOf(origin)
+}
+
+// LikelyCredentialForm is a phishing heuristic which is true if any form
+// asks for a password along with a username or email, and submits it
+// to a suspicious location
+func LikelyCredentialForm(origin *url.URL, forms []*Form) bool {
+	for _, f := range forms {
+		if !f.hasInput("password") || !f.hasInput("text", "email") {
+			continue
+		}
+
+		if f.suspiciousAction(origin) {
+			return true
+		}
+	}
+
+	return false
+}
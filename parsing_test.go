@@ -3,6 +3,7 @@ package kraaler_test
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/aau-network-security/kraaler"
 )
@@ -39,6 +40,52 @@ func TestRetrieveLinks(t *testing.T) {
 			name: "empty",
 			src:  "<html></html>",
 		},
+		{
+			name: "resources",
+			src: `<html><head><link rel="stylesheet" href="/style.css"><script src="https://cdn.com/app.js"></script></head>
+<body><img src="/logo.png"/><iframe src="https://ads.com/frame"></iframe><form action="/login"></form></body></html>`,
+			urls: []string{
+				domain.String() + "/style.css",
+				"https://cdn.com/app.js",
+				domain.String() + "/logo.png",
+				"https://ads.com/frame",
+				domain.String() + "/login",
+			},
+		},
+		{
+			name: "same link in multiple elements",
+			src:  `<html><a href="/logo.png">logo</a><img src="/logo.png"/></html>`,
+			urls: []string{
+				domain.String() + "/logo.png",
+			},
+		},
+		{
+			name: "xml sitemap",
+			src: `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://test.com/</loc><lastmod>2019-01-01</lastmod></url>
+  <url><loc> https://test.com/about </loc></url>
+</urlset>`,
+			urls: []string{
+				domain.String() + "/",
+				domain.String() + "/about",
+			},
+		},
+		{
+			name: "text with urls",
+			src: `{"next": "https://api.test.com/page/2", "docs": "see http://docs.test.com/api."}
+visit https://test.com/contact, or (https://test.com/help)`,
+			urls: []string{
+				"https://api.test.com/page/2",
+				"http://docs.test.com/api",
+				domain.String() + "/contact",
+				domain.String() + "/help",
+			},
+		},
+		{
+			name: "filtered schemes",
+			src:  `<html><a href="mailto:a@test.com">mail</a><a href="javascript:void(0)">js</a></html>`,
+		},
 	}
 
 	for _, tc := range tt {
@@ -65,3 +112,265 @@ func TestRetrieveLinks(t *testing.T) {
 		})
 	}
 }
+
+func TestRetrieveLinksMatching(t *testing.T) {
+	domain, _ := url.Parse("https://test.com/dir/")
+	src := `<html><a href="page.html">rel</a><a href="//cdn.com/lib.js">proto</a></html>`
+
+	found, err := kraaler.RetrieveLinksMatching(domain, []byte(src), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := map[string]bool{
+		"https://test.com/dir/page.html": true,
+		"https://cdn.com/lib.js":         true,
+	}
+
+	if n := len(found); n != len(expected) {
+		t.Fatalf("expected to find %d url(s), but found %d", len(expected), n)
+	}
+
+	for _, u := range found {
+		if !expected[u.String()] {
+			t.Fatalf("unexpected url: %s", u)
+		}
+	}
+}
+
+func TestURLRegexpFilter(t *testing.T) {
+	tt := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		allowed  []string
+		rejected []string
+		err      bool
+	}{
+		{
+			name:    "none",
+			allowed: []string{"https://test.com/"},
+		},
+		{
+			name:     "include",
+			include:  []string{`/login`, `\.php$`},
+			allowed:  []string{"https://test.com/login", "https://test.com/index.php"},
+			rejected: []string{"https://test.com/about"},
+		},
+		{
+			name:     "exclude",
+			exclude:  []string{`\.(png|jpg)$`},
+			allowed:  []string{"https://test.com/"},
+			rejected: []string{"https://test.com/logo.png"},
+		},
+		{
+			name:     "include and exclude",
+			include:  []string{`^https://`},
+			exclude:  []string{`cdn\.`},
+			allowed:  []string{"https://test.com/"},
+			rejected: []string{"http://test.com/", "https://cdn.test.com/"},
+		},
+		{
+			name:    "invalid",
+			exclude: []string{`(`},
+			err:     true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := kraaler.URLRegexpFilter(tc.include, tc.exclude)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error of invalid expression")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unable to create filter: %s", err)
+			}
+
+			for _, s := range tc.allowed {
+				u, _ := url.Parse(s)
+				if !f(u) {
+					t.Fatalf("expected %s to be allowed", s)
+				}
+			}
+
+			for _, s := range tc.rejected {
+				u, _ := url.Parse(s)
+				if f(u) {
+					t.Fatalf("expected %s to be rejected", s)
+				}
+			}
+		})
+	}
+}
+
+func TestLinksFromBodies(t *testing.T) {
+	host, _ := url.Parse("https://test.com")
+	bodies := []*kraaler.ResponseBody{
+		{Body: []byte(`<html><a href="/a">a</a><a href="https://google.com">g</a></html>`)},
+		{Body: []byte(`<html><a href="/a">a</a><a href="/b">b</a></html>`)},
+		nil,
+	}
+
+	links := kraaler.LinksFromBodies(host, bodies...)
+	if n := len(links); n != 3 {
+		t.Fatalf("expected 3 unique links, but found: %d", n)
+	}
+
+	expected := map[string]bool{
+		"https://test.com/a": true,
+		"https://test.com/b": true,
+		"https://google.com": true,
+	}
+	for _, l := range links {
+		if !expected[l.String()] {
+			t.Fatalf("unexpected link: %s", l)
+		}
+	}
+}
+
+func TestRetrieveMetaRefresh(t *testing.T) {
+	domain, _ := url.Parse("https://test.com")
+	tt := []struct {
+		name  string
+		src   string
+		url   string
+		delay time.Duration
+	}{
+		{
+			name:  "absolute",
+			src:   `<html><head><meta http-equiv="refresh" content="5; url=https://phish.com/login"></head></html>`,
+			url:   "https://phish.com/login",
+			delay: 5 * time.Second,
+		},
+		{
+			name: "relative quoted",
+			src:  `<html><head><meta http-equiv="Refresh" content="0;URL='/next'"></head></html>`,
+			url:  domain.String() + "/next",
+		},
+		{
+			name: "reload only",
+			src:  `<html><head><meta http-equiv="refresh" content="30"></head></html>`,
+		},
+		{
+			name: "none",
+			src:  `<html><head></head></html>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, delay, err := kraaler.RetrieveMetaRefresh(domain, []byte(tc.src))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if tc.url == "" {
+				if u != nil {
+					t.Fatalf("expected no url, but received: %s", u)
+				}
+				return
+			}
+
+			if u == nil || u.String() != tc.url {
+				t.Fatalf("unexpected url (%v), expected: %s", u, tc.url)
+			}
+
+			if delay != tc.delay {
+				t.Fatalf("unexpected delay (%s), expected: %s", delay, tc.delay)
+			}
+		})
+	}
+}
+
+func TestRetrieveLocationRedirects(t *testing.T) {
+	domain, _ := url.Parse("https://test.com")
+	src := `<script>window.location.href = "https://phish.com/a"; location.replace('/b');</script>`
+
+	found := kraaler.RetrieveLocationRedirects(domain, []byte(src))
+	expected := []string{"https://phish.com/a", domain.String() + "/b"}
+	if n := len(found); n != len(expected) {
+		t.Fatalf("expected to find %d url(s), but found %d", len(expected), n)
+	}
+
+	for i, u := range found {
+		if u.String() != expected[i] {
+			t.Fatalf("unexpected url (%s), expected: %s", u, expected[i])
+		}
+	}
+}
+
+func TestLikelyCredentialForm(t *testing.T) {
+	origin, _ := url.Parse("https://paypal.example.com/signin")
+	tt := []struct {
+		name     string
+		src      string
+		expected bool
+	}{
+		{
+			name: "fake login",
+			src: `<html><body><form method="post" action="http://203.0.113.7/collect.php">
+<input type="email" name="email"><input type="password" name="pass"><input type="submit"></form></body></html>`,
+			expected: true,
+		},
+		{
+			name: "cross origin login",
+			src: `<html><body><form method="post" action="https://harvest.com/l">
+<input name="user"><input type="password" name="pass"></form></body></html>`,
+			expected: true,
+		},
+		{
+			name: "same site login",
+			src: `<html><body><form method="post" action="/signin">
+<input name="user"><input type="password" name="pass"></form></body></html>`,
+		},
+		{
+			name: "search form",
+			src:  `<html><body><form action="https://search.com/"><input type="text" name="q"></form></body></html>`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			forms, err := kraaler.RetrieveForms(origin, []byte(tc.src))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if n := len(forms); n != 1 {
+				t.Fatalf("expected to find one form, but found: %d", n)
+			}
+
+			if likely := kraaler.LikelyCredentialForm(origin, forms); likely != tc.expected {
+				t.Fatalf("expected likely credential form to be %t", tc.expected)
+			}
+		})
+	}
+}
+
+func TestRetrieveCharset(t *testing.T) {
+	tt := []struct {
+		name        string
+		contentType string
+		src         string
+		charset     string
+	}{
+		{name: "header", contentType: "text/html; charset=ISO-8859-1", src: `<html></html>`, charset: "iso-8859-1"},
+		{name: "header over meta", contentType: "text/html; charset=utf-8", src: `<meta charset="windows-1252">`, charset: "utf-8"},
+		{name: "meta charset", contentType: "text/html", src: `<html><head><meta charset="Shift_JIS"></head></html>`, charset: "shift_jis"},
+		{name: "meta http-equiv", src: `<meta http-equiv="Content-Type" content="text/html; charset=windows-1251">`, charset: "windows-1251"},
+		{name: "none", contentType: "text/html", src: `<html></html>`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if cs := kraaler.RetrieveCharset(tc.contentType, []byte(tc.src)); cs != tc.charset {
+				t.Fatalf("unexpected charset (%s), expected: %s", cs, tc.charset)
+			}
+		})
+	}
+}
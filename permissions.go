@@ -0,0 +1,155 @@
+package kraaler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/page"
+	"github.com/mafredri/cdp/protocol/runtime"
+)
+
+// PermissionRequest is an attempt of the page to use a permission gated
+// API, such as notifications, the camera or the clipboard, which was denied
+type PermissionRequest struct {
+	Name      string
+	API       string
+	URL       string
+	Requested time.Time
+}
+
+const permissionBinding = "__kraalerPermission"
+
+// permissionsScript replaces the permission gated APIs before any script of
+// the page runs, reporting their use to the binding and denying it
+const permissionsScript = `(() => {
+	const report = (name, api) => {
+		try {
+			window.` + permissionBinding + `(JSON.stringify({name: name, api: api, url: location.href}));
+		} catch (e) {}
+	};
+	const denied = () => new DOMException("Permission denied", "NotAllowedError");
+	const override = (obj, prop, name, api, fn) => {
+		if (!obj || !(prop in obj)) return;
+		try {
+			Object.defineProperty(obj, prop, {
+				configurable: true,
+				writable: true,
+				value: function() {
+					report(typeof name === "function" ? name.apply(this, arguments) : name, api);
+					return fn.apply(this, arguments);
+				},
+			});
+		} catch (e) {}
+	};
+
+	if (window.Notification) {
+		override(Notification, "requestPermission", "notifications", "Notification.requestPermission", (cb) => {
+			if (typeof cb === "function") cb("denied");
+			return Promise.resolve("denied");
+		});
+	}
+
+	const perms = navigator.permissions && Object.getPrototypeOf(navigator.permissions);
+	override(perms, "query", (desc) => (desc && desc.name) || "unknown", "permissions.query", () => Promise.resolve({state: "denied", onchange: null}));
+
+	const media = navigator.mediaDevices && Object.getPrototypeOf(navigator.mediaDevices);
+	override(media, "getUserMedia", (c) => c && c.video ? "camera" : "microphone", "mediaDevices.getUserMedia", () => Promise.reject(denied()));
+	override(media, "getDisplayMedia", "display-capture", "mediaDevices.getDisplayMedia", () => Promise.reject(denied()));
+
+	const geo = navigator.geolocation && Object.getPrototypeOf(navigator.geolocation);
+	const geoDenied = (ok, fail) => {
+		if (typeof fail === "function") fail({code: 1, message: "User denied Geolocation", PERMISSION_DENIED: 1});
+	};
+	override(geo, "getCurrentPosition", "geolocation", "geolocation.getCurrentPosition", geoDenied);
+	override(geo, "watchPosition", "geolocation", "geolocation.watchPosition", (ok, fail) => { geoDenied(ok, fail); return 0; });
+
+	const clip = navigator.clipboard && Object.getPrototypeOf(navigator.clipboard);
+	override(clip, "read", "clipboard-read", "clipboard.read", () => Promise.reject(denied()));
+	override(clip, "readText", "clipboard-read", "clipboard.readText", () => Promise.reject(denied()));
+	override(clip, "write", "clipboard-write", "clipboard.write", () => Promise.reject(denied()));
+	override(clip, "writeText", "clipboard-write", "clipboard.writeText", () => Promise.reject(denied()));
+
+	if (window.PushManager) {
+		override(PushManager.prototype, "subscribe", "push", "PushManager.subscribe", () => Promise.reject(denied()));
+	}
+	override(Navigator.prototype, "requestMIDIAccess", "midi", "navigator.requestMIDIAccess", () => Promise.reject(denied()));
+})()`
+
+// permissionReader records the permissions requested by documents loaded
+// after it is installed, denying every request such that the page is not
+// left waiting for a prompt
+func permissionReader(ctx context.Context, runt cdp.Runtime, pg cdp.Page) (func() ([]*PermissionRequest, error), error) {
+	if err := runt.AddBinding(ctx, runtime.NewAddBindingArgs(permissionBinding)); err != nil {
+		return nil, err
+	}
+
+	if _, err := pg.AddScriptToEvaluateOnNewDocument(ctx, page.NewAddScriptToEvaluateOnNewDocumentArgs(permissionsScript)); err != nil {
+		return nil, err
+	}
+
+	called, err := runt.BindingCalled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var m sync.Mutex
+	var requests []*PermissionRequest
+
+	go func() {
+		defer close(done)
+		defer called.Close()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-called.Ready():
+			}
+
+			ev, err := called.Recv()
+			if err != nil {
+				return
+			}
+
+			if ev.Name != permissionBinding {
+				continue
+			}
+
+			var req struct {
+				Name string `json:"name"`
+				API  string `json:"api"`
+				URL  string `json:"url"`
+			}
+			if err := json.Unmarshal([]byte(ev.Payload), &req); err != nil {
+				continue
+			}
+
+			m.Lock()
+			requests = append(requests, &PermissionRequest{
+				Name:      req.Name,
+				API:       req.API,
+				URL:       req.URL,
+				Requested: time.Now(),
+			})
+			m.Unlock()
+		}
+	}()
+
+	return func() ([]*PermissionRequest, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done:
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		return requests, nil
+	}, nil
+}
@@ -2,9 +2,12 @@ package kraaler
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -30,7 +33,188 @@ func (ucp URLChanProvider) UrlsC() <-chan *url.URL {
 	return ucp.C
 }
 
+// SourceProvider is implemented by providers which know the source (feed) of
+// the urls they provide
+type SourceProvider interface {
+	Source(*url.URL) string
+}
+
+// PriorityProvider is implemented by providers which know some of their urls
+// to be more urgent than others, urls of higher priority are more urgent
+type PriorityProvider interface {
+	Priority(*url.URL) int
+}
+
+// sourceTracker remembers the source and priority of each url passed on by
+// a provider merging other providers, until they are looked up
+type sourceTracker struct {
+	m          sync.Mutex
+	sources    map[*url.URL]string
+	priorities map[*url.URL]int
+}
+
+func (st *sourceTracker) track(p URLProvider, u *url.URL) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if sp, ok := p.(SourceProvider); ok {
+		if st.sources == nil {
+			st.sources = map[*url.URL]string{}
+		}
+		st.sources[u] = sp.Source(u)
+	}
+
+	if pp, ok := p.(PriorityProvider); ok {
+		if prio := pp.Priority(u); prio != 0 {
+			if st.priorities == nil {
+				st.priorities = map[*url.URL]int{}
+			}
+			st.priorities[u] = prio
+		}
+	}
+}
+
+func (st *sourceTracker) Source(u *url.URL) string {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	src := st.sources[u]
+	delete(st.sources, u)
+
+	return src
+}
+
+func (st *sourceTracker) Priority(u *url.URL) int {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	prio := st.priorities[u]
+	delete(st.priorities, u)
+
+	return prio
+}
+
+// ProviderStats tells providers which are done apart from providers which
+// stopped emitting urls while still running
+type ProviderStats struct {
+	Emitted  int       `json:"emitted"`
+	LastEmit time.Time `json:"last_emit"`
+	Errors   int       `json:"errors"`
+	Done     bool      `json:"done"`
+}
+
+// Fields are the fields of the stats for structured logging
+func (ps ProviderStats) Fields() []zap.Field {
+	return []zap.Field{
+		zap.Int("providers_emitted", ps.Emitted),
+		zap.Time("providers_last_emit", ps.LastEmit),
+		zap.Int("providers_errors", ps.Errors),
+		zap.Bool("providers_done", ps.Done),
+	}
+}
+
+type StatsProvider interface {
+	Stats() ProviderStats
+}
+
+type providerStats struct {
+	m     sync.Mutex
+	stats ProviderStats
+}
+
+func (ps *providerStats) emitted() {
+	ps.m.Lock()
+	ps.stats.Emitted += 1
+	ps.stats.LastEmit = time.Now()
+	ps.m.Unlock()
+}
+
+func (ps *providerStats) failed() {
+	ps.m.Lock()
+	ps.stats.Errors += 1
+	ps.m.Unlock()
+}
+
+func (ps *providerStats) done() {
+	ps.m.Lock()
+	ps.stats.Done = true
+	ps.m.Unlock()
+}
+
+func (ps *providerStats) Stats() ProviderStats {
+	ps.m.Lock()
+	defer ps.m.Unlock()
+	return ps.stats
+}
+
+func AggregateProviderStats(providers ...URLProvider) ProviderStats {
+	agg := ProviderStats{Done: len(providers) > 0}
+	for _, p := range providers {
+		sp, ok := p.(StatsProvider)
+		if !ok {
+			agg.Done = false
+			continue
+		}
+
+		s := sp.Stats()
+		agg.Emitted += s.Emitted
+		agg.Errors += s.Errors
+		agg.Done = agg.Done && s.Done
+		if s.LastEmit.After(agg.LastEmit) {
+			agg.LastEmit = s.LastEmit
+		}
+	}
+
+	return agg
+}
+
+type mergedProvider struct {
+	sourceTracker
+
+	providers []URLProvider
+	once      sync.Once
+	urls      chan *url.URL
+}
+
+// MergeProviders fans in the urls of every provider into a single channel,
+// which is closed once every provider is done
+func MergeProviders(providers ...URLProvider) URLProvider {
+	return &mergedProvider{
+		providers: providers,
+		urls:      make(chan *url.URL),
+	}
+}
+
+func (mp *mergedProvider) UrlsC() <-chan *url.URL {
+	mp.once.Do(func() {
+		var wg sync.WaitGroup
+		for _, p := range mp.providers {
+			wg.Add(1)
+			go func(p URLProvider) {
+				defer wg.Done()
+				for u := range p.UrlsC() {
+					mp.track(p, u)
+					mp.urls <- u
+				}
+			}(p)
+		}
+
+		go func() {
+			wg.Wait()
+			close(mp.urls)
+		}()
+	})
+
+	return mp.urls
+}
+
+func (mp *mergedProvider) Stats() ProviderStats {
+	return AggregateProviderStats(mp.providers...)
+}
+
 type DomainFileProvider struct {
+	providerStats
+
 	path string
 	c    DomainFileProviderConfig
 	urls chan *url.URL
@@ -95,13 +279,15 @@ func (dfp *DomainFileProvider) UrlsC() <-chan *url.URL {
 				return strings.ToLower(strings.TrimSpace(s))
 			}
 
+			defer close(dfp.urls)
+			defer dfp.done()
+
 			file, err := os.Open(dfp.path)
 			if err != nil {
+				dfp.failed()
 				return
 			}
-
 			defer file.Close()
-			defer close(dfp.urls)
 
 			scanner := bufio.NewScanner(file)
 			for scanner.Scan() {
@@ -117,6 +303,7 @@ func (dfp *DomainFileProvider) UrlsC() <-chan *url.URL {
 
 						select {
 						case dfp.urls <- u:
+							dfp.emitted()
 						case <-dfp.stop:
 							return
 						}
@@ -125,6 +312,7 @@ func (dfp *DomainFileProvider) UrlsC() <-chan *url.URL {
 			}
 
 			if err := scanner.Err(); err != nil {
+				dfp.failed()
 				return
 			}
 		}()
@@ -133,10 +321,98 @@ func (dfp *DomainFileProvider) UrlsC() <-chan *url.URL {
 	return dfp.urls
 }
 
+func (dfp *DomainFileProvider) Source(*url.URL) string {
+	return "domain-file"
+}
+
 func (dfp *DomainFileProvider) Close() {
 	close(dfp.stop)
 }
 
+type StdinProvider struct {
+	providerStats
+
+	c    StdinProviderConfig
+	urls chan *url.URL
+	stop chan struct{}
+	once sync.Once
+}
+
+type StdinProviderConfig struct {
+	Logger *zap.Logger
+	Reader io.Reader
+}
+
+// NewStdinProvider provides the urls read line by line from stdin, blank lines
+// and lines starting with # are skipped
+func NewStdinProvider(conf *StdinProviderConfig) *StdinProvider {
+	var c StdinProviderConfig
+	if conf != nil {
+		c = *conf
+	}
+
+	if c.Logger == nil {
+		c.Logger = zap.L()
+	}
+
+	if c.Reader == nil {
+		c.Reader = os.Stdin
+	}
+
+	return &StdinProvider{
+		c:    c,
+		urls: make(chan *url.URL),
+		stop: make(chan struct{}),
+	}
+}
+
+func (sp *StdinProvider) UrlsC() <-chan *url.URL {
+	sp.once.Do(func() {
+		go func() {
+			defer close(sp.urls)
+			defer sp.done()
+
+			scanner := bufio.NewScanner(sp.c.Reader)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+
+				u, err := url.Parse(line)
+				if err != nil || u.Scheme == "" || u.Host == "" {
+					sp.c.Logger.Info("stdin_invalid_url",
+						zap.String("line", line),
+					)
+					sp.failed()
+					continue
+				}
+
+				select {
+				case sp.urls <- u:
+					sp.emitted()
+				case <-sp.stop:
+					return
+				}
+			}
+
+			if err := scanner.Err(); err != nil {
+				sp.failed()
+			}
+		}()
+	})
+
+	return sp.urls
+}
+
+func (sp *StdinProvider) Source(*url.URL) string {
+	return "stdin"
+}
+
+func (sp *StdinProvider) Close() {
+	close(sp.stop)
+}
+
 type phishTankEntry struct {
 	ID               int
 	RawID            string    `json:"phish_id"`
@@ -154,19 +430,29 @@ func (el phishTankEntryList) Swap(i, j int)      { el[i], el[j] = el[j], el[i] }
 func (el phishTankEntryList) Less(i, j int) bool { return el[i].ID < el[j].ID }
 
 type PhishTankProvider struct {
-	conf PhishTankProviderConfig
-	once sync.Once
-	etag string
-	stop chan struct{}
-	urls chan *url.URL
+	providerStats
+
+	conf  PhishTankProviderConfig
+	once  sync.Once
+	etag  string
+	stop  chan struct{}
+	urls  chan *url.URL
+	m     sync.Mutex
+	fresh map[*url.URL]struct{}
 }
 
 type PhishTankProviderConfig struct {
 	Endpoint     string
 	APIKey       string
 	TickDuration time.Duration
+
+	// FreshPriority is the priority of urls verified after the first
+	// fetch of the feed, defaults to DefaultPhishTankFreshPriority
+	FreshPriority int
 }
 
+const DefaultPhishTankFreshPriority = 10
+
 func NewPhishTankProviderWithConfig(conf PhishTankProviderConfig) *PhishTankProvider {
 	if conf.Endpoint == "" {
 		conf.Endpoint = "http://data.phishtank.com/data/online-valid.json.gz"
@@ -180,10 +466,15 @@ func NewPhishTankProviderWithConfig(conf PhishTankProviderConfig) *PhishTankProv
 		conf.TickDuration = 20 * time.Minute
 	}
 
+	if conf.FreshPriority == 0 {
+		conf.FreshPriority = DefaultPhishTankFreshPriority
+	}
+
 	return &PhishTankProvider{
-		conf: conf,
-		stop: make(chan struct{}),
-		urls: make(chan *url.URL),
+		conf:  conf,
+		stop:  make(chan struct{}),
+		urls:  make(chan *url.URL),
+		fresh: map[*url.URL]struct{}{},
 	}
 }
 
@@ -239,14 +530,19 @@ func (ptr *PhishTankProvider) UrlsC() <-chan *url.URL {
 			ticker := time.NewTicker(ptr.conf.TickDuration)
 			defer ticker.Stop()
 			defer close(ptr.urls)
+			defer ptr.done()
 
 			var newestId int
 			for {
 				entries, err := ptr.getEntries()
 				if err != nil {
+					ptr.failed()
 					fmt.Println(err)
 				}
 
+				// entries of the first fetch are the backlog of the feed,
+				// later entries have been verified since
+				fetched := newestId > 0
 				for _, e := range entries {
 					if e.ID <= newestId {
 						continue
@@ -257,8 +553,15 @@ func (ptr *PhishTankProvider) UrlsC() <-chan *url.URL {
 						continue
 					}
 
+					if fetched {
+						ptr.m.Lock()
+						ptr.fresh[u] = struct{}{}
+						ptr.m.Unlock()
+					}
+
 					select {
 					case ptr.urls <- u:
+						ptr.emitted()
 						newestId = e.ID
 					case <-ptr.stop:
 						return
@@ -277,6 +580,572 @@ func (ptr *PhishTankProvider) UrlsC() <-chan *url.URL {
 	return ptr.urls
 }
 
+func (ptr *PhishTankProvider) Source(*url.URL) string {
+	return "phishtank"
+}
+
+// Priority is the priority of urls verified since the feed was first
+// fetched, other urls have no priority
+func (ptr *PhishTankProvider) Priority(u *url.URL) int {
+	ptr.m.Lock()
+	defer ptr.m.Unlock()
+
+	if _, ok := ptr.fresh[u]; !ok {
+		return 0
+	}
+	delete(ptr.fresh, u)
+
+	return ptr.conf.FreshPriority
+}
+
 func (ptr *PhishTankProvider) Close() {
 	close(ptr.stop)
 }
+
+type OpenPhishProvider struct {
+	providerStats
+
+	conf OpenPhishProviderConfig
+	once sync.Once
+	etag string
+	seen map[string]struct{}
+	stop chan struct{}
+	urls chan *url.URL
+}
+
+type OpenPhishProviderConfig struct {
+	Endpoint     string
+	TickDuration time.Duration
+}
+
+func NewOpenPhishProviderWithConfig(conf OpenPhishProviderConfig) *OpenPhishProvider {
+	if conf.Endpoint == "" {
+		conf.Endpoint = "https://openphish.com/feed.txt"
+	}
+
+	if conf.TickDuration == 0 {
+		conf.TickDuration = 20 * time.Minute
+	}
+
+	return &OpenPhishProvider{
+		conf: conf,
+		seen: map[string]struct{}{},
+		stop: make(chan struct{}),
+		urls: make(chan *url.URL),
+	}
+}
+
+func NewOpenPhishProvider() *OpenPhishProvider {
+	return NewOpenPhishProviderWithConfig(OpenPhishProviderConfig{})
+}
+
+func (opp *OpenPhishProvider) getEntries() ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, opp.conf.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if opp.etag != "" {
+		req.Header.Set("If-None-Match", opp.etag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code for feed: %d", resp.StatusCode)
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if _, ok := opp.seen[line]; ok {
+			continue
+		}
+		opp.seen[line] = struct{}{}
+
+		entries = append(entries, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	opp.etag = resp.Header.Get("Etag")
+
+	return entries, nil
+}
+
+func (opp *OpenPhishProvider) UrlsC() <-chan *url.URL {
+	opp.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(opp.conf.TickDuration)
+			defer ticker.Stop()
+			defer close(opp.urls)
+			defer opp.done()
+
+			for {
+				entries, err := opp.getEntries()
+				if err != nil {
+					opp.failed()
+				}
+
+				for _, e := range entries {
+					u, err := url.Parse(e)
+					if err != nil {
+						continue
+					}
+
+					select {
+					case opp.urls <- u:
+						opp.emitted()
+					case <-opp.stop:
+						return
+					}
+				}
+
+				select {
+				case <-ticker.C:
+				case <-opp.stop:
+					return
+				}
+			}
+		}()
+	})
+
+	return opp.urls
+}
+
+func (opp *OpenPhishProvider) Source(*url.URL) string {
+	return "openphish"
+}
+
+func (opp *OpenPhishProvider) Close() {
+	close(opp.stop)
+}
+
+type HTTPProvider struct {
+	providerStats
+
+	conf HTTPProviderConfig
+	once sync.Once
+	seen map[string]struct{}
+	stop chan struct{}
+	urls chan *url.URL
+}
+
+type HTTPProviderConfig struct {
+	Endpoint     string
+	Token        string
+	TickDuration time.Duration
+	Client       *http.Client
+	Logger       *zap.Logger
+}
+
+type httpProviderEntry struct {
+	Url string `json:"url"`
+}
+
+// httpProviderPage is a page of entries, where next points to the following
+// page if the endpoint paginates its entries
+type httpProviderPage struct {
+	Urls []httpProviderEntry `json:"urls"`
+	Next string              `json:"next"`
+}
+
+// NewHTTPProvider polls a JSON endpoint returning either a list of
+// {"url": "..."} entries, or a page of such entries in "urls" with a link to
+// the following page in "next"
+func NewHTTPProvider(conf HTTPProviderConfig) *HTTPProvider {
+	if conf.TickDuration == 0 {
+		conf.TickDuration = time.Minute
+	}
+
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+
+	if conf.Logger == nil {
+		conf.Logger = zap.L()
+	}
+
+	return &HTTPProvider{
+		conf: conf,
+		seen: map[string]struct{}{},
+		stop: make(chan struct{}),
+		urls: make(chan *url.URL),
+	}
+}
+
+func (hp *HTTPProvider) getPage(endpoint string) (*httpProviderPage, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if hp.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+hp.conf.Token)
+	}
+
+	resp, err := hp.conf.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code for %s: %d", endpoint, resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var page httpProviderPage
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &page.Urls)
+	} else {
+		err = json.Unmarshal(trimmed, &page)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if page.Next != "" {
+		base, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := base.Parse(page.Next)
+		if err != nil {
+			return nil, err
+		}
+		page.Next = next.String()
+	}
+
+	return &page, nil
+}
+
+// poll emits the unseen urls of every page, it returns false if the provider
+// has been stopped
+func (hp *HTTPProvider) poll() bool {
+	visited := map[string]struct{}{}
+	for endpoint := hp.conf.Endpoint; endpoint != ""; {
+		if _, ok := visited[endpoint]; ok {
+			return true
+		}
+		visited[endpoint] = struct{}{}
+
+		page, err := hp.getPage(endpoint)
+		if err != nil {
+			hp.failed()
+			hp.conf.Logger.Info("http_provider_error",
+				zap.String("endpoint", endpoint),
+				zap.String("error", err.Error()),
+			)
+			return true
+		}
+
+		for _, e := range page.Urls {
+			if _, ok := hp.seen[e.Url]; ok {
+				continue
+			}
+
+			u, err := url.Parse(e.Url)
+			if err != nil {
+				continue
+			}
+			hp.seen[e.Url] = struct{}{}
+
+			select {
+			case hp.urls <- u:
+				hp.emitted()
+			case <-hp.stop:
+				return false
+			}
+		}
+
+		endpoint = page.Next
+	}
+
+	return true
+}
+
+func (hp *HTTPProvider) UrlsC() <-chan *url.URL {
+	hp.once.Do(func() {
+		go func() {
+			ticker := time.NewTicker(hp.conf.TickDuration)
+			defer ticker.Stop()
+			defer close(hp.urls)
+			defer hp.done()
+
+			for {
+				if !hp.poll() {
+					return
+				}
+
+				select {
+				case <-ticker.C:
+				case <-hp.stop:
+					return
+				}
+			}
+		}()
+	})
+
+	return hp.urls
+}
+
+func (hp *HTTPProvider) Source(*url.URL) string {
+	return "http"
+}
+
+func (hp *HTTPProvider) Close() {
+	close(hp.stop)
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+type sitemapDoc struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type SitemapProvider struct {
+	providerStats
+
+	conf SitemapProviderConfig
+	once sync.Once
+	stop chan struct{}
+	urls chan *url.URL
+}
+
+type SitemapProviderConfig struct {
+	Endpoint string
+	MaxURLs  int
+	Client   *http.Client
+}
+
+func NewSitemapProvider(conf SitemapProviderConfig) *SitemapProvider {
+	if conf.Client == nil {
+		conf.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &SitemapProvider{
+		conf: conf,
+		stop: make(chan struct{}),
+		urls: make(chan *url.URL),
+	}
+}
+
+func (sp *SitemapProvider) getSitemap(endpoint string) (*sitemapDoc, error) {
+	resp, err := sp.conf.Client.Get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code for sitemap: %d", resp.StatusCode)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	var r io.Reader = br
+
+	// compressed sitemaps (.xml.gz) are identified by the gzip magic number
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		uncompressed, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer uncompressed.Close()
+
+		r = uncompressed
+	}
+
+	var doc sitemapDoc
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+func (sp *SitemapProvider) UrlsC() <-chan *url.URL {
+	sp.once.Do(func() {
+		go func() {
+			defer close(sp.urls)
+			defer sp.done()
+
+			var emitted int
+			seen := map[string]bool{}
+			queue := []string{sp.conf.Endpoint}
+			for len(queue) > 0 {
+				endpoint := queue[0]
+				queue = queue[1:]
+
+				if seen[endpoint] {
+					continue
+				}
+				seen[endpoint] = true
+
+				doc, err := sp.getSitemap(endpoint)
+				if err != nil {
+					sp.failed()
+					continue
+				}
+
+				for _, sm := range doc.Sitemaps {
+					queue = append(queue, strings.TrimSpace(sm.Loc))
+				}
+
+				for _, loc := range doc.URLs {
+					if sp.conf.MaxURLs > 0 && emitted >= sp.conf.MaxURLs {
+						return
+					}
+
+					u, err := url.Parse(strings.TrimSpace(loc.Loc))
+					if err != nil {
+						continue
+					}
+
+					select {
+					case sp.urls <- u:
+						sp.emitted()
+						emitted += 1
+					case <-sp.stop:
+						return
+					}
+				}
+			}
+		}()
+	})
+
+	return sp.urls
+}
+
+func (sp *SitemapProvider) Source(*url.URL) string {
+	return "sitemap"
+}
+
+func (sp *SitemapProvider) Close() {
+	close(sp.stop)
+}
+
+type ProviderQuota struct {
+	Provider URLProvider
+	Weight   int
+}
+
+type WeightedProviderConfig struct {
+	Quotas []ProviderQuota
+	// Wait is how long to wait for a provider to fill its quota within a
+	// round before moving on to the next provider
+	Wait time.Duration
+}
+
+// WeightedProvider merges multiple providers, emitting up to Weight URLs
+// from each provider per round so no single provider can starve the others
+type WeightedProvider struct {
+	sourceTracker
+
+	conf WeightedProviderConfig
+	once sync.Once
+	stop chan struct{}
+	urls chan *url.URL
+}
+
+func NewWeightedProvider(conf WeightedProviderConfig) *WeightedProvider {
+	if conf.Wait == 0 {
+		conf.Wait = 100 * time.Millisecond
+	}
+
+	for i, q := range conf.Quotas {
+		if q.Weight <= 0 {
+			conf.Quotas[i].Weight = 1
+		}
+	}
+
+	return &WeightedProvider{
+		conf: conf,
+		stop: make(chan struct{}),
+		urls: make(chan *url.URL),
+	}
+}
+
+func (wp *WeightedProvider) UrlsC() <-chan *url.URL {
+	wp.once.Do(func() {
+		go func() {
+			defer close(wp.urls)
+
+			chans := make([]<-chan *url.URL, len(wp.conf.Quotas))
+			for i, q := range wp.conf.Quotas {
+				chans[i] = q.Provider.UrlsC()
+			}
+
+			open := len(chans)
+			for open > 0 {
+				for i, q := range wp.conf.Quotas {
+					if chans[i] == nil {
+						continue
+					}
+
+				quota:
+					for n := 0; n < q.Weight; n++ {
+						select {
+						case u, ok := <-chans[i]:
+							if !ok {
+								chans[i] = nil
+								open--
+								break quota
+							}
+
+							wp.track(q.Provider, u)
+							select {
+							case wp.urls <- u:
+							case <-wp.stop:
+								return
+							}
+						case <-time.After(wp.conf.Wait):
+							break quota
+						case <-wp.stop:
+							return
+						}
+					}
+				}
+			}
+		}()
+	})
+
+	return wp.urls
+}
+
+func (wp *WeightedProvider) Stats() ProviderStats {
+	var providers []URLProvider
+	for _, q := range wp.conf.Quotas {
+		providers = append(providers, q.Provider)
+	}
+
+	return AggregateProviderStats(providers...)
+}
+
+func (wp *WeightedProvider) Close() {
+	close(wp.stop)
+}
@@ -11,10 +11,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aau-network-security/kraaler"
+	"github.com/aau-network-security/kraaler/store"
 )
 
 func TestDomainFileProvider(t *testing.T) {
@@ -82,11 +84,52 @@ func TestDomainFileProvider(t *testing.T) {
 			if tc.expectedAmount != len(urls) {
 				t.Fatalf("unexpected amount %d, expected: %d", len(urls), tc.expectedAmount)
 			}
+
+			stats := dfp.Stats()
+			if stats.Emitted != tc.expectedAmount {
+				t.Fatalf("unexpected emit count %d, expected: %d", stats.Emitted, tc.expectedAmount)
+			}
+
+			if !stats.Done {
+				t.Fatalf("expected provider to report being done")
+			}
+
+			if agg := kraaler.AggregateProviderStats(dfp, kraaler.URLChanProvider{}); agg.Done {
+				t.Fatalf("expected aggregate to not be done when a provider is unable to report stats")
+			}
 		})
 	}
 
 }
 
+func TestStdinProvider(t *testing.T) {
+	input := `# seeds
+http://test.com/a
+
+https://test.com/b?c=d
+not a url
+`
+
+	sp := kraaler.NewStdinProvider(&kraaler.StdinProviderConfig{
+		Reader: strings.NewReader(input),
+	})
+	defer sp.Close()
+
+	var urls []string
+	for u := range sp.UrlsC() {
+		urls = append(urls, u.String())
+	}
+
+	expected := []string{"http://test.com/a", "https://test.com/b?c=d"}
+	if strings.Join(urls, " ") != strings.Join(expected, " ") {
+		t.Fatalf("unexpected urls %v, expected: %v", urls, expected)
+	}
+
+	if stats := sp.Stats(); !stats.Done || stats.Emitted != 2 || stats.Errors != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
 func TestPhishTankReader(t *testing.T) {
 	tt := []struct {
 		name           string
@@ -149,3 +192,280 @@ func TestPhishTankReader(t *testing.T) {
 	}
 
 }
+
+func TestOpenPhishProvider(t *testing.T) {
+	feeds := []string{
+		"http://test.com/a\nhttp://test.com/b\n",
+		"http://test.com/a\nhttp://test.com/b\nhttp://test.com/c\n",
+	}
+
+	var m sync.Mutex
+	var requests, notModified int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		feed := feeds[0]
+		if requests > 1 {
+			feed = feeds[1]
+		}
+		requests += 1
+
+		etag := fmt.Sprintf("%d", len(feed))
+		if r.Header.Get("If-None-Match") == etag {
+			notModified += 1
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Etag", etag)
+		fmt.Fprint(w, feed)
+	}))
+	defer ts.Close()
+
+	opp := kraaler.NewOpenPhishProviderWithConfig(kraaler.OpenPhishProviderConfig{
+		Endpoint:     ts.URL,
+		TickDuration: 50 * time.Millisecond,
+	})
+	defer opp.Close()
+
+	var urls []string
+loop:
+	for {
+		select {
+		case u := <-opp.UrlsC():
+			urls = append(urls, u.String())
+		case <-time.After(300 * time.Millisecond):
+			break loop
+		}
+	}
+
+	if len(urls) != 3 {
+		t.Fatalf("expected each url to be emitted once, but received: %v", urls)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if notModified == 0 {
+		t.Fatalf("expected unchanged feed to not be downloaded again")
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	var m sync.Mutex
+	var requests, unauthorized int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			unauthorized += 1
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		requests += 1
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			fmt.Fprint(w, `{"urls": [{"url": "http://test.com/a"}, {"url": "http://test.com/b"}], "next": "?page=2"}`)
+		case "2":
+			fmt.Fprint(w, `[{"url": "http://test.com/b"}, {"url": "http://test.com/c"}]`)
+		}
+	}))
+	defer ts.Close()
+
+	hp := kraaler.NewHTTPProvider(kraaler.HTTPProviderConfig{
+		Endpoint:     ts.URL,
+		Token:        "secret",
+		TickDuration: 50 * time.Millisecond,
+	})
+	defer hp.Close()
+
+	var urls []string
+loop:
+	for {
+		select {
+		case u := <-hp.UrlsC():
+			urls = append(urls, u.String())
+		case <-time.After(300 * time.Millisecond):
+			break loop
+		}
+	}
+
+	expected := []string{"http://test.com/a", "http://test.com/b", "http://test.com/c"}
+	if strings.Join(urls, " ") != strings.Join(expected, " ") {
+		t.Fatalf("unexpected urls %v, expected: %v", urls, expected)
+	}
+
+	if stats := hp.Stats(); stats.Errors == 0 {
+		t.Fatalf("expected failed poll to be counted as an error")
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if unauthorized != 0 {
+		t.Fatalf("expected every request to carry the bearer token")
+	}
+}
+
+type sourcedProvider struct {
+	kraaler.URLProvider
+	source string
+}
+
+func (sp sourcedProvider) Source(*url.URL) string { return sp.source }
+
+func TestMergeProviders(t *testing.T) {
+	fill := func(host string, n int) kraaler.URLProvider {
+		c := make(chan *url.URL, n)
+		for i := 0; i < n; i++ {
+			u, _ := url.Parse(fmt.Sprintf("http://%s/%d", host, i))
+			c <- u
+		}
+		close(c)
+
+		return kraaler.URLChanProvider{c}
+	}
+
+	mp := kraaler.MergeProviders(fill("a.com", 10), sourcedProvider{fill("b.com", 5), "feed"}, fill("c.com", 0))
+
+	counts := map[string]int{}
+	sources := map[string]int{}
+	done := make(chan struct{})
+	go func() {
+		for u := range mp.UrlsC() {
+			counts[u.Host] += 1
+			sources[mp.(kraaler.SourceProvider).Source(u)] += 1
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected merged provider to be closed once every provider is done")
+	}
+
+	if counts["a.com"] != 10 || counts["b.com"] != 5 {
+		t.Fatalf("unexpected urls (a.com: %d, b.com: %d), expected: (10, 5)", counts["a.com"], counts["b.com"])
+	}
+
+	if sources["feed"] != 5 {
+		t.Fatalf("expected urls of b.com to be attributed to their source, but received: %v", sources)
+	}
+}
+
+func TestWeightedProvider(t *testing.T) {
+	fill := func(host string, n int) kraaler.URLProvider {
+		c := make(chan *url.URL, n)
+		for i := 0; i < n; i++ {
+			u, _ := url.Parse(fmt.Sprintf("http://%s/%d", host, i))
+			c <- u
+		}
+		close(c)
+
+		return kraaler.URLChanProvider{c}
+	}
+
+	wp := kraaler.NewWeightedProvider(kraaler.WeightedProviderConfig{
+		Quotas: []kraaler.ProviderQuota{
+			{Provider: fill("domains.com", 100), Weight: 3},
+			{Provider: fill("phish.com", 100), Weight: 1},
+		},
+	})
+	defer wp.Close()
+
+	db, fn, err := getDB("kraaler-url-store-weighted")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	counts := map[string]int{}
+	us, err := store.NewURLStore(db, store.WithURLFilters(func(u *url.URL) bool {
+		counts[u.Host] += 1
+		return true
+	}))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	urls := wp.UrlsC()
+	for i := 0; i < 40; i++ {
+		if _, err := us.Add(<-urls); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+	}
+
+	if counts["domains.com"] != 30 || counts["phish.com"] != 10 {
+		t.Fatalf("unexpected mix of urls (domains.com: %d, phish.com: %d), expected: (30, 10)",
+			counts["domains.com"], counts["phish.com"])
+	}
+
+	if n := us.Size(); n != 40 {
+		t.Fatalf("expected store to contain 40 urls, but contained: %d", n)
+	}
+}
+
+func TestSitemapProvider(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>%s/pages.xml.gz</loc></sitemap>
+<sitemap><loc>%s/sitemap.xml</loc></sitemap>
+</sitemapindex>`, ts.URL, ts.URL)
+		case "/pages.xml.gz":
+			writer := gzip.NewWriter(w)
+			writer.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>http://test.com/a</loc></url>
+<url><loc>http://test.com/b</loc></url>
+<url><loc>http://test.com/c</loc></url>
+</urlset>`))
+			writer.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name           string
+		maxURLs        int
+		expectedAmount int
+	}{
+		{name: "nested compressed", expectedAmount: 3},
+		{name: "max urls", maxURLs: 2, expectedAmount: 2},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sp := kraaler.NewSitemapProvider(kraaler.SitemapProviderConfig{
+				Endpoint: ts.URL + "/sitemap.xml",
+				MaxURLs:  tc.maxURLs,
+			})
+			defer sp.Close()
+
+			var urls []*url.URL
+			for u := range sp.UrlsC() {
+				urls = append(urls, u)
+			}
+
+			if n := len(urls); n != tc.expectedAmount {
+				t.Fatalf("unexpected amount %d, expected: %d", n, tc.expectedAmount)
+			}
+
+			if stats := sp.Stats(); !stats.Done || stats.Emitted != tc.expectedAmount {
+				t.Fatalf("unexpected stats: %+v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Package query reads the pages stored by the store package from the
+// warehouse, such that users need not know its schema
+package query
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// SessionsByBodyHash returns the ids of the sessions with a response body
+// of the given SHA-256 hash (hex encoded), as bodies are deduplicated by
+// their hash this finds every page serving the same payload
+func SessionsByBodyHash(db *sql.DB, hash string) ([]int64, error) {
+	rows, err := db.Query(`select distinct a.session_id from fact_bodies b
+join fact_actions a on a.id = b.action_id
+where b.hash256 = ?
+order by a.session_id`, strings.ToLower(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// SessionSummary is a stored session, with URL being the URL of the page
+// requested and FinalURL the URL of the document it ended at, if known
+type SessionSummary struct {
+	ID          int64
+	URL         string
+	FinalURL    string
+	Resolution  string
+	Source      string
+	Navigated   time.Time
+	Loaded      time.Time
+	Terminated  time.Time
+	Actions     int
+	FinalStatus int
+	Error       string
+}
+
+const sessionSummaryQuery = `select s.id,
+(select u.url from fact_actions a join fact_urls u on u.action_id = a.id
+ where a.session_id = s.id order by a.id limit 1),
+s.final_url, r.resolution, src.source,
+s.navigated_time, s.loaded_time, s.terminated_time,
+s.amount_of_actions, s.final_status, s.error
+from fact_sessions s
+join dim_resolutions r on r.id = s.resolution_id
+left join dim_sources src on src.id = s.source_id`
+
+// SessionsByDomain returns the sessions which requested any resource from
+// domain or one of its subdomains, ordered as they were stored
+func SessionsByDomain(db *sql.DB, domain string) ([]SessionSummary, error) {
+	domain = likeEscaper.Replace(strings.ToLower(domain))
+	rows, err := db.Query(sessionSummaryQuery+`
+where s.id in (select a.session_id from fact_actions a
+ join fact_urls u on u.action_id = a.id
+ join dim_url_hosts h on h.id = u.host_id
+ where lower(h.host) like ? escape '\' or lower(h.host) like ? escape '\'
+ or lower(h.host) like ? escape '\' or lower(h.host) like ? escape '\')
+order by s.id`, domain, domain+":%", "%."+domain, "%."+domain+":%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []SessionSummary
+	for rows.Next() {
+		var s SessionSummary
+		var u, final, src, serr sql.NullString
+		var status sql.NullInt64
+		var nav, loaded, term int64
+		if err := rows.Scan(&s.ID, &u, &final, &s.Resolution, &src, &nav, &loaded, &term, &s.Actions, &status, &serr); err != nil {
+			return nil, err
+		}
+
+		s.URL, s.FinalURL, s.Source, s.Error = u.String, final.String, src.String, serr.String
+		s.FinalStatus = int(status.Int64)
+		s.Navigated, s.Loaded, s.Terminated = time.Unix(0, nav), time.Unix(0, loaded), time.Unix(0, term)
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// Action is a request made during a session, with ParentID being the id of
+// the action redirecting to it, zero if none
+type Action struct {
+	ID         int64
+	SessionID  int64
+	ParentID   int64
+	Method     string
+	URL        string
+	Protocol   string
+	Initiator  string
+	StatusCode int
+	StatusText string
+	RemoteIP   string
+	RemotePort int
+	Error      string
+	Warm       bool
+	FromCache  bool
+}
+
+// ActionsForSession returns the actions of the session in the order they
+// were made
+func ActionsForSession(db *sql.DB, id int64) ([]Action, error) {
+	rows, err := db.Query(`select a.id, a.session_id, a.parent_id, m.method, u.url,
+p.protocol, i.initiator, a.status_code, a.status_text,
+a.remote_ip, a.remote_port, e.error, a.warm, a.from_cache
+from fact_actions a
+join dim_methods m on m.id = a.method_id
+join dim_initiators i on i.id = a.initiator_id
+left join fact_urls u on u.action_id = a.id
+left join dim_protocols p on p.id = a.protocol_id
+left join dim_errors e on e.id = a.error_id
+where a.session_id = ?
+order by a.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []Action
+	for rows.Next() {
+		var a Action
+		var parent, status, port sql.NullInt64
+		var u, proto, text, ip, aerr sql.NullString
+		if err := rows.Scan(&a.ID, &a.SessionID, &parent, &a.Method, &u, &proto, &a.Initiator, &status, &text, &ip, &port, &aerr, &a.Warm, &a.FromCache); err != nil {
+			return nil, err
+		}
+
+		a.ParentID, a.StatusCode, a.RemotePort = parent.Int64, int(status.Int64), int(port.Int64)
+		a.URL, a.Protocol, a.StatusText, a.RemoteIP, a.Error = u.String, proto.String, text.String, ip.String, aerr.String
+		actions = append(actions, a)
+	}
+
+	return actions, rows.Err()
+}
+
+// Body is a stored response body, with Path being the file holding it when
+// stored on disk
+type Body struct {
+	ActionID       int64
+	SessionID      int64
+	URL            string
+	Hash256        string
+	BrowserMime    string
+	DeterminedMime string
+	Size           int
+	CompSize       int
+	Path           string
+}
+
+// BodiesByHash returns every response body of the given SHA-256 hash (hex
+// encoded), with the action serving it
+func BodiesByHash(db *sql.DB, hash string) ([]Body, error) {
+	rows, err := db.Query(`select b.action_id, a.session_id, u.url, b.hash256,
+bm.mime_type, dm.mime_type, b.org_size, b.comp_size, b.path
+from fact_bodies b
+join fact_actions a on a.id = b.action_id
+join dim_mime_types bm on bm.id = b.browser_mime_id
+join dim_mime_types dm on dm.id = b.determined_mime_id
+left join fact_urls u on u.action_id = a.id
+where b.hash256 = ?
+order by b.action_id`, strings.ToLower(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bodies []Body
+	for rows.Next() {
+		var b Body
+		var u, path sql.NullString
+		var comp sql.NullInt64
+		if err := rows.Scan(&b.ActionID, &b.SessionID, &u, &b.Hash256, &b.BrowserMime, &b.DeterminedMime, &b.Size, &comp, &path); err != nil {
+			return nil, err
+		}
+
+		b.URL, b.Path, b.CompSize = u.String, path.String, int(comp.Int64)
+		bodies = append(bodies, b)
+	}
+
+	return bodies, rows.Err()
+}
+
+// likeEscaper escapes the wildcards of patterns matched with like
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,214 @@
+package query_test
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/aau-network-security/kraaler/query"
+	"github.com/aau-network-security/kraaler/store"
+	"github.com/mafredri/cdp/protocol/network"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// storeDB is a warehouse in a temporary directory, with the given pages
+// stored in it
+func storeDB(t *testing.T, pages ...kraaler.Page) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "kraaler-query")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+
+	for _, sub := range []string{"bodies", "screenshots"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("unable to create dir: %s", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "kraaler.db"))
+	if err != nil {
+		t.Fatalf("unable to open db: %s", err)
+	}
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+
+	s, err := store.NewStore(db, filepath.Join(dir, "bodies"), filepath.Join(dir, "screenshots"))
+	if err != nil {
+		t.Fatalf("unable to create store: %s", err)
+	}
+
+	for _, p := range pages {
+		if err := s.SaveSession(p); err != nil {
+			cleanup()
+			t.Fatalf("unable to save session: %s", err)
+		}
+	}
+
+	return db, cleanup
+}
+
+func page(rawURL string, bodies ...string) kraaler.Page {
+	u, _ := url.Parse(rawURL)
+	p := kraaler.Page{
+		InitialURL:     u,
+		Resolution:     "800x600",
+		NavigateTime:   time.Now(),
+		LoadedTime:     time.Now(),
+		TerminatedTime: time.Now(),
+	}
+
+	for i, b := range bodies {
+		p.Actions = append(p.Actions, &kraaler.CrawlAction{
+			Request:  network.Request{URL: fmt.Sprintf("%s/%d", rawURL, i), Method: "GET", Headers: network.Headers("{}")},
+			Response: &network.Response{Status: 200, MimeType: "text/html", Headers: network.Headers("{}")},
+			Body:     &kraaler.ResponseBody{Body: []byte(b)},
+		})
+	}
+
+	return p
+}
+
+func TestSessionsByBodyHash(t *testing.T) {
+	kit := "<html><body><form action=login.php></form></body></html>"
+	db, cleanup := storeDB(t,
+		page("http://kit1.dk", kit, "one"),
+		page("http://other.dk", "other"),
+		page("http://kit2.dk", "two", kit),
+	)
+	defer cleanup()
+
+	hash := fmt.Sprintf("%X", sha256.Sum256([]byte(kit)))
+	ids, err := query.SessionsByBodyHash(db, hash)
+	if err != nil {
+		t.Fatalf("unable to query sessions: %s", err)
+	}
+
+	// sessions are numbered in the order they were stored
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatalf("expected the two sessions sharing the body, but received: %v", ids)
+	}
+
+	ids, err = query.SessionsByBodyHash(db, fmt.Sprintf("%x", sha256.Sum256([]byte("unknown"))))
+	if err != nil {
+		t.Fatalf("unable to query sessions: %s", err)
+	}
+
+	if len(ids) != 0 {
+		t.Fatalf("expected no sessions of unknown body, but received: %v", ids)
+	}
+}
+
+func TestSessionsByDomain(t *testing.T) {
+	db, cleanup := storeDB(t,
+		page("http://aau.dk", "front"),
+		page("http://login.aau.dk:8080", "login"),
+		page("http://notaau.dk", "other"),
+	)
+	defer cleanup()
+
+	tt := []struct {
+		name   string
+		domain string
+		ids    []int64
+		urls   []string
+	}{
+		{name: "domain and subdomains", domain: "AAU.dk", ids: []int64{1, 2}, urls: []string{"http://aau.dk/0", "http://login.aau.dk:8080/0"}},
+		{name: "subdomain", domain: "login.aau.dk", ids: []int64{2}, urls: []string{"http://login.aau.dk:8080/0"}},
+		{name: "unknown", domain: "a_u.dk"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sessions, err := query.SessionsByDomain(db, tc.domain)
+			if err != nil {
+				t.Fatalf("unable to query sessions: %s", err)
+			}
+
+			if len(sessions) != len(tc.ids) {
+				t.Fatalf("expected %d session(s), but received: %d", len(tc.ids), len(sessions))
+			}
+
+			for i, s := range sessions {
+				if s.ID != tc.ids[i] || s.URL != tc.urls[i] {
+					t.Fatalf("expected session %d (%s), but received: %d (%s)", tc.ids[i], tc.urls[i], s.ID, s.URL)
+				}
+
+				if s.Resolution != "800x600" || s.Actions != 1 || s.Navigated.IsZero() {
+					t.Fatalf("unexpected session summary: %+v", s)
+				}
+			}
+		})
+	}
+}
+
+func TestActionsForSession(t *testing.T) {
+	p := page("http://aau.dk", "redirect", "landing")
+	p.Actions[1].Parent = p.Actions[0]
+	failed := "net::ERR_FAILED"
+	p.Actions[1].Error = &failed
+
+	db, cleanup := storeDB(t, page("http://other.dk", "other"), p)
+	defer cleanup()
+
+	actions, err := query.ActionsForSession(db, 2)
+	if err != nil {
+		t.Fatalf("unable to query actions: %s", err)
+	}
+
+	if len(actions) != 2 {
+		t.Fatalf("expected 2 actions, but received: %d", len(actions))
+	}
+
+	first, second := actions[0], actions[1]
+	if first.SessionID != 2 || first.Method != "GET" || first.URL != "http://aau.dk/0" || first.StatusCode != 200 {
+		t.Fatalf("unexpected first action: %+v", first)
+	}
+
+	if second.ParentID != first.ID || second.Error != failed {
+		t.Fatalf("expected second action to be redirected by the first and failed, but was: %+v", second)
+	}
+
+	actions, err = query.ActionsForSession(db, 3)
+	if err != nil {
+		t.Fatalf("unable to query actions: %s", err)
+	}
+
+	if len(actions) != 0 {
+		t.Fatalf("expected no actions of unknown session, but received: %d", len(actions))
+	}
+}
+
+func TestBodiesByHash(t *testing.T) {
+	kit := "<html><body><form action=login.php></form></body></html>"
+	db, cleanup := storeDB(t,
+		page("http://kit1.dk", kit),
+		page("http://kit2.dk", "other", kit),
+	)
+	defer cleanup()
+
+	hash := fmt.Sprintf("%X", sha256.Sum256([]byte(kit)))
+	bodies, err := query.BodiesByHash(db, hash)
+	if err != nil {
+		t.Fatalf("unable to query bodies: %s", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 bodies, but received: %d", len(bodies))
+	}
+
+	for i, u := range []string{"http://kit1.dk/0", "http://kit2.dk/1"} {
+		b := bodies[i]
+		if b.URL != u || b.SessionID != int64(i+1) || b.Size != len(kit) || b.BrowserMime != "text/html" {
+			t.Fatalf("unexpected body: %+v", b)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package kraaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	DefaultHostLookupTimeout     = 5 * time.Second
+	DefaultHostLookupConcurrency = 8
+)
+
+// ErrNoASN is returned by an ASNResolver when no autonomous system
+// announces an address
+var ErrNoASN = errors.New("address is not announced by any autonomous system")
+
+// ASN is the autonomous system announcing the address of a host
+type ASN struct {
+	Number uint32
+	Org    string
+}
+
+// ASNResolver looks up the autonomous system announcing an address, e.g.
+// using a local MaxMind database or the Team Cymru IP to ASN service
+type ASNResolver interface {
+	LookupASN(ctx context.Context, ip string) (ASN, error)
+}
+
+// HostResolver looks up the host information of several domains in
+// parallel, bounding every lookup by a timeout
+type HostResolver struct {
+	resolver    *net.Resolver
+	timeout     time.Duration
+	concurrency int
+	cache       *cache.Cache
+	reverseDNS  bool
+	asn         ASNResolver
+	nameServer  string
+}
+
+type HostResolverOpt func(*HostResolver)
+
+// WithResolver uses r rather than the default resolver for lookups
+func WithResolver(r *net.Resolver) HostResolverOpt {
+	return func(hr *HostResolver) {
+		hr.resolver = r
+	}
+}
+
+// WithLookupTimeout bounds the time spent looking up a single domain
+func WithLookupTimeout(d time.Duration) HostResolverOpt {
+	return func(hr *HostResolver) {
+		hr.timeout = d
+	}
+}
+
+// WithLookupConcurrency is the amount of domains looked up at a time
+func WithLookupConcurrency(n int) HostResolverOpt {
+	return func(hr *HostResolver) {
+		hr.concurrency = n
+	}
+}
+
+// WithReverseDNS looks up the PTR record of the address of every host
+func WithReverseDNS() HostResolverOpt {
+	return func(hr *HostResolver) {
+		hr.reverseDNS = true
+	}
+}
+
+// WithASNResolver looks up the autonomous system of the address of every
+// host using ar
+func WithASNResolver(ar ASNResolver) HostResolverOpt {
+	return func(hr *HostResolver) {
+		hr.asn = ar
+	}
+}
+
+// WithDNSRecords looks up the address records of every host, along with
+// their time to live, by querying the name server at addr (host:port)
+// directly, as the records are not exposed by the resolver
+func WithDNSRecords(addr string) HostResolverOpt {
+	return func(hr *HostResolver) {
+		hr.nameServer = addr
+	}
+}
+
+func NewHostResolver(opts ...HostResolverOpt) *HostResolver {
+	hr := &HostResolver{
+		resolver:    net.DefaultResolver,
+		timeout:     DefaultHostLookupTimeout,
+		concurrency: DefaultHostLookupConcurrency,
+		cache:       cache.New(2*time.Minute, 30*time.Second),
+	}
+
+	for _, opt := range opts {
+		opt(hr)
+	}
+
+	if hr.concurrency <= 0 {
+		hr.concurrency = 1
+	}
+
+	return hr
+}
+
+// Resolve looks up every distinct domain of domains which is not cached,
+// and returns the host information of each of them
+func (hr *HostResolver) Resolve(domains ...string) map[string]Host {
+	hosts := map[string]Host{}
+	var missing []string
+	for _, d := range domains {
+		if _, ok := hosts[d]; ok {
+			continue
+		}
+
+		if h, ok := hr.cache.Get(d); ok {
+			hosts[d] = h.(Host)
+			continue
+		}
+
+		// reserve the domain, such that it is looked up once
+		hosts[d] = Host{Domain: Domain(d)}
+		missing = append(missing, d)
+	}
+
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, hr.concurrency)
+	for _, d := range missing {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(d string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), hr.timeout)
+			defer cancel()
+
+			host, _ := GetHostInfoContext(ctx, hr.resolver, Domain(d))
+			hr.enrich(ctx, &host)
+			hr.lookupRecords(ctx, &host)
+			hr.cache.Set(d, host, cache.DefaultExpiration)
+
+			m.Lock()
+			hosts[d] = host
+			m.Unlock()
+		}(d)
+	}
+	wg.Wait()
+
+	return hosts
+}
+
+// enrich adds the PTR record and autonomous system of the address of h,
+// when enabled, failed lookups leave them empty
+func (hr *HostResolver) enrich(ctx context.Context, h *Host) {
+	ip := h.IPAddr()
+	if ip == "" {
+		return
+	}
+
+	if hr.reverseDNS {
+		if names, err := hr.resolver.LookupAddr(ctx, ip); err == nil && len(names) > 0 {
+			h.PTR = names[0]
+		}
+	}
+
+	if hr.asn != nil {
+		if asn, err := hr.asn.LookupASN(ctx, ip); err == nil {
+			h.ASN = asn
+		}
+	}
+}
+
+// lookupRecords adds the address records of h, when enabled, failed lookups
+// leave them empty
+func (hr *HostResolver) lookupRecords(ctx context.Context, h *Host) {
+	if hr.nameServer == "" {
+		return
+	}
+
+	records, err := LookupDNSRecords(ctx, hr.nameServer, string(h.Domain))
+	if err != nil || len(records) == 0 {
+		return
+	}
+
+	h.DNSRecords = records
+	h.NameServer = hr.nameServer
+}
+
+// CymruASNResolver looks up autonomous systems using the DNS interface of
+// the Team Cymru IP to ASN mapping service
+type CymruASNResolver struct {
+	Resolver *net.Resolver
+}
+
+func (cr CymruASNResolver) LookupASN(ctx context.Context, ip string) (ASN, error) {
+	r := cr.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ASN{}, fmt.Errorf("invalid address: %s", ip)
+	}
+
+	// the origin is formatted as "15169 | 8.8.8.0/24 | US | arin | 2014-03-14"
+	origin, err := lookupCymru(ctx, r, cymruOriginName(addr))
+	if err != nil {
+		return ASN{}, err
+	}
+
+	// addresses announced by several systems list each of them
+	num, err := strconv.ParseUint(strings.Fields(origin[0])[0], 10, 32)
+	if err != nil {
+		return ASN{}, err
+	}
+	asn := ASN{Number: uint32(num)}
+
+	// the description is formatted as "15169 | US | arin | 2000-03-30 | GOOGLE - Google LLC, US"
+	desc, err := lookupCymru(ctx, r, fmt.Sprintf("AS%d.asn.cymru.com", num))
+	if err == nil && len(desc) == 5 {
+		asn.Org = desc[4]
+	}
+
+	return asn, nil
+}
+
+// cymruOriginName is the name queried for the origin of addr
+func cymruOriginName(addr net.IP) string {
+	var labels []string
+	if v4 := addr.To4(); v4 != nil {
+		for i := len(v4) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(v4[i])))
+		}
+
+		return strings.Join(labels, ".") + ".origin.asn.cymru.com"
+	}
+
+	const hex = "0123456789abcdef"
+	for i := len(addr) - 1; i >= 0; i-- {
+		labels = append(labels, string(hex[addr[i]&0xf]), string(hex[addr[i]>>4]))
+	}
+
+	return strings.Join(labels, ".") + ".origin6.asn.cymru.com"
+}
+
+// lookupCymru returns the fields of the TXT record of name
+func lookupCymru(ctx context.Context, r *net.Resolver, name string) ([]string, error) {
+	txts, err := r.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(txts) == 0 {
+		return nil, ErrNoASN
+	}
+
+	fields := strings.Split(txts[0], "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	if fields[0] == "" {
+		return nil, ErrNoASN
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,384 @@
+package kraaler_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsRecords are the records answered by answeringResolver, txt and ptr
+// records by the name queried. Address queries are left unanswered when
+// stallAddrs is set.
+type dnsRecords struct {
+	a          [][4]byte
+	aaaa       [][16]byte
+	ns         []string
+	ptr        map[string]string
+	txt        map[string]string
+	cname      string
+	ttl        uint32
+	stallAddrs bool
+}
+
+// answeringResolver is a resolver using a dns server answering every
+// query with the given records
+func answeringResolver(t *testing.T, records dnsRecords) (*net.Resolver, func()) {
+	addr, stop := answeringServer(t, records)
+	return answeringResolverAt(addr), stop
+}
+
+// answeringResolverAt is a resolver using the dns server at addr
+func answeringResolverAt(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", addr)
+		},
+	}
+}
+
+// answeringServer is a dns server answering every query with the given
+// records, address records are answered for the target of cname if set
+func answeringServer(t *testing.T, records dnsRecords) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+
+	ttl := records.ttl
+	if ttl == 0 {
+		ttl = 60
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var p dnsmessage.Parser
+			hdr, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+
+			if records.stallAddrs && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA) {
+				continue
+			}
+
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: hdr.ID, Response: true, Authoritative: true})
+			b.EnableCompression()
+			b.StartQuestions()
+			b.Question(q)
+			b.StartAnswers()
+
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+			if records.cname != "" && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeAAAA) {
+				target := dnsmessage.MustNewName(records.cname)
+				b.CNAMEResource(rh, dnsmessage.CNAMEResource{CNAME: target})
+				rh.Name = target
+			}
+
+			switch q.Type {
+			case dnsmessage.TypeA:
+				for _, ip := range records.a {
+					b.AResource(rh, dnsmessage.AResource{A: ip})
+				}
+			case dnsmessage.TypeAAAA:
+				for _, ip := range records.aaaa {
+					b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: ip})
+				}
+			case dnsmessage.TypeNS:
+				for _, n := range records.ns {
+					b.NSResource(rh, dnsmessage.NSResource{NS: dnsmessage.MustNewName(n)})
+				}
+			case dnsmessage.TypePTR:
+				if n, ok := records.ptr[q.Name.String()]; ok {
+					b.PTRResource(rh, dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(n)})
+				}
+			case dnsmessage.TypeTXT:
+				if txt, ok := records.txt[q.Name.String()]; ok {
+					b.TXTResource(rh, dnsmessage.TXTResource{TXT: []string{txt}})
+				}
+			}
+
+			msg, err := b.Finish()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(msg, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String(), func() { conn.Close() }
+}
+
+func TestGetHostInfoContext(t *testing.T) {
+	r, stop := answeringResolver(t, dnsRecords{
+		a:    [][4]byte{{10, 0, 0, 1}, {10, 0, 0, 2}},
+		aaaa: [][16]byte{{0x20, 0x01, 0x0d, 0xb8, 15: 1}},
+		ns:   []string{"ns1.kraaler.test."},
+	})
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	h, err := kraaler.GetHostInfoContext(ctx, r, "multi.kraaler.test")
+	if err != nil {
+		t.Fatalf("unable to get host info: %s", err)
+	}
+
+	expected := map[string]bool{"10.0.0.1": true, "10.0.0.2": true, "2001:db8::1": true}
+	if len(h.IPAddrs) != len(expected) {
+		t.Fatalf("expected %d addresses, but received: %v", len(expected), h.IPAddrs)
+	}
+
+	for _, ip := range h.IPAddrs {
+		if !expected[ip] {
+			t.Fatalf("unexpected address: %s", ip)
+		}
+	}
+
+	if h.IPAddr() != h.IPAddrs[0] {
+		t.Fatalf("expected first address, but received: %s", h.IPAddr())
+	}
+
+	if len(h.NameServers) != 1 || h.NameServers[0] != "ns1.kraaler.test." {
+		t.Fatalf("unexpected name servers: %v", h.NameServers)
+	}
+}
+
+func TestGetHostInfoContextTimeout(t *testing.T) {
+	r, stop := answeringResolver(t, dnsRecords{
+		ns:         []string{"ns1.kraaler.test."},
+		stallAddrs: true,
+	})
+	defer stop()
+
+	timeout := 200 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	h, err := kraaler.GetHostInfoContext(ctx, r, "stalled.kraaler.test")
+	if err != kraaler.ErrHostLookupTimeout {
+		t.Fatalf("expected lookup to time out, but received: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Fatalf("expected lookup to give up within %s, but took: %s", 2*timeout, elapsed)
+	}
+
+	// name servers resolved before the timeout are kept
+	if h.Domain != "stalled.kraaler.test" || len(h.NameServers) != 1 || len(h.IPAddrs) != 0 {
+		t.Fatalf("unexpected partial host: %+v", h)
+	}
+}
+
+func TestHostResolverEnrich(t *testing.T) {
+	tt := []struct {
+		name   string
+		opts   []kraaler.HostResolverOpt
+		txt    map[string]string
+		ptr    string
+		asn    kraaler.ASN
+		remote bool
+	}{
+		{name: "disabled"},
+		{
+			name: "reverse dns",
+			opts: []kraaler.HostResolverOpt{kraaler.WithReverseDNS()},
+			ptr:  "web.kraaler.test.",
+		},
+		{
+			name:   "cymru",
+			opts:   []kraaler.HostResolverOpt{kraaler.WithReverseDNS()},
+			ptr:    "web.kraaler.test.",
+			asn:    kraaler.ASN{Number: 64500, Org: "KRAALER-TEST Kraaler Test, DK"},
+			remote: true,
+			txt: map[string]string{
+				"1.0.0.10.origin.asn.cymru.com.": "64500 64501 | 10.0.0.0/8 | DK | ripencc | 2020-01-01",
+				"AS64500.asn.cymru.com.":         "64500 | DK | ripencc | 2020-01-01 | KRAALER-TEST Kraaler Test, DK",
+			},
+		},
+		{
+			name:   "not announced",
+			remote: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, stop := answeringResolver(t, dnsRecords{
+				a:   [][4]byte{{10, 0, 0, 1}},
+				ptr: map[string]string{"1.0.0.10.in-addr.arpa.": "web.kraaler.test."},
+				txt: tc.txt,
+			})
+			defer stop()
+
+			opts := append([]kraaler.HostResolverOpt{kraaler.WithResolver(r)}, tc.opts...)
+			if tc.remote {
+				opts = append(opts, kraaler.WithASNResolver(kraaler.CymruASNResolver{Resolver: r}))
+			}
+
+			h := kraaler.NewHostResolver(opts...).Resolve("web.kraaler.test")["web.kraaler.test"]
+			if h.IPAddr() != "10.0.0.1" {
+				t.Fatalf("unexpected address of host: %s", h.IPAddr())
+			}
+
+			if h.PTR != tc.ptr {
+				t.Fatalf("expected ptr (%s), but received: %s", tc.ptr, h.PTR)
+			}
+
+			if h.ASN != tc.asn {
+				t.Fatalf("expected asn (%+v), but received: %+v", tc.asn, h.ASN)
+			}
+		})
+	}
+}
+
+// stalledResolver is a resolver using a dns server which never answers
+func stalledResolver(t *testing.T) (*net.Resolver, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err)
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+
+	return r, func() { conn.Close() }
+}
+
+func TestHostResolver(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	tt := []struct {
+		name        string
+		domains     []string
+		concurrency int
+		min         time.Duration
+		max         time.Duration
+	}{
+		{
+			name:        "parallel",
+			domains:     []string{"a.kraaler.test", "b.kraaler.test", "c.kraaler.test"},
+			concurrency: 3,
+			max:         2 * timeout,
+		},
+		{
+			name:        "duplicates",
+			domains:     []string{"a.kraaler.test", "a.kraaler.test", "a.kraaler.test"},
+			concurrency: 1,
+			max:         2 * timeout,
+		},
+		{
+			name:        "bounded",
+			domains:     []string{"a.kraaler.test", "b.kraaler.test"},
+			concurrency: 1,
+			min:         2 * timeout,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, stop := stalledResolver(t)
+			defer stop()
+
+			hr := kraaler.NewHostResolver(
+				kraaler.WithResolver(r),
+				kraaler.WithLookupTimeout(timeout),
+				kraaler.WithLookupConcurrency(tc.concurrency),
+			)
+
+			start := time.Now()
+			hosts := hr.Resolve(tc.domains...)
+			elapsed := time.Since(start)
+
+			if tc.max > 0 && elapsed > tc.max {
+				t.Fatalf("expected lookups to be done within %s, but took: %s", tc.max, elapsed)
+			}
+
+			if elapsed < tc.min {
+				t.Fatalf("expected lookups to take at least %s, but took: %s", tc.min, elapsed)
+			}
+
+			for _, d := range tc.domains {
+				h, ok := hosts[d]
+				if !ok {
+					t.Fatalf("expected host of %s", d)
+				}
+
+				if string(h.Domain) != d || len(h.IPAddrs) != 0 {
+					t.Fatalf("unexpected host of %s: %+v", d, h)
+				}
+			}
+
+			// lookups are cached, also when they failed
+			start = time.Now()
+			hr.Resolve(tc.domains...)
+			if elapsed := time.Since(start); elapsed > timeout/2 {
+				t.Fatalf("expected cached lookups, but took: %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestLookupDNSRecords(t *testing.T) {
+	addr, stop := answeringServer(t, dnsRecords{
+		a:     [][4]byte{{10, 0, 0, 1}},
+		aaaa:  [][16]byte{{0x20, 0x01, 0x0d, 0xb8, 15: 1}},
+		cname: "flux.kraaler.test.",
+		ttl:   30,
+	})
+	defer stop()
+
+	hr := kraaler.NewHostResolver(kraaler.WithResolver(answeringResolverAt(addr)), kraaler.WithDNSRecords(addr))
+	h := hr.Resolve("www.kraaler.test")["www.kraaler.test"]
+
+	if h.NameServer != addr {
+		t.Fatalf("expected records to be answered by %s, but was: %s", addr, h.NameServer)
+	}
+
+	expected := []kraaler.DNSRecord{
+		{Name: "www.kraaler.test.", Type: "CNAME", Value: "flux.kraaler.test.", TTL: 30},
+		{Name: "flux.kraaler.test.", Type: "A", Value: "10.0.0.1", TTL: 30},
+		{Name: "flux.kraaler.test.", Type: "AAAA", Value: "2001:db8::1", TTL: 30},
+	}
+
+	if len(h.DNSRecords) != len(expected) {
+		t.Fatalf("expected %d records, but received: %+v", len(expected), h.DNSRecords)
+	}
+
+	for i, r := range expected {
+		if h.DNSRecords[i] != r {
+			t.Fatalf("expected record %+v, but received: %+v", r, h.DNSRecords[i])
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package kraaler
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+const robotsMaxSize = 512 * 1024
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// robotsRules are the rules of the group matching our user agent, an empty
+// set of rules allows everything
+type robotsRules []robotsRule
+
+func (rr robotsRules) allowed(path string) bool {
+	allow, length := true, -1
+	for _, r := range rr {
+		if !r.pattern.MatchString(path) {
+			continue
+		}
+
+		// the longest matching rule wins, allow wins ties
+		if r.length > length || (r.length == length && r.allow) {
+			allow, length = r.allow, r.length
+		}
+	}
+
+	return allow
+}
+
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+
+	expr := "^" + strings.Replace(regexp.QuoteMeta(p), `\*`, ".*", -1)
+	if anchored {
+		expr += "$"
+	}
+
+	return regexp.MustCompile(expr)
+}
+
+// parseRobots reads the rules of a robots.txt which applies to the given user
+// agent, falling back to the rules for every agent (*)
+func parseRobots(r io.Reader, agent string) robotsRules {
+	agent = strings.ToLower(agent)
+
+	var specific, wildcard robotsRules
+	var foundSpecific bool
+	var inSpecific, inWildcard, inRules bool
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			// consecutive user agent lines share the rules which follow them
+			if inRules {
+				inSpecific, inWildcard, inRules = false, false, false
+			}
+
+			ua := strings.ToLower(value)
+			switch {
+			case ua == "*":
+				inWildcard = true
+			case ua != "" && strings.Contains(agent, ua):
+				inSpecific, foundSpecific = true, true
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+
+			rule := robotsRule{
+				allow:   key == "allow",
+				length:  len(value),
+				pattern: robotsPattern(value),
+			}
+
+			if inSpecific {
+				specific = append(specific, rule)
+			}
+
+			if inWildcard {
+				wildcard = append(wildcard, rule)
+			}
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+
+	return wildcard
+}
+
+type RobotsCache struct {
+	agent  string
+	client *http.Client
+	rules  *cache.Cache
+}
+
+func NewRobotsCache(agent string) *RobotsCache {
+	return &RobotsCache{
+		agent:  agent,
+		client: &http.Client{Timeout: 5 * time.Second},
+		rules:  cache.New(time.Hour, 10*time.Minute),
+	}
+}
+
+func (rc *RobotsCache) get(u *url.URL) robotsRules {
+	origin := u.Scheme + "://" + u.Host
+	if r, ok := rc.rules.Get(origin); ok {
+		if rules, ok := r.(robotsRules); ok {
+			return rules
+		}
+	}
+
+	// robots.txt which cannot be retrieved allows everything
+	var rules robotsRules
+	resp, err := rc.client.Get(origin + "/robots.txt")
+	if err == nil {
+		if resp.StatusCode == http.StatusOK {
+			rules = parseRobots(io.LimitReader(resp.Body, robotsMaxSize), rc.agent)
+		}
+		resp.Body.Close()
+	}
+
+	rc.rules.Set(origin, rules, cache.DefaultExpiration)
+	return rules
+}
+
+// Allowed reports whether the robots.txt of the host of u allows crawling u
+func (rc *RobotsCache) Allowed(u *url.URL) bool {
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	return rc.get(u).allowed(path)
+}
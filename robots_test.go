@@ -0,0 +1,77 @@
+package kraaler_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+func TestRobotsCache(t *testing.T) {
+	var fetches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fetches += 1
+		fmt.Fprint(w, `# test robots
+User-agent: *
+Disallow: /
+
+User-agent: googlebot
+User-agent: kraaler
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+`)
+	}))
+	defer ts.Close()
+
+	tt := []struct {
+		name    string
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{name: "root", agent: "kraaler", path: "/", allowed: true},
+		{name: "disallowed", agent: "kraaler", path: "/private/page", allowed: false},
+		{name: "longest match", agent: "kraaler", path: "/private/public/page", allowed: true},
+		{name: "wildcard", agent: "kraaler", path: "/docs/report.pdf", allowed: false},
+		{name: "anchored", agent: "kraaler", path: "/docs/report.pdf.html", allowed: true},
+		{name: "any agent", agent: "other", path: "/page", allowed: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := kraaler.NewRobotsCache(tc.agent)
+			u, _ := url.Parse(ts.URL + tc.path)
+			if allowed := rc.Allowed(u); allowed != tc.allowed {
+				t.Fatalf("unexpected allowed (%t) for %s, expected: %t", allowed, tc.path, tc.allowed)
+			}
+		})
+	}
+
+	fetches = 0
+	rc := kraaler.NewRobotsCache("kraaler")
+	for _, p := range []string{"/a", "/b", "/private"} {
+		u, _ := url.Parse(ts.URL + p)
+		rc.Allowed(u)
+	}
+
+	if fetches != 1 {
+		t.Fatalf("expected robots.txt to be fetched once per host, but was fetched: %d times", fetches)
+	}
+
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	u, _ := url.Parse(missing.URL + "/anything")
+	if !rc.Allowed(u) {
+		t.Fatalf("expected missing robots.txt to allow everything")
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter is a set of strings which may report strings as members
+// which are not, but never the opposite
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// newBloomFilter sizes a filter for n members, reporting non-members as
+// members with a probability of fpRate
+func newBloomFilter(n uint, fpRate float64) *bloomFilter {
+	if n == 0 {
+		n = 1
+	}
+
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+
+	return &bloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hashes derives the k positions of s by double hashing
+func (bf *bloomFilter) hashes(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	a := h.Sum64()
+
+	h = fnv.New64()
+	h.Write([]byte(s))
+	b := h.Sum64() | 1
+
+	return a, b
+}
+
+func (bf *bloomFilter) add(s string) {
+	a, b := bf.hashes(s)
+	for i := uint64(0); i < bf.k; i++ {
+		pos := (a + i*b) % bf.m
+		bf.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+// test reports whether s might be a member
+func (bf *bloomFilter) test(s string) bool {
+	a, b := bf.hashes(s)
+	for i := uint64(0); i < bf.k; i++ {
+		pos := (a + i*b) % bf.m
+		if bf.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
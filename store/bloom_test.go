@@ -0,0 +1,31 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	n := 10000
+	bf := newBloomFilter(uint(n), 0.01)
+	for i := 0; i < n; i++ {
+		bf.add(fmt.Sprintf("https://%d.aau.dk", i))
+	}
+
+	for i := 0; i < n; i++ {
+		if s := fmt.Sprintf("https://%d.aau.dk", i); !bf.test(s) {
+			t.Fatalf("expected member to be reported: %s", s)
+		}
+	}
+
+	var positives int
+	for i := n; i < 2*n; i++ {
+		if bf.test(fmt.Sprintf("https://%d.aau.dk", i)) {
+			positives += 1
+		}
+	}
+
+	if rate := float64(positives) / float64(n); rate > 0.03 {
+		t.Fatalf("expected a false positive rate near 0.01, but was: %f", rate)
+	}
+}
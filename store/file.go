@@ -1,48 +1,76 @@
 package store
 
 import (
+	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/aau-network-security/kraaler"
+	"github.com/klauspost/compress/zstd"
 )
 
 var (
 	NotAllowedMimeErr = errors.New("mime type is not allowed to be stored")
+	CiphertextErr     = errors.New("ciphertext is too short")
+	ScreenFormatErr   = errors.New("screenshots can only be encoded as png or jpeg")
+	ScreenDecodeErr   = errors.New("screenshots can only be re-encoded from png or jpeg")
 )
 
+// Compressor wraps a writer, the returned writer must be closed to flush
+// the compressed output but does not close the underlying writer
 type Compressor interface {
-	NewWriter(io.Writer) (io.Writer, error)
+	NewWriter(io.Writer) (io.WriteCloser, error)
 	Ext() string
 }
 
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
 type noComp struct{}
 
-func (noComp) NewWriter(w io.Writer) (io.Writer, error) { return w, nil }
-func (noComp) Ext() string                              { return "" }
+func (noComp) NewWriter(w io.Writer) (io.WriteCloser, error) { return nopCloser{w}, nil }
+func (noComp) Ext() string                                   { return "" }
 
 var NoCompression = noComp{}
 
 type gzipComp struct{}
 
-func (gzipComp) NewWriter(w io.Writer) (io.Writer, error) {
+func (gzipComp) NewWriter(w io.Writer) (io.WriteCloser, error) {
 	return gzip.NewWriterLevel(w, flate.BestCompression)
 }
 func (gzipComp) Ext() string { return ".gz" }
 
 var GzipCompression = gzipComp{}
 
+type zstdComp struct{}
+
+func (zstdComp) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+}
+func (zstdComp) Ext() string { return ".zst" }
+
+var ZstdCompression = zstdComp{}
+
 type Hasher interface {
 	Sum([]byte) string
 	Name() string
@@ -77,13 +105,36 @@ func WithMimeTypes(types ...MimeValidator) FileStoreOpt {
 	}
 }
 
+// WithBrowserMimeTypes validates the mime type reported by the browser,
+// when known, instead of the sniffed mime type
+func WithBrowserMimeTypes() FileStoreOpt {
+	return func(fs *FileStore) {
+		fs.browserMime = true
+	}
+}
+
+// WithEncryption encrypts files using AES-GCM after compression, the key
+// must be 16, 24 or 32 bytes long
+func WithEncryption(key []byte) FileStoreOpt {
+	return func(fs *FileStore) {
+		fs.key = key
+	}
+}
+
+// BlobStore stores content such as response bodies, the path of the
+// returned StoredFile is the location of the content
+type BlobStore interface {
+	Store([]byte) (StoredFile, error)
+}
+
 type StoredFile struct {
-	HashType string
-	Hash     string
-	Path     string
-	OrgSize  int
-	CompSize int
-	MimeType string
+	HashType  string
+	Hash      string
+	Path      string
+	OrgSize   int
+	CompSize  int
+	MimeType  string
+	Encrypted bool
 }
 
 type FileStore struct {
@@ -91,6 +142,9 @@ type FileStore struct {
 	hasher      Hasher
 	rootDir     string
 	allowedMime []MimeValidator
+	browserMime bool
+	key         []byte
+	aead        cipher.AEAD
 	known       map[string]StoredFile
 }
 
@@ -107,9 +161,129 @@ func NewFileStore(root string, opts ...FileStoreOpt) (*FileStore, error) {
 		opt(&fs)
 	}
 
+	if fs.key != nil {
+		aead, err := newAEAD(fs.key)
+		if err != nil {
+			return nil, err
+		}
+		fs.aead = aead
+	}
+
+	if err := fs.index(); err != nil {
+		return nil, err
+	}
+
 	return &fs, nil
 }
 
+// index makes files stored by earlier runs known, so they are deduplicated
+// across restarts. Only files encoded like new files are considered.
+func (fs *FileStore) index() error {
+	if fs.rootDir == "" {
+		return nil
+	}
+
+	files, err := ioutil.ReadDir(fs.rootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	suffix := fs.comp.Ext()
+	if fs.aead != nil {
+		suffix += ".enc"
+	}
+
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+
+		rest := strings.TrimSuffix(name, suffix)
+		hash, ext := rest, ""
+		if i := strings.Index(rest, "."); i >= 0 {
+			hash, ext = rest[:i], rest[i:]
+		}
+
+		// files of other encodings are left, as the suffix of new files
+		// is empty when they are neither compressed nor encrypted
+		if encodedExt(ext) {
+			continue
+		}
+
+		fs.known[hash] = StoredFile{
+			HashType:  fs.hasher.Name(),
+			Hash:      hash,
+			Path:      filepath.Join(fs.rootDir, name),
+			CompSize:  int(fi.Size()),
+			MimeType:  mime.TypeByExtension(ext),
+			Encrypted: fs.aead != nil,
+		}
+	}
+
+	return nil
+}
+
+// encodedExt tells whether ext ends in the extension of a compression or
+// of encryption
+func encodedExt(ext string) bool {
+	for _, e := range []string{GzipCompression.Ext(), ZstdCompression.Ext(), ".enc"} {
+		if strings.HasSuffix(ext, e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// DecryptReader reads a file stored using WithEncryption and returns its
+// (still compressed) content
+func DecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ns := aead.NonceSize()
+	if len(data) < ns {
+		return nil, CiphertextErr
+	}
+
+	plain, err := aead.Open(nil, data[:ns], data[ns:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(plain), nil
+}
+
+// allowed reports whether content described by sf may be stored, given
+// the mime type reported by the browser
+func (fs *FileStore) allowed(sf StoredFile, browserMime string) bool {
+	if fs.browserMime && browserMime != "" {
+		return fs.mimeAllowed(browserMime)
+	}
+
+	return fs.mimeAllowed(sf.MimeType)
+}
+
 func (fs *FileStore) mimeAllowed(mimeType string) bool {
 	for _, f := range fs.allowedMime {
 		if f(mimeType) {
@@ -120,25 +294,52 @@ func (fs *FileStore) mimeAllowed(mimeType string) bool {
 	return false
 }
 
-func (fs *FileStore) Store(raw []byte) (StoredFile, error) {
-	hash := fs.hasher.Sum(raw)
-	mimeType := http.DetectContentType(raw)
-	storedf := StoredFile{
+// describe hashes and determines the mime type of raw without storing it
+func (fs *FileStore) describe(raw []byte) StoredFile {
+	return StoredFile{
 		HashType: fs.hasher.Name(),
-		Hash:     hash,
+		Hash:     fs.hasher.Sum(raw),
 		OrgSize:  len(raw),
-		MimeType: mimeType,
+		MimeType: http.DetectContentType(raw),
+	}
+}
+
+func (fs *FileStore) Store(raw []byte) (StoredFile, error) {
+	return fs.store(raw, "", fs.writeFile)
+}
+
+// StoreWithMime stores raw which the browser reported to be of browserMime
+func (fs *FileStore) StoreWithMime(raw []byte, browserMime string) (StoredFile, error) {
+	return fs.store(raw, browserMime, fs.writeFile)
+}
+
+func (fs *FileStore) writeFile(name string, data []byte) (string, error) {
+	path := filepath.Join(fs.rootDir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
 	}
 
+	return path, nil
+}
+
+// store encodes raw and hands it to write, which returns the location of the
+// written content
+func (fs *FileStore) store(raw []byte, browserMime string, write func(name string, data []byte) (string, error)) (StoredFile, error) {
+	storedf := fs.describe(raw)
+	hash, mimeType := storedf.Hash, storedf.MimeType
+
 	sendErr := func(err error) (StoredFile, error) {
 		return storedf, err
 	}
 
-	if !fs.mimeAllowed(mimeType) {
+	if !fs.allowed(storedf, browserMime) {
 		return sendErr(NotAllowedMimeErr)
 	}
 
-	if storedf, ok := fs.known[hash]; ok {
+	if known, ok := fs.known[hash]; ok {
+		storedf.Path = known.Path
+		storedf.CompSize = known.CompSize
+		storedf.Encrypted = known.Encrypted
 		return storedf, nil
 	}
 
@@ -149,33 +350,55 @@ func (fs *FileStore) Store(raw []byte) (StoredFile, error) {
 	}
 
 	filename += fs.comp.Ext()
-	absFilepath := filepath.Join(fs.rootDir, filename)
-	f, err := os.Create(absFilepath)
-	if err != nil {
-		return sendErr(err)
+	if fs.aead != nil {
+		filename += ".enc"
 	}
-	defer f.Close()
 
-	w, err := fs.comp.NewWriter(f)
+	data, err := fs.encode(raw)
 	if err != nil {
 		return sendErr(err)
 	}
-	storedf.Path = absFilepath
 
-	_, err = w.Write(raw)
+	path, err := write(filename, data)
 	if err != nil {
 		return sendErr(err)
 	}
+	storedf.Path = path
+	storedf.CompSize = len(data)
+	storedf.Encrypted = fs.aead != nil
+
+	fs.known[hash] = storedf
+
+	return storedf, nil
+}
 
-	fi, err := f.Stat()
+// encode compresses and, if enabled, encrypts raw
+func (fs *FileStore) encode(raw []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := fs.comp.NewWriter(&buf)
 	if err != nil {
-		return sendErr(err)
+		return nil, err
 	}
-	storedf.CompSize = int(fi.Size())
 
-	fs.known[hash] = storedf
+	if _, err := w.Write(raw); err != nil {
+		w.Close()
+		return nil, err
+	}
 
-	return storedf, nil
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if fs.aead == nil {
+		return buf.Bytes(), nil
+	}
+
+	nonce := make([]byte, fs.aead.NonceSize())
+	if _, err := crand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return fs.aead.Seal(nonce, nonce, buf.Bytes(), nil), nil
 }
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -205,15 +428,13 @@ func randStringOfLen(n int) string {
 	return string(b)
 }
 
-type ScreenshotStore struct {
-	rootDir string
-}
-
-func NewScreenshotStore(dir string) *ScreenshotStore {
-	return &ScreenshotStore{dir}
+// ScreenshotBlobStore stores screenshots and returns their location
+type ScreenshotBlobStore interface {
+	Store(s *kraaler.BrowserScreenshot, domain string) (string, error)
 }
 
-func (ss *ScreenshotStore) Store(s *kraaler.BrowserScreenshot, domain string) (string, error) {
+// screenshotName is the path of s relative to the root of a screenshot store
+func screenshotName(s *kraaler.BrowserScreenshot, domain string) (string, error) {
 	if s == nil {
 		return "", fmt.Errorf("screenshot cannot be nil")
 	}
@@ -230,12 +451,77 @@ func (ss *ScreenshotStore) Store(s *kraaler.BrowserScreenshot, domain string) (s
 		return "", fmt.Errorf("domain cannot be empty")
 	}
 
-	folder := filepath.Join(ss.rootDir, domain)
-	if err := os.MkdirAll(folder, os.ModePerm); err != nil {
+	return path.Join(domain, filename), nil
+}
+
+// encodeScreenshot re-encodes s as an image of format, leaving it as is
+// when already of the format
+func encodeScreenshot(s *kraaler.BrowserScreenshot, format string) (*kraaler.BrowserScreenshot, error) {
+	format = strings.ToLower(format)
+	if format == "" || format == strings.ToLower(s.Kind) {
+		return s, nil
+	}
+
+	// no decoder of webp is registered
+	if !decodableScreenshot(s.Kind) {
+		return nil, ScreenDecodeErr
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(s.Screenshot))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	default:
+		return nil, ScreenFormatErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := *s
+	encoded.Screenshot = buf.Bytes()
+	encoded.Kind = format
+
+	return &encoded, nil
+}
+
+// decodableScreenshot tells whether screenshots of format can be decoded
+// for them to be re-encoded
+func decodableScreenshot(format string) bool {
+	switch strings.ToLower(format) {
+	case "png", "jpeg":
+		return true
+	}
+
+	return false
+}
+
+type ScreenshotStore struct {
+	rootDir string
+}
+
+func NewScreenshotStore(dir string) *ScreenshotStore {
+	return &ScreenshotStore{dir}
+}
+
+func (ss *ScreenshotStore) Store(s *kraaler.BrowserScreenshot, domain string) (string, error) {
+	name, err := screenshotName(s, domain)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(ss.rootDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
 		return "", err
 	}
 
-	path := filepath.Join(folder, filename)
 	f, err := os.Create(path)
 	if err != nil {
 		return "", err
@@ -2,7 +2,9 @@ package store
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/aau-network-security/kraaler"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestFileStore(t *testing.T) {
@@ -23,9 +26,58 @@ func TestFileStore(t *testing.T) {
 
 	type checker func(StoredFile) error
 
+	gzipReader := func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+	zstdReader := func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }
+
+	key := bytes.Repeat([]byte{0x42}, 32)
+	decryptReader := func(r io.Reader) (io.Reader, error) {
+		dr, err := DecryptReader(r, key)
+		if err != nil {
+			return nil, err
+		}
+
+		return gzip.NewReader(dr)
+	}
+	encrypted := func(sf StoredFile) error {
+		if !sf.Encrypted {
+			return fmt.Errorf("expected file to be marked as encrypted")
+		}
+
+		if expected := Sha256Hasher.Sum([]byte(strings.Repeat("meow ", 100))); sf.Hash != expected {
+			return fmt.Errorf("expected hash of plaintext (%s), but got: %s", expected, sf.Hash)
+		}
+		return nil
+	}
+	roundTrips := func(newReader func(io.Reader) (io.Reader, error), expected string) checker {
+		return func(sf StoredFile) error {
+			f, err := os.Open(sf.Path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			r, err := newReader(f)
+			if err != nil {
+				return err
+			}
+
+			content, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+
+			if string(content) != expected {
+				return fmt.Errorf("unexpected content read back (expected: %d bytes): %d bytes", len(expected), len(content))
+			}
+
+			return nil
+		}
+	}
+
 	tt := []struct {
 		name   string
 		files  []string
+		mime   string
 		opts   []FileStoreOpt
 		checks []checker
 		amount int
@@ -35,15 +87,42 @@ func TestFileStore(t *testing.T) {
 		{name: "distinct", files: []string{"meow", "meow2"}, amount: 2},
 		{name: "compression",
 			opts:   []FileStoreOpt{WithCompression(GzipCompression)},
-			files:  []string{"meow meow meow"},
+			files:  []string{strings.Repeat("meow ", 100)},
+			amount: 1,
+			checks: []checker{lessThanOrg, roundTrips(gzipReader, strings.Repeat("meow ", 100))},
+		},
+		{name: "zstd compression",
+			opts:   []FileStoreOpt{WithCompression(ZstdCompression)},
+			files:  []string{strings.Repeat("meow ", 100)},
 			amount: 1,
-			checks: []checker{lessThanOrg},
+			checks: []checker{lessThanOrg, roundTrips(zstdReader, strings.Repeat("meow ", 100))},
+		},
+		{name: "encryption",
+			opts:   []FileStoreOpt{WithCompression(GzipCompression), WithEncryption(key)},
+			files:  []string{strings.Repeat("meow ", 100)},
+			amount: 1,
+			checks: []checker{encrypted, roundTrips(decryptReader, strings.Repeat("meow ", 100))},
 		},
 		{name: "conditional mime",
 			opts:   []FileStoreOpt{WithMimeTypes(func(s string) bool { return strings.HasPrefix(s, "text/html") })},
 			files:  []string{"meow", "<html></html>"},
 			amount: 1,
 		},
+		{name: "browser mime",
+			opts: []FileStoreOpt{
+				WithMimeTypes(func(s string) bool { return s == "application/json" }),
+				WithBrowserMimeTypes(),
+			},
+			mime:   "application/json",
+			files:  []string{`{"meow": true}`},
+			amount: 1,
+		},
+		{name: "sniffed mime",
+			opts:   []FileStoreOpt{WithMimeTypes(func(s string) bool { return s == "application/json" })},
+			mime:   "application/json",
+			files:  []string{`{"meow": true}`},
+			amount: 0,
+		},
 	}
 
 	for _, tc := range tt {
@@ -60,7 +139,7 @@ func TestFileStore(t *testing.T) {
 			}
 
 			for _, txt := range tc.files {
-				sf, err := fs.Store([]byte(txt))
+				sf, err := fs.StoreWithMime([]byte(txt), tc.mime)
 				if err != nil {
 					if err == NotAllowedMimeErr {
 						continue
@@ -89,6 +168,105 @@ func TestFileStore(t *testing.T) {
 	}
 }
 
+func TestFileStoreRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kraaler-filestore-restart")
+	if err != nil {
+		t.Fatalf("error when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	body := []byte(strings.Repeat("meow ", 100))
+	fs, err := NewFileStore(dir, WithCompression(GzipCompression))
+	if err != nil {
+		t.Fatalf("error when creating filestore: %s", err)
+	}
+
+	first, err := fs.Store(body)
+	if err != nil {
+		t.Fatalf("error when storing file: %s", err)
+	}
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(first.Path, past, past); err != nil {
+		t.Fatalf("unable to change file times: %s", err)
+	}
+
+	fs, err = NewFileStore(dir, WithCompression(GzipCompression))
+	if err != nil {
+		t.Fatalf("error when recreating filestore: %s", err)
+	}
+
+	second, err := fs.Store(body)
+	if err != nil {
+		t.Fatalf("error when storing file again: %s", err)
+	}
+
+	if second != first {
+		t.Fatalf("expected stored file to be known after restart (%+v), but got: %+v", first, second)
+	}
+
+	fi, err := os.Stat(first.Path)
+	if err != nil {
+		t.Fatalf("unable to stat stored file: %s", err)
+	}
+
+	if !fi.ModTime().Equal(past) {
+		t.Fatalf("expected stored file to not be rewritten")
+	}
+}
+
+func TestFileStoreRestartCompression(t *testing.T) {
+	tt := []struct {
+		name   string
+		before Compressor
+		after  Compressor
+	}{
+		{name: "gzip to none", before: GzipCompression, after: NoCompression},
+		{name: "zstd to none", before: ZstdCompression, after: NoCompression},
+		{name: "none to gzip", before: NoCompression, after: GzipCompression},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "kraaler-filestore-compression")
+			if err != nil {
+				t.Fatalf("error when creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			body := []byte("<html><body>" + strings.Repeat("meow ", 100) + "</body></html>")
+			fs, err := NewFileStore(dir, WithCompression(tc.before))
+			if err != nil {
+				t.Fatalf("error when creating filestore: %s", err)
+			}
+
+			first, err := fs.Store(body)
+			if err != nil {
+				t.Fatalf("error when storing file: %s", err)
+			}
+
+			fs, err = NewFileStore(dir, WithCompression(tc.after))
+			if err != nil {
+				t.Fatalf("error when recreating filestore: %s", err)
+			}
+
+			second, err := fs.Store(body)
+			if err != nil {
+				t.Fatalf("error when storing file again: %s", err)
+			}
+
+			if second.Path == first.Path {
+				t.Fatalf("expected file of other compression to be stored anew, but got: %s", second.Path)
+			}
+
+			ext := tc.after.Ext()
+			if ext == "" && encodedExt(second.Path) || !strings.HasSuffix(second.Path, ext) {
+				t.Fatalf("expected file compressed as %q, but got: %s", ext, second.Path)
+			}
+		})
+	}
+}
+
 func TestScreenshotStore(t *testing.T) {
 	tt := []struct {
 		name       string
@@ -101,6 +279,12 @@ func TestScreenshotStore(t *testing.T) {
 			Kind:       "png",
 			Taken:      time.Now(),
 		}},
+		{name: "webp", domain: "test.com", screenshot: kraaler.BrowserScreenshot{
+			Screenshot: []byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00"),
+			Resolution: kraaler.Resolution{800, 600},
+			Kind:       "webp",
+			Taken:      time.Now(),
+		}},
 	}
 
 	for _, tc := range tt {
@@ -152,6 +336,10 @@ func TestScreenshotStore(t *testing.T) {
 			if bytes.Compare(content, tc.screenshot.Screenshot) != 0 {
 				t.Fatalf("expected file to be stored directly without modification")
 			}
+
+			if tc.screenshot.Kind == "webp" && (len(content) < 12 || string(content[0:4]) != "RIFF" || string(content[8:12]) != "WEBP") {
+				t.Fatalf("expected stored file to have a webp header")
+			}
 		})
 	}
 }
@@ -7,6 +7,11 @@ create table if not exists dim_resolutions (
     resolution TEXT NOT NULL
 );
 
+create table if not exists dim_sources (
+    id INTEGER PRIMARY KEY,
+    source TEXT NOT NULL
+);
+
 create table if not exists fact_sessions (
     id INTEGER PRIMARY KEY,
     resolution_id INTEGER references dim_resolutions(id) NOT NULL,
@@ -14,8 +19,45 @@ create table if not exists fact_sessions (
     loaded_time INTEGER NOT NULL,
     terminated_time INTEGER NOT NULL,
     amount_of_actions INTEGER NOT NULL,
+    failed_request_count INTEGER NOT NULL DEFAULT 0,
+    blocked_request_count INTEGER NOT NULL DEFAULT 0,
+    failed_request_bytes INTEGER NOT NULL DEFAULT 0,
+    queue_wait_duration INTEGER NOT NULL DEFAULT 0,
+    setup_duration INTEGER NOT NULL DEFAULT 0,
+    navigate_duration INTEGER NOT NULL DEFAULT 0,
+    terminate_duration INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    likely_credential_form INTEGER NOT NULL DEFAULT 0,
+    tracker_request_count INTEGER NOT NULL DEFAULT 0,
+    set_cookie_count INTEGER NOT NULL DEFAULT 0,
+    set_cookie_bytes INTEGER NOT NULL DEFAULT 0,
+    source_id INTEGER references dim_sources(id),
+    final_status INTEGER,
+    redirect_hops INTEGER,
+    redirect_count INTEGER NOT NULL DEFAULT 0,
+    redirect_limit_exceeded INTEGER NOT NULL DEFAULT 0,
+    lifecycle_event TEXT,
+    lifecycle_timestamp REAL,
+    script_result TEXT,
+    script_exception TEXT,
+    click_selector TEXT,
+    click_x REAL,
+    click_y REAL,
+    egress_ip TEXT,
+    beforeunload_handler INTEGER NOT NULL DEFAULT 0,
+    unload_handler INTEGER NOT NULL DEFAULT 0,
+    final_url TEXT,
+    requested_scheme TEXT,
+    upgraded_scheme TEXT,
+    scheme_upgrade TEXT,
+    warm_error TEXT,
     error TEXT
 );
+
+create unique index if not exists dim_resolutions_key on dim_resolutions(resolution);
+create unique index if not exists dim_sources_key on dim_sources(source);
+create index if not exists fact_sessions_resolution_id on fact_sessions(resolution_id);
+create index if not exists fact_sessions_source_id on fact_sessions(source_id);
 `
 	consoleSchema = `
 create table if not exists dim_console_messages (
@@ -30,27 +72,224 @@ create table if not exists dim_javascript_origin (
     line INTEGER NOT NULL
 );
 
+create table if not exists dim_console_types (
+    id INTEGER PRIMARY KEY,
+    type TEXT NOT NULL
+);
+
+create table if not exists dim_console_levels (
+    id INTEGER PRIMARY KEY,
+    level TEXT NOT NULL
+);
+
 create table if not exists fact_console_output (
     session_id INTEGER references fact_sessions(id) NOT NULL,
     seq INTEGER NOT NULL,
     javascript_origin_id INTEGER NOT NULL,
+    type_id INTEGER references dim_console_types(id),
+    level_id INTEGER references dim_console_levels(id),
     msg_id INTEGER references dim_console_messages(id) NOT NULL
-);`
+);
+
+create table if not exists fact_console_args (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    seq INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    type_id INTEGER references dim_console_types(id) NOT NULL,
+    value TEXT NOT NULL
+);
+
+create unique index if not exists dim_console_messages_key on dim_console_messages(message);
+create unique index if not exists dim_javascript_origin_key on dim_javascript_origin(func, column, line);
+create unique index if not exists dim_console_types_key on dim_console_types(type);
+create unique index if not exists dim_console_levels_key on dim_console_levels(level);
+create index if not exists fact_console_output_session_id on fact_console_output(session_id);
+create index if not exists fact_console_args_session_id on fact_console_args(session_id);`
+
+	dialogSchema = `
+create table if not exists dim_dialog_types (
+    id INTEGER PRIMARY KEY,
+    type TEXT NOT NULL
+);
+
+create table if not exists fact_dialogs (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    seq INTEGER NOT NULL,
+    type_id INTEGER references dim_dialog_types(id) NOT NULL,
+    message TEXT NOT NULL,
+    opened_time INTEGER NOT NULL
+);
+
+create unique index if not exists dim_dialog_types_key on dim_dialog_types(type);
+create index if not exists fact_dialogs_session_id on fact_dialogs(session_id);`
+
+	permissionSchema = `
+create table if not exists dim_permissions (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+create table if not exists fact_permissions (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    seq INTEGER NOT NULL,
+    permission_id INTEGER references dim_permissions(id) NOT NULL,
+    api TEXT NOT NULL,
+    url TEXT NOT NULL,
+    requested_time INTEGER NOT NULL
+);
+
+create unique index if not exists dim_permissions_key on dim_permissions(name);
+create index if not exists fact_permissions_session_id on fact_permissions(session_id);
+create index if not exists fact_permissions_permission_id on fact_permissions(permission_id);`
+
+	formSchema = `
+create table if not exists fact_forms (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    seq INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    method TEXT NOT NULL,
+    inputs TEXT NOT NULL
+);
+
+create index if not exists fact_forms_session_id on fact_forms(session_id);`
+
+	webSocketSchema = `
+create table if not exists fact_websockets (
+    id INTEGER PRIMARY KEY,
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    action_id INTEGER references fact_actions(id),
+    url TEXT NOT NULL
+);
+
+create table if not exists fact_websocket_frames (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    websocket_id INTEGER references fact_websockets(id),
+    direction TEXT NOT NULL,
+    opcode INTEGER NOT NULL,
+    payload_length INTEGER NOT NULL,
+    timestamp REAL NOT NULL
+);
+
+create index if not exists fact_websockets_session_id on fact_websockets(session_id);
+create index if not exists fact_websocket_frames_websocket_id on fact_websocket_frames(websocket_id);`
+
+	performanceSchema = `
+create table if not exists dim_performance_metrics (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+create table if not exists fact_performance_metrics (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    metric_id INTEGER references dim_performance_metrics(id) NOT NULL,
+    value REAL NOT NULL
+);
+
+create unique index if not exists dim_performance_metrics_key on dim_performance_metrics(name);
+create index if not exists fact_performance_metrics_session_id on fact_performance_metrics(session_id);`
+
+	cookieSchema = `
+create table if not exists fact_cookie_stats (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    host TEXT NOT NULL,
+    cookie_count INTEGER NOT NULL,
+    cookie_bytes INTEGER NOT NULL
+);
+
+create table if not exists fact_cookies (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL,
+    domain TEXT NOT NULL,
+    path TEXT NOT NULL,
+    expires INTEGER,
+    secure BOOLEAN NOT NULL,
+    http_only BOOLEAN NOT NULL
+);
+
+create index if not exists fact_cookie_stats_session_id on fact_cookie_stats(session_id);
+create index if not exists fact_cookies_session_id on fact_cookies(session_id);`
+
+	traceSchema = `
+create table if not exists fact_traces (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    hash256 TEXT NOT NULL,
+    org_size INTEGER NOT NULL,
+    comp_size INTEGER,
+    encrypted BOOLEAN NOT NULL DEFAULT 0,
+    path TEXT NOT NULL
+);
+
+create index if not exists fact_traces_session_id on fact_traces(session_id);`
+
+	manifestSchema = `
+create table if not exists fact_manifests (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    url TEXT NOT NULL,
+    name TEXT,
+    short_name TEXT,
+    start_url TEXT,
+    hash256 TEXT,
+    path TEXT,
+    errors TEXT
+);
+
+create table if not exists fact_manifest_icons (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    seq INTEGER NOT NULL,
+    src TEXT NOT NULL,
+    sizes TEXT,
+    type TEXT
+);
+
+create index if not exists fact_manifests_session_id on fact_manifests(session_id);
+create index if not exists fact_manifest_icons_session_id on fact_manifest_icons(session_id);`
+
+	trackerSchema = `
+create table if not exists fact_trackers (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    domain TEXT NOT NULL,
+    request_count INTEGER NOT NULL
+);
+
+create index if not exists fact_trackers_session_id on fact_trackers(session_id);`
+
+	serviceWorkerSchema = `
+create table if not exists fact_service_workers (
+    session_id INTEGER references fact_sessions(id) NOT NULL,
+    scope_url TEXT NOT NULL,
+    script_url TEXT NOT NULL,
+    status TEXT
+);
+
+create index if not exists fact_service_workers_session_id on fact_service_workers(session_id);`
 
 	screenshotSchema = `
 create table if not exists fact_screenshots (
     session_id INTEGER references fact_sessions(id) NOT NULL,
     time_taken INTEGER NOT NULL,
-    path TEXT NOT NULL
-);`
+    path TEXT NOT NULL,
+    format TEXT NOT NULL DEFAULT 'png'
+);
+
+create index if not exists fact_screenshots_session_id on fact_screenshots(session_id);`
 
 	actionSchema = `
+create table if not exists dim_asns (
+    id INTEGER PRIMARY KEY,
+    asn INTEGER,
+    org TEXT,
+    ptr TEXT
+);
+
 create table if not exists dim_hosts (
     id INTEGER PRIMARY KEY,
     domain TEXT NOT NULL,
     tld TEXT NOT NULL,
     ipv4 TEXT NOT NULL,
-    nameservers TEXT NOT NULL
+    ip_addrs TEXT NOT NULL,
+    nameservers TEXT NOT NULL,
+    asn_id INTEGER references dim_asns(id)
 );
 
 create table if not exists dim_errors (
@@ -63,6 +302,11 @@ create table if not exists dim_methods (
     method TEXT NOT NULL
 );
 
+create table if not exists dim_priorities (
+    id INTEGER PRIMARY KEY,
+    priority TEXT NOT NULL
+);
+
 create table if not exists dim_protocols (
     id INTEGER PRIMARY KEY,
     protocol TEXT NOT NULL
@@ -81,9 +325,29 @@ create table if not exists fact_actions (
     protocol_id INTEGER references dim_procols(id),
     host_id INTEGER references dim_hosts(id),
     initiator_id INTEGER references dim_initiators(id) NOT NULL,
+    initiator_url TEXT,
     status_code INTEGER,
-    error_id INTEGER references dim_errors(id)
-);`
+    status_text TEXT,
+    remote_ip TEXT,
+    remote_port INTEGER,
+    priority_id INTEGER references dim_priorities(id),
+    render_blocking BOOLEAN NOT NULL DEFAULT 0,
+    error_id INTEGER references dim_errors(id),
+    warm BOOLEAN NOT NULL DEFAULT 0,
+    from_cache BOOLEAN NOT NULL DEFAULT 0,
+    proxy_cache TEXT
+);
+
+create unique index if not exists dim_asns_key on dim_asns(asn, org, ptr);
+create unique index if not exists dim_hosts_key on dim_hosts(domain, tld, ipv4, ip_addrs, nameservers, asn_id);
+create unique index if not exists dim_errors_key on dim_errors(error);
+create unique index if not exists dim_methods_key on dim_methods(method);
+create unique index if not exists dim_priorities_key on dim_priorities(priority);
+create unique index if not exists dim_protocols_key on dim_protocols(protocol);
+create unique index if not exists dim_initiators_key on dim_initiators(initiator);
+create index if not exists fact_actions_session_id on fact_actions(session_id);
+create index if not exists fact_actions_parent_id on fact_actions(parent_id);
+create index if not exists fact_actions_host_id on fact_actions(host_id);`
 
 	urlSchema = `
 create table if not exists dim_url_schemes (
@@ -125,7 +389,16 @@ create table if not exists fact_urls (
     fragment_id INTEGER references dim_url_fragments(id),
     raw_query_id INTEGER references dim_url_raw_queries(id),
     url TEXT NOT NULL
-);`
+);
+
+create unique index if not exists dim_url_schemes_key on dim_url_schemes(scheme);
+create unique index if not exists dim_url_users_key on dim_url_users(user);
+create unique index if not exists dim_url_hosts_key on dim_url_hosts(host);
+create unique index if not exists dim_url_paths_key on dim_url_paths(path);
+create unique index if not exists dim_url_fragments_key on dim_url_fragments(fragment);
+create unique index if not exists dim_url_raw_queries_key on dim_url_raw_queries(query);
+create index if not exists fact_urls_action_id on fact_urls(action_id);
+create index if not exists fact_urls_host_id on fact_urls(host_id);`
 
 	headerSchema = `
 create table if not exists dim_header_keys (
@@ -147,7 +420,12 @@ create table if not exists fact_response_headers (
 create table if not exists fact_request_headers (
     action_id INTEGER references fact_action(id) NOT NULL,
     header_keyvalue_id INTEGER references dim_header_keyvalues(id) NOT NULL
-);`
+);
+
+create unique index if not exists dim_header_keys_key on dim_header_keys(key);
+create unique index if not exists dim_header_keyvalues_key on dim_header_keyvalues(key_id, value);
+create index if not exists fact_response_headers_action_id on fact_response_headers(action_id);
+create index if not exists fact_request_headers_action_id on fact_request_headers(action_id);`
 
 	securitySchema = `
 create table if not exists dim_protocols (
@@ -185,7 +463,14 @@ create table if not exists fact_security_details (
     subject_name TEXT NOT NULL,
     valid_from INTEGER NOT NULL,
     valid_to INTEGER NOT NULL
-);`
+);
+
+create unique index if not exists dim_protocols_key on dim_protocols(protocol);
+create unique index if not exists dim_issuers_key on dim_issuers(issuer);
+create unique index if not exists dim_key_exchanges_key on dim_key_exchanges(key_exchange);
+create unique index if not exists dim_ciphers_key on dim_ciphers(cipher);
+create unique index if not exists dim_san_lists_key on dim_san_lists(list);
+create index if not exists fact_security_details_action_id on fact_security_details(action_id);`
 
 	bodySchema = `
 create table if not exists dim_mime_types (
@@ -199,15 +484,56 @@ create table if not exists fact_bodies (
     determined_mime_id INTEGER references dim_mime_types(id) NOT NULL,
     hash256 TEXT NOT NULL,
     org_size INTEGER NOT NULL,
+    encoded_size INTEGER,
     comp_size INTEGER,
-    path TEXT
-);`
+    charset TEXT,
+    storage TEXT,
+    encrypted BOOLEAN NOT NULL DEFAULT 0,
+    rendered BOOLEAN NOT NULL DEFAULT 0,
+    path TEXT,
+    data BLOB
+);
+
+create index if not exists fact_bodies_hash256 on fact_bodies(hash256);
+
+create unique index if not exists dim_mime_types_key on dim_mime_types(mime_type);
+create index if not exists fact_bodies_action_id on fact_bodies(action_id);`
 
 	postDataSchema = `
 create table if not exists fact_post_data (
     action_id INTEGER references fact_action(id) NOT NULL,
-    data TEXT NOT NULL
-);`
+    data BLOB NOT NULL
+);
+
+create index if not exists fact_post_data_action_id on fact_post_data(action_id);`
+
+	setCookieSchema = `
+create table if not exists fact_set_cookies (
+    action_id INTEGER references fact_action(id) NOT NULL,
+    name TEXT NOT NULL,
+    value TEXT NOT NULL,
+    domain TEXT,
+    path TEXT,
+    expires INTEGER,
+    max_age INTEGER,
+    secure BOOLEAN NOT NULL,
+    http_only BOOLEAN NOT NULL,
+    same_site TEXT
+);
+
+create index if not exists fact_set_cookies_action_id on fact_set_cookies(action_id);`
+
+	dnsSchema = `
+create table if not exists fact_dns (
+    action_id INTEGER references fact_action(id) NOT NULL,
+    name_server TEXT NOT NULL,
+    name TEXT NOT NULL,
+    type TEXT NOT NULL,
+    value TEXT NOT NULL,
+    ttl INTEGER NOT NULL
+);
+
+create index if not exists fact_dns_action_id on fact_dns(action_id);`
 
 	initiatorStackSchema = `
 create table if not exists fact_initiator_stack (
@@ -215,12 +541,94 @@ create table if not exists fact_initiator_stack (
     col INTEGER NOT NULL,
     line INTEGER NOT NULL,
     func TEXT
-);`
+);
+
+create index if not exists fact_initiator_stack_action_id on fact_initiator_stack(action_id);`
 
 	urlStoreSchema = `
 create table if not exists url_visits (
     id INTEGER PRIMARY KEY,
     url TEXT NOT NULL,
-    last_visit INTEGER
+    last_visit INTEGER,
+    depth INTEGER NOT NULL DEFAULT 0,
+    source TEXT,
+    failures INTEGER NOT NULL DEFAULT 0,
+    priority INTEGER NOT NULL DEFAULT 0
 );`
 )
+
+// addedColumns are the columns added to tables after their first release,
+// which are added to the tables of stores created by earlier versions. Not
+// null columns are given a default, as sqlite cannot add them otherwise.
+var addedColumns = map[string][]string{
+	"fact_sessions": {
+		"failed_request_count INTEGER NOT NULL DEFAULT 0",
+		"blocked_request_count INTEGER NOT NULL DEFAULT 0",
+		"failed_request_bytes INTEGER NOT NULL DEFAULT 0",
+		"queue_wait_duration INTEGER NOT NULL DEFAULT 0",
+		"setup_duration INTEGER NOT NULL DEFAULT 0",
+		"navigate_duration INTEGER NOT NULL DEFAULT 0",
+		"terminate_duration INTEGER NOT NULL DEFAULT 0",
+		"attempts INTEGER NOT NULL DEFAULT 1",
+		"likely_credential_form INTEGER NOT NULL DEFAULT 0",
+		"tracker_request_count INTEGER NOT NULL DEFAULT 0",
+		"set_cookie_count INTEGER NOT NULL DEFAULT 0",
+		"set_cookie_bytes INTEGER NOT NULL DEFAULT 0",
+		"source_id INTEGER references dim_sources(id)",
+		"final_status INTEGER",
+		"redirect_hops INTEGER",
+		"redirect_count INTEGER NOT NULL DEFAULT 0",
+		"redirect_limit_exceeded INTEGER NOT NULL DEFAULT 0",
+		"lifecycle_event TEXT",
+		"lifecycle_timestamp REAL",
+		"script_result TEXT",
+		"script_exception TEXT",
+		"click_selector TEXT",
+		"click_x REAL",
+		"click_y REAL",
+		"egress_ip TEXT",
+		"beforeunload_handler INTEGER NOT NULL DEFAULT 0",
+		"unload_handler INTEGER NOT NULL DEFAULT 0",
+		"final_url TEXT",
+		"requested_scheme TEXT",
+		"upgraded_scheme TEXT",
+		"scheme_upgrade TEXT",
+		"warm_error TEXT",
+	},
+	"fact_console_output": {
+		"type_id INTEGER references dim_console_types(id)",
+		"level_id INTEGER references dim_console_levels(id)",
+	},
+	"fact_screenshots": {
+		"format TEXT NOT NULL DEFAULT 'png'",
+	},
+	"dim_hosts": {
+		"ip_addrs TEXT NOT NULL DEFAULT ''",
+		"asn_id INTEGER references dim_asns(id)",
+	},
+	"fact_actions": {
+		"initiator_url TEXT",
+		"status_text TEXT",
+		"remote_ip TEXT",
+		"remote_port INTEGER",
+		"priority_id INTEGER references dim_priorities(id)",
+		"render_blocking BOOLEAN NOT NULL DEFAULT 0",
+		"warm BOOLEAN NOT NULL DEFAULT 0",
+		"from_cache BOOLEAN NOT NULL DEFAULT 0",
+		"proxy_cache TEXT",
+	},
+	"fact_bodies": {
+		"encoded_size INTEGER",
+		"charset TEXT",
+		"storage TEXT",
+		"encrypted BOOLEAN NOT NULL DEFAULT 0",
+		"rendered BOOLEAN NOT NULL DEFAULT 0",
+		"data BLOB",
+	},
+	"url_visits": {
+		"depth INTEGER NOT NULL DEFAULT 0",
+		"source TEXT",
+		"failures INTEGER NOT NULL DEFAULT 0",
+		"priority INTEGER NOT NULL DEFAULT 0",
+	},
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+var createTableRe = regexp.MustCompile(`^create table if not exists (\w+)`)
+
+// execSchema executes the statements of schema, adding the columns missing
+// from tables created by earlier versions (see addedColumns) before their
+// indexes are created. Unique indexes of tables already holding duplicate
+// rows are created as plain indexes, as the rows may be referenced.
+func execSchema(db *sql.DB, schema string) error {
+	for _, stmt := range strings.Split(schema, ";") {
+		stmt = strings.TrimSpace(stmt)
+		if stmt == "" {
+			continue
+		}
+
+		_, err := db.Exec(stmt)
+		if isConstraintErr(err) && strings.HasPrefix(stmt, "create unique index") {
+			_, err = db.Exec(strings.Replace(stmt, "create unique index", "create index", 1))
+		}
+		if err != nil {
+			return err
+		}
+
+		if m := createTableRe.FindStringSubmatch(stmt); m != nil {
+			if err := addColumns(db, m[1], addedColumns[m[1]]...); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// addColumns adds the columns of defs which are missing from table
+func addColumns(db *sql.DB, table string, defs ...string) error {
+	if len(defs) == 0 {
+		return nil
+	}
+
+	rows, err := db.Query(fmt.Sprintf("pragma table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cols := map[string]bool{}
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		cols[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, def := range defs {
+		name := strings.Fields(def)[0]
+		if cols[name] {
+			continue
+		}
+
+		if _, err := db.Exec(fmt.Sprintf("alter table %s add column %s", table, def)); err != nil {
+			return fmt.Errorf("unable to add column %s to %s: %s", name, table, err)
+		}
+	}
+
+	return nil
+}
+
+func isConstraintErr(err error) bool {
+	serr, ok := err.(sqlite3.Error)
+	return ok && serr.Code == sqlite3.ErrConstraint
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+type PageStoreConfig struct {
+	DB             *sql.DB
+	BodyPath       string
+	ScreenshotPath string
+	StoreOpts      []StoreOpt
+}
+
+type PageStoreFactory func(PageStoreConfig) (kraaler.PageStore, error)
+
+var (
+	pageStoresM sync.RWMutex
+	pageStores  = map[string]PageStoreFactory{}
+
+	samplersM sync.RWMutex
+	samplers  = map[string]Sampler{}
+)
+
+func init() {
+	RegisterPageStore("sqlite", func(conf PageStoreConfig) (kraaler.PageStore, error) {
+		return NewStore(conf.DB, conf.BodyPath, conf.ScreenshotPath, conf.StoreOpts...)
+	})
+
+	RegisterSampler("uni", UniformSampler())
+	RegisterSampler("pw", PairSampler(2000))
+	RegisterSampler("recency", RecencySampler(24*time.Hour))
+}
+
+// RegisterPageStore panics if called twice with the same name, similar to sql.Register
+func RegisterPageStore(name string, factory PageStoreFactory) {
+	pageStoresM.Lock()
+	defer pageStoresM.Unlock()
+
+	if factory == nil {
+		panic("store: page store factory is nil")
+	}
+
+	if _, dup := pageStores[name]; dup {
+		panic("store: RegisterPageStore called twice for page store " + name)
+	}
+
+	pageStores[name] = factory
+}
+
+func PageStores() []string {
+	pageStoresM.RLock()
+	defer pageStoresM.RUnlock()
+
+	var names []string
+	for name := range pageStores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func NewPageStore(conf PageStoreConfig, names ...string) (kraaler.PageStore, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("need one or more page stores")
+	}
+
+	var stores MultiStore
+	for _, name := range names {
+		pageStoresM.RLock()
+		factory, ok := pageStores[name]
+		pageStoresM.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown page store: %s", name)
+		}
+
+		ps, err := factory(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		stores = append(stores, ps)
+	}
+
+	if len(stores) == 1 {
+		return stores[0], nil
+	}
+
+	return stores, nil
+}
+
+// RegisterSampler panics if called twice with the same name, similar to sql.Register
+func RegisterSampler(name string, s Sampler) {
+	samplersM.Lock()
+	defer samplersM.Unlock()
+
+	if s == nil {
+		panic("store: sampler is nil")
+	}
+
+	if _, dup := samplers[name]; dup {
+		panic("store: RegisterSampler called twice for sampler " + name)
+	}
+
+	samplers[name] = s
+}
+
+func Samplers() []string {
+	samplersM.RLock()
+	defer samplersM.RUnlock()
+
+	var names []string
+	for name := range samplers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func LookupSampler(name string) (Sampler, error) {
+	samplersM.RLock()
+	defer samplersM.RUnlock()
+
+	s, ok := samplers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sampler: %s", name)
+	}
+
+	return s, nil
+}
+
+type MultiStore []kraaler.PageStore
+
+func (ms MultiStore) SaveSession(p kraaler.Page) error {
+	var firstErr error
+	for _, ps := range ms {
+		if err := ps.SaveSession(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// AcceptScreenshotFormat reports whether every store accepts screenshots
+// taken as format
+func (ms MultiStore) AcceptScreenshotFormat(format string) error {
+	for _, ps := range ms {
+		if sps, ok := ps.(kraaler.ScreenshotPageStore); ok {
+			if err := sps.AcceptScreenshotFormat(format); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
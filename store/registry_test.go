@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+type fakePageStore struct {
+	pages chan kraaler.Page
+}
+
+func (fps *fakePageStore) SaveSession(p kraaler.Page) error {
+	fps.pages <- p
+	return nil
+}
+
+type fakeWorker struct{}
+
+func (fakeWorker) Close() error {
+	return nil
+}
+
+func (fakeWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for r := range queue {
+		results <- kraaler.Page{InitialURL: r.Url}
+	}
+
+	return nil
+}
+
+func TestPageStoreRegistry(t *testing.T) {
+	fps := &fakePageStore{pages: make(chan kraaler.Page, 1)}
+	RegisterPageStore("fake", func(PageStoreConfig) (kraaler.PageStore, error) {
+		return fps, nil
+	})
+
+	if _, err := NewPageStore(PageStoreConfig{}, "unknown"); err == nil {
+		t.Fatalf("expected error for unknown page store")
+	}
+
+	ps, err := NewPageStore(PageStoreConfig{}, "fake")
+	if err != nil {
+		t.Fatalf("unable to create page store: %s", err)
+	}
+
+	db, fn, err := getDB("kraaler-registry-test")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := NewURLStore(db, WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("http://aau.dk")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:       us,
+			PageStore:      ps,
+			WorkerProducer: func() (kraaler.Worker, error) { return fakeWorker{}, nil },
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+	defer wc.Close()
+
+	if err := wc.AddWorker(); err != nil {
+		t.Fatalf("unable to add worker: %s", err)
+	}
+
+	select {
+	case p := <-fps.pages:
+		if p.InitialURL.String() != u.String() {
+			t.Fatalf("unexpected url (%s), expected: %s", p.InitialURL, u)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected session to be saved in registered page store")
+	}
+}
+
+func TestMultiStore(t *testing.T) {
+	a := &fakePageStore{pages: make(chan kraaler.Page, 1)}
+	b := &fakePageStore{pages: make(chan kraaler.Page, 1)}
+
+	ms := MultiStore{a, b}
+	if err := ms.SaveSession(kraaler.Page{}); err != nil {
+		t.Fatalf("unable to save session: %s", err)
+	}
+
+	for i, fps := range []*fakePageStore{a, b} {
+		if n := len(fps.pages); n != 1 {
+			t.Fatalf("expected store (index: %d) to receive one session, but received: %d", i, n)
+		}
+	}
+}
+
+func TestSamplerRegistry(t *testing.T) {
+	for _, name := range []string{"uni", "pw"} {
+		if _, err := LookupSampler(name); err != nil {
+			t.Fatalf("expected builtin sampler %s: %s", name, err)
+		}
+	}
+
+	if _, err := LookupSampler("unknown"); err == nil {
+		t.Fatalf("expected error for unknown sampler")
+	}
+
+	// samples the url of the greatest depth
+	var us *urlStore
+	RegisterSampler("deepest", func(urls map[*url.URL]*time.Time) *url.URL {
+		var deepest *url.URL
+		for u := range urls {
+			if deepest == nil || us.depths[u] > us.depths[deepest] {
+				deepest = u
+			}
+		}
+
+		return deepest
+	})
+
+	smpl, err := LookupSampler("deepest")
+	if err != nil {
+		t.Fatalf("unable to look up registered sampler: %s", err)
+	}
+
+	db, fn, err := getDB("kraaler-sampler-registry-test")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err = NewURLStore(db, WithSampler(smpl))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	shallow, _ := url.Parse("http://aau.dk/")
+	deep, _ := url.Parse("http://aau.dk/a/b")
+	us.AddWithDepth(0, shallow)
+	us.AddWithDepth(2, deep)
+
+	if u, err := us.Sample(); err != nil || u != deep {
+		t.Fatalf("expected registered sampler to sample %s, but sampled: %v (%v)", deep, u, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected registering a sampler twice to panic")
+		}
+	}()
+	RegisterSampler("deepest", UniformSampler())
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aau-network-security/kraaler"
+)
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+type s3Client struct {
+	conf S3Config
+	now  func() time.Time
+}
+
+func newS3Client(conf S3Config) (*s3Client, error) {
+	if conf.Endpoint == "" || conf.Bucket == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket must be given")
+	}
+
+	if conf.Region == "" {
+		conf.Region = "us-east-1"
+	}
+
+	if conf.Client == nil {
+		conf.Client = &http.Client{Timeout: time.Minute}
+	}
+
+	return &s3Client{conf: conf, now: time.Now}, nil
+}
+
+// put uploads data using a path-style request, which is supported by most
+// S3-compatible services, and returns the s3:// URL of the object
+func (c *s3Client) put(name string, data []byte, contentType string) (string, error) {
+	key := path.Join(c.conf.Prefix, name)
+	u := fmt.Sprintf("%s/%s/%s",
+		strings.TrimSuffix(c.conf.Endpoint, "/"),
+		c.conf.Bucket,
+		(&url.URL{Path: key}).EscapedPath(),
+	)
+
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	sum := sha256.Sum256(data)
+	signV4(req, hex.EncodeToString(sum[:]), c.conf.Region, c.conf.AccessKey, c.conf.SecretKey, c.now())
+
+	resp, err := c.conf.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unable to upload %s (%d): %s", key, resp.StatusCode, msg)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", c.conf.Bucket, key), nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 adds an AWS Signature Version 4 authorization to req, signing the
+// host and every header set on req
+func signV4(req *http.Request, payloadHash, region, accessKey, secretKey string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+
+	var keys []string
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var canonHeaders strings.Builder
+	for _, k := range keys {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(keys, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+
+	query := req.URL.Query()
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	sort.Strings(params)
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		uri,
+		strings.Join(params, "&"),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	reqHash := sha256.Sum256([]byte(canonReq))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, toSign)),
+	))
+}
+
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// S3Store stores content in an S3 bucket, it is hashed, compressed,
+// encrypted and filtered by mime type like the FileStore
+type S3Store struct {
+	fs     *FileStore
+	client *s3Client
+}
+
+func NewS3Store(conf S3Config, opts ...FileStoreOpt) (*S3Store, error) {
+	client, err := newS3Client(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := NewFileStore("", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Store{fs: fs, client: client}, nil
+}
+
+func (s *S3Store) Store(raw []byte) (StoredFile, error) {
+	return s.StoreWithMime(raw, "")
+}
+
+func (s *S3Store) StoreWithMime(raw []byte, browserMime string) (StoredFile, error) {
+	return s.fs.store(raw, browserMime, func(name string, data []byte) (string, error) {
+		return s.client.put(name, data, "application/octet-stream")
+	})
+}
+
+func (s *S3Store) describe(raw []byte) StoredFile {
+	return s.fs.describe(raw)
+}
+
+func (s *S3Store) allowed(sf StoredFile, browserMime string) bool {
+	return s.fs.allowed(sf, browserMime)
+}
+
+type S3ScreenshotStore struct {
+	client *s3Client
+}
+
+func NewS3ScreenshotStore(conf S3Config) (*S3ScreenshotStore, error) {
+	client, err := newS3Client(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3ScreenshotStore{client}, nil
+}
+
+func (ss *S3ScreenshotStore) Store(s *kraaler.BrowserScreenshot, domain string) (string, error) {
+	name, err := screenshotName(s, domain)
+	if err != nil {
+		return "", err
+	}
+
+	return ss.client.put(name, s.Screenshot, "image/"+strings.ToLower(s.Kind))
+}
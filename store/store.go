@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aau-network-security/kraaler"
@@ -16,42 +17,202 @@ import (
 	"golang.org/x/net/publicsuffix"
 )
 
-type sessStoreFunc func(*sql.Tx, *kraaler.Page) (interface{}, error)
-type actionStoreFunc func(*sql.Tx, *kraaler.CrawlAction) (interface{}, error)
+type sessStoreFunc func(*Tx, *kraaler.Page) (interface{}, error)
+type actionStoreFunc func(*Tx, *kraaler.CrawlAction) (interface{}, error)
 
+// Store stores pages in the warehouse. It is safe for concurrent use,
+// sessions are saved one transaction at a time such that the dimensions
+// cached by its stores stay consistent with the database
 type Store struct {
+	m       sync.Mutex
 	db      *sql.DB
 	session *SessionStore
 	action  *ActionStore
 	console *ConsoleStore
+	dialog  *DialogStore
+	perm    *PermissionStore
+	sworker *ServiceWorkerStore
+	form    *FormStore
+	tracker *TrackerStore
+	cookie  *CookieStore
+	socket  *WebSocketStore
+	perf    *PerformanceStore
 	screen  *ScreenStore
+	trace   *TraceStore
+	mfest   *ManifestStore
 }
 
-func NewStore(db *sql.DB, bodyPath, screenPath string) (*Store, error) {
+type storeConfig struct {
+	bodyOpts []BodyStoreOpt
+	comp     Compressor
+	key      []byte
+	s3       *S3Config
+	mimes    []MimeValidator
+	fsOpts   []FileStoreOpt
+	screen   []ScreenStoreOpt
+}
+
+type StoreOpt func(*storeConfig)
+
+// WithInlineBodySize stores response bodies smaller than size bytes in the
+// database rather than on disk
+func WithInlineBodySize(size int) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.bodyOpts = append(sc.bodyOpts, WithInlineBodies(size))
+	}
+}
+
+// WithBodyCompression compresses response bodies stored on disk using c,
+// defaults to GzipCompression
+func WithBodyCompression(c Compressor) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.comp = c
+	}
+}
+
+// WithBodyEncryption encrypts response bodies stored on disk using key
+func WithBodyEncryption(key []byte) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.key = key
+	}
+}
+
+// WithBodyMimeTypes only stores response bodies of which the mime type is
+// allowed by any of types, defaults to MimeIsText
+func WithBodyMimeTypes(types ...MimeValidator) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.mimes = types
+	}
+}
+
+// WithFileStoreOpts forwards opts to the store of response bodies, after
+// the options given by the other StoreOpts
+func WithFileStoreOpts(opts ...FileStoreOpt) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.fsOpts = append(sc.fsOpts, opts...)
+	}
+}
+
+// WithScreenshotFormat stores screenshots as format (png or jpeg), defaults
+// to the format they were taken in. Screenshots taken as webp cannot be
+// re-encoded, which is rejected by AcceptScreenshotFormat.
+func WithScreenshotFormat(format string) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.screen = append(sc.screen, WithScreenEncoding(format))
+	}
+}
+
+// WithS3 stores response bodies and screenshots in an S3 bucket instead of
+// the body and screenshot directories
+func WithS3(conf S3Config) StoreOpt {
+	return func(sc *storeConfig) {
+		sc.s3 = &conf
+	}
+}
+
+// NewStore stores pages in db, along with their response bodies in bodyPath
+// and screenshots in screenPath. Without options, only bodies of text mime
+// types are stored, gzip compressed
+func NewStore(db *sql.DB, bodyPath, screenPath string, opts ...StoreOpt) (*Store, error) {
+	conf := storeConfig{comp: GzipCompression, mimes: []MimeValidator{MimeIsText}}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+
 	ss, err := NewSessionStore(db)
 	if err != nil {
 		return nil, err
 	}
 
-	bodyS, err := NewFileStore(bodyPath,
-		WithCompression(GzipCompression),
-		WithMimeTypes(func(s string) bool { return strings.HasPrefix(s, "text/") }))
+	fsOpts := []FileStoreOpt{
+		WithCompression(conf.comp),
+		WithMimeTypes(conf.mimes...),
+	}
+	if conf.key != nil {
+		fsOpts = append(fsOpts, WithEncryption(conf.key))
+	}
+	fsOpts = append(fsOpts, conf.fsOpts...)
+
+	var bodyS BlobStore
+	var screenS ScreenshotBlobStore = NewScreenshotStore(screenPath)
+	if conf.s3 != nil {
+		bodyS, err = NewS3Store(*conf.s3, fsOpts...)
+		if err != nil {
+			return nil, err
+		}
 
+		screenS, err = NewS3ScreenshotStore(*conf.s3)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bodyS, err = NewFileStore(bodyPath, fsOpts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	as, err := NewActionStore(db, bodyS, conf.bodyOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	as, err := NewActionStore(db, bodyS)
+	cs, err := NewConsoleStore(db)
 	if err != nil {
 		return nil, err
 	}
 
-	cs, err := NewConsoleStore(db)
+	ds, err := NewDialogStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	pms, err := NewPermissionStore(db)
 	if err != nil {
 		return nil, err
 	}
 
-	scs, err := NewScreenStore(db, NewScreenshotStore(screenPath))
+	sws, err := NewServiceWorkerStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, err := NewFormStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	ts, err := NewTrackerStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	wss, err := NewWebSocketStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	cks, err := NewCookieStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	pfs, err := NewPerformanceStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	scs, err := NewScreenStore(db, screenS, conf.screen...)
+	if err != nil {
+		return nil, err
+	}
+
+	trs, err := NewTraceStore(db, bodyS)
+	if err != nil {
+		return nil, err
+	}
+
+	mfs, err := NewManifestStore(db, bodyS)
 	if err != nil {
 		return nil, err
 	}
@@ -61,12 +222,33 @@ func NewStore(db *sql.DB, bodyPath, screenPath string) (*Store, error) {
 		session: ss,
 		action:  as,
 		console: cs,
+		dialog:  ds,
+		perm:    pms,
+		sworker: sws,
+		form:    fs,
+		tracker: ts,
+		cookie:  cks,
+		socket:  wss,
+		perf:    pfs,
 		screen:  scs,
+		trace:   trs,
+		mfest:   mfs,
 	}, nil
 }
 
+// AcceptScreenshotFormat reports whether screenshots taken as format can be
+// stored in the screenshot format of the store
+func (s *Store) AcceptScreenshotFormat(format string) error {
+	return s.screen.AcceptScreenshotFormat(format)
+}
+
+// SaveSession saves the page in a single transaction, waiting for the
+// sessions saved by other callers to be committed first
 func (s *Store) SaveSession(cs kraaler.Page) error {
-	tx, err := s.db.Begin()
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	tx, err := Begin(s.db)
 	if err != nil {
 		return err
 	}
@@ -77,7 +259,25 @@ func (s *Store) SaveSession(cs kraaler.Page) error {
 		return err
 	}
 
-	err = s.action.Save(tx, id, cs.Actions)
+	acids, err := s.action.save(tx, id, cs.Actions)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := s.action.savePass(tx, id, cs.WarmActions, true); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if cs.RenderedHTML != nil && len(cs.Actions) > 0 {
+		if err := s.action.bodyStore.SaveRendered(tx, acids[cs.Actions[0]], cs.RenderedHTML); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	err = s.socket.Save(tx, id, acids, cs.WebSockets, cs.WebSocketFrames)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -89,110 +289,763 @@ func (s *Store) SaveSession(cs kraaler.Page) error {
 		return err
 	}
 
+	err = s.dialog.Save(tx, id, cs.Dialogs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.perm.Save(tx, id, cs.Permissions)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.sworker.Save(tx, id, cs.ServiceWorkers)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.form.Save(tx, id, cs.Forms)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.tracker.Save(tx, id, cs.Trackers)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.cookie.Save(tx, id, cs.SetCookies)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.cookie.SaveCookies(tx, id, cs.Cookies)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.perf.Save(tx, id, cs.PerformanceMetrics)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.trace.Save(tx, id, cs.Trace)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = s.mfest.Save(tx, id, cs.Manifest)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	dom, err := publicsuffix.EffectiveTLDPlusOne(cs.InitialURL.Host)
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	err = s.screen.Save(tx, id, dom, cs.Screenshots)
+	err = s.screen.Save(tx, id, dom, cs.Screenshots)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type SessionStore struct {
+	dimResolution *IDStore
+	dimSources    *IDStore
+}
+
+func NewSessionStore(db *sql.DB) (*SessionStore, error) {
+	if db != nil {
+		if err := execSchema(db, sessionSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SessionStore{
+		dimResolution: NewIDStore("dim_resolutions", cache.New(15*time.Minute, 15*time.Minute), "resolution"),
+		dimSources:    NewIDStore("dim_sources", cache.New(15*time.Minute, 15*time.Minute), "source"),
+	}, nil
+}
+
+func (ss *SessionStore) Save(tx *Tx, sess *kraaler.Page) (int64, error) {
+	phases := sess.Phases()
+	ins := WarehouseInserter{
+		"resolution_id": func(tx *Tx) (interface{}, error) {
+			id, err := ss.dimResolution.Get(tx, sess.Resolution)
+			if err != nil {
+				return nil, err
+			}
+
+			return id, nil
+		},
+		"source_id": func(tx *Tx) (interface{}, error) {
+			if sess.Source == "" {
+				return nil, nil
+			}
+
+			id, err := ss.dimSources.Get(tx, sess.Source)
+			if err != nil {
+				return nil, err
+			}
+
+			return id, nil
+		},
+		"navigated_time": func(tx *Tx) (interface{}, error) {
+			return sess.NavigateTime.UnixNano(), nil
+		},
+		"loaded_time": func(tx *Tx) (interface{}, error) {
+			return sess.LoadedTime.UnixNano(), nil
+		},
+		"terminated_time": func(tx *Tx) (interface{}, error) {
+			return sess.TerminatedTime.UnixNano(), nil
+		},
+		"amount_of_actions": func(tx *Tx) (interface{}, error) {
+			return len(sess.Actions), nil
+		},
+		"failed_request_count": func(tx *Tx) (interface{}, error) {
+			return sess.FailedRequests, nil
+		},
+		"blocked_request_count": func(tx *Tx) (interface{}, error) {
+			return sess.BlockedRequests, nil
+		},
+		"failed_request_bytes": func(tx *Tx) (interface{}, error) {
+			return sess.FailedRequestBytes, nil
+		},
+		"queue_wait_duration": func(tx *Tx) (interface{}, error) {
+			return int64(phases.QueueWait), nil
+		},
+		"setup_duration": func(tx *Tx) (interface{}, error) {
+			return int64(phases.Setup), nil
+		},
+		"navigate_duration": func(tx *Tx) (interface{}, error) {
+			return int64(phases.Navigate), nil
+		},
+		"terminate_duration": func(tx *Tx) (interface{}, error) {
+			return int64(phases.Terminate), nil
+		},
+		"likely_credential_form": func(tx *Tx) (interface{}, error) {
+			return sess.LikelyCredentialForm, nil
+		},
+		"set_cookie_count": func(tx *Tx) (interface{}, error) {
+			var n int
+			for _, s := range sess.SetCookies {
+				n += s.Count
+			}
+
+			return n, nil
+		},
+		"set_cookie_bytes": func(tx *Tx) (interface{}, error) {
+			var n int
+			for _, s := range sess.SetCookies {
+				n += s.Bytes
+			}
+
+			return n, nil
+		},
+		"tracker_request_count": func(tx *Tx) (interface{}, error) {
+			var n int
+			for _, c := range sess.Trackers {
+				n += c
+			}
+
+			return n, nil
+		},
+		"final_status": func(tx *Tx) (interface{}, error) {
+			if sess.FinalStatus == 0 {
+				return nil, nil
+			}
+
+			return sess.FinalStatus, nil
+		},
+		"redirect_hops": func(tx *Tx) (interface{}, error) {
+			if sess.FinalStatus == 0 {
+				return nil, nil
+			}
+
+			return sess.RedirectHops, nil
+		},
+		"click_selector": func(tx *Tx) (interface{}, error) {
+			if sess.Interaction == nil || sess.Interaction.Selector == "" {
+				return nil, nil
+			}
+
+			return sess.Interaction.Selector, nil
+		},
+		"click_x": func(tx *Tx) (interface{}, error) {
+			if sess.Interaction == nil {
+				return nil, nil
+			}
+
+			return sess.Interaction.X, nil
+		},
+		"click_y": func(tx *Tx) (interface{}, error) {
+			if sess.Interaction == nil {
+				return nil, nil
+			}
+
+			return sess.Interaction.Y, nil
+		},
+		"egress_ip": func(tx *Tx) (interface{}, error) {
+			if sess.EgressIP == "" {
+				return nil, nil
+			}
+
+			return sess.EgressIP, nil
+		},
+		"beforeunload_handler": func(tx *Tx) (interface{}, error) {
+			return sess.BeforeUnloadHandler, nil
+		},
+		"unload_handler": func(tx *Tx) (interface{}, error) {
+			return sess.UnloadHandler, nil
+		},
+		"redirect_count": func(tx *Tx) (interface{}, error) {
+			return sess.Redirects, nil
+		},
+		"redirect_limit_exceeded": func(tx *Tx) (interface{}, error) {
+			return sess.RedirectLimitExceeded, nil
+		},
+		"lifecycle_event": func(tx *Tx) (interface{}, error) {
+			if sess.LifecycleEvent == "" {
+				return nil, nil
+			}
+
+			return sess.LifecycleEvent, nil
+		},
+		"lifecycle_timestamp": func(tx *Tx) (interface{}, error) {
+			if sess.LifecycleEvent == "" {
+				return nil, nil
+			}
+
+			return sess.LifecycleTimestamp, nil
+		},
+		"final_url": func(tx *Tx) (interface{}, error) {
+			if sess.FinalURL == nil {
+				return nil, nil
+			}
+
+			return sess.FinalURL.String(), nil
+		},
+		"requested_scheme": func(tx *Tx) (interface{}, error) {
+			if sess.RequestedScheme == "" {
+				return nil, nil
+			}
+
+			return sess.RequestedScheme, nil
+		},
+		"upgraded_scheme": func(tx *Tx) (interface{}, error) {
+			if sess.UpgradedScheme == "" {
+				return nil, nil
+			}
+
+			return sess.UpgradedScheme, nil
+		},
+		"scheme_upgrade": func(tx *Tx) (interface{}, error) {
+			if sess.SchemeUpgrade == "" {
+				return nil, nil
+			}
+
+			return sess.SchemeUpgrade, nil
+		},
+		"script_result": func(tx *Tx) (interface{}, error) {
+			if sess.ScriptResult == "" {
+				return nil, nil
+			}
+
+			return sess.ScriptResult, nil
+		},
+		"script_exception": func(tx *Tx) (interface{}, error) {
+			if sess.ScriptException == "" {
+				return nil, nil
+			}
+
+			return sess.ScriptException, nil
+		},
+		"attempts": func(tx *Tx) (interface{}, error) {
+			if sess.Attempts == 0 {
+				return 1, nil
+			}
+
+			return sess.Attempts, nil
+		},
+		"warm_error": func(tx *Tx) (interface{}, error) {
+			if sess.WarmError == nil {
+				return nil, nil
+			}
+
+			return sess.WarmError.Error(), nil
+		},
+		"error": func(tx *Tx) (interface{}, error) {
+			if sess.Error == nil {
+				return nil, nil
+			}
+
+			return sess.Error.Error(), nil
+		},
+	}
+
+	id, err := ins.Store(tx, "fact_sessions")
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+type ConsoleStore struct {
+	dimMessages         *IDStore
+	dimJavaScriptOrigin *IDStore
+	dimTypes            *IDStore
+	dimLevels           *IDStore
+}
+
+func NewConsoleStore(db *sql.DB) (*ConsoleStore, error) {
+	if db != nil {
+		if err := execSchema(db, consoleSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ConsoleStore{
+		dimMessages:         NewIDStore("dim_console_messages", cache.New(10*time.Minute, 2*time.Minute), "message"),
+		dimJavaScriptOrigin: NewIDStore("dim_javascript_origin", nil, "func", "column", "line"),
+		dimTypes:            NewIDStore("dim_console_types", cache.New(10*time.Minute, 2*time.Minute), "type"),
+		dimLevels:           NewIDStore("dim_console_levels", cache.New(10*time.Minute, 2*time.Minute), "level"),
+	}, nil
+}
+
+func (cs *ConsoleStore) Save(tx *Tx, id int64, console []*kraaler.JavaScriptConsole) error {
+	cins := inserter{tx, GetInsertQuery("fact_console_output", "session_id", "seq", "javascript_origin_id", "type_id", "level_id", "msg_id"), true}
+	ains := inserter{tx, GetInsertQuery("fact_console_args", "session_id", "seq", "position", "type_id", "value"), true}
+	for i, c := range console {
+		jid, err := cs.dimJavaScriptOrigin.Get(tx, c.Function, c.Column, c.Line)
+		if err != nil {
+			return err
+		}
+
+		var tid interface{}
+		if c.Type != "" {
+			tid, err = cs.dimTypes.Get(tx, c.Type)
+			if err != nil {
+				return err
+			}
+		}
+
+		var lid interface{}
+		if c.Level != "" {
+			lid, err = cs.dimLevels.Get(tx, c.Level)
+			if err != nil {
+				return err
+			}
+		}
+
+		mid, err := cs.dimMessages.Get(tx, c.Msg)
+		if err != nil {
+			return err
+		}
+
+		if _, err := cins.Insert(id, i+1, jid, tid, lid, mid); err != nil {
+			return err
+		}
+
+		for pos, arg := range c.Args {
+			atid, err := cs.dimTypes.Get(tx, arg.Type)
+			if err != nil {
+				return err
+			}
+
+			if _, err := ains.Insert(id, i+1, pos+1, atid, arg.Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type DialogStore struct {
+	dimTypes *IDStore
+}
+
+func NewDialogStore(db *sql.DB) (*DialogStore, error) {
+	if db != nil {
+		if err := execSchema(db, dialogSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DialogStore{
+		dimTypes: NewIDStore("dim_dialog_types", cache.New(15*time.Minute, 15*time.Minute), "type"),
+	}, nil
+}
+
+func (ds *DialogStore) Save(tx *Tx, id int64, dialogs []*kraaler.JavaScriptDialog) error {
+	dins := inserter{tx, GetInsertQuery("fact_dialogs", "session_id", "seq", "type_id", "message", "opened_time"), true}
+	for i, d := range dialogs {
+		tid, err := ds.dimTypes.Get(tx, d.Kind)
+		if err != nil {
+			return err
+		}
+
+		if _, err := dins.Insert(id, i+1, tid, d.Message, d.Opened.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type PermissionStore struct {
+	dimPermissions *IDStore
+}
+
+func NewPermissionStore(db *sql.DB) (*PermissionStore, error) {
+	if db != nil {
+		if err := execSchema(db, permissionSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PermissionStore{
+		dimPermissions: NewIDStore("dim_permissions", cache.New(15*time.Minute, 15*time.Minute), "name"),
+	}, nil
+}
+
+func (ps *PermissionStore) Save(tx *Tx, id int64, requests []*kraaler.PermissionRequest) error {
+	pins := inserter{tx, GetInsertQuery("fact_permissions", "session_id", "seq", "permission_id", "api", "url", "requested_time"), true}
+	for i, r := range requests {
+		pid, err := ps.dimPermissions.Get(tx, r.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := pins.Insert(id, i+1, pid, r.API, r.URL, r.Requested.UnixNano()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type ServiceWorkerStore struct{}
+
+func NewServiceWorkerStore(db *sql.DB) (*ServiceWorkerStore, error) {
+	if db != nil {
+		if err := execSchema(db, serviceWorkerSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ServiceWorkerStore{}, nil
+}
+
+func (sws *ServiceWorkerStore) Save(tx *Tx, id int64, workers []*kraaler.ServiceWorker) error {
+	swins := inserter{tx, GetInsertQuery("fact_service_workers", "session_id", "scope_url", "script_url", "status"), true}
+	for _, w := range workers {
+		var status interface{}
+		if w.Status != "" {
+			status = w.Status
+		}
+
+		if _, err := swins.Insert(id, w.ScopeURL, w.ScriptURL, status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type FormStore struct{}
+
+func NewFormStore(db *sql.DB) (*FormStore, error) {
+	if db != nil {
+		if err := execSchema(db, formSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &FormStore{}, nil
+}
+
+func (fs *FormStore) Save(tx *Tx, id int64, forms []*kraaler.Form) error {
+	fins := inserter{tx, GetInsertQuery("fact_forms", "session_id", "seq", "action", "method", "inputs"), true}
+	for i, f := range forms {
+		var action string
+		if f.Action != nil {
+			action = f.Action.String()
+		}
+
+		var inputs []string
+		for _, in := range f.Inputs {
+			inputs = append(inputs, fmt.Sprintf("%s:%s", in.Type, in.Name))
+		}
+
+		if _, err := fins.Insert(id, i+1, action, f.Method, strings.Join(inputs, ",")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type TrackerStore struct{}
+
+func NewTrackerStore(db *sql.DB) (*TrackerStore, error) {
+	if db != nil {
+		if err := execSchema(db, trackerSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &TrackerStore{}, nil
+}
+
+func (ts *TrackerStore) Save(tx *Tx, id int64, trackers map[string]int) error {
+	var domains []string
+	for d := range trackers {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+
+	tins := inserter{tx, GetInsertQuery("fact_trackers", "session_id", "domain", "request_count"), true}
+	for _, d := range domains {
+		if _, err := tins.Insert(id, d, trackers[d]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type CookieStore struct{}
+
+func NewCookieStore(db *sql.DB) (*CookieStore, error) {
+	if db != nil {
+		if err := execSchema(db, cookieSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CookieStore{}, nil
+}
+
+func (cs *CookieStore) Save(tx *Tx, id int64, stats map[string]kraaler.CookieStats) error {
+	var hosts []string
+	for h := range stats {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+
+	cins := inserter{tx, GetInsertQuery("fact_cookie_stats", "session_id", "host", "cookie_count", "cookie_bytes"), true}
+	for _, h := range hosts {
+		if _, err := cins.Insert(id, h, stats[h].Count, stats[h].Bytes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveCookies stores the cookies of the browser after loading a page,
+// session cookies are stored without an expiry
+func (cs *CookieStore) SaveCookies(tx *Tx, id int64, cookies []*kraaler.Cookie) error {
+	cins := inserter{tx, GetInsertQuery("fact_cookies", "session_id", "name", "value", "domain", "path", "expires", "secure", "http_only"), true}
+	for _, c := range cookies {
+		var expires interface{}
+		if !c.Expires.IsZero() {
+			expires = c.Expires.UnixNano()
+		}
+
+		if _, err := cins.Insert(id, c.Name, c.Value, c.Domain, c.Path, expires, c.Secure, c.HTTPOnly); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type PerformanceStore struct {
+	dimMetrics *IDStore
+}
+
+func NewPerformanceStore(db *sql.DB) (*PerformanceStore, error) {
+	if db != nil {
+		if err := execSchema(db, performanceSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PerformanceStore{
+		dimMetrics: NewIDStore("dim_performance_metrics", cache.New(10*time.Minute, 2*time.Minute), "name"),
+	}, nil
+}
+
+func (ps *PerformanceStore) Save(tx *Tx, id int64, metrics map[string]float64) error {
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pins := inserter{tx, GetInsertQuery("fact_performance_metrics", "session_id", "metric_id", "value"), true}
+	for _, name := range names {
+		mid, err := ps.dimMetrics.Get(tx, name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := pins.Insert(id, mid, metrics[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TraceStore stores the traces of sessions as files of the blob store,
+// linked to the session in fact_traces
+type TraceStore struct {
+	fs BlobStore
+}
+
+func NewTraceStore(db *sql.DB, fs BlobStore) (*TraceStore, error) {
+	if db != nil {
+		if err := execSchema(db, traceSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &TraceStore{fs: fs}, nil
+}
+
+func (ts *TraceStore) Save(tx *Tx, id int64, trace []byte) error {
+	if len(trace) == 0 {
+		return nil
+	}
+
+	sf, err := ts.fs.Store(trace)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	tx.Commit()
+	var compSize interface{}
+	if sf.CompSize != 0 {
+		compSize = sf.CompSize
+	}
 
-	return nil
+	tins := inserter{tx, GetInsertQuery("fact_traces", "session_id", "hash256", "org_size", "comp_size", "encrypted", "path"), true}
+	_, err = tins.Insert(id, sf.Hash, sf.OrgSize, compSize, sf.Encrypted, sf.Path)
+	return err
 }
 
-type SessionStore struct {
-	dimResolution *IDStore
+// ManifestStore stores the web app manifests of pages, their raw content
+// in the store of response bodies
+type ManifestStore struct {
+	fs BlobStore
 }
 
-func NewSessionStore(db *sql.DB) (*SessionStore, error) {
+func NewManifestStore(db *sql.DB, fs BlobStore) (*ManifestStore, error) {
 	if db != nil {
-		if _, err := db.Exec(sessionSchema); err != nil {
+		if err := execSchema(db, manifestSchema); err != nil {
 			return nil, err
 		}
 	}
 
-	return &SessionStore{
-		dimResolution: NewIDStore("dim_resolutions", cache.New(15*time.Minute, 15*time.Minute), "resolution"),
-	}, nil
+	return &ManifestStore{fs: fs}, nil
 }
 
-func (ss *SessionStore) Save(tx *sql.Tx, sess *kraaler.Page) (int64, error) {
-	ins := WarehouseInserter{
-		"resolution_id": func(tx *sql.Tx) (interface{}, error) {
-			id, err := ss.dimResolution.Get(tx, sess.Resolution)
-			if err != nil {
-				return nil, err
-			}
+func (ms *ManifestStore) Save(tx *Tx, id int64, m *kraaler.WebManifest) error {
+	if m == nil {
+		return nil
+	}
 
-			return id, nil
-		},
-		"navigated_time": func(tx *sql.Tx) (interface{}, error) {
-			return sess.NavigateTime.UnixNano(), nil
-		},
-		"loaded_time": func(tx *sql.Tx) (interface{}, error) {
-			return sess.LoadedTime.UnixNano(), nil
-		},
-		"terminated_time": func(tx *sql.Tx) (interface{}, error) {
-			return sess.TerminatedTime.UnixNano(), nil
-		},
-		"amount_of_actions": func(tx *sql.Tx) (interface{}, error) {
-			return len(sess.Actions), nil
-		},
-		"error": func(tx *sql.Tx) (interface{}, error) {
-			if sess.Error == nil {
-				return nil, nil
-			}
+	var hash, path interface{}
+	if len(m.Raw) > 0 {
+		sf, err := ms.fs.Store(m.Raw)
+		if err != nil && err != NotAllowedMimeErr {
+			return err
+		}
 
-			return sess.Error.Error(), nil
-		},
+		hash = sf.Hash
+		if sf.Path != "" {
+			path = sf.Path
+		}
 	}
 
-	id, err := ins.Store(tx, "fact_sessions")
-	if err != nil {
-		return 0, err
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
 	}
 
-	return id, nil
-}
+	mins := inserter{tx, GetInsertQuery("fact_manifests", "session_id", "url", "name", "short_name", "start_url", "hash256", "path", "errors"), true}
+	if _, err := mins.Insert(id, m.URL, nullable(m.Name), nullable(m.ShortName), nullable(m.StartURL), hash, path, nullable(strings.Join(m.Errors, "\n"))); err != nil {
+		return err
+	}
 
-type ConsoleStore struct {
-	dimMessages         *IDStore
-	dimJavaScriptOrigin *IDStore
+	iins := inserter{tx, GetInsertQuery("fact_manifest_icons", "session_id", "seq", "src", "sizes", "type"), true}
+	for i, icon := range m.Icons {
+		if _, err := iins.Insert(id, i+1, icon.Src, nullable(icon.Sizes), nullable(icon.Type)); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func NewConsoleStore(db *sql.DB) (*ConsoleStore, error) {
+type WebSocketStore struct{}
+
+func NewWebSocketStore(db *sql.DB) (*WebSocketStore, error) {
 	if db != nil {
-		if _, err := db.Exec(consoleSchema); err != nil {
+		if err := execSchema(db, webSocketSchema); err != nil {
 			return nil, err
 		}
 	}
 
-	return &ConsoleStore{
-		dimMessages:         NewIDStore("dim_console_messages", cache.New(10*time.Minute, 2*time.Minute), "message"),
-		dimJavaScriptOrigin: NewIDStore("dim_javascript_origin", nil, "func", "column", "line"),
-	}, nil
+	return &WebSocketStore{}, nil
 }
 
-func (cs *ConsoleStore) Save(tx *sql.Tx, id int64, console []*kraaler.JavaScriptConsole) error {
-	cins := inserter{tx, GetInsertQuery("fact_console_output", "session_id", "seq", "javascript_origin_id", "msg_id"), true}
-	for i, c := range console {
-		jid, err := cs.dimJavaScriptOrigin.Get(tx, c.Function, c.Column, c.Line)
-		if err != nil {
-			return err
+// Save links each websocket to the stored action of its handshake, and
+// each frame to its websocket
+func (wss *WebSocketStore) Save(tx *Tx, id int64, acids map[*kraaler.CrawlAction]int64, sockets []*kraaler.WebSocket, frames []*kraaler.WebSocketFrame) error {
+	wsids := map[*kraaler.WebSocket]int64{}
+	wsins := inserter{tx, GetInsertQuery("fact_websockets", "session_id", "action_id", "url"), false}
+	for _, ws := range sockets {
+		var actionID interface{}
+		if aid, ok := acids[ws.Handshake]; ok {
+			actionID = aid
 		}
 
-		mid, err := cs.dimMessages.Get(tx, c.Msg)
+		wsid, err := wsins.Insert(id, actionID, ws.URL)
 		if err != nil {
 			return err
 		}
+		wsids[ws] = wsid
+	}
+
+	fins := inserter{tx, GetInsertQuery("fact_websocket_frames", "session_id", "websocket_id", "direction", "opcode", "payload_length", "timestamp"), true}
+	for _, f := range frames {
+		var wsid interface{}
+		if sid, ok := wsids[f.Socket]; ok {
+			wsid = sid
+		}
 
-		if _, err := cins.Insert(id, i+1, jid, mid); err != nil {
+		if _, err := fins.Insert(id, wsid, f.Direction, f.Opcode, f.PayloadLength, f.Timestamp); err != nil {
 			return err
 		}
 	}
@@ -201,28 +1054,66 @@ func (cs *ConsoleStore) Save(tx *sql.Tx, id int64, console []*kraaler.JavaScript
 }
 
 type ScreenStore struct {
-	ssStore *ScreenshotStore
+	ssStore ScreenshotBlobStore
+	format  string
+}
+
+type ScreenStoreOpt func(*ScreenStore)
+
+// WithScreenEncoding re-encodes screenshots as format (png or jpeg) before
+// they are stored, defaults to the format they were taken in
+func WithScreenEncoding(format string) ScreenStoreOpt {
+	return func(ss *ScreenStore) {
+		ss.format = strings.ToLower(format)
+	}
 }
 
-func NewScreenStore(db *sql.DB, ss *ScreenshotStore) (*ScreenStore, error) {
+func NewScreenStore(db *sql.DB, ss ScreenshotBlobStore, opts ...ScreenStoreOpt) (*ScreenStore, error) {
+	scs := &ScreenStore{ssStore: ss}
+	for _, opt := range opts {
+		opt(scs)
+	}
+
+	switch scs.format {
+	case "", "png", "jpeg":
+	default:
+		return nil, ScreenFormatErr
+	}
+
 	if db != nil {
-		if _, err := db.Exec(screenshotSchema); err != nil {
+		if err := execSchema(db, screenshotSchema); err != nil {
 			return nil, err
 		}
 	}
 
-	return &ScreenStore{ss}, nil
+	return scs, nil
+}
+
+// AcceptScreenshotFormat reports whether screenshots taken as format can be
+// stored, which is not the case when they must be re-encoded from webp
+func (ss *ScreenStore) AcceptScreenshotFormat(format string) error {
+	format = strings.ToLower(format)
+	if ss.format == "" || ss.format == format || decodableScreenshot(format) {
+		return nil
+	}
+
+	return fmt.Errorf("unable to store %s screenshots as %s: %s", format, ss.format, ScreenDecodeErr)
 }
 
-func (ss *ScreenStore) Save(tx *sql.Tx, id int64, urlstr string, screenshots []*kraaler.BrowserScreenshot) error {
-	sins := inserter{tx, GetInsertQuery("fact_screenshots", "session_id", "time_taken", "path"), true}
+func (ss *ScreenStore) Save(tx *Tx, id int64, urlstr string, screenshots []*kraaler.BrowserScreenshot) error {
+	sins := inserter{tx, GetInsertQuery("fact_screenshots", "session_id", "time_taken", "path", "format"), true}
 	for _, screen := range screenshots {
+		screen, err := encodeScreenshot(screen, ss.format)
+		if err != nil {
+			return err
+		}
+
 		path, err := ss.ssStore.Store(screen, urlstr)
 		if err != nil {
 			return err
 		}
 
-		if _, err := sins.Insert(id, screen.Taken.UnixNano(), path); err != nil {
+		if _, err := sins.Insert(id, screen.Taken.UnixNano(), path, strings.ToLower(screen.Kind)); err != nil {
 			return err
 		}
 	}
@@ -236,17 +1127,21 @@ type ActionStore struct {
 	bodyStore           *BodyStore
 	securityStore       *SecurityStore
 	postDataStore       *PostDataStore
+	setCookieStore      *SetCookieStore
+	dnsStore            *DNSStore
 	initiatorStackStore *InitiatorStackStore
 
 	dimMethod     *IDStore
 	dimProto      *IDStore
 	dimHosts      *IDStore
+	dimASNs       *IDStore
 	dimInitiators *IDStore
 	dimErrors     *IDStore
+	dimPriorities *IDStore
 }
 
-func NewActionStore(db *sql.DB, fs *FileStore) (*ActionStore, error) {
-	if _, err := db.Exec(actionSchema); err != nil {
+func NewActionStore(db *sql.DB, fs BlobStore, opts ...BodyStoreOpt) (*ActionStore, error) {
+	if err := execSchema(db, actionSchema); err != nil {
 		return nil, err
 	}
 
@@ -260,7 +1155,7 @@ func NewActionStore(db *sql.DB, fs *FileStore) (*ActionStore, error) {
 		return nil, err
 	}
 
-	bs, err := NewBodyStore(db, fs)
+	bs, err := NewBodyStore(db, fs, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +1165,16 @@ func NewActionStore(db *sql.DB, fs *FileStore) (*ActionStore, error) {
 		return nil, err
 	}
 
+	scs, err := NewSetCookieStore(db)
+	if err != nil {
+		return nil, err
+	}
+
+	dns, err := NewDNSStore(db)
+	if err != nil {
+		return nil, err
+	}
+
 	iss, err := NewInitiatorStackStore(db)
 	if err != nil {
 		return nil, err
@@ -286,23 +1191,52 @@ func NewActionStore(db *sql.DB, fs *FileStore) (*ActionStore, error) {
 		bodyStore:           bs,
 		securityStore:       ss,
 		postDataStore:       pds,
+		setCookieStore:      scs,
+		dnsStore:            dns,
 		initiatorStackStore: iss,
 
 		dimMethod:     NewIDStore("dim_methods", cache.New(15*time.Minute, 15*time.Minute), "method"),
 		dimProto:      NewIDStore("dim_protocols", cache.New(15*time.Minute, 15*time.Minute), "protocol"),
-		dimHosts:      NewIDStore("dim_hosts", cache.New(time.Minute, 10*time.Minute), "domain", "tld", "ipv4", "nameservers"),
+		dimHosts:      NewIDStore("dim_hosts", cache.New(time.Minute, 10*time.Minute), "domain", "tld", "ipv4", "ip_addrs", "nameservers", "asn_id"),
+		dimASNs:       NewIDStore("dim_asns", cache.New(time.Minute, 10*time.Minute), "asn", "org", "ptr"),
 		dimInitiators: NewIDStore("dim_initiators", cache.New(15*time.Minute, 15*time.Minute), "initiator"),
 		dimErrors:     NewIDStore("dim_errors", nil, "error"),
+		dimPriorities: NewIDStore("dim_priorities", cache.New(15*time.Minute, 15*time.Minute), "priority"),
 	}, nil
 }
 
-func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction) error {
+func (as *ActionStore) Save(tx *Tx, id int64, actions []*kraaler.CrawlAction) error {
+	_, err := as.save(tx, id, actions)
+	return err
+}
+
+// save stores the actions and returns the id of each stored action
+func (as *ActionStore) save(tx *Tx, id int64, actions []*kraaler.CrawlAction) (map[*kraaler.CrawlAction]int64, error) {
+	return as.savePass(tx, id, actions, false)
+}
+
+// savePass stores the actions of either the first or the warm visit
+// of the session
+func (as *ActionStore) savePass(tx *Tx, id int64, actions []*kraaler.CrawlAction, warm bool) (map[*kraaler.CrawlAction]int64, error) {
 	acids := map[*kraaler.CrawlAction]int64{}
-	actionFuncs := map[string]func(*sql.Tx, *kraaler.CrawlAction) (interface{}, error){
-		"session_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+	actionFuncs := map[string]func(*Tx, *kraaler.CrawlAction) (interface{}, error){
+		"session_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			return id, nil
 		},
-		"method_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"warm": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			return warm, nil
+		},
+		"from_cache": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			return a.FromCache, nil
+		},
+		"proxy_cache": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			if a.ProxyCache == "" {
+				return nil, nil
+			}
+
+			return a.ProxyCache, nil
+		},
+		"method_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			id, err := as.dimMethod.Get(tx, a.Request.Method)
 			if err != nil {
 				return nil, err
@@ -310,7 +1244,7 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 
 			return id, nil
 		},
-		"protocol_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"protocol_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			if resp := a.Response; resp == nil {
 				return nil, nil
 			}
@@ -326,7 +1260,7 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 
 			return id, nil
 		},
-		"host_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"host_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			if strings.HasPrefix(a.Request.URL, "data:") {
 				return nil, nil
 			}
@@ -344,14 +1278,31 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 			tld, _ := publicsuffix.PublicSuffix(rootDom)
 			sort.Strings(a.Host.NameServers)
 
-			id, err := as.dimHosts.Get(tx, rootDom, tld, a.Host.IPAddr, strings.Join(a.Host.NameServers, ","))
+			var asnID interface{}
+			if asn := a.Host.ASN; asn.Number != 0 || a.Host.PTR != "" {
+				var num, org, ptr interface{}
+				if asn.Number != 0 {
+					num, org = asn.Number, asn.Org
+				}
+
+				if a.Host.PTR != "" {
+					ptr = a.Host.PTR
+				}
+
+				asnID, err = as.dimASNs.Get(tx, num, org, ptr)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			id, err := as.dimHosts.Get(tx, rootDom, tld, a.Host.IPAddr(), strings.Join(a.Host.IPAddrs, ","), strings.Join(a.Host.NameServers, ","), asnID)
 			if err != nil {
 				return nil, err
 			}
 
 			return id, nil
 		},
-		"initiator_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"initiator_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			id, err := as.dimInitiators.Get(tx, a.Initiator.Kind)
 			if err != nil {
 				return nil, err
@@ -359,7 +1310,14 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 
 			return id, nil
 		},
-		"error_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"initiator_url": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			if a.Initiator.URL == "" {
+				return nil, nil
+			}
+
+			return a.Initiator.URL, nil
+		},
+		"error_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			if a.Error == nil {
 				return nil, nil
 			}
@@ -371,25 +1329,63 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 
 			return id, nil
 		},
-		"parent_id": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"parent_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			if a.Parent != nil {
 				return acids[a.Parent], nil
 			}
 
 			return nil, nil
 		},
-		"status_code": func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error) {
+		"status_code": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
 			if a.Response != nil {
 				return a.Response.Status, nil
 			}
 
 			return nil, nil
 		},
+		"status_text": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			if a.Response != nil && a.Response.StatusText != "" {
+				return a.Response.StatusText, nil
+			}
+
+			return nil, nil
+		},
+		"priority_id": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			if a.Request.InitialPriority == "" {
+				return nil, nil
+			}
+
+			id, err := as.dimPriorities.Get(tx, string(a.Request.InitialPriority))
+			if err != nil {
+				return nil, err
+			}
+
+			return id, nil
+		},
+		"render_blocking": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			return a.RenderBlocking, nil
+		},
+		"remote_ip": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			if a.RemoteIP == "" {
+				return nil, nil
+			}
+
+			return a.RemoteIP, nil
+		},
+		"remote_port": func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error) {
+			if a.RemoteIP == "" {
+				return nil, nil
+			}
+
+			return a.RemotePort, nil
+		},
 	}
 
-	wrap := func(f func(tx *sql.Tx, a *kraaler.CrawlAction) (interface{}, error), a *kraaler.CrawlAction) func(tx *sql.Tx) (interface{}, error) {
-		return func(tx *sql.Tx) (interface{}, error) { return f(tx, a) }
+	wrap := func(f func(tx *Tx, a *kraaler.CrawlAction) (interface{}, error), a *kraaler.CrawlAction) func(tx *Tx) (interface{}, error) {
+		return func(tx *Tx) (interface{}, error) { return f(tx, a) }
 	}
+	// the records of a host are stored once, by its first action
+	lookedUp := map[kraaler.Domain]bool{}
 	for _, a := range actions {
 		ins := WarehouseInserter{}
 		for k, f := range actionFuncs {
@@ -398,56 +1394,67 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 
 		id, err := ins.Store(tx, "fact_actions")
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if a.Request.PostData != nil {
-			if err := as.postDataStore.Save(tx, id, *a.Request.PostData); err != nil {
-				return err
+		if h := a.Host; len(h.DNSRecords) > 0 && !lookedUp[h.Domain] {
+			lookedUp[h.Domain] = true
+			if err := as.dnsStore.Save(tx, id, h.NameServer, h.DNSRecords); err != nil {
+				return nil, err
+			}
+		}
+
+		if data := a.RequestBody(); data != nil {
+			if err := as.postDataStore.Save(tx, id, data); err != nil {
+				return nil, err
 			}
 		}
 
 		if a.Initiator.Stack != nil {
 			if err := as.initiatorStackStore.Save(tx, id, *a.Initiator.Stack); err != nil {
-				return err
+				return nil, err
 			}
 		}
 
 		if err := as.urlStore.Save(tx, id, a.Request.URL); err != nil {
-			return err
+			return nil, err
 		}
 
 		reqHeaders, err := a.Request.Headers.Map()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		for k, v := range reqHeaders {
 			if err := as.headerStore.SaveRequest(tx, id, k, v); err != nil {
-				return err
+				return nil, err
 			}
 		}
 
 		if resp := a.Response; resp != nil {
 			respHeaders, err := resp.Headers.Map()
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			for k, v := range respHeaders {
 				if err := as.headerStore.SaveResponse(tx, id, k, v); err != nil {
-					return err
+					return nil, err
 				}
 			}
 
+			if err := as.setCookieStore.Save(tx, id, a.ResponseCookies()); err != nil {
+				return nil, err
+			}
+
 			if resp.SecurityDetails != nil {
 				if err := as.securityStore.Save(tx, id, resp.SecurityDetails); err != nil {
-					return err
+					return nil, err
 				}
 			}
 
 			if a.Body != nil {
 				if err := as.bodyStore.Save(tx, id, *a.Body, resp.MimeType); err != nil {
-					return err
+					return nil, err
 				}
 			}
 		}
@@ -455,7 +1462,7 @@ func (as *ActionStore) Save(tx *sql.Tx, id int64, actions []*kraaler.CrawlAction
 		acids[a] = id
 	}
 
-	return nil
+	return acids, nil
 }
 
 type UrlStore struct {
@@ -469,7 +1476,7 @@ type UrlStore struct {
 
 func NewUrlStore(db *sql.DB) (*UrlStore, error) {
 	if db != nil {
-		if _, err := db.Exec(urlSchema); err != nil {
+		if err := execSchema(db, urlSchema); err != nil {
 			return nil, err
 		}
 	}
@@ -484,24 +1491,24 @@ func NewUrlStore(db *sql.DB) (*UrlStore, error) {
 	}, nil
 }
 
-func (us *UrlStore) Save(tx *sql.Tx, id int64, urlstr string) error {
+func (us *UrlStore) Save(tx *Tx, id int64, urlstr string) error {
 	u, err := url.Parse(urlstr)
 	if err != nil {
 		return err
 	}
 
 	ins := WarehouseInserter{
-		"action_id": func(tx *sql.Tx) (interface{}, error) {
+		"action_id": func(tx *Tx) (interface{}, error) {
 			return id, nil
 		},
-		"scheme_id": func(tx *sql.Tx) (interface{}, error) {
+		"scheme_id": func(tx *Tx) (interface{}, error) {
 			id, err := us.dimScheme.Get(tx, u.Scheme)
 			if err != nil {
 				return nil, err
 			}
 			return id, nil
 		},
-		"user_id": func(tx *sql.Tx) (interface{}, error) {
+		"user_id": func(tx *Tx) (interface{}, error) {
 			if u.User == nil {
 				return nil, nil
 			}
@@ -512,21 +1519,21 @@ func (us *UrlStore) Save(tx *sql.Tx, id int64, urlstr string) error {
 			}
 			return id, nil
 		},
-		"host_id": func(tx *sql.Tx) (interface{}, error) {
+		"host_id": func(tx *Tx) (interface{}, error) {
 			id, err := us.dimHost.Get(tx, u.Host)
 			if err != nil {
 				return nil, err
 			}
 			return id, nil
 		},
-		"path_id": func(tx *sql.Tx) (interface{}, error) {
+		"path_id": func(tx *Tx) (interface{}, error) {
 			id, err := us.dimPath.Get(tx, u.Path)
 			if err != nil {
 				return nil, err
 			}
 			return id, nil
 		},
-		"fragment_id": func(tx *sql.Tx) (interface{}, error) {
+		"fragment_id": func(tx *Tx) (interface{}, error) {
 			if u.Fragment == "" {
 				return nil, nil
 			}
@@ -537,7 +1544,7 @@ func (us *UrlStore) Save(tx *sql.Tx, id int64, urlstr string) error {
 			}
 			return id, nil
 		},
-		"raw_query_id": func(tx *sql.Tx) (interface{}, error) {
+		"raw_query_id": func(tx *Tx) (interface{}, error) {
 			if u.RawQuery == "" {
 				return nil, nil
 			}
@@ -548,7 +1555,7 @@ func (us *UrlStore) Save(tx *sql.Tx, id int64, urlstr string) error {
 			}
 			return id, nil
 		},
-		"url": func(tx *sql.Tx) (interface{}, error) {
+		"url": func(tx *Tx) (interface{}, error) {
 			return urlstr, nil
 		},
 	}
@@ -567,7 +1574,7 @@ type HeaderStore struct {
 
 func NewHeaderStore(db *sql.DB) (*HeaderStore, error) {
 	if db != nil {
-		if _, err := db.Exec(headerSchema); err != nil {
+		if err := execSchema(db, headerSchema); err != nil {
 			return nil, err
 		}
 	}
@@ -578,12 +1585,12 @@ func NewHeaderStore(db *sql.DB) (*HeaderStore, error) {
 	}, nil
 }
 
-func (hs *HeaderStore) saveHeader(tx *sql.Tx, id int64, key, value string, table string) error {
+func (hs *HeaderStore) saveHeader(tx *Tx, id int64, key, value string, table string) error {
 	ins := WarehouseInserter{
-		"action_id": func(tx *sql.Tx) (interface{}, error) {
+		"action_id": func(tx *Tx) (interface{}, error) {
 			return id, nil
 		},
-		"header_keyvalue_id": func(tx *sql.Tx) (interface{}, error) {
+		"header_keyvalue_id": func(tx *Tx) (interface{}, error) {
 			kid, err := hs.dimHeaderKey.Get(tx, key)
 			if err != nil {
 				return nil, err
@@ -605,11 +1612,11 @@ func (hs *HeaderStore) saveHeader(tx *sql.Tx, id int64, key, value string, table
 	return nil
 }
 
-func (hs *HeaderStore) SaveRequest(tx *sql.Tx, id int64, key, value string) error {
+func (hs *HeaderStore) SaveRequest(tx *Tx, id int64, key, value string) error {
 	return hs.saveHeader(tx, id, key, value, "fact_request_headers")
 }
 
-func (hs *HeaderStore) SaveResponse(tx *sql.Tx, id int64, key, value string) error {
+func (hs *HeaderStore) SaveResponse(tx *Tx, id int64, key, value string) error {
 	return hs.saveHeader(tx, id, key, value, "fact_response_headers")
 }
 
@@ -623,7 +1630,7 @@ type SecurityStore struct {
 
 func NewSecurityStore(db *sql.DB) (*SecurityStore, error) {
 	if db != nil {
-		if _, err := db.Exec(securitySchema); err != nil {
+		if err := execSchema(db, securitySchema); err != nil {
 			return nil, err
 		}
 	}
@@ -637,9 +1644,9 @@ func NewSecurityStore(db *sql.DB) (*SecurityStore, error) {
 	}, nil
 }
 
-func (ss *SecurityStore) Save(tx *sql.Tx, id int64, sd *network.SecurityDetails) error {
-	get := func(s *IDStore, i interface{}) func(tx *sql.Tx) (interface{}, error) {
-		return func(tx *sql.Tx) (interface{}, error) {
+func (ss *SecurityStore) Save(tx *Tx, id int64, sd *network.SecurityDetails) error {
+	get := func(s *IDStore, i interface{}) func(tx *Tx) (interface{}, error) {
+		return func(tx *Tx) (interface{}, error) {
 			id, err := s.Get(tx, i)
 			if err != nil {
 				return nil, err
@@ -648,7 +1655,7 @@ func (ss *SecurityStore) Save(tx *sql.Tx, id int64, sd *network.SecurityDetails)
 		}
 	}
 	ins := WarehouseInserter{
-		"action_id": func(tx *sql.Tx) (interface{}, error) {
+		"action_id": func(tx *Tx) (interface{}, error) {
 			return id, nil
 		},
 		"protocol_id":     get(ss.dimProtocol, sd.Protocol),
@@ -656,13 +1663,13 @@ func (ss *SecurityStore) Save(tx *sql.Tx, id int64, sd *network.SecurityDetails)
 		"cipher_id":       get(ss.dimCipher, sd.Cipher),
 		"issuer_id":       get(ss.dimIssuer, sd.Issuer),
 		"san_list_id":     get(ss.dimSanList, strings.Join(sd.SanList, ",")),
-		"subject_name": func(tx *sql.Tx) (interface{}, error) {
+		"subject_name": func(tx *Tx) (interface{}, error) {
 			return sd.SubjectName, nil
 		},
-		"valid_from": func(tx *sql.Tx) (interface{}, error) {
+		"valid_from": func(tx *Tx) (interface{}, error) {
 			return sd.ValidFrom, nil
 		},
-		"valid_to": func(tx *sql.Tx) (interface{}, error) {
+		"valid_to": func(tx *Tx) (interface{}, error) {
 			return sd.ValidTo, nil
 		},
 	}
@@ -674,27 +1681,74 @@ func (ss *SecurityStore) Save(tx *sql.Tx, id int64, sd *network.SecurityDetails)
 	return nil
 }
 
+const (
+	bodyStorageFile   = "file"
+	bodyStorageS3     = "s3"
+	bodyStorageInline = "inline"
+)
+
+// describer determines the hash and mime type of content, and whether it
+// may be stored, without storing it
+type describer interface {
+	describe([]byte) StoredFile
+	allowed(sf StoredFile, browserMime string) bool
+}
+
+// mimeStorer stores content taking the mime type reported by the browser
+// into account
+type mimeStorer interface {
+	StoreWithMime(raw []byte, browserMime string) (StoredFile, error)
+}
+
 type BodyStore struct {
-	fs      *FileStore
-	dimMime *IDStore
+	fs         BlobStore
+	inlineSize int
+	dimMime    *IDStore
+}
+
+type BodyStoreOpt func(*BodyStore)
+
+// WithInlineBodies stores bodies smaller than size bytes as a blob in
+// fact_bodies instead of in the file store
+func WithInlineBodies(size int) BodyStoreOpt {
+	return func(bs *BodyStore) {
+		bs.inlineSize = size
+	}
 }
 
-func NewBodyStore(db *sql.DB, fs *FileStore) (*BodyStore, error) {
+func NewBodyStore(db *sql.DB, fs BlobStore, opts ...BodyStoreOpt) (*BodyStore, error) {
 	if db != nil {
-		if _, err := db.Exec(bodySchema); err != nil {
+		if err := execSchema(db, bodySchema); err != nil {
 			return nil, err
 		}
 	}
 
-	return &BodyStore{
+	bs := &BodyStore{
 		fs:      fs,
 		dimMime: NewIDStore("dim_mime_types", cache.New(10*time.Minute, time.Minute), "mime_type"),
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(bs)
+	}
+
+	return bs, nil
+}
+
+func (ss *BodyStore) Save(tx *Tx, id int64, body kraaler.ResponseBody, mime string) error {
+	return ss.save(tx, id, body, mime, false)
+}
+
+// SaveRendered stores the html serialized from the DOM of the document
+// loaded by the action, marked as rendered to tell it apart from the body
+// received from the network
+func (ss *BodyStore) SaveRendered(tx *Tx, id int64, html []byte) error {
+	return ss.save(tx, id, kraaler.ResponseBody{Body: html}, "text/html", true)
 }
 
-func (ss *BodyStore) Save(tx *sql.Tx, id int64, body kraaler.ResponseBody, mime string) error {
-	get := func(s *IDStore, i interface{}) func(tx *sql.Tx) (interface{}, error) {
-		return func(tx *sql.Tx) (interface{}, error) {
+func (ss *BodyStore) save(tx *Tx, id int64, body kraaler.ResponseBody, mime string, rendered bool) error {
+	get := func(s *IDStore, i interface{}) func(tx *Tx) (interface{}, error) {
+		return func(tx *Tx) (interface{}, error) {
 			id, err := s.Get(tx, i)
 			if err != nil {
 				return nil, err
@@ -703,35 +1757,88 @@ func (ss *BodyStore) Save(tx *sql.Tx, id int64, body kraaler.ResponseBody, mime
 		}
 	}
 
-	sf, err := ss.fs.Store(body.Body)
-	if err != nil && err != NotAllowedMimeErr {
-		return err
+	var sf StoredFile
+	var storage string
+	var data []byte
+	d, canDescribe := ss.fs.(describer)
+	if canDescribe && len(body.Body) < ss.inlineSize {
+		sf = d.describe(body.Body)
+		if d.allowed(sf, mime) {
+			storage, data = bodyStorageInline, body.Body
+		}
+	} else {
+		var err error
+		if ms, ok := ss.fs.(mimeStorer); ok {
+			sf, err = ms.StoreWithMime(body.Body, mime)
+		} else {
+			sf, err = ss.fs.Store(body.Body)
+		}
+		if err != nil && err != NotAllowedMimeErr {
+			return err
+		}
+
+		if sf.Path != "" {
+			storage = bodyStorageFile
+			if _, ok := ss.fs.(*S3Store); ok {
+				storage = bodyStorageS3
+			}
+		}
 	}
 
 	ins := WarehouseInserter{
-		"action_id": func(tx *sql.Tx) (interface{}, error) {
+		"action_id": func(tx *Tx) (interface{}, error) {
 			return id, nil
 		},
 		"browser_mime_id":    get(ss.dimMime, mime),
 		"determined_mime_id": get(ss.dimMime, sf.MimeType),
-		"path": func(tx *sql.Tx) (interface{}, error) {
+		"path": func(tx *Tx) (interface{}, error) {
 			if sf.Path == "" {
 				return nil, nil
 			}
 			return sf.Path, nil
 		},
-		"hash256": func(tx *sql.Tx) (interface{}, error) {
+		"hash256": func(tx *Tx) (interface{}, error) {
 			return sf.Hash, nil
 		},
-		"org_size": func(tx *sql.Tx) (interface{}, error) {
+		"org_size": func(tx *Tx) (interface{}, error) {
 			return sf.OrgSize, nil
 		},
-		"comp_size": func(tx *sql.Tx) (interface{}, error) {
+		"encoded_size": func(tx *Tx) (interface{}, error) {
+			if body.EncodedSize == 0 {
+				return nil, nil
+			}
+			return body.EncodedSize, nil
+		},
+		"comp_size": func(tx *Tx) (interface{}, error) {
 			if sf.CompSize == 0 {
 				return nil, nil
 			}
 			return sf.CompSize, nil
 		},
+		"charset": func(tx *Tx) (interface{}, error) {
+			if body.Charset == "" {
+				return nil, nil
+			}
+			return body.Charset, nil
+		},
+		"storage": func(tx *Tx) (interface{}, error) {
+			if storage == "" {
+				return nil, nil
+			}
+			return storage, nil
+		},
+		"encrypted": func(tx *Tx) (interface{}, error) {
+			return sf.Encrypted, nil
+		},
+		"rendered": func(tx *Tx) (interface{}, error) {
+			return rendered, nil
+		},
+		"data": func(tx *Tx) (interface{}, error) {
+			if data == nil {
+				return nil, nil
+			}
+			return data, nil
+		},
 	}
 
 	if _, err := ins.Store(tx, "fact_bodies"); err != nil {
@@ -741,11 +1848,78 @@ func (ss *BodyStore) Save(tx *sql.Tx, id int64, body kraaler.ResponseBody, mime
 	return nil
 }
 
+// SetCookieStore stores the cookies set by the response of an action
+type SetCookieStore struct{}
+
+func NewSetCookieStore(db *sql.DB) (*SetCookieStore, error) {
+	if db != nil {
+		if err := execSchema(db, setCookieSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SetCookieStore{}, nil
+}
+
+func (ss *SetCookieStore) Save(tx *Tx, id int64, cookies []*kraaler.SetCookie) error {
+	orNil := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+
+	cins := inserter{tx, GetInsertQuery("fact_set_cookies", "action_id", "name", "value", "domain", "path", "expires", "max_age", "secure", "http_only", "same_site"), true}
+	for _, c := range cookies {
+		var expires, maxAge interface{}
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+
+		switch {
+		case c.MaxAge > 0:
+			maxAge = c.MaxAge
+		case c.MaxAge < 0:
+			maxAge = 0
+		}
+
+		if _, err := cins.Insert(id, c.Name, c.Value, orNil(c.Domain), orNil(c.Path), expires, maxAge, c.Secure, c.HTTPOnly, orNil(c.SameSite)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DNSStore stores the records answering the lookup of the host of an action
+type DNSStore struct{}
+
+func NewDNSStore(db *sql.DB) (*DNSStore, error) {
+	if db != nil {
+		if err := execSchema(db, dnsSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DNSStore{}, nil
+}
+
+func (ds *DNSStore) Save(tx *Tx, id int64, server string, records []kraaler.DNSRecord) error {
+	dins := inserter{tx, GetInsertQuery("fact_dns", "action_id", "name_server", "name", "type", "value", "ttl"), true}
+	for _, r := range records {
+		if _, err := dins.Insert(id, server, r.Name, r.Type, r.Value, r.TTL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 type PostDataStore struct{}
 
 func NewPostDataStore(db *sql.DB) (*PostDataStore, error) {
 	if db != nil {
-		if _, err := db.Exec(postDataSchema); err != nil {
+		if err := execSchema(db, postDataSchema); err != nil {
 			return nil, err
 		}
 	}
@@ -753,12 +1927,12 @@ func NewPostDataStore(db *sql.DB) (*PostDataStore, error) {
 	return &PostDataStore{}, nil
 }
 
-func (ps *PostDataStore) Save(tx *sql.Tx, id int64, data string) error {
+func (ps *PostDataStore) Save(tx *Tx, id int64, data []byte) error {
 	ins := WarehouseInserter{
-		"action_id": func(tx *sql.Tx) (interface{}, error) {
+		"action_id": func(tx *Tx) (interface{}, error) {
 			return id, nil
 		},
-		"data": func(tx *sql.Tx) (interface{}, error) {
+		"data": func(tx *Tx) (interface{}, error) {
 			return data, nil
 		},
 	}
@@ -774,7 +1948,7 @@ type InitiatorStackStore struct{}
 
 func NewInitiatorStackStore(db *sql.DB) (*InitiatorStackStore, error) {
 	if db != nil {
-		if _, err := db.Exec(initiatorStackSchema); err != nil {
+		if err := execSchema(db, initiatorStackSchema); err != nil {
 			return nil, err
 		}
 	}
@@ -782,18 +1956,18 @@ func NewInitiatorStackStore(db *sql.DB) (*InitiatorStackStore, error) {
 	return &InitiatorStackStore{}, nil
 }
 
-func (is *InitiatorStackStore) Save(tx *sql.Tx, id int64, cf kraaler.CallFrame) error {
+func (is *InitiatorStackStore) Save(tx *Tx, id int64, cf kraaler.CallFrame) error {
 	ins := WarehouseInserter{
-		"action_id": func(tx *sql.Tx) (interface{}, error) {
+		"action_id": func(tx *Tx) (interface{}, error) {
 			return id, nil
 		},
-		"col": func(tx *sql.Tx) (interface{}, error) {
+		"col": func(tx *Tx) (interface{}, error) {
 			return cf.Column, nil
 		},
-		"line": func(tx *sql.Tx) (interface{}, error) {
+		"line": func(tx *Tx) (interface{}, error) {
 			return cf.LineNumber, nil
 		},
-		"func": func(tx *sql.Tx) (interface{}, error) {
+		"func": func(tx *Tx) (interface{}, error) {
 			return cf.Function, nil
 		},
 	}
@@ -814,13 +1988,13 @@ func GetInsertQuery(table string, fields ...string) string {
 	return fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", table, strings.Join(fields, ","), qmarks)
 }
 
-type WarehouseInserter map[string]func(tx *sql.Tx) (interface{}, error)
+type WarehouseInserter map[string]func(tx *Tx) (interface{}, error)
 
 func (m WarehouseInserter) Add(s string, i interface{}) {
-	m[s] = func(*sql.Tx) (interface{}, error) { return i, nil }
+	m[s] = func(*Tx) (interface{}, error) { return i, nil }
 }
 
-func (m WarehouseInserter) Store(tx *sql.Tx, table string) (int64, error) {
+func (m WarehouseInserter) Store(tx *Tx, table string) (int64, error) {
 	var fields []string
 	var values []interface{}
 	for f, get := range m {
@@ -843,9 +2017,10 @@ type IDStore struct {
 }
 
 func NewIDStore(table string, cache *cache.Cache, fields ...string) *IDStore {
+	// fields are compared using is, such that null values match as well
 	var conds string
 	for _, f := range fields {
-		conds += fmt.Sprintf("%s = ? and ", f)
+		conds += fmt.Sprintf("%s is ? and ", f)
 	}
 
 	conds = conds[0 : len(conds)-5]
@@ -858,19 +2033,62 @@ func NewIDStore(table string, cache *cache.Cache, fields ...string) *IDStore {
 	}
 }
 
-func (is *IDStore) Get(tx *sql.Tx, items ...interface{}) (int64, error) {
+type pendingKey struct {
+	is  *IDStore
+	key string
+}
+
+// Tx is a transaction in which IDStores get ids, which may not exist once
+// the transaction is ended, and are therefore only cached once committed
+type Tx struct {
+	*sql.Tx
+	ids map[pendingKey]int64
+}
+
+// Begin starts a transaction of db
+func Begin(db *sql.DB) (*Tx, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{Tx: tx, ids: map[pendingKey]int64{}}, nil
+}
+
+// Commit commits the transaction, caching the ids got by IDStores within it
+func (tx *Tx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+
+	for pk, id := range tx.ids {
+		id := id
+		pk.is.cache.Set(pk.key, &id, cache.DefaultExpiration)
+	}
+
+	return nil
+}
+
+// Get is the id of the row of items, which is inserted if missing. Ids are
+// only cached once tx is committed
+func (is *IDStore) Get(tx *Tx, items ...interface{}) (int64, error) {
 	key := fmt.Sprintf("%v", items)
+	pk := pendingKey{is, key}
 	if is.cache != nil {
 		if p, ok := is.cache.Get(key); ok {
 			if id, ok := p.(*int64); ok {
 				return *id, nil
 			}
 		}
+
+		if id, ok := tx.ids[pk]; ok {
+			return id, nil
+		}
 	}
 
 	foundId := func(id int64) (int64, error) {
 		if is.cache != nil {
-			is.cache.Set(key, &id, cache.DefaultExpiration)
+			tx.ids[pk] = id
 		}
 		return id, nil
 	}
@@ -897,7 +2115,7 @@ func (is *IDStore) Get(tx *sql.Tx, items ...interface{}) (int64, error) {
 }
 
 type inserter struct {
-	tx     *sql.Tx
+	tx     *Tx
 	query  string
 	skipId bool
 }
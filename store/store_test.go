@@ -1,13 +1,19 @@
 package store
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"database/sql"
 	"fmt"
+	"image"
+	"image/png"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -75,7 +81,7 @@ height INTEGER NOT NULL
 			}
 
 			s := NewIDStore("whatever_test", tc.cache, "name", "age", "height")
-			tx, err := db.Begin()
+			tx, err := Begin(db)
 			if err != nil {
 				t.Fatalf("unable to begin transaction: %s", err)
 			}
@@ -102,7 +108,70 @@ height INTEGER NOT NULL
 	}
 }
 
-func integerFieldsNonZero(tx *sql.Tx, table string, fields ...string) error {
+func TestIDStoreRollback(t *testing.T) {
+	db, path, err := getDB("id-store-rollback-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+	defer db.Close()
+
+	if _, err := db.Exec("create table whatever_test (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"); err != nil {
+		t.Fatalf("unable to initialize database: %s", err)
+	}
+
+	s := NewIDStore("whatever_test", cache.New(time.Minute, time.Minute), "name")
+	get := func(end func(*Tx) error) int64 {
+		tx, err := Begin(db)
+		if err != nil {
+			t.Fatalf("unable to begin transaction: %s", err)
+		}
+
+		id, err := s.Get(tx, "Martin")
+		if err != nil {
+			t.Fatalf("unable to get id: %s", err)
+		}
+
+		if err := tableMustBeOfSize(tx, "whatever_test", 1); err != nil {
+			t.Fatalf("expected id to exist within its transaction: %s", err)
+		}
+
+		if err := end(tx); err != nil {
+			t.Fatalf("unable to end transaction: %s", err)
+		}
+
+		return id
+	}
+
+	get((*Tx).Rollback)
+	committed := get((*Tx).Commit)
+
+	var n int
+	if err := db.QueryRow("select count(*) from whatever_test where id = ?", committed).Scan(&n); err != nil {
+		t.Fatalf("unable to count rows: %s", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected id to be inserted again after rollback")
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to begin transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	// the committed id is served from the cache without a query
+	if _, err := db.Exec("delete from whatever_test"); err != nil {
+		t.Fatalf("unable to delete rows: %s", err)
+	}
+
+	if id, err := s.Get(tx, "Martin"); err != nil || id != committed {
+		t.Fatalf("expected committed id (%d) to be cached, but received: %d (err: %v)", committed, id, err)
+	}
+}
+
+func integerFieldsNonZero(tx *Tx, table string, fields ...string) error {
 	query := fmt.Sprintf("select %s from %s", strings.Join(fields, ","), table)
 
 	ints := make([]interface{}, len(fields))
@@ -125,7 +194,7 @@ func integerFieldsNonZero(tx *sql.Tx, table string, fields ...string) error {
 	return nil
 }
 
-func tableMustBeOfSize(tx *sql.Tx, table string, n int) error {
+func tableMustBeOfSize(tx *Tx, table string, n int) error {
 	query := fmt.Sprintf("select count(*) from %s", table)
 
 	var count int
@@ -155,6 +224,8 @@ func getDB(name string) (*sql.DB, string, error) {
 func TestSessionStore(t *testing.T) {
 
 	aauURL, _ := url.Parse("http://aau.dk")
+	landingURL, _ := url.Parse("https://www.aau.dk/en/")
+	now := time.Now()
 	tt := []struct {
 		name string
 		page kraaler.Page
@@ -166,6 +237,131 @@ func TestSessionStore(t *testing.T) {
 			LoadedTime:     time.Now(),
 			TerminatedTime: time.Now(),
 		}},
+		{name: "failed requests", page: kraaler.Page{
+			InitialURL:         aauURL,
+			Resolution:         "800x600",
+			NavigateTime:       time.Now(),
+			LoadedTime:         time.Now(),
+			TerminatedTime:     time.Now(),
+			FailedRequests:     1,
+			BlockedRequests:    2,
+			FailedRequestBytes: 512,
+		}},
+		{name: "phases", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			QueuedTime:     now,
+			InitiatedTime:  now.Add(time.Second),
+			NavigateTime:   now.Add(3 * time.Second),
+			LoadedTime:     now.Add(6 * time.Second),
+			TerminatedTime: now.Add(10 * time.Second),
+		}},
+		{name: "retried", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			Attempts:       3,
+		}},
+		{name: "final status", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			FinalStatus:    200,
+			RedirectHops:   3,
+			FinalURL:       landingURL,
+		}},
+		{name: "click", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			Interaction: &kraaler.Interaction{
+				Click: kraaler.Click{Selector: "#enter", X: 120, Y: 48.5},
+				Time:  time.Now(),
+			},
+		}},
+		{name: "redirect limit", page: kraaler.Page{
+			InitialURL:            aauURL,
+			Resolution:            "800x600",
+			NavigateTime:          time.Now(),
+			LoadedTime:            time.Now(),
+			TerminatedTime:        time.Now(),
+			Redirects:             6,
+			RedirectLimitExceeded: true,
+			Error:                 kraaler.ErrTooManyRedirects,
+		}},
+		{name: "egress ip", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			EgressIP:       "192.0.2.10",
+		}},
+		{name: "warm visit failed", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			WarmError:      context.DeadlineExceeded,
+		}},
+		{name: "beforeunload handler", page: kraaler.Page{
+			InitialURL:          aauURL,
+			Resolution:          "800x600",
+			NavigateTime:        time.Now(),
+			LoadedTime:          time.Now(),
+			TerminatedTime:      time.Now(),
+			BeforeUnloadHandler: true,
+		}},
+		{name: "lifecycle event", page: kraaler.Page{
+			InitialURL:         aauURL,
+			Resolution:         "800x600",
+			NavigateTime:       time.Now(),
+			LoadedTime:         time.Now(),
+			TerminatedTime:     time.Now(),
+			LifecycleEvent:     "load",
+			LifecycleTimestamp: 1234.5,
+		}},
+		{name: "hsts upgrade", page: kraaler.Page{
+			InitialURL:      aauURL,
+			Resolution:      "800x600",
+			NavigateTime:    time.Now(),
+			LoadedTime:      time.Now(),
+			TerminatedTime:  time.Now(),
+			RequestedScheme: "http",
+			UpgradedScheme:  "https",
+			SchemeUpgrade:   kraaler.UpgradeHSTS,
+		}},
+		{name: "script result", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			ScriptResult:   `{"title":"aau"}`,
+		}},
+		{name: "script exception", page: kraaler.Page{
+			InitialURL:      aauURL,
+			Resolution:      "800x600",
+			NavigateTime:    time.Now(),
+			LoadedTime:      time.Now(),
+			TerminatedTime:  time.Now(),
+			ScriptException: "Error: meow",
+		}},
+		{name: "source", page: kraaler.Page{
+			InitialURL:     aauURL,
+			Resolution:     "800x600",
+			NavigateTime:   time.Now(),
+			LoadedTime:     time.Now(),
+			TerminatedTime: time.Now(),
+			Source:         "phishtank",
+		}},
 	}
 
 	for _, tc := range tt {
@@ -181,7 +377,7 @@ func TestSessionStore(t *testing.T) {
 				t.Fatalf("unable to create session store: %s", err)
 			}
 
-			tx, err := db.Begin()
+			tx, err := Begin(db)
 			if err != nil {
 				t.Fatalf("unable to create transaction: %s", err)
 			}
@@ -208,6 +404,147 @@ func TestSessionStore(t *testing.T) {
 			); err != nil {
 				t.Fatal(err)
 			}
+
+			var failed, blocked int
+			var failedBytes int64
+			if err := tx.QueryRow("select failed_request_count, blocked_request_count, failed_request_bytes from fact_sessions").Scan(&failed, &blocked, &failedBytes); err != nil {
+				t.Fatalf("unable to read failed requests: %s", err)
+			}
+
+			if failed != tc.page.FailedRequests || blocked != tc.page.BlockedRequests || failedBytes != tc.page.FailedRequestBytes {
+				t.Fatalf("unexpected failed requests (%d, %d, %d), expected: (%d, %d, %d)",
+					failed, blocked, failedBytes,
+					tc.page.FailedRequests, tc.page.BlockedRequests, tc.page.FailedRequestBytes)
+			}
+
+			var queueWait, setup, navigate, terminate int64
+			if err := tx.QueryRow("select queue_wait_duration, setup_duration, navigate_duration, terminate_duration from fact_sessions").Scan(&queueWait, &setup, &navigate, &terminate); err != nil {
+				t.Fatalf("unable to read phase durations: %s", err)
+			}
+
+			p := tc.page
+			if !p.QueuedTime.IsZero() && queueWait != p.InitiatedTime.Sub(p.QueuedTime).Nanoseconds() {
+				t.Fatalf("unexpected queue wait duration: %d", queueWait)
+			}
+
+			if !p.InitiatedTime.IsZero() && setup != p.NavigateTime.Sub(p.InitiatedTime).Nanoseconds() {
+				t.Fatalf("unexpected setup duration: %d", setup)
+			}
+
+			if navigate != p.LoadedTime.Sub(p.NavigateTime).Nanoseconds() {
+				t.Fatalf("unexpected navigate duration: %d", navigate)
+			}
+
+			if terminate != p.TerminatedTime.Sub(p.LoadedTime).Nanoseconds() {
+				t.Fatalf("unexpected terminate duration: %d", terminate)
+			}
+
+			total := queueWait + setup + navigate + terminate
+			if !p.QueuedTime.IsZero() && total != p.TerminatedTime.Sub(p.QueuedTime).Nanoseconds() {
+				t.Fatalf("expected phases to sum up to the total crawl time, but was: %d", total)
+			}
+
+			expectedAttempts := p.Attempts
+			if expectedAttempts == 0 {
+				expectedAttempts = 1
+			}
+
+			var attempts int
+			if err := tx.QueryRow("select attempts from fact_sessions").Scan(&attempts); err != nil {
+				t.Fatalf("unable to read attempts: %s", err)
+			}
+
+			if attempts != expectedAttempts {
+				t.Fatalf("expected %d attempt(s), but was: %d", expectedAttempts, attempts)
+			}
+
+			var status, hops sql.NullInt64
+			if err := tx.QueryRow("select final_status, redirect_hops from fact_sessions").Scan(&status, &hops); err != nil {
+				t.Fatalf("unable to read final status: %s", err)
+			}
+
+			if int(status.Int64) != p.FinalStatus || int(hops.Int64) != p.RedirectHops {
+				t.Fatalf("unexpected final status %d after %d hops, expected: %d after %d hops", status.Int64, hops.Int64, p.FinalStatus, p.RedirectHops)
+			}
+
+			var selector sql.NullString
+			var x, y sql.NullFloat64
+			if err := tx.QueryRow("select click_selector, click_x, click_y from fact_sessions").Scan(&selector, &x, &y); err != nil {
+				t.Fatalf("unable to read click: %s", err)
+			}
+
+			if in := p.Interaction; in != nil {
+				if selector.String != in.Selector || x.Float64 != in.X || y.Float64 != in.Y {
+					t.Fatalf("unexpected click on %s at (%f, %f), expected: %+v", selector.String, x.Float64, y.Float64, in.Click)
+				}
+			} else if selector.Valid || x.Valid || y.Valid {
+				t.Fatalf("expected no click to be stored")
+			}
+
+			var redirects int
+			var exceeded bool
+			if err := tx.QueryRow("select redirect_count, redirect_limit_exceeded from fact_sessions").Scan(&redirects, &exceeded); err != nil {
+				t.Fatalf("unable to read redirects: %s", err)
+			}
+
+			if redirects != p.Redirects || exceeded != p.RedirectLimitExceeded {
+				t.Fatalf("unexpected %d redirect(s) (exceeded: %t), expected: %d (exceeded: %t)", redirects, exceeded, p.Redirects, p.RedirectLimitExceeded)
+			}
+
+			var egress sql.NullString
+			if err := tx.QueryRow("select egress_ip from fact_sessions").Scan(&egress); err != nil {
+				t.Fatalf("unable to read egress ip: %s", err)
+			}
+
+			if egress.String != p.EgressIP {
+				t.Fatalf("unexpected egress ip %q, expected: %q", egress.String, p.EgressIP)
+			}
+
+			var event sql.NullString
+			var ts sql.NullFloat64
+			if err := tx.QueryRow("select lifecycle_event, lifecycle_timestamp from fact_sessions").Scan(&event, &ts); err != nil {
+				t.Fatalf("unable to read lifecycle event: %s", err)
+			}
+
+			if event.String != p.LifecycleEvent || ts.Float64 != p.LifecycleTimestamp {
+				t.Fatalf("unexpected lifecycle event %s at %f, expected: %s at %f", event.String, ts.Float64, p.LifecycleEvent, p.LifecycleTimestamp)
+			}
+
+			var final sql.NullString
+			if err := tx.QueryRow("select final_url from fact_sessions").Scan(&final); err != nil {
+				t.Fatalf("unable to read final url: %s", err)
+			}
+
+			if p.FinalURL != nil && final.String != p.FinalURL.String() || p.FinalURL == nil && final.Valid {
+				t.Fatalf("unexpected final url: %s", final.String)
+			}
+
+			var requested, upgraded, upgrade sql.NullString
+			if err := tx.QueryRow("select requested_scheme, upgraded_scheme, scheme_upgrade from fact_sessions").Scan(&requested, &upgraded, &upgrade); err != nil {
+				t.Fatalf("unable to read scheme upgrade: %s", err)
+			}
+
+			if requested.String != p.RequestedScheme || upgraded.String != p.UpgradedScheme || upgrade.String != p.SchemeUpgrade {
+				t.Fatalf("unexpected scheme upgrade %s -> %s (%s), expected: %s -> %s (%s)", requested.String, upgraded.String, upgrade.String, p.RequestedScheme, p.UpgradedScheme, p.SchemeUpgrade)
+			}
+
+			var warmErr sql.NullString
+			if err := tx.QueryRow("select warm_error from fact_sessions").Scan(&warmErr); err != nil {
+				t.Fatalf("unable to read warm visit error: %s", err)
+			}
+
+			if p.WarmError != nil && warmErr.String != p.WarmError.Error() || p.WarmError == nil && warmErr.Valid {
+				t.Fatalf("unexpected warm visit error: %s", warmErr.String)
+			}
+
+			var scriptResult, scriptException sql.NullString
+			if err := tx.QueryRow("select script_result, script_exception from fact_sessions").Scan(&scriptResult, &scriptException); err != nil {
+				t.Fatalf("unable to read script result: %s", err)
+			}
+
+			if scriptResult.String != p.ScriptResult || scriptException.String != p.ScriptException {
+				t.Fatalf("unexpected script result %q (exception %q), expected: %q (exception %q)", scriptResult.String, scriptException.String, p.ScriptResult, p.ScriptException)
+			}
 		})
 	}
 }
@@ -221,6 +558,23 @@ func TestConsoleStore(t *testing.T) {
 			&kraaler.JavaScriptConsole{Msg: "hello"},
 			&kraaler.JavaScriptConsole{Msg: "hello2"},
 		}},
+		{name: "types", console: []*kraaler.JavaScriptConsole{
+			&kraaler.JavaScriptConsole{Type: "log", Msg: "hello"},
+			&kraaler.JavaScriptConsole{Type: "info", Msg: "marker"},
+			&kraaler.JavaScriptConsole{Type: "endGroup"},
+		}},
+		{name: "levels", console: []*kraaler.JavaScriptConsole{
+			&kraaler.JavaScriptConsole{Type: "warning", Level: "warn", Msg: "mixed content"},
+			&kraaler.JavaScriptConsole{Type: "error", Level: "error", Msg: "csp violation"},
+			&kraaler.JavaScriptConsole{Type: "table", Level: "log"},
+		}},
+		{name: "args", console: []*kraaler.JavaScriptConsole{
+			&kraaler.JavaScriptConsole{Type: "log", Msg: `"x" {"a":1}`, Args: []kraaler.ConsoleArg{
+				{Type: "string", Value: `"x"`},
+				{Type: "object", Value: `{"a":1}`},
+			}},
+			&kraaler.JavaScriptConsole{Type: "log"},
+		}},
 	}
 
 	table := "fact_console_output"
@@ -237,7 +591,7 @@ func TestConsoleStore(t *testing.T) {
 				t.Fatalf("unable to create console store: %s", err)
 			}
 
-			tx, err := db.Begin()
+			tx, err := Begin(db)
 			if err != nil {
 				t.Fatalf("unable to create transaction: %s", err)
 			}
@@ -257,178 +611,547 @@ func TestConsoleStore(t *testing.T) {
 			); err != nil {
 				t.Fatal(err)
 			}
-		})
-	}
-}
-
-func TestScreenStore(t *testing.T) {
-	tt := []struct {
-		name       string
-		url        string
-		screenshot kraaler.BrowserScreenshot
-	}{
-		{name: "basic", url: "http://aau.dk", screenshot: kraaler.BrowserScreenshot{
-			Screenshot: []byte("a"),
-			Kind:       "png",
-			Taken:      time.Now(),
-		}},
-	}
-
-	table := "fact_screenshots"
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-			db, path, err := getDB("screen-store-test")
-			if err != nil {
-				t.Fatalf("unable to create database: %s", err)
-			}
-			defer os.Remove(path)
 
-			dir, err := ioutil.TempDir("", fmt.Sprintf("screen-store-screenshotstore-test-%s", tc.name))
-			if err != nil {
-				t.Fatalf("error when creating temp dir: %s", err)
+			var args int
+			for _, c := range tc.console {
+				args += len(c.Args)
 			}
-			defer os.RemoveAll(dir)
 
-			ss, err := NewScreenStore(db, NewScreenshotStore(dir))
-			if err != nil {
-				t.Fatalf("unable to create screen store: %s", err)
+			if err := tableMustBeOfSize(tx, "fact_console_args", args); err != nil {
+				t.Fatal(err)
 			}
 
-			tx, err := db.Begin()
+			rows, err := tx.Query(`select t.type, l.level from fact_console_output o
+left join dim_console_types t on o.type_id = t.id
+left join dim_console_levels l on o.level_id = l.id order by o.seq`)
 			if err != nil {
-				t.Fatalf("unable to create transaction: %s", err)
+				t.Fatalf("unable to read console types: %s", err)
 			}
-			defer tx.Rollback()
+			defer rows.Close()
 
-			if err := ss.Save(tx, 1, tc.url, []*kraaler.BrowserScreenshot{&tc.screenshot}); err != nil {
-				t.Fatalf("unable to save: %s", err)
-			}
+			for _, c := range tc.console {
+				var kind, level sql.NullString
+				if !rows.Next() || rows.Scan(&kind, &level) != nil {
+					t.Fatalf("expected a console type for: %s", c.Msg)
+				}
 
-			if err := tableMustBeOfSize(tx, table, 1); err != nil {
-				t.Fatal(err)
-			}
+				if kind.String != c.Type {
+					t.Fatalf("unexpected console type %s, expected: %s", kind.String, c.Type)
+				}
 
-			if err := integerFieldsNonZero(tx, table,
-				"session_id",
-				"time_taken",
-			); err != nil {
-				t.Fatal(err)
+				if level.String != c.Level {
+					t.Fatalf("unexpected console level %s, expected: %s", level.String, c.Level)
+				}
 			}
 		})
 	}
 }
 
-func TestActionStore(t *testing.T) {
-	tt := []struct {
-		name      string
-		action    kraaler.CrawlAction
-		tableDiff map[string]int
-	}{
-		{
-			name: "basic",
-			action: kraaler.CrawlAction{
-				Initiator: kraaler.Initiator{
-					Kind: "script",
-					Stack: &kraaler.CallFrame{
-						Column:     2,
-						LineNumber: 25,
-						Function:   func(s string) *string { return &s }("some_func"),
-					},
-				},
-				Host: kraaler.Host{
-					Domain: "aau.dk",
-					IPAddr: "8.8.8.8",
-				},
-				Request: network.Request{
-					URL:    "http://aau.dk",
-					Method: "GET",
-					Headers: network.Headers([]byte(
-						`{ "User-Agent": "Chrome", "Date": "Today"}`,
-					)),
-					PostData: func(s string) *string { return &s }("some_post"),
-				},
-				Response: &network.Response{
-					Status:   http.StatusOK,
-					Protocol: func(s string) *string { return &s }("http"),
-					Headers: network.Headers([]byte(
-						`{ "Server": "nginx" }`,
-					)),
-					MimeType: "text/plain",
-					SecurityDetails: &network.SecurityDetails{
-						Protocol: "Test",
-						Issuer:   "Test",
-					},
-				},
-				Body: &kraaler.ResponseBody{
-					Body: []byte("hello world"),
-				},
-			},
-			tableDiff: map[string]int{
-				"dim_methods":    1,
-				"dim_hosts":      1,
-				"dim_protocols":  2,
-				"dim_initiators": 1,
-				"fact_actions":   1,
+func TestDialogStore(t *testing.T) {
+	db, path, err := getDB("dialog-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
 
-				"dim_header_keyvalues":  3,
-				"fact_response_headers": 1,
-				"fact_request_headers":  2,
+	ds, err := NewDialogStore(db)
+	if err != nil {
+		t.Fatalf("unable to create dialog store: %s", err)
+	}
 
-				"dim_url_schemes":     1,
-				"dim_url_users":       0,
-				"dim_url_hosts":       1,
-				"dim_url_paths":       1,
-				"dim_url_fragments":   0,
-				"dim_url_raw_queries": 0,
-				"fact_urls":           1,
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
 
-				"dim_mime_types": 2,
-				"fact_bodies":    1,
+	dialogs := []*kraaler.JavaScriptDialog{
+		{Kind: "alert", Message: "hello", Opened: time.Now()},
+		{Kind: "confirm", Message: "are you sure?", Opened: time.Now()},
+		{Kind: "alert", Message: "bye", Opened: time.Now()},
+	}
 
-				"fact_post_data":       1,
-				"fact_initiator_stack": 1,
+	if err := ds.Save(tx, 1, dialogs); err != nil {
+		t.Fatalf("unable to save dialogs: %s", err)
+	}
 
-				"dim_issuers":           1,
-				"dim_key_exchanges":     1,
-				"dim_ciphers":           1,
-				"dim_san_lists":         1,
-				"fact_security_details": 1,
-			},
+	if err := tableMustBeOfSize(tx, "fact_dialogs", len(dialogs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tableMustBeOfSize(tx, "dim_dialog_types", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := integerFieldsNonZero(tx, "fact_dialogs",
+		"session_id",
+		"seq",
+		"type_id",
+		"opened_time",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPermissionStore(t *testing.T) {
+	db, path, err := getDB("permission-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	ps, err := NewPermissionStore(db)
+	if err != nil {
+		t.Fatalf("unable to create permission store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	requests := []*kraaler.PermissionRequest{
+		{Name: "notifications", API: "Notification.requestPermission", URL: "http://aau.dk/", Requested: time.Now()},
+		{Name: "camera", API: "mediaDevices.getUserMedia", URL: "http://aau.dk/", Requested: time.Now()},
+		{Name: "notifications", API: "permissions.query", URL: "http://aau.dk/", Requested: time.Now()},
+	}
+
+	if err := ps.Save(tx, 1, requests); err != nil {
+		t.Fatalf("unable to save permissions: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_permissions", len(requests)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tableMustBeOfSize(tx, "dim_permissions", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := integerFieldsNonZero(tx, "fact_permissions",
+		"session_id",
+		"seq",
+		"permission_id",
+		"requested_time",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFormStore(t *testing.T) {
+	db, path, err := getDB("form-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	fs, err := NewFormStore(db)
+	if err != nil {
+		t.Fatalf("unable to create form store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	action, _ := url.Parse("http://harvest.com/collect.php")
+	forms := []*kraaler.Form{
+		{Action: action, Method: "POST", Inputs: []kraaler.FormInput{
+			{Name: "email", Type: "email"},
+			{Name: "pass", Type: "password"},
+		}},
+	}
+
+	if err := fs.Save(tx, 1, forms); err != nil {
+		t.Fatalf("unable to save forms: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_forms", len(forms)); err != nil {
+		t.Fatal(err)
+	}
+
+	var inputs string
+	if err := tx.QueryRow("select inputs from fact_forms").Scan(&inputs); err != nil {
+		t.Fatalf("unable to read inputs: %s", err)
+	}
+
+	if inputs != "email:email,password:pass" {
+		t.Fatalf("unexpected inputs: %s", inputs)
+	}
+}
+
+func TestTrackerStore(t *testing.T) {
+	db, path, err := getDB("tracker-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	ts, err := NewTrackerStore(db)
+	if err != nil {
+		t.Fatalf("unable to create tracker store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err := ts.Save(tx, 1, map[string]int{"doubleclick.net": 3, "hotjar.com": 1}); err != nil {
+		t.Fatalf("unable to save trackers: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_trackers", 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCookieStore(t *testing.T) {
+	db, path, err := getDB("cookie-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	cs, err := NewCookieStore(db)
+	if err != nil {
+		t.Fatalf("unable to create cookie store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	stats := map[string]kraaler.CookieStats{
+		"aau.dk":      {Count: 1, Bytes: 12},
+		"tracker.com": {Count: 3, Bytes: 48},
+	}
+	if err := cs.Save(tx, 1, stats); err != nil {
+		t.Fatalf("unable to save cookie stats: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_cookie_stats", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := []*kraaler.Cookie{
+		{Name: "consent", Value: "yes", Domain: "aau.dk", Path: "/", Expires: time.Now().Add(time.Hour)},
+		{Name: "sid", Value: "42", Domain: "aau.dk", Path: "/", Secure: true, HTTPOnly: true},
+	}
+	if err := cs.SaveCookies(tx, 1, cookies); err != nil {
+		t.Fatalf("unable to save cookies: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_cookies", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var sessionCookies int
+	if err := tx.QueryRow("select count(*) from fact_cookies where expires is null and secure and http_only").Scan(&sessionCookies); err != nil {
+		t.Fatalf("unable to read cookies: %s", err)
+	}
+
+	if sessionCookies != 1 {
+		t.Fatalf("expected one secure http only session cookie, but received: %d", sessionCookies)
+	}
+}
+
+func TestTraceStore(t *testing.T) {
+	db, path, err := getDB("trace-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	dir, err := ioutil.TempDir("", "trace-store-test")
+	if err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir, WithCompression(GzipCompression))
+	if err != nil {
+		t.Fatalf("unable to create file store: %s", err)
+	}
+
+	ts, err := NewTraceStore(db, fs)
+	if err != nil {
+		t.Fatalf("unable to create trace store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err := ts.Save(tx, 1, nil); err != nil {
+		t.Fatalf("unable to save empty trace: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_traces", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	trace := []byte(`{"traceEvents":[{"name":"navigationStart","ph":"R","ts":1}]}`)
+	if err := ts.Save(tx, 1, trace); err != nil {
+		t.Fatalf("unable to save trace: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_traces", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var tracePath string
+	var size int
+	if err := tx.QueryRow("select path, org_size from fact_traces where session_id = 1").Scan(&tracePath, &size); err != nil {
+		t.Fatalf("unable to read trace: %s", err)
+	}
+
+	if size != len(trace) {
+		t.Fatalf("expected size of trace to be %d, but received: %d", len(trace), size)
+	}
+
+	f, err := os.Open(tracePath)
+	if err != nil {
+		t.Fatalf("unable to open trace: %s", err)
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unable to decompress trace: %s", err)
+	}
+
+	stored, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read trace: %s", err)
+	}
+
+	if !bytes.Equal(stored, trace) {
+		t.Fatalf("expected stored trace to equal the trace, but received: %s", stored)
+	}
+}
+
+func TestManifestStore(t *testing.T) {
+	db, path, err := getDB("manifest-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	dir, err := ioutil.TempDir("", "manifest-store-test")
+	if err != nil {
+		t.Fatalf("unable to create directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("unable to create file store: %s", err)
+	}
+
+	ms, err := NewManifestStore(db, fs)
+	if err != nil {
+		t.Fatalf("unable to create manifest store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err := ms.Save(tx, 1, nil); err != nil {
+		t.Fatalf("unable to save missing manifest: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_manifests", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := []byte(`{"name": "AAU Portal", "start_url": "/", "icons": [{"src": "/icon.png", "sizes": "192x192"}]}`)
+	m := &kraaler.WebManifest{
+		URL:      "http://aau.dk/manifest.json",
+		Raw:      raw,
+		Name:     "AAU Portal",
+		StartURL: "http://aau.dk/",
+		Icons: []kraaler.ManifestIcon{
+			{Src: "http://aau.dk/icon.png", Sizes: "192x192"},
 		},
 	}
+	if err := ms.Save(tx, 1, m); err != nil {
+		t.Fatalf("unable to save manifest: %s", err)
+	}
 
-	table := "fact_actions"
+	if err := tableMustBeOfSize(tx, "fact_manifests", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_manifest_icons", len(m.Icons)); err != nil {
+		t.Fatal(err)
+	}
+
+	var name, manifestPath string
+	if err := tx.QueryRow("select name, path from fact_manifests where session_id = 1").Scan(&name, &manifestPath); err != nil {
+		t.Fatalf("unable to read manifest: %s", err)
+	}
+
+	if name != m.Name {
+		t.Fatalf("expected manifest name %q, but received: %q", m.Name, name)
+	}
+
+	stored, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatalf("unable to read stored manifest: %s", err)
+	}
+
+	if !bytes.Equal(stored, raw) {
+		t.Fatalf("expected stored manifest to equal the manifest, but received: %s", stored)
+	}
+}
+
+func TestSetCookieStore(t *testing.T) {
+	db, path, err := getDB("set-cookie-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	ss, err := NewSetCookieStore(db)
+	if err != nil {
+		t.Fatalf("unable to create set cookie store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	a := &kraaler.CrawlAction{
+		Response: &network.Response{Headers: network.Headers([]byte(
+			`{"Set-Cookie": "sid=42; Domain=aau.dk; Path=/; Expires=Wed, 21 Oct 2026 07:28:00 GMT; Max-Age=3600; Secure; HttpOnly; SameSite=Lax\nlogout=; Max-Age=0"}`,
+		))},
+	}
+	if err := ss.Save(tx, 7, a.ResponseCookies()); err != nil {
+		t.Fatalf("unable to save cookies: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_set_cookies", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var name, value, domain, cpath, sameSite string
+	var expires, maxAge int64
+	var secure, httpOnly bool
+	if err := tx.QueryRow("select name, value, domain, path, expires, max_age, secure, http_only, same_site from fact_set_cookies where action_id = 7 and name = 'sid'").
+		Scan(&name, &value, &domain, &cpath, &expires, &maxAge, &secure, &httpOnly, &sameSite); err != nil {
+		t.Fatalf("unable to read cookie: %s", err)
+	}
+
+	if value != "42" || domain != "aau.dk" || cpath != "/" || expires != 1792567680 || maxAge != 3600 || !secure || !httpOnly || sameSite != "Lax" {
+		t.Fatalf("unexpected attributes of cookie: %s=%s domain=%s path=%s expires=%d max-age=%d secure=%t httponly=%t samesite=%s",
+			name, value, domain, cpath, expires, maxAge, secure, httpOnly, sameSite)
+	}
+
+	var deleted sql.NullInt64
+	var logoutDomain sql.NullString
+	if err := tx.QueryRow("select max_age, domain from fact_set_cookies where name = 'logout'").Scan(&deleted, &logoutDomain); err != nil {
+		t.Fatalf("unable to read cookie: %s", err)
+	}
+
+	if !deleted.Valid || deleted.Int64 != 0 || logoutDomain.Valid {
+		t.Fatalf("expected deleted cookie without domain, but received max-age %v and domain %v", deleted, logoutDomain)
+	}
+}
+
+func TestPerformanceStore(t *testing.T) {
+	db, path, err := getDB("performance-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	ps, err := NewPerformanceStore(db)
+	if err != nil {
+		t.Fatalf("unable to create performance store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	metrics := map[string]float64{"Timestamp": 1234.5, "Nodes": 42, "JSHeapUsedSize": 1048576}
+	if err := ps.Save(tx, 1, metrics); err != nil {
+		t.Fatalf("unable to save performance metrics: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_performance_metrics", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range metrics {
+		var value float64
+		if err := tx.QueryRow(`select f.value from fact_performance_metrics f
+join dim_performance_metrics d on d.id = f.metric_id where d.name = ?`, name).Scan(&value); err != nil {
+			t.Fatalf("unable to read metric %s: %s", name, err)
+		}
+
+		if value != expected {
+			t.Fatalf("unexpected value of metric %s (%f), expected: %f", name, value, expected)
+		}
+	}
+}
+
+func TestScreenStore(t *testing.T) {
+	tt := []struct {
+		name       string
+		url        string
+		screenshot kraaler.BrowserScreenshot
+	}{
+		{name: "basic", url: "http://aau.dk", screenshot: kraaler.BrowserScreenshot{
+			Screenshot: []byte("a"),
+			Kind:       "png",
+			Taken:      time.Now(),
+		}},
+	}
+
+	table := "fact_screenshots"
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			db, path, err := getDB("action-store-test")
+			db, path, err := getDB("screen-store-test")
 			if err != nil {
 				t.Fatalf("unable to create database: %s", err)
 			}
 			defer os.Remove(path)
 
-			dir, err := ioutil.TempDir("", fmt.Sprintf("action-store-test-%s", tc.name))
+			dir, err := ioutil.TempDir("", fmt.Sprintf("screen-store-screenshotstore-test-%s", tc.name))
 			if err != nil {
 				t.Fatalf("error when creating temp dir: %s", err)
 			}
 			defer os.RemoveAll(dir)
 
-			fs, err := NewFileStore(dir, WithCompression(GzipCompression))
-			if err != nil {
-				t.Fatalf("unable to create file store: %s", err)
-			}
-
-			as, err := NewActionStore(db, fs)
+			ss, err := NewScreenStore(db, NewScreenshotStore(dir))
 			if err != nil {
-				t.Fatalf("unable to create action store: %s", err)
+				t.Fatalf("unable to create screen store: %s", err)
 			}
 
-			tx, err := db.Begin()
+			tx, err := Begin(db)
 			if err != nil {
 				t.Fatalf("unable to create transaction: %s", err)
 			}
 			defer tx.Rollback()
 
-			if err := as.Save(tx, 1, []*kraaler.CrawlAction{&tc.action}); err != nil {
+			if err := ss.Save(tx, 1, tc.url, []*kraaler.BrowserScreenshot{&tc.screenshot}); err != nil {
 				t.Fatalf("unable to save: %s", err)
 			}
 
@@ -436,22 +1159,1040 @@ func TestActionStore(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			for table, diff := range tc.tableDiff {
-				if err := tableMustBeOfSize(tx, table, diff); err != nil {
-					t.Fatal(err)
-				}
-			}
-
 			if err := integerFieldsNonZero(tx, table,
 				"session_id",
-				"method_id",
-				"protocol_id",
-				"host_id",
-				"initiator_id",
-				"status_code",
+				"time_taken",
 			); err != nil {
 				t.Fatal(err)
 			}
 		})
 	}
 }
+
+func TestScreenStoreEncoding(t *testing.T) {
+	var raw bytes.Buffer
+	if err := png.Encode(&raw, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("unable to encode screenshot: %s", err)
+	}
+
+	tt := []struct {
+		name    string
+		kind    string
+		format  string
+		magic   []byte
+		err     error
+		saveErr error
+	}{
+		{name: "as taken", magic: []byte("\x89PNG")},
+		{name: "jpeg", format: "jpeg", magic: []byte{0xff, 0xd8}},
+		{name: "unsupported", format: "gif", err: ScreenFormatErr},
+		{name: "webp to png", kind: "webp", format: "png", saveErr: ScreenDecodeErr},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, path, err := getDB("screen-store-encoding-test")
+			if err != nil {
+				t.Fatalf("unable to create database: %s", err)
+			}
+			defer os.Remove(path)
+
+			dir, err := ioutil.TempDir("", "screen-store-encoding-test")
+			if err != nil {
+				t.Fatalf("error when creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			ss, err := NewScreenStore(db, NewScreenshotStore(dir), WithScreenEncoding(tc.format))
+			if err != tc.err {
+				t.Fatalf("unexpected error (%v), expected: %v", err, tc.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			tx, err := Begin(db)
+			if err != nil {
+				t.Fatalf("unable to create transaction: %s", err)
+			}
+			defer tx.Rollback()
+
+			kind := tc.kind
+			if kind == "" {
+				kind = "png"
+			}
+
+			// screenshots which cannot be stored are rejected before crawling
+			if err := ss.AcceptScreenshotFormat(kind); (err == nil) != (tc.saveErr == nil) {
+				t.Fatalf("unexpected acceptance of %s screenshots: %v", kind, err)
+			}
+
+			screen := &kraaler.BrowserScreenshot{
+				Screenshot: raw.Bytes(),
+				Resolution: kraaler.Resolution{Width: 4, Height: 4},
+				Kind:       kind,
+				Taken:      time.Now(),
+			}
+			if err := ss.Save(tx, 1, "aau.dk", []*kraaler.BrowserScreenshot{screen}); err != tc.saveErr {
+				t.Fatalf("unexpected error when saving (%v), expected: %v", err, tc.saveErr)
+			}
+
+			if tc.saveErr != nil {
+				return
+			}
+
+			var stored, format string
+			if err := tx.QueryRow("select path, format from fact_screenshots").Scan(&stored, &format); err != nil {
+				t.Fatalf("unable to read screenshot: %s", err)
+			}
+
+			expected := tc.format
+			if expected == "" {
+				expected = "png"
+			}
+
+			if format != expected || !strings.HasSuffix(stored, "."+expected) {
+				t.Fatalf("expected screenshot stored as %s, but was: %s (%s)", expected, format, stored)
+			}
+
+			content, err := ioutil.ReadFile(stored)
+			if err != nil {
+				t.Fatalf("unable to read stored screenshot: %s", err)
+			}
+
+			if !bytes.HasPrefix(content, tc.magic) {
+				t.Fatalf("expected screenshot to be encoded as %s", expected)
+			}
+		})
+	}
+}
+
+func TestActionStore(t *testing.T) {
+	tt := []struct {
+		name      string
+		action    kraaler.CrawlAction
+		tableDiff map[string]int
+		postData  []byte
+		warm      bool
+	}{
+		{
+			name: "basic",
+			action: kraaler.CrawlAction{
+				Initiator: kraaler.Initiator{
+					Kind: "script",
+					Stack: &kraaler.CallFrame{
+						Column:     2,
+						LineNumber: 25,
+						Function:   func(s string) *string { return &s }("some_func"),
+					},
+				},
+				Host: kraaler.Host{
+					Domain:  "aau.dk",
+					IPAddrs: []string{"8.8.8.8", "8.8.4.4", "2001:4860:4860::8888"},
+				},
+				Request: network.Request{
+					URL:    "http://aau.dk",
+					Method: "GET",
+					Headers: network.Headers([]byte(
+						`{ "User-Agent": "Chrome", "Date": "Today"}`,
+					)),
+					PostData: func(s string) *string { return &s }("some_post"),
+				},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers: network.Headers([]byte(
+						`{ "Server": "nginx" }`,
+					)),
+					MimeType: "text/plain",
+					SecurityDetails: &network.SecurityDetails{
+						Protocol: "Test",
+						Issuer:   "Test",
+					},
+				},
+				Body: &kraaler.ResponseBody{
+					Body: []byte("hello world"),
+				},
+			},
+			tableDiff: map[string]int{
+				"dim_methods":    1,
+				"dim_hosts":      1,
+				"dim_asns":       0,
+				"dim_protocols":  2,
+				"dim_initiators": 1,
+				"fact_actions":   1,
+
+				"dim_header_keyvalues":  3,
+				"fact_response_headers": 1,
+				"fact_request_headers":  2,
+
+				"dim_url_schemes":     1,
+				"dim_url_users":       0,
+				"dim_url_hosts":       1,
+				"dim_url_paths":       1,
+				"dim_url_fragments":   0,
+				"dim_url_raw_queries": 0,
+				"fact_urls":           1,
+
+				"dim_mime_types": 2,
+				"fact_bodies":    1,
+
+				"fact_post_data":       1,
+				"fact_initiator_stack": 1,
+
+				"dim_issuers":           1,
+				"dim_key_exchanges":     1,
+				"dim_ciphers":           1,
+				"dim_san_lists":         1,
+				"fact_security_details": 1,
+			},
+		},
+		{
+			name: "large post data",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://aau.dk",
+					Method:  "POST",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "script"},
+				Host:      kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{}`)),
+				},
+				PostData: append([]byte("\x00\xff"), bytes.Repeat([]byte("x"), 100000)...),
+			},
+			tableDiff: map[string]int{
+				"fact_post_data": 1,
+			},
+			postData: append([]byte("\x00\xff"), bytes.Repeat([]byte("x"), 100000)...),
+		},
+		{
+			name: "warm cached",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://aau.dk/logo.png",
+					Method:  "GET",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "parser"},
+				Host:      kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{}`)),
+				},
+				FromCache: true,
+			},
+			warm: true,
+		},
+		{
+			name: "proxy cache hit",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://aau.dk/app.js",
+					Method:  "GET",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "parser"},
+				Host:      kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{"X-Kraaler-Cache": "hit"}`)),
+				},
+				ProxyCache: kraaler.CacheHit,
+			},
+		},
+		{
+			name: "remote address",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://aau.dk/",
+					Method:  "GET",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "user"},
+				Host:      kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+				Response: &network.Response{
+					Status:     http.StatusNotFound,
+					StatusText: "Not Found",
+					Protocol:   func(s string) *string { return &s }("http"),
+					Headers:    network.Headers([]byte(`{}`)),
+				},
+				RemoteIP:   "130.225.198.143",
+				RemotePort: 443,
+			},
+		},
+		{
+			name: "render blocking",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:             "http://aau.dk/style.css",
+					Method:          "GET",
+					Headers:         network.Headers([]byte(`{}`)),
+					InitialPriority: network.ResourcePriorityVeryHigh,
+				},
+				Initiator: kraaler.Initiator{Kind: "parser"},
+				Host:      kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{}`)),
+				},
+				RenderBlocking: true,
+			},
+		},
+		{
+			name: "asn",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://aau.dk/",
+					Method:  "GET",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "user"},
+				Host: kraaler.Host{
+					Domain:  "aau.dk",
+					IPAddrs: []string{"130.225.198.143"},
+					PTR:     "web.aau.dk.",
+					ASN:     kraaler.ASN{Number: 1878, Org: "AAU-NET Aalborg University, DK"},
+				},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{}`)),
+				},
+			},
+			tableDiff: map[string]int{
+				"dim_asns": 1,
+			},
+		},
+		{
+			name: "set cookies",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://aau.dk/login",
+					Method:  "POST",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "user"},
+				Host:      kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{"Set-Cookie": "sid=42; Secure\nconsent=yes"}`)),
+				},
+			},
+			tableDiff: map[string]int{
+				"fact_set_cookies": 2,
+			},
+		},
+		{
+			name: "dns records",
+			action: kraaler.CrawlAction{
+				Request: network.Request{
+					URL:     "http://www.aau.dk",
+					Method:  "GET",
+					Headers: network.Headers([]byte(`{}`)),
+				},
+				Initiator: kraaler.Initiator{Kind: "user"},
+				Host: kraaler.Host{
+					Domain:     "www.aau.dk",
+					IPAddrs:    []string{"10.0.0.1"},
+					NameServer: "10.0.0.53:53",
+					DNSRecords: []kraaler.DNSRecord{
+						{Name: "www.aau.dk.", Type: "CNAME", Value: "web.aau.dk.", TTL: 3600},
+						{Name: "web.aau.dk.", Type: "A", Value: "10.0.0.1", TTL: 30},
+					},
+				},
+				Response: &network.Response{
+					Status:   http.StatusOK,
+					Protocol: func(s string) *string { return &s }("http"),
+					Headers:  network.Headers([]byte(`{}`)),
+				},
+			},
+			tableDiff: map[string]int{
+				"fact_dns": 2,
+			},
+		},
+	}
+
+	table := "fact_actions"
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, path, err := getDB("action-store-test")
+			if err != nil {
+				t.Fatalf("unable to create database: %s", err)
+			}
+			defer os.Remove(path)
+
+			dir, err := ioutil.TempDir("", fmt.Sprintf("action-store-test-%s", tc.name))
+			if err != nil {
+				t.Fatalf("error when creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			fs, err := NewFileStore(dir, WithCompression(GzipCompression))
+			if err != nil {
+				t.Fatalf("unable to create file store: %s", err)
+			}
+
+			as, err := NewActionStore(db, fs)
+			if err != nil {
+				t.Fatalf("unable to create action store: %s", err)
+			}
+
+			tx, err := Begin(db)
+			if err != nil {
+				t.Fatalf("unable to create transaction: %s", err)
+			}
+			defer tx.Rollback()
+
+			if _, err := as.savePass(tx, 1, []*kraaler.CrawlAction{&tc.action}, tc.warm); err != nil {
+				t.Fatalf("unable to save: %s", err)
+			}
+
+			var warm, fromCache bool
+			var proxyCache sql.NullString
+			if err := tx.QueryRow("SELECT warm, from_cache, proxy_cache FROM fact_actions").Scan(&warm, &fromCache, &proxyCache); err != nil {
+				t.Fatalf("unable to read action: %s", err)
+			}
+
+			if warm != tc.warm || fromCache != tc.action.FromCache {
+				t.Fatalf("unexpected warm (%t) and from cache (%t) of action", warm, fromCache)
+			}
+
+			if proxyCache.String != tc.action.ProxyCache {
+				t.Fatalf("unexpected proxy cache status %q, expected: %q", proxyCache.String, tc.action.ProxyCache)
+			}
+
+			var ipv4, ipAddrs string
+			if err := tx.QueryRow("SELECT ipv4, ip_addrs FROM dim_hosts").Scan(&ipv4, &ipAddrs); err != nil {
+				t.Fatalf("unable to read host: %s", err)
+			}
+
+			if ipv4 != tc.action.Host.IPAddr() || ipAddrs != strings.Join(tc.action.Host.IPAddrs, ",") {
+				t.Fatalf("unexpected addresses of host %s (%s)", ipv4, ipAddrs)
+			}
+
+			var asn sql.NullInt64
+			var org, ptr sql.NullString
+			if err := tx.QueryRow(`SELECT a.asn, a.org, a.ptr FROM dim_hosts h
+LEFT JOIN dim_asns a ON h.asn_id = a.id`).Scan(&asn, &org, &ptr); err != nil {
+				t.Fatalf("unable to read asn: %s", err)
+			}
+
+			if uint32(asn.Int64) != tc.action.Host.ASN.Number || org.String != tc.action.Host.ASN.Org || ptr.String != tc.action.Host.PTR {
+				t.Fatalf("unexpected asn of host %d %s (%s)", asn.Int64, org.String, ptr.String)
+			}
+
+			var statusText, remoteIP sql.NullString
+			var remotePort sql.NullInt64
+			if err := tx.QueryRow("SELECT status_text, remote_ip, remote_port FROM fact_actions").Scan(&statusText, &remoteIP, &remotePort); err != nil {
+				t.Fatalf("unable to read action: %s", err)
+			}
+
+			if statusText.String != tc.action.Response.StatusText {
+				t.Fatalf("unexpected status text: %s", statusText.String)
+			}
+
+			if remoteIP.String != tc.action.RemoteIP || int(remotePort.Int64) != tc.action.RemotePort {
+				t.Fatalf("unexpected remote address %s:%d", remoteIP.String, remotePort.Int64)
+			}
+
+			var priority sql.NullString
+			var blocking bool
+			if err := tx.QueryRow(`SELECT p.priority, a.render_blocking FROM fact_actions a
+LEFT JOIN dim_priorities p ON a.priority_id = p.id`).Scan(&priority, &blocking); err != nil {
+				t.Fatalf("unable to read priority: %s", err)
+			}
+
+			if priority.String != string(tc.action.Request.InitialPriority) || blocking != tc.action.RenderBlocking {
+				t.Fatalf("unexpected priority %s (render blocking: %t)", priority.String, blocking)
+			}
+
+			if err := tableMustBeOfSize(tx, table, 1); err != nil {
+				t.Fatal(err)
+			}
+
+			for table, diff := range tc.tableDiff {
+				if err := tableMustBeOfSize(tx, table, diff); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, r := range tc.action.Host.DNSRecords {
+				var ttl uint32
+				var server string
+				if err := tx.QueryRow("SELECT ttl, name_server FROM fact_dns WHERE type = ? AND value = ?", r.Type, r.Value).Scan(&ttl, &server); err != nil {
+					t.Fatalf("unable to read dns record: %s", err)
+				}
+
+				if ttl != r.TTL || server != tc.action.Host.NameServer {
+					t.Fatalf("unexpected ttl %d of %s record answered by %s", ttl, r.Type, server)
+				}
+			}
+
+			if err := integerFieldsNonZero(tx, table,
+				"session_id",
+				"method_id",
+				"protocol_id",
+				"host_id",
+				"initiator_id",
+				"status_code",
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.postData != nil {
+				var data []byte
+				if err := tx.QueryRow("SELECT data FROM fact_post_data").Scan(&data); err != nil {
+					t.Fatalf("unable to read post data: %s", err)
+				}
+
+				if !bytes.Equal(data, tc.postData) {
+					t.Fatalf("expected post data of %d bytes, but received %d bytes", len(tc.postData), len(data))
+				}
+			}
+		})
+	}
+}
+
+func TestBodyStore(t *testing.T) {
+	tt := []struct {
+		name     string
+		body     []byte
+		charset  string
+		encoded  int64
+		storage  string
+		rendered bool
+	}{
+		{name: "small inline", body: []byte("tiny body!"), storage: "inline"},
+		{name: "charset", body: []byte("caf\xe9"), charset: "iso-8859-1", storage: "inline"},
+		{name: "large on disk", body: []byte(strings.Repeat("large body ", 100)), storage: "file"},
+		{name: "encoded size", body: []byte(strings.Repeat("large body ", 100)), encoded: 64, storage: "file"},
+		{name: "rendered", body: []byte("<html><body>" + strings.Repeat("<p>rendered</p>", 100) + "</body></html>"), storage: "file", rendered: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, path, err := getDB("body-store-test")
+			if err != nil {
+				t.Fatalf("unable to create database: %s", err)
+			}
+			defer os.Remove(path)
+
+			dir, err := ioutil.TempDir("", "body-store-test")
+			if err != nil {
+				t.Fatalf("error when creating temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			fs, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatalf("unable to create file store: %s", err)
+			}
+
+			bs, err := NewBodyStore(db, fs, WithInlineBodies(512))
+			if err != nil {
+				t.Fatalf("unable to create body store: %s", err)
+			}
+
+			tx, err := Begin(db)
+			if err != nil {
+				t.Fatalf("unable to create transaction: %s", err)
+			}
+			defer tx.Rollback()
+
+			save := func() error {
+				return bs.Save(tx, 1, kraaler.ResponseBody{Body: tc.body, Charset: tc.charset, EncodedSize: tc.encoded}, "text/plain")
+			}
+			if tc.rendered {
+				save = func() error { return bs.SaveRendered(tx, 1, tc.body) }
+			}
+
+			if err := save(); err != nil {
+				t.Fatalf("unable to save body: %s", err)
+			}
+
+			var storage string
+			var fpath, charset sql.NullString
+			var encoded sql.NullInt64
+			var data []byte
+			var rendered bool
+			if err := tx.QueryRow("select storage, path, data, charset, encoded_size, rendered from fact_bodies").Scan(&storage, &fpath, &data, &charset, &encoded, &rendered); err != nil {
+				t.Fatalf("unable to read body: %s", err)
+			}
+
+			if rendered != tc.rendered {
+				t.Fatalf("unexpected rendered marker %t, expected: %t", rendered, tc.rendered)
+			}
+
+			if encoded.Int64 != tc.encoded {
+				t.Fatalf("unexpected encoded size %d, expected: %d", encoded.Int64, tc.encoded)
+			}
+
+			if charset.String != tc.charset {
+				t.Fatalf("unexpected charset %s, expected: %s", charset.String, tc.charset)
+			}
+
+			if storage != tc.storage {
+				t.Fatalf("unexpected storage mode %s, expected: %s", storage, tc.storage)
+			}
+
+			files, _ := ioutil.ReadDir(dir)
+			switch tc.storage {
+			case "inline":
+				if !bytes.Equal(data, tc.body) || fpath.Valid || len(files) != 0 {
+					t.Fatalf("expected body to only be stored inline")
+				}
+			case "file":
+				if data != nil || !fpath.Valid || len(files) != 1 {
+					t.Fatalf("expected body to only be stored on disk")
+				}
+			}
+		})
+	}
+}
+
+func TestWebSocketStore(t *testing.T) {
+	db, path, err := getDB("websocket-store-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+
+	dir, err := ioutil.TempDir("", "websocket-store-test")
+	if err != nil {
+		t.Fatalf("error when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("unable to create file store: %s", err)
+	}
+
+	as, err := NewActionStore(db, fs)
+	if err != nil {
+		t.Fatalf("unable to create action store: %s", err)
+	}
+
+	wss, err := NewWebSocketStore(db)
+	if err != nil {
+		t.Fatalf("unable to create websocket store: %s", err)
+	}
+
+	tx, err := Begin(db)
+	if err != nil {
+		t.Fatalf("unable to create transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	handshake := &kraaler.CrawlAction{
+		Initiator: kraaler.Initiator{Kind: "websocket"},
+		Request: network.Request{
+			URL:     "ws://aau.dk/socket",
+			Method:  "GET",
+			Headers: network.Headers([]byte(`{"Upgrade": "websocket"}`)),
+		},
+		Response: &network.Response{
+			Status:  http.StatusSwitchingProtocols,
+			Headers: network.Headers([]byte(`{"Connection": "Upgrade"}`)),
+		},
+	}
+
+	acids, err := as.save(tx, 1, []*kraaler.CrawlAction{handshake})
+	if err != nil {
+		t.Fatalf("unable to save actions: %s", err)
+	}
+
+	sockets := []*kraaler.WebSocket{{URL: "ws://aau.dk/socket", Handshake: handshake}}
+	frames := []*kraaler.WebSocketFrame{
+		{Socket: sockets[0], Direction: "sent", Opcode: 1, PayloadLength: 5, Timestamp: 1},
+		{Socket: sockets[0], Direction: "received", Opcode: 2, PayloadLength: 3, Timestamp: 2},
+	}
+	if err := wss.Save(tx, 1, acids, sockets, frames); err != nil {
+		t.Fatalf("unable to save websockets: %s", err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_websockets", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tableMustBeOfSize(tx, "fact_websocket_frames", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var wsURL string
+	if err := tx.QueryRow(`select ws.url from fact_websocket_frames f
+join fact_websockets ws on ws.id = f.websocket_id where f.direction = 'received'`).Scan(&wsURL); err != nil {
+		t.Fatalf("unable to read websocket of frame: %s", err)
+	}
+
+	if wsURL != "ws://aau.dk/socket" {
+		t.Fatalf("unexpected websocket url of frame: %s", wsURL)
+	}
+
+	var status int
+	if err := tx.QueryRow(`select a.status_code from fact_websockets ws
+join fact_actions a on a.id = ws.action_id`).Scan(&status); err != nil {
+		t.Fatalf("unable to read handshake of websocket: %s", err)
+	}
+
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected handshake status %d, expected: %d", status, http.StatusSwitchingProtocols)
+	}
+}
+
+func TestStoreBodyMimeTypes(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tt := []struct {
+		name     string
+		opts     []StoreOpt
+		expected int
+	}{
+		{name: "default text", expected: 1},
+		{name: "any", opts: []StoreOpt{WithBodyMimeTypes(MimeAny)}, expected: 2},
+		{name: "images", opts: []StoreOpt{WithBodyMimeTypes(func(s string) bool { return strings.HasPrefix(s, "image/") })}, expected: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, path, err := getDB("store-mime-test")
+			if err != nil {
+				t.Fatalf("unable to create database: %s", err)
+			}
+			defer os.Remove(path)
+			defer db.Close()
+
+			dir, err := ioutil.TempDir("", "store-mime-test")
+			if err != nil {
+				t.Fatalf("unable to create temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			s, err := NewStore(db, dir, dir, tc.opts...)
+			if err != nil {
+				t.Fatalf("unable to create store: %s", err)
+			}
+
+			u, _ := url.Parse("http://aau.dk")
+			action := func(path string, body []byte) *kraaler.CrawlAction {
+				return &kraaler.CrawlAction{
+					Request:  network.Request{URL: "http://aau.dk" + path, Method: "GET", Headers: network.Headers("{}")},
+					Response: &network.Response{Status: 200, Headers: network.Headers("{}")},
+					Body:     &kraaler.ResponseBody{Body: body},
+				}
+			}
+
+			err = s.SaveSession(kraaler.Page{
+				InitialURL:     u,
+				Resolution:     "800x600",
+				NavigateTime:   time.Now(),
+				LoadedTime:     time.Now(),
+				TerminatedTime: time.Now(),
+				Actions: []*kraaler.CrawlAction{
+					action("/", []byte("<html><body>hello</body></html>")),
+					action("/logo.png", png),
+				},
+			})
+			if err != nil {
+				t.Fatalf("unable to save session: %s", err)
+			}
+
+			var n int
+			if err := db.QueryRow("select count(*) from fact_bodies where path is not null").Scan(&n); err != nil {
+				t.Fatalf("unable to count bodies: %s", err)
+			}
+
+			if n != tc.expected {
+				t.Fatalf("expected %d stored bodies, but stored: %d", tc.expected, n)
+			}
+		})
+	}
+}
+
+func TestStoreConcurrentSaveSession(t *testing.T) {
+	db, path, err := getDB("store-concurrent-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "store-concurrent-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(db, dir, dir)
+	if err != nil {
+		t.Fatalf("unable to create store: %s", err)
+	}
+
+	workers, sessions := 8, 5
+	errs := make(chan error, workers*sessions)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < sessions; j++ {
+				u, _ := url.Parse(fmt.Sprintf("http://aau.dk/%d/%d", i, j))
+				errs <- s.SaveSession(kraaler.Page{
+					InitialURL:     u,
+					Resolution:     "800x600",
+					NavigateTime:   time.Now(),
+					LoadedTime:     time.Now(),
+					TerminatedTime: time.Now(),
+					Actions: []*kraaler.CrawlAction{{
+						Request:  network.Request{URL: u.String(), Method: "GET", Headers: network.Headers("{}")},
+						Response: &network.Response{Status: 200, Headers: network.Headers("{}")},
+						Host:     kraaler.Host{Domain: "aau.dk", IPAddrs: []string{"8.8.8.8"}},
+						Body:     &kraaler.ResponseBody{Body: []byte(fmt.Sprintf("<html>%d</html>", j))},
+					}},
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("unable to save session concurrently: %s", err)
+		}
+	}
+
+	for table, size := range map[string]int{
+		"fact_sessions":   workers * sessions,
+		"fact_actions":    workers * sessions,
+		"dim_resolutions": 1,
+		"dim_hosts":       1,
+	} {
+		var n int
+		if err := db.QueryRow(fmt.Sprintf("select count(*) from %s", table)).Scan(&n); err != nil {
+			t.Fatalf("unable to count %s: %s", table, err)
+		}
+
+		if n != size {
+			t.Fatalf("expected %d row(s) in %s, but found: %d", size, table, n)
+		}
+	}
+}
+
+func TestStoreIndexes(t *testing.T) {
+	db, path, err := getDB("store-indexes-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+	defer db.Close()
+
+	dir, err := ioutil.TempDir("", "store-indexes-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewStore(db, dir, dir); err != nil {
+		t.Fatalf("unable to create store: %s", err)
+	}
+
+	// the schemas are created again on every store, as when reopening a database
+	if _, err := NewStore(db, dir, dir); err != nil {
+		t.Fatalf("unable to create store on existing database: %s", err)
+	}
+
+	for _, idx := range []string{
+		"dim_methods_key",
+		"dim_url_hosts_key",
+		"dim_header_keyvalues_key",
+		"fact_actions_session_id",
+		"fact_urls_action_id",
+		"fact_response_headers_action_id",
+	} {
+		var n int
+		if err := db.QueryRow("select count(*) from sqlite_master where type = 'index' and name = ?", idx).Scan(&n); err != nil {
+			t.Fatalf("unable to look up index: %s", err)
+		}
+
+		if n != 1 {
+			t.Fatalf("expected index %s to exist", idx)
+		}
+	}
+
+	tt := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{name: "method", query: "insert into dim_methods (method) values (?)", args: []interface{}{"GET"}},
+		{name: "url host", query: "insert into dim_url_hosts (host) values (?)", args: []interface{}{"aau.dk"}},
+		{name: "header keyvalue", query: "insert into dim_header_keyvalues (key_id, value) values (?, ?)", args: []interface{}{1, "text/html"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := db.Exec(tc.query, tc.args...); err != nil {
+				t.Fatalf("unable to insert value: %s", err)
+			}
+
+			if _, err := db.Exec(tc.query, tc.args...); err == nil {
+				t.Fatalf("expected duplicate value to be rejected")
+			}
+		})
+	}
+}
+
+func TestStoreMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store-migration-test")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	open := func(db *sql.DB) (*Store, error) {
+		s, err := NewStore(db, dir, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := NewURLStore(db); err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+
+	fresh, freshPath, err := getDB("store-migration-fresh-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(freshPath)
+	defer fresh.Close()
+
+	if _, err := open(fresh); err != nil {
+		t.Fatalf("unable to create store on fresh database: %s", err)
+	}
+
+	db, path, err := getDB("store-migration-test")
+	if err != nil {
+		t.Fatalf("unable to create database: %s", err)
+	}
+	defer os.Remove(path)
+	defer db.Close()
+
+	baseline, err := ioutil.ReadFile("testdata/baseline.sql")
+	if err != nil {
+		t.Fatalf("unable to read baseline schema: %s", err)
+	}
+
+	if _, err := db.Exec(string(baseline)); err != nil {
+		t.Fatalf("unable to create baseline schema: %s", err)
+	}
+
+	// earlier versions could store the same dimension twice
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec("insert into dim_methods (method) values (?)", "GET"); err != nil {
+			t.Fatalf("unable to insert method: %s", err)
+		}
+	}
+
+	s, err := open(db)
+	if err != nil {
+		t.Fatalf("unable to create store on baseline database: %s", err)
+	}
+
+	want, err := tableColumns(fresh)
+	if err != nil {
+		t.Fatalf("unable to read columns of fresh database: %s", err)
+	}
+
+	got, err := tableColumns(db)
+	if err != nil {
+		t.Fatalf("unable to read columns of baseline database: %s", err)
+	}
+
+	for col := range want {
+		if !got[col] {
+			t.Errorf("expected column %s to be added to baseline database", col)
+		}
+	}
+
+	u, _ := url.Parse("https://aau.dk")
+	err = s.SaveSession(kraaler.Page{
+		InitialURL:     u,
+		Resolution:     "800x600",
+		NavigateTime:   time.Now(),
+		LoadedTime:     time.Now(),
+		TerminatedTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("unable to save session in baseline database: %s", err)
+	}
+
+	var n int
+	if err := db.QueryRow("select count(*) from sqlite_master where type = 'index' and name = ?", "dim_methods_key").Scan(&n); err != nil {
+		t.Fatalf("unable to look up index: %s", err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected index of duplicate dimension to exist")
+	}
+
+	// migrated databases are opened like any other
+	if _, err := open(db); err != nil {
+		t.Fatalf("unable to create store on migrated database: %s", err)
+	}
+}
+
+// tableColumns returns the columns of every table in db as table.column
+func tableColumns(db *sql.DB) (map[string]bool, error) {
+	rows, err := db.Query("select name from sqlite_master where type = 'table'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	cols := map[string]bool{}
+	for _, table := range tables {
+		rows, err := db.Query(fmt.Sprintf("pragma table_info(%s)", table))
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var cid, notNull, pk int
+			var name, typ string
+			var dflt sql.NullString
+			if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			cols[table+"."+name] = true
+		}
+		rows.Close()
+	}
+
+	return cols, nil
+}
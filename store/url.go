@@ -1,11 +1,14 @@
 package store
 
 import (
+	"container/list"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +18,8 @@ import (
 )
 
 var (
-	StoreIsEmptyErr = errors.New("store is empty")
+	StoreIsEmptyErr      = errors.New("store is empty")
+	BloomWithoutEvictErr = errors.New("bloom filter requires urls to be evicted from memory")
 )
 
 type URLFilter func(*url.URL) bool
@@ -27,9 +31,35 @@ type urlStore struct {
 	resampling bool
 	filters    []URLFilter
 
-	strings map[string]*url.URL
-	urls    map[*url.URL]*time.Time
-	ids     map[*url.URL]int64
+	// maxFailures is the amount of consecutive failed crawls after which
+	// a url is no longer sampled, 0 means urls are never dropped
+	maxFailures int
+
+	// prioritize samples urls of the highest priority first
+	prioritize bool
+
+	// maxInMemory is the amount of urls kept in memory before visited urls
+	// are evicted, 0 means every url is kept
+	maxInMemory int
+
+	// seen holds every stored url, when set, such that urls not in memory
+	// are only looked up in the database when they might be stored
+	seen *bloomFilter
+
+	// evictable orders the urls which may be evicted from memory by when
+	// they were last visited, such that the least recently visited urls
+	// are evicted first
+	evictable   *list.List
+	evictableAt map[*url.URL]*list.Element
+
+	strings    map[string]*url.URL
+	urls       map[*url.URL]*time.Time
+	sampled    map[*url.URL]struct{}
+	ids        map[*url.URL]int64
+	depths     map[*url.URL]int
+	sources    map[*url.URL]string
+	failures   map[*url.URL]int
+	priorities map[*url.URL]int
 }
 
 func OnlyTLD(ending string) func(*url.URL) bool {
@@ -43,6 +73,50 @@ func OnlyTLD(ending string) func(*url.URL) bool {
 	}
 }
 
+// normalizeDomain lowercases domain and strips its www label and trailing dot
+func normalizeDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	return strings.TrimPrefix(domain, "www.")
+}
+
+// OnlyDomain only allows urls of the registered domain (eTLD+1) of domain,
+// including its subdomains
+func OnlyDomain(domain string) URLFilter {
+	domain = normalizeDomain(domain)
+	if reg, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		domain = reg
+	}
+
+	return func(u *url.URL) bool {
+		reg, err := publicsuffix.EffectiveTLDPlusOne(normalizeDomain(u.Hostname()))
+		if err != nil {
+			return false
+		}
+
+		return reg == domain
+	}
+}
+
+// ExcludeDomains disallows urls of any of domains, including their
+// subdomains
+func ExcludeDomains(domains ...string) URLFilter {
+	excluded := make([]string, len(domains))
+	for i, d := range domains {
+		excluded[i] = normalizeDomain(d)
+	}
+
+	return func(u *url.URL) bool {
+		host := normalizeDomain(u.Hostname())
+		for _, d := range excluded {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
 type URLStoreOpt func(*urlStore)
 
 func WithURLFilters(f ...URLFilter) URLStoreOpt {
@@ -63,12 +137,52 @@ func WithNoResampling() URLStoreOpt {
 	}
 }
 
+// WithFailureThreshold stops sampling urls which failed to be crawled n
+// times in a row
+func WithFailureThreshold(n int) URLStoreOpt {
+	return func(u *urlStore) {
+		u.maxFailures = n
+	}
+}
+
+// WithPrioritySampling samples urls of the highest priority, which have not
+// been visited yet, before any other urls
+func WithPrioritySampling() URLStoreOpt {
+	return func(u *urlStore) {
+		u.prioritize = true
+	}
+}
+
+// WithMaxInMemory bounds the amount of urls kept in memory by n, exceeding
+// it evicts visited urls from memory, which are reloaded from the database
+// once no urls in memory are left to be sampled
+func WithMaxInMemory(n int) URLStoreOpt {
+	return func(u *urlStore) {
+		u.maxInMemory = n
+	}
+}
+
+// WithBloomFilter checks whether urls evicted from memory (see
+// WithMaxInMemory, without which NewURLStore fails with
+// BloomWithoutEvictErr) are already stored using a bloom filter sized for
+// expectedN urls, with a false positive rate of fpRate, rather than the
+// database. The check becomes probabilistic rather than exact, so positives
+// are confirmed by the database, such that no urls are dropped by false
+// positives.
+func WithBloomFilter(expectedN uint, fpRate float64) URLStoreOpt {
+	return func(u *urlStore) {
+		u.seen = newBloomFilter(expectedN, fpRate)
+	}
+}
+
+const urlVisitsColumns = "id, url, last_visit, depth, source, failures, priority"
+
 func NewURLStore(db *sql.DB, opts ...URLStoreOpt) (*urlStore, error) {
-	if _, err := db.Exec(urlStoreSchema); err != nil {
+	if err := execSchema(db, urlStoreSchema); err != nil {
 		return nil, err
 	}
 
-	rows, err := db.Query("select id, url, last_visit from url_visits")
+	rows, err := db.Query("select " + urlVisitsColumns + " from url_visits")
 	if err != nil {
 		return nil, err
 	}
@@ -79,40 +193,206 @@ func NewURLStore(db *sql.DB, opts ...URLStoreOpt) (*urlStore, error) {
 		sampler:    UniformSampler(),
 		resampling: true,
 		urls:       map[*url.URL]*time.Time{},
+		sampled:    map[*url.URL]struct{}{},
 		ids:        map[*url.URL]int64{},
+		depths:     map[*url.URL]int{},
+		sources:    map[*url.URL]string{},
+		failures:   map[*url.URL]int{},
+		priorities: map[*url.URL]int{},
 		strings:    map[string]*url.URL{},
+
+		evictable:   list.New(),
+		evictableAt: map[*url.URL]*list.Element{},
 	}
 
 	for _, opt := range opts {
 		opt(us)
 	}
 
-	for rows.Next() {
-		var id int64
-		var urlStr string
-		var unixTime sql.NullInt64
+	// urls in memory are looked up directly, the filter would never be used
+	if us.seen != nil && us.maxInMemory <= 0 {
+		return nil, BloomWithoutEvictErr
+	}
 
-		err = rows.Scan(&id, &urlStr, &unixTime)
-		if err != nil {
-			return nil, err
-		}
+	if us.prioritize {
+		// priorities are read while sampling, which holds the lock
+		us.sampler = PrioritySampler(func(u *url.URL) int { return us.priorities[u] }, us.sampler)
+	}
 
-		u, err := url.Parse(urlStr)
-		if err != nil {
+	for rows.Next() {
+		if err := us.load(rows); err != nil {
 			return nil, err
 		}
+	}
+	us.evict(us.maxInMemory)
 
-		us.strings[urlStr] = u
-		us.ids[u] = id
+	return us, nil
+}
+
+// load adds the url of the current row to memory, visited urls are
+// skipped when the memory is full
+func (us *urlStore) load(rows *sql.Rows) error {
+	var id int64
+	var urlStr string
+	var unixTime sql.NullInt64
+	var depth int
+	var source sql.NullString
+	var failures, priority int
+
+	err := rows.Scan(&id, &urlStr, &unixTime, &depth, &source, &failures, &priority)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := us.strings[urlStr]; ok {
+		return nil
+	}
+
+	if us.seen != nil {
+		us.seen.add(urlStr)
+	}
+
+	if unixTime.Valid && us.maxInMemory > 0 && len(us.strings) >= us.maxInMemory {
+		return nil
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return err
+	}
+
+	us.strings[urlStr] = u
+	us.ids[u] = id
+	us.depths[u] = depth
+	us.sources[u] = source.String
+	us.failures[u] = failures
+	us.priorities[u] = priority
+
+	if us.dropped(u) {
+		us.markEvictable(u)
+		return nil
+	}
+
+	if !unixTime.Valid {
 		us.urls[u] = nil
+		return nil
+	}
+
+	// urls visited by earlier runs are only crawled again when
+	// resampling
+	if us.resampling {
+		t := time.Unix(0, unixTime.Int64)
+		us.urls[u] = &t
+	}
+	us.markEvictable(u)
+
+	return nil
+}
+
+// markEvictable moves u to the back of the urls to be evicted, as it has
+// just been visited
+func (us *urlStore) markEvictable(u *url.URL) {
+	if us.maxInMemory <= 0 {
+		return
+	}
+
+	if e, ok := us.evictableAt[u]; ok {
+		us.evictable.MoveToBack(e)
+		return
+	}
+
+	us.evictableAt[u] = us.evictable.PushBack(u)
+}
+
+// unmarkEvictable keeps u in memory, as it is yet to be visited or has
+// been sampled
+func (us *urlStore) unmarkEvictable(u *url.URL) {
+	if e, ok := us.evictableAt[u]; ok {
+		us.evictable.Remove(e)
+		delete(us.evictableAt, u)
+	}
+}
+
+// evict removes visited urls from memory, least recently visited first,
+// until at most n urls are kept or only urls which are yet to be visited or
+// have been sampled are left
+func (us *urlStore) evict(n int) {
+	if us.maxInMemory <= 0 {
+		return
+	}
 
-		if unixTime.Valid && us.resampling {
-			t := time.Unix(0, unixTime.Int64)
-			us.urls[u] = &t
+	for len(us.strings) > n {
+		e := us.evictable.Front()
+		if e == nil {
+			return
 		}
+
+		u := e.Value.(*url.URL)
+		us.unmarkEvictable(u)
+
+		delete(us.strings, u.String())
+		delete(us.urls, u)
+		delete(us.ids, u)
+		delete(us.depths, u)
+		delete(us.sources, u)
+		delete(us.failures, u)
+		delete(us.priorities, u)
+	}
+}
+
+// reload replaces the visited urls in memory by the urls visited the
+// longest time ago, such that evicted urls are sampled again
+func (us *urlStore) reload() error {
+	if us.maxInMemory <= 0 || !us.resampling {
+		return nil
 	}
+	us.evict(0)
 
-	return us, nil
+	q := "select " + urlVisitsColumns + " from url_visits where last_visit is not null"
+	if us.maxFailures > 0 {
+		q += fmt.Sprintf(" and failures < %d", us.maxFailures)
+	}
+
+	rows, err := us.db.Query(q+" order by last_visit limit ?", us.maxInMemory)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := us.load(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// stored reports whether the url is stored, either in memory or, when urls
+// are evicted, in the database
+func (us *urlStore) stored(u string) (bool, error) {
+	if _, ok := us.strings[u]; ok {
+		return true, nil
+	}
+
+	if us.maxInMemory <= 0 {
+		return false, nil
+	}
+
+	if us.seen != nil && !us.seen.test(u) {
+		return false, nil
+	}
+
+	var id int64
+	err := us.db.QueryRow("select id from url_visits where url = ? limit 1", u).Scan(&id)
+	switch err {
+	case nil:
+		return true, nil
+	case sql.ErrNoRows:
+		return false, nil
+	}
+
+	return false, err
 }
 
 func (us *urlStore) Size() int {
@@ -122,37 +402,116 @@ func (us *urlStore) Size() int {
 	return n
 }
 
+// Sample picks a url to be crawled, without resampling the url is held
+// back from later samples until it is either visited or released
 func (us *urlStore) Sample() (*url.URL, error) {
-	us.m.RLock()
+	us.m.Lock()
+	defer us.m.Unlock()
+
+	if len(us.urls) == 0 {
+		if err := us.reload(); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(us.urls) == 0 {
-		us.m.RUnlock()
 		return nil, StoreIsEmptyErr
 	}
 
 	u := us.sampler(us.urls)
-	us.m.RUnlock()
 	if u == nil {
 		return nil, fmt.Errorf("sample is nil")
 	}
 
 	if !us.resampling {
-		us.m.Lock()
 		delete(us.urls, u)
-		us.m.Unlock()
+		us.sampled[u] = struct{}{}
+		us.unmarkEvictable(u)
 	}
 
 	return u, nil
 }
 
+// Release makes a sampled url, which could not be crawled, available to be
+// sampled again, and reports whether the url was held back
+func (us *urlStore) Release(u *url.URL) bool {
+	us.m.Lock()
+	defer us.m.Unlock()
+
+	if _, ok := us.sampled[u]; !ok {
+		return false
+	}
+
+	delete(us.sampled, u)
+	us.urls[u] = nil
+	us.unmarkEvictable(u)
+
+	return true
+}
+
+// dropped reports whether u failed too many times in a row to be sampled
+func (us *urlStore) dropped(u *url.URL) bool {
+	return us.maxFailures > 0 && us.failures[u] >= us.maxFailures
+}
+
 func (us *urlStore) Consume(p kraaler.URLProvider) {
+	sp, _ := p.(kraaler.SourceProvider)
+	pp, _ := p.(kraaler.PriorityProvider)
+
 	go func() {
 		for u := range p.UrlsC() {
-			us.Add(u)
+			var source string
+			if sp != nil {
+				source = sp.Source(u)
+			}
+
+			var priority int
+			if pp != nil {
+				priority = pp.Priority(u)
+			}
+
+			us.AddWithPriority(source, 0, priority, u)
 		}
 	}()
 }
 
 func (us *urlStore) Add(urls ...*url.URL) (int, error) {
+	return us.AddWithDepth(0, urls...)
+}
+
+func (us *urlStore) Source(u *url.URL) string {
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.sources[u]
+}
+
+func (us *urlStore) Depth(u *url.URL) int {
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.depths[u]
+}
+
+func (us *urlStore) AddWithDepth(depth int, urls ...*url.URL) (int, error) {
+	return us.AddWithSource("", depth, urls...)
+}
+
+// Priority is the priority the url was added with
+func (us *urlStore) Priority(u *url.URL) int {
+	us.m.RLock()
+	defer us.m.RUnlock()
+
+	return us.priorities[u]
+}
+
+func (us *urlStore) AddWithSource(source string, depth int, urls ...*url.URL) (int, error) {
+	return us.AddWithPriority(source, depth, 0, urls...)
+}
+
+// AddWithPriority adds urls which are sampled before urls of lower
+// priority when sampling by priority
+func (us *urlStore) AddWithPriority(source string, depth, priority int, urls ...*url.URL) (int, error) {
 	var urlsToAdd []*url.URL
 	us.m.Lock()
 	defer us.m.Unlock()
@@ -165,7 +524,12 @@ loop:
 			}
 		}
 
-		if _, ok := us.strings[u.String()]; ok {
+		known, err := us.stored(u.String())
+		if err != nil {
+			return 0, err
+		}
+
+		if known {
 			continue
 		}
 
@@ -181,7 +545,7 @@ loop:
 		return 0, err
 	}
 
-	stmt, err := tx.Prepare("INSERT INTO url_visits(url) values(?)")
+	stmt, err := tx.Prepare("INSERT INTO url_visits(url, depth, source, priority) values(?, ?, ?, ?)")
 	if err != nil {
 		return 0, err
 	}
@@ -190,7 +554,12 @@ loop:
 	var dbErr error
 
 	for _, u := range urlsToAdd {
-		res, err := stmt.Exec(u.String())
+		var src interface{}
+		if source != "" {
+			src = source
+		}
+
+		res, err := stmt.Exec(u.String(), depth, src, priority)
 		if err != nil {
 			if dbErr != nil {
 				dbErr = err
@@ -212,55 +581,99 @@ loop:
 		us.strings[u.String()] = u
 		us.urls[u] = nil
 		us.ids[u] = id
+		if us.seen != nil {
+			us.seen.add(u.String())
+		}
+		us.depths[u] = depth
+		us.sources[u] = source
+		us.priorities[u] = priority
 		count += 1
 	}
 	tx.Commit()
+	us.evict(us.maxInMemory)
 
 	return count, dbErr
 }
 
 func (us *urlStore) Visit(u *url.URL, t time.Time) error {
+	return us.visit(u, t, false)
+}
+
+// Fail records a failed crawl of u as a visit, urls failing more times in
+// a row than the failure threshold are no longer sampled
+func (us *urlStore) Fail(u *url.URL, t time.Time) error {
+	return us.visit(u, t, true)
+}
+
+func (us *urlStore) visit(u *url.URL, t time.Time, failed bool) error {
 	us.m.Lock()
-	if _, ok := us.urls[u]; ok {
-		stmt, err := us.db.Prepare("update url_visits set last_visit=? where id=?")
-		if err != nil {
-			us.m.Unlock()
-			return err
-		}
+	defer us.m.Unlock()
 
-		_, err = stmt.Exec(t.Unix(), us.ids[u])
-		if err != nil {
-			us.m.Unlock()
-			return err
-		}
+	_, queued := us.urls[u]
+	_, sampled := us.sampled[u]
+	if !queued && !sampled {
+		return us.visitEvicted(u, t, failed)
+	}
 
-		if !us.resampling {
-			delete(us.urls, u)
-			us.m.Unlock()
-			return nil
-		}
+	failures := 0
+	if failed {
+		failures = us.failures[u] + 1
+	}
 
-		us.urls[u] = &t
+	if _, err := us.db.Exec("update url_visits set last_visit=?, failures=? where id=?", t.UnixNano(), failures, us.ids[u]); err != nil {
+		return err
+	}
+	us.failures[u] = failures
 
+	if !us.resampling || us.dropped(u) {
+		delete(us.urls, u)
+		delete(us.sampled, u)
+		us.markEvictable(u)
+		us.evict(us.maxInMemory)
+		return nil
 	}
-	us.m.Unlock()
+
+	us.urls[u] = &t
+	us.markEvictable(u)
+	us.evict(us.maxInMemory)
 
 	return nil
 }
 
+// visitEvicted records the visit of a url evicted from memory while it was
+// being crawled, which only happens when resampling, as sampled urls are
+// otherwise kept in memory until visited
+func (us *urlStore) visitEvicted(u *url.URL, t time.Time, failed bool) error {
+	if us.maxInMemory <= 0 || !us.resampling {
+		return nil
+	}
+
+	if _, ok := us.ids[u]; ok {
+		return nil
+	}
+
+	failures := "0"
+	if failed {
+		failures = "failures + 1"
+	}
+
+	_, err := us.db.Exec("update url_visits set last_visit=?, failures="+failures+" where url=?", t.UnixNano(), u.String())
+	return err
+}
+
 func (us *urlStore) FilterKnown(doms <-chan kraaler.Domain) <-chan kraaler.Domain {
 	out := make(chan kraaler.Domain)
 
 	go func() {
 		for dom := range doms {
 			us.m.RLock()
-			if _, ok := us.strings[dom.HTTPS()]; !ok {
+			if ok, _ := us.stored(dom.HTTPS()); !ok {
 				us.m.RUnlock()
 				out <- dom
 				continue
 			}
 
-			if _, ok := us.strings[dom.HTTP()]; !ok {
+			if ok, _ := us.stored(dom.HTTP()); !ok {
 				us.m.RUnlock()
 				out <- dom
 				continue
@@ -294,6 +707,86 @@ func UniformSampler() Sampler {
 	}
 }
 
+// RecencySampler prefers urls never visited, and otherwise urls visited
+// long ago. The weight of a visited url is halved every halfLife closer to
+// its last visit it gets, approaching zero for urls just visited. It panics
+// if halfLife is not positive.
+func RecencySampler(halfLife time.Duration) Sampler {
+	if halfLife <= 0 {
+		panic("store: RecencySampler called with a non-positive half life")
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	uniform := UniformSampler()
+
+	return func(urls map[*url.URL]*time.Time) *url.URL {
+		if len(urls) == 0 {
+			return nil
+		}
+
+		var unvisited []*url.URL
+		for u, t := range urls {
+			if t == nil {
+				unvisited = append(unvisited, u)
+			}
+		}
+
+		if len(unvisited) > 0 {
+			return unvisited[r.Intn(len(unvisited))]
+		}
+
+		now := time.Now()
+		weights := map[*url.URL]float64{}
+		for u, t := range urls {
+			// visits in the future, as of clock skew, are just visited
+			age := now.Sub(*t)
+			if age < 0 {
+				age = 0
+			}
+			weights[u] = 1 - math.Exp2(-float64(age)/float64(halfLife))
+		}
+
+		if u := randomPickWeighted(r, weights); u != nil {
+			return u
+		}
+
+		// every url was visited just now
+		return uniform(urls)
+	}
+}
+
+// PrioritySampler samples among the urls of the highest priority which
+// have not been visited yet using s, once every url of a priority above
+// zero has been visited s samples among every url
+func PrioritySampler(priority func(*url.URL) int, s Sampler) Sampler {
+	return func(urls map[*url.URL]*time.Time) *url.URL {
+		var max int
+		var tier map[*url.URL]*time.Time
+		for u, t := range urls {
+			if t != nil {
+				continue
+			}
+
+			p := priority(u)
+			if p <= 0 || p < max {
+				continue
+			}
+
+			if p > max {
+				max = p
+				tier = map[*url.URL]*time.Time{}
+			}
+			tier[u] = t
+		}
+
+		if len(tier) == 0 {
+			return s(urls)
+		}
+
+		return s(tier)
+	}
+}
+
 func PairSampler(pw int) Sampler {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	pwF := float64(pw)
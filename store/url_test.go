@@ -2,6 +2,7 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
 	"net/url"
 	"os"
 	"testing"
@@ -19,14 +20,34 @@ func TestURLStore(t *testing.T) {
 				t.Fatalf("unable to add url: %s", err)
 			}
 		}},
-		// {name: "with-visit", actions: func(t *testing.T, us *urlStore) {
-		// 	u, _ := url.Parse("https://google.com")
-		// 	if _, err := us.Add(u); err != nil {
-		// 		t.Fatalf("unable to add url: %s", err)
-		// 	}
+		{name: "with-depth", actions: func(t *testing.T, us *urlStore) {
+			u, _ := url.Parse("https://google.com/deep")
+			if _, err := us.AddWithDepth(2, u); err != nil {
+				t.Fatalf("unable to add url: %s", err)
+			}
+
+			if d := us.Depth(u); d != 2 {
+				t.Fatalf("expected depth to be 2, but was: %d", d)
+			}
+		}},
+		{name: "with-source", actions: func(t *testing.T, us *urlStore) {
+			u, _ := url.Parse("https://phish.com/login")
+			if _, err := us.AddWithSource("phishtank", 1, u); err != nil {
+				t.Fatalf("unable to add url: %s", err)
+			}
 
-		// 	us.Visit(u, time.Now())
-		// }},
+			if s := us.Source(u); s != "phishtank" {
+				t.Fatalf("expected source to be phishtank, but was: %s", s)
+			}
+		}},
+		{name: "with-visit", actions: func(t *testing.T, us *urlStore) {
+			u, _ := url.Parse("https://google.com")
+			if _, err := us.Add(u); err != nil {
+				t.Fatalf("unable to add url: %s", err)
+			}
+
+			us.Visit(u, time.Now())
+		}},
 	}
 
 	for _, tc := range tt {
@@ -89,8 +110,633 @@ func TestURLStore(t *testing.T) {
 				if id != otherId {
 					t.Fatalf("expected ids to match (%d != %d)", id, otherId)
 				}
+
+				if d, otherD := us2.Depth(us2.strings[u.String()]), us.Depth(u); d != otherD {
+					t.Fatalf("expected depths to match (%d != %d)", d, otherD)
+				}
+
+				if s, otherS := us2.Source(us2.strings[u.String()]), us.Source(u); s != otherS {
+					t.Fatalf("expected sources to match (%s != %s)", s, otherS)
+				}
+			}
+
+		})
+	}
+}
+
+func TestURLStoreRelease(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-release")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := NewURLStore(db, WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("https://aau.dk")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	sampled, err := us.Sample()
+	if err != nil {
+		t.Fatalf("unable to sample: %s", err)
+	}
+
+	if sampled != u {
+		t.Fatalf("expected %s to be sampled, but sampled: %s", u, sampled)
+	}
+
+	if _, err := us.Sample(); err != StoreIsEmptyErr {
+		t.Fatalf("expected sampled url to be held back, but received: %v", err)
+	}
+
+	// the crawl of the url failed
+	us.Release(u)
+	if n := us.Size(); n != 1 {
+		t.Fatalf("expected released url to remain for retry, but size is: %d", n)
+	}
+
+	if sampled, err = us.Sample(); err != nil || sampled != u {
+		t.Fatalf("expected released url to be sampled again, but received: %v (%v)", sampled, err)
+	}
+
+	if err := us.Visit(u, time.Now()); err != nil {
+		t.Fatalf("unable to visit url: %s", err)
+	}
+
+	// releasing a visited url has no effect
+	us.Release(u)
+	if n := us.Size(); n != 0 {
+		t.Fatalf("expected visited url to be gone, but size is: %d", n)
+	}
+	db.Close()
+
+	db2, err := sql.Open("sqlite3", fn)
+	if err != nil {
+		t.Fatalf("unable to open db again: %s", err)
+	}
+	defer db2.Close()
+
+	us2, err := NewURLStore(db2, WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	if n := us2.Size(); n != 0 {
+		t.Fatalf("expected visited url not to be crawled again, but size is: %d", n)
+	}
+
+	if _, err := us2.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	if n := us2.Size(); n != 0 {
+		t.Fatalf("expected visited url not to be added again, but size is: %d", n)
+	}
+}
+
+func TestURLStoreFailures(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-failures")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := NewURLStore(db, WithFailureThreshold(3))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("https://dead.aau.dk")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := us.Fail(u, time.Now()); err != nil {
+			t.Fatalf("unable to fail url: %s", err)
+		}
+	}
+
+	if us.urls[u] == nil {
+		t.Fatalf("expected failure to be recorded as a visit")
+	}
+
+	// a successful visit resets the consecutive failures
+	if err := us.Visit(u, time.Now()); err != nil {
+		t.Fatalf("unable to visit url: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if n := us.Size(); n != 1 {
+			t.Fatalf("expected url to be sampled after %d failure(s), but size is: %d", i, n)
+		}
+
+		if err := us.Fail(u, time.Now()); err != nil {
+			t.Fatalf("unable to fail url: %s", err)
+		}
+	}
+
+	if _, err := us.Sample(); err != StoreIsEmptyErr {
+		t.Fatalf("expected url to be dropped after failing three times, but received: %v", err)
+	}
+
+	var failures int
+	if err := db.QueryRow("select failures from url_visits where url = ?", u.String()).Scan(&failures); err != nil {
+		t.Fatalf("unable to read failures: %s", err)
+	}
+
+	if failures != 3 {
+		t.Fatalf("expected three failures, but received: %d", failures)
+	}
+	db.Close()
+
+	db2, err := sql.Open("sqlite3", fn)
+	if err != nil {
+		t.Fatalf("unable to open db again: %s", err)
+	}
+	defer db2.Close()
+
+	us2, err := NewURLStore(db2, WithFailureThreshold(3))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	if n := us2.Size(); n != 0 {
+		t.Fatalf("expected dropped url to stay dropped, but size is: %d", n)
+	}
+}
+
+func TestRecencySampler(t *testing.T) {
+	parse := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+	ago := func(d time.Duration) *time.Time {
+		t := time.Now().Add(-d)
+		return &t
+	}
+
+	smpl := RecencySampler(time.Hour)
+	if u := smpl(map[*url.URL]*time.Time{}); u != nil {
+		t.Fatalf("expected no url of empty map, but received: %s", u)
+	}
+
+	fresh, old, never := parse("http://fresh.dk"), parse("http://old.dk"), parse("http://never.dk")
+	urls := map[*url.URL]*time.Time{
+		fresh: ago(time.Minute),
+		old:   ago(24 * time.Hour),
+		never: nil,
+	}
+
+	for i := 0; i < 100; i++ {
+		if u := smpl(urls); u != never {
+			t.Fatalf("expected url never visited to be preferred, but sampled: %s", u)
+		}
+	}
+
+	delete(urls, never)
+	counts := map[*url.URL]int{}
+	for i := 0; i < 1000; i++ {
+		counts[smpl(urls)]++
+	}
+
+	if counts[old] < 900 {
+		t.Fatalf("expected url visited long ago to be preferred, but sampled: %v", counts)
+	}
+
+	// urls visited just now are still sampled
+	now := time.Now().Add(time.Hour)
+	if u := smpl(map[*url.URL]*time.Time{fresh: &now}); u != fresh {
+		t.Fatalf("expected url to be sampled, but received: %v", u)
+	}
+
+	// visits in the future weigh as visits just now, rather than negatively
+	for i := 0; i < 100; i++ {
+		if u := smpl(map[*url.URL]*time.Time{fresh: &now, old: ago(24 * time.Hour)}); u != old {
+			t.Fatalf("expected url visited long ago to be sampled, but received: %v", u)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected non-positive half life to be rejected")
+		}
+	}()
+	RecencySampler(0)
+}
+
+func TestURLStorePriority(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-priority")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := NewURLStore(db, WithPrioritySampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	low, _ := url.Parse("https://discovered.aau.dk")
+	high, _ := url.Parse("https://reported.aau.dk")
+	if _, err := us.Add(low); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	if _, err := us.AddWithPriority("phishtank", 0, 10, high); err != nil {
+		t.Fatalf("unable to add url with priority: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		u, err := us.Sample()
+		if err != nil {
+			t.Fatalf("unable to sample: %s", err)
+		}
+
+		if u != high {
+			t.Fatalf("expected url of high priority to be sampled, but received: %s", u)
+		}
+	}
+
+	// visited urls lose their precedence
+	if err := us.Visit(high, time.Now()); err != nil {
+		t.Fatalf("unable to visit url: %s", err)
+	}
+
+	sampled := map[*url.URL]bool{}
+	for i := 0; i < 100; i++ {
+		u, err := us.Sample()
+		if err != nil {
+			t.Fatalf("unable to sample: %s", err)
+		}
+		sampled[u] = true
+	}
+
+	if !sampled[low] {
+		t.Fatalf("expected url of low priority to be sampled once visited")
+	}
+	db.Close()
+
+	db2, err := sql.Open("sqlite3", fn)
+	if err != nil {
+		t.Fatalf("unable to open db again: %s", err)
+	}
+	defer db2.Close()
+
+	us2, err := NewURLStore(db2)
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	for u, _ := range us2.urls {
+		expected := 0
+		if u.String() == high.String() {
+			expected = 10
+		}
+
+		if p := us2.Priority(u); p != expected {
+			t.Fatalf("expected priority %d of %s, but received: %d", expected, u, p)
+		}
+	}
+}
+
+func TestURLStoreMaxInMemory(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-max-in-memory")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+	defer db.Close()
+
+	max := 10
+	us, err := NewURLStore(db, WithMaxInMemory(max), WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	var first *url.URL
+	for i := 0; i < 5*max; i++ {
+		u, _ := url.Parse(fmt.Sprintf("https://%d.aau.dk", i))
+		if _, err := us.Add(u); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+
+		sampled, err := us.Sample()
+		if err != nil {
+			t.Fatalf("unable to sample: %s", err)
+		}
+
+		if err := us.Visit(sampled, time.Now()); err != nil {
+			t.Fatalf("unable to visit url: %s", err)
+		}
+
+		if first == nil {
+			first = u
+		}
+
+		for name, n := range map[string]int{
+			"strings": len(us.strings),
+			"ids":     len(us.ids),
+			"depths":  len(us.depths),
+			"sources": len(us.sources),
+		} {
+			if n > max {
+				t.Fatalf("expected at most %d %s in memory, but had: %d", max, name, n)
+			}
+		}
+	}
+
+	var rows int
+	if err := db.QueryRow("select count(*) from url_visits").Scan(&rows); err != nil {
+		t.Fatalf("unable to count urls: %s", err)
+	}
+
+	if rows != 5*max {
+		t.Fatalf("expected evicted urls to remain stored, but %d of %d are", rows, 5*max)
+	}
+
+	// evicted urls are still known
+	again, _ := url.Parse(first.String())
+	if n, err := us.Add(again); err != nil || n != 0 {
+		t.Fatalf("expected evicted url not to be added again, but added %d: %v", n, err)
+	}
+}
+
+func TestURLStoreReload(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-reload")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+	defer db.Close()
+
+	us, err := NewURLStore(db, WithMaxInMemory(2), WithFailureThreshold(1))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	visited, _ := url.Parse("https://visited.aau.dk")
+	if _, err := us.Add(visited); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	if err := us.Visit(visited, time.Now()); err != nil {
+		t.Fatalf("unable to visit url: %s", err)
+	}
+
+	var dead []*url.URL
+	for _, s := range []string{"https://dead1.aau.dk", "https://dead2.aau.dk"} {
+		u, _ := url.Parse(s)
+		if _, err := us.Add(u); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+		dead = append(dead, u)
+	}
+
+	if _, ok := us.strings[visited.String()]; ok {
+		t.Fatalf("expected visited url to be evicted")
+	}
+
+	for _, u := range dead {
+		if err := us.Fail(u, time.Now()); err != nil {
+			t.Fatalf("unable to fail url: %s", err)
+		}
+	}
+
+	// only dropped urls are left in memory, the visited url is reloaded
+	u, err := us.Sample()
+	if err != nil {
+		t.Fatalf("unable to sample: %s", err)
+	}
+
+	if u.String() != visited.String() {
+		t.Fatalf("expected evicted url to be reloaded, but sampled: %s", u)
+	}
+}
+
+func TestURLStoreEvictionOrder(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-eviction-order")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+	defer db.Close()
+
+	us, err := NewURLStore(db, WithMaxInMemory(3))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	urls := map[string]*url.URL{}
+	for _, s := range []string{"https://a.aau.dk", "https://b.aau.dk", "https://c.aau.dk"} {
+		u, _ := url.Parse(s)
+		if _, err := us.Add(u); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+		urls[s] = u
+	}
+
+	// a is visited again after b, such that b is the least recently visited
+	for _, s := range []string{"https://a.aau.dk", "https://b.aau.dk", "https://a.aau.dk"} {
+		if err := us.Visit(urls[s], time.Now()); err != nil {
+			t.Fatalf("unable to visit url: %s", err)
+		}
+	}
+
+	d, _ := url.Parse("https://d.aau.dk")
+	if _, err := us.Add(d); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	if _, ok := us.strings["https://b.aau.dk"]; ok {
+		t.Fatalf("expected least recently visited url to be evicted")
+	}
+
+	for _, s := range []string{"https://a.aau.dk", "https://c.aau.dk", "https://d.aau.dk"} {
+		if _, ok := us.strings[s]; !ok {
+			t.Fatalf("expected %s to be kept in memory", s)
+		}
+	}
+
+	if n := us.evictable.Len(); n != 1 {
+		t.Fatalf("expected one url left to be evicted, but had: %d", n)
+	}
+}
+
+func TestURLStoreVisitEvicted(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-visit-evicted")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+	defer db.Close()
+
+	us, err := NewURLStore(db, WithMaxInMemory(2))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	inflight, _ := url.Parse("https://inflight.aau.dk")
+	if _, err := us.Add(inflight); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	if err := us.Visit(inflight, time.Now()); err != nil {
+		t.Fatalf("unable to visit url: %s", err)
+	}
+
+	if u, err := us.Sample(); err != nil || u != inflight {
+		t.Fatalf("expected to sample %s, but got %v: %v", inflight, u, err)
+	}
+
+	// the url is evicted while it is being crawled
+	for _, s := range []string{"https://a.aau.dk", "https://b.aau.dk"} {
+		u, _ := url.Parse(s)
+		if _, err := us.Add(u); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+	}
+
+	if _, ok := us.strings[inflight.String()]; ok {
+		t.Fatalf("expected visited url to be evicted")
+	}
+
+	visit := time.Now().Add(time.Hour)
+	if err := us.Fail(inflight, visit); err != nil {
+		t.Fatalf("unable to fail url: %s", err)
+	}
+
+	var lastVisit int64
+	var failures int
+	err = db.QueryRow("select last_visit, failures from url_visits where url = ?", inflight.String()).Scan(&lastVisit, &failures)
+	if err != nil {
+		t.Fatalf("unable to read visit: %s", err)
+	}
+
+	if lastVisit != visit.UnixNano() {
+		t.Fatalf("expected visit of evicted url to be stored (%d), but was: %d", visit.UnixNano(), lastVisit)
+	}
+
+	if failures != 1 {
+		t.Fatalf("expected failure of evicted url to be counted, but had: %d", failures)
+	}
+}
+
+func TestURLStoreBloomFilter(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-bloom")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+	defer db.Close()
+
+	us, err := NewURLStore(db, WithMaxInMemory(2), WithBloomFilter(100, 0.01))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	evicted, _ := url.Parse("https://evicted.aau.dk")
+	if _, err := us.Add(evicted); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	if err := us.Visit(evicted, time.Now()); err != nil {
+		t.Fatalf("unable to visit url: %s", err)
+	}
+
+	for _, s := range []string{"https://a.aau.dk", "https://b.aau.dk"} {
+		u, _ := url.Parse(s)
+		if _, err := us.Add(u); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+	}
+
+	if _, ok := us.strings[evicted.String()]; ok {
+		t.Fatalf("expected visited url to be evicted")
+	}
+
+	if !us.seen.test(evicted.String()) {
+		t.Fatalf("expected evicted url to be in the bloom filter")
+	}
+
+	again, _ := url.Parse(evicted.String())
+	if n, err := us.Add(again); err != nil || n != 0 {
+		t.Fatalf("expected evicted url not to be added again, but added %d: %v", n, err)
+	}
+
+	fresh, _ := url.Parse("https://fresh.aau.dk")
+	if n, err := us.Add(fresh); err != nil || n != 1 {
+		t.Fatalf("expected unseen url to be added, but added %d: %v", n, err)
+	}
+}
+
+func TestURLStoreBloomFilterWithoutEviction(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-bloom-alone")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+	defer db.Close()
+
+	// every url is kept in memory, such that the filter would never be used
+	if _, err := NewURLStore(db, WithBloomFilter(100, 0.01)); err != BloomWithoutEvictErr {
+		t.Fatalf("expected bloom filter without eviction to be rejected, but got: %v", err)
+	}
+}
+
+func TestDomainFilters(t *testing.T) {
+	tt := []struct {
+		name     string
+		filter   URLFilter
+		allowed  []string
+		rejected []string
+	}{
+		{
+			name:     "only domain",
+			filter:   OnlyDomain("example.com"),
+			allowed:  []string{"https://example.com/", "https://sub.example.com/login", "https://a.b.example.com:8080/", "https://EXAMPLE.com/"},
+			rejected: []string{"https://example.org/", "https://notexample.com/", "https://example.com.evil.net/"},
+		},
+		{
+			name:     "only domain www",
+			filter:   OnlyDomain("www.example.com"),
+			allowed:  []string{"https://example.com/", "https://www.example.com/", "https://sub.example.com/"},
+			rejected: []string{"https://example.net/"},
+		},
+		{
+			name:     "only domain of public suffix",
+			filter:   OnlyDomain("aau.co.uk"),
+			allowed:  []string{"https://aau.co.uk/", "https://www.aau.co.uk/"},
+			rejected: []string{"https://other.co.uk/"},
+		},
+		{
+			name:     "exclude domains",
+			filter:   ExcludeDomains("evil.com", "www.tracker.net", "ads.example.com"),
+			allowed:  []string{"https://example.com/", "https://notevil.com/", "https://www.example.com/"},
+			rejected: []string{"https://evil.com/", "https://sub.evil.com/", "https://tracker.net/", "https://www.tracker.net/", "https://ads.example.com/", "https://x.ads.example.com/"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, s := range tc.allowed {
+				u, _ := url.Parse(s)
+				if !tc.filter(u) {
+					t.Fatalf("expected %s to be allowed", s)
+				}
 			}
 
+			for _, s := range tc.rejected {
+				u, _ := url.Parse(s)
+				if tc.filter(u) {
+					t.Fatalf("expected %s to be rejected", s)
+				}
+			}
 		})
 	}
 }
@@ -0,0 +1,113 @@
+package kraaler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunSummary summarizes the pages crawled by a WorkerController since it
+// was created
+type RunSummary struct {
+	Sessions  int           `json:"sessions"`
+	Successes int           `json:"successes"`
+	Errors    int           `json:"errors"`
+	Timeouts  int           `json:"timeouts"`
+	Bytes     int64         `json:"bytes"`
+	Hosts     int           `json:"hosts"`
+	Duration  time.Duration `json:"duration"`
+
+	// Providers are the aggregated stats of the url providers of the run
+	Providers ProviderStats `json:"providers"`
+}
+
+// Fields are the fields of the summary for structured logging
+func (rs RunSummary) Fields() []zap.Field {
+	fields := []zap.Field{
+		zap.Int("sessions", rs.Sessions),
+		zap.Int("successes", rs.Successes),
+		zap.Int("errors", rs.Errors),
+		zap.Int("timeouts", rs.Timeouts),
+		zap.Int64("bytes", rs.Bytes),
+		zap.Int("hosts", rs.Hosts),
+		zap.Duration("duration", rs.Duration),
+	}
+
+	return append(fields, rs.Providers.Fields()...)
+}
+
+// summaryCounter aggregates the summary of the pages of a run
+type summaryCounter struct {
+	m       sync.Mutex
+	started time.Time
+	summary RunSummary
+	hosts   map[string]struct{}
+}
+
+func newSummaryCounter() *summaryCounter {
+	return &summaryCounter{
+		started: time.Now(),
+		hosts:   map[string]struct{}{},
+	}
+}
+
+func (sc *summaryCounter) add(p Page) {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	sc.summary.Sessions += 1
+	switch {
+	case p.Error == nil:
+		sc.summary.Successes += 1
+	case isTimeout(p.Error):
+		sc.summary.Timeouts += 1
+	default:
+		sc.summary.Errors += 1
+	}
+	sc.summary.Bytes += pageBytes(p)
+
+	if p.InitialURL != nil {
+		sc.hosts[p.InitialURL.Hostname()] = struct{}{}
+	}
+}
+
+func (sc *summaryCounter) get() RunSummary {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+
+	rs := sc.summary
+	rs.Hosts = len(sc.hosts)
+	rs.Duration = time.Since(sc.started)
+
+	return rs
+}
+
+func isTimeout(err error) bool {
+	switch err {
+	case context.DeadlineExceeded, ErrFuncTimeout, ErrTimeoutDOM, ErrHostLookupTimeout:
+		return true
+	}
+
+	return false
+}
+
+// pageBytes is the size of the bodies, screenshots and captures of p
+func pageBytes(p Page) int64 {
+	var n int
+	for _, acts := range [][]*CrawlAction{p.Actions, p.WarmActions} {
+		for _, a := range acts {
+			if a.Body != nil {
+				n += len(a.Body.Body)
+			}
+		}
+	}
+
+	for _, s := range p.Screenshots {
+		n += len(s.Screenshot)
+	}
+	n += len(p.RenderedHTML) + len(p.Trace)
+
+	return int64(n)
+}
@@ -0,0 +1,99 @@
+package kraaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/mafredri/cdp"
+	cdpio "github.com/mafredri/cdp/protocol/io"
+	"github.com/mafredri/cdp/protocol/tracing"
+)
+
+// traceCategories are the categories recorded by the performance panel of
+// the developer tools
+var traceCategories = []string{
+	"-*",
+	"devtools.timeline",
+	"disabled-by-default-devtools.timeline",
+	"disabled-by-default-devtools.timeline.frame",
+	"disabled-by-default-devtools.timeline.stack",
+	"disabled-by-default-devtools.screenshot",
+	"v8.execute",
+	"blink.console",
+	"blink.user_timing",
+	"loading",
+	"latencyInfo",
+	"toplevel",
+	"netlog",
+}
+
+var ErrNoTraceStream = errors.New("trace completed without a stream")
+
+// startTrace starts tracing the page, the trace is returned as a stream
+// once stopped with stopTrace
+func startTrace(ctx context.Context, tr cdp.Tracing) (tracing.CompleteClient, error) {
+	complete, err := tr.TracingComplete(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	args := tracing.NewStartArgs().
+		SetTransferMode("ReturnAsStream").
+		SetTraceConfig(tracing.TraceConfig{IncludedCategories: traceCategories})
+	if err := tr.Start(ctx, args); err != nil {
+		complete.Close()
+		return nil, err
+	}
+
+	return complete, nil
+}
+
+// stopTrace stops tracing and reads the trace, in the JSON format of
+// chrome://tracing, from the stream it was written to
+func stopTrace(ctx context.Context, tr cdp.Tracing, rd cdp.IO, complete tracing.CompleteClient) ([]byte, error) {
+	defer complete.Close()
+
+	if err := tr.End(ctx); err != nil {
+		return nil, err
+	}
+
+	reply, err := complete.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Stream == nil {
+		return nil, ErrNoTraceStream
+	}
+
+	return readStream(ctx, rd, *reply.Stream)
+}
+
+// readStream reads the chunks of stream until its end and closes it
+func readStream(ctx context.Context, rd cdp.IO, stream cdpio.StreamHandle) ([]byte, error) {
+	defer rd.Close(ctx, cdpio.NewCloseArgs(stream))
+
+	var buf bytes.Buffer
+	for {
+		chunk, err := rd.Read(ctx, cdpio.NewReadArgs(stream))
+		if err != nil {
+			return nil, err
+		}
+
+		if chunk.Base64Encoded != nil && *chunk.Base64Encoded {
+			data, err := base64.StdEncoding.DecodeString(chunk.Data)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(data)
+		} else {
+			buf.WriteString(chunk.Data)
+		}
+
+		if chunk.EOF {
+			return buf.Bytes(), nil
+		}
+	}
+}
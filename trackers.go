@@ -0,0 +1,122 @@
+package kraaler
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TrackerList is a set of tracker and ad domains keyed by eTLD+1
+type TrackerList map[string]struct{}
+
+var defaultTrackers = []string{
+	"2mdn.net",
+	"adnxs.com",
+	"adsrvr.org",
+	"advertising.com",
+	"amazon-adsystem.com",
+	"bluekai.com",
+	"casalemedia.com",
+	"chartbeat.com",
+	"criteo.com",
+	"criteo.net",
+	"demdex.net",
+	"doubleclick.net",
+	"facebook.net",
+	"google-analytics.com",
+	"googleadservices.com",
+	"googlesyndication.com",
+	"googletagmanager.com",
+	"googletagservices.com",
+	"hotjar.com",
+	"krxd.net",
+	"mathtag.com",
+	"moatads.com",
+	"mixpanel.com",
+	"newrelic.com",
+	"nr-data.net",
+	"outbrain.com",
+	"pubmatic.com",
+	"quantserve.com",
+	"rubiconproject.com",
+	"scorecardresearch.com",
+	"segment.io",
+	"taboola.com",
+	"yandex.ru",
+}
+
+// DefaultTrackerList is the bundled list of tracker and ad domains
+var DefaultTrackerList = NewTrackerList(defaultTrackers...)
+
+func NewTrackerList(domains ...string) TrackerList {
+	tl := TrackerList{}
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+
+		tl[siteOf(&url.URL{Host: d})] = struct{}{}
+	}
+
+	return tl
+}
+
+// ReadTrackerList reads one domain per line, skipping blank lines and
+// comments starting with #
+func ReadTrackerList(r io.Reader) (TrackerList, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		domains = append(domains, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewTrackerList(domains...), nil
+}
+
+func LoadTrackerList(path string) (TrackerList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadTrackerList(f)
+}
+
+func (tl TrackerList) Contains(u *url.URL) bool {
+	_, ok := tl[siteOf(u)]
+	return ok
+}
+
+// Requests counts the requests of the actions sent to each tracker domain
+func (tl TrackerList) Requests(actions []*CrawlAction) map[string]int {
+	counts := map[string]int{}
+	for _, a := range actions {
+		u, err := url.Parse(a.Request.URL)
+		if err != nil {
+			continue
+		}
+
+		if tl.Contains(u) {
+			counts[siteOf(u)] += 1
+		}
+	}
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	return counts
+}
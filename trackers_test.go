@@ -0,0 +1,51 @@
+package kraaler_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+func TestTrackerList(t *testing.T) {
+	tl, err := kraaler.ReadTrackerList(strings.NewReader(`
+# test trackers
+tracker.com
+ads.example.org
+`))
+	if err != nil {
+		t.Fatalf("unable to read tracker list: %s", err)
+	}
+
+	action := func(u string) *kraaler.CrawlAction {
+		return &kraaler.CrawlAction{Request: network.Request{URL: u}}
+	}
+
+	page := kraaler.Page{
+		Actions: []*kraaler.CrawlAction{
+			action("http://site.com/"),
+			action("http://tracker.com/pixel.gif"),
+			action("https://cdn.tracker.com/t.js"),
+			action("http://static.example.org/ad.js"),
+			action("http://nottracker.com/"),
+		},
+	}
+
+	counts := tl.Requests(page.Actions)
+	if len(counts) != 2 {
+		t.Fatalf("expected two tracker domains, but received: %v", counts)
+	}
+
+	if n := counts["tracker.com"]; n != 2 {
+		t.Fatalf("unexpected request count for tracker.com %d, expected: 2", n)
+	}
+
+	if n := counts["example.org"]; n != 1 {
+		t.Fatalf("unexpected request count for example.org %d, expected: 1", n)
+	}
+
+	if counts := kraaler.NewTrackerList().Requests(page.Actions); counts != nil {
+		t.Fatalf("expected no trackers for empty list, but received: %v", counts)
+	}
+}
@@ -0,0 +1,115 @@
+package kraaler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/page"
+	"github.com/mafredri/cdp/protocol/runtime"
+)
+
+const unloadBinding = "__kraalerUnload"
+
+// unloadScript reports the beforeunload and unload handlers registered by
+// the document, whether through addEventListener, the window properties or
+// the attributes of the body, which are only visible once the body is parsed
+const unloadScript = `(() => {
+	const events = ["beforeunload", "unload"];
+	const reported = {};
+	const report = (ev) => {
+		if (reported[ev]) return;
+		reported[ev] = true;
+		try {
+			window.` + unloadBinding + `(ev);
+		} catch (e) {}
+	};
+
+	const add = EventTarget.prototype.addEventListener;
+	EventTarget.prototype.addEventListener = function(type, listener, options) {
+		if (this === window && listener && events.includes(type)) report(type);
+		return add.apply(this, arguments);
+	};
+
+	events.forEach((ev) => {
+		const desc = Object.getOwnPropertyDescriptor(window, "on" + ev);
+		if (!desc || !desc.set || !desc.configurable) return;
+		Object.defineProperty(window, "on" + ev, {
+			configurable: true,
+			enumerable: desc.enumerable,
+			get: desc.get,
+			set: function(fn) {
+				if (fn) report(ev);
+				return desc.set.call(this, fn);
+			},
+		});
+	});
+
+	const check = () => events.forEach((ev) => {
+		if (typeof window["on" + ev] === "function") report(ev);
+	});
+	add.call(window, "DOMContentLoaded", check);
+	add.call(window, "load", check);
+})()`
+
+// unloadReader records whether documents loaded after it is installed
+// registered beforeunload or unload handlers, as pages trapping their
+// visitors do
+func unloadReader(ctx context.Context, runt cdp.Runtime, pg cdp.Page) (func() (beforeUnload, unload bool, err error), error) {
+	if err := runt.AddBinding(ctx, runtime.NewAddBindingArgs(unloadBinding)); err != nil {
+		return nil, err
+	}
+
+	if _, err := pg.AddScriptToEvaluateOnNewDocument(ctx, page.NewAddScriptToEvaluateOnNewDocumentArgs(unloadScript)); err != nil {
+		return nil, err
+	}
+
+	called, err := runt.BindingCalled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var m sync.Mutex
+	seen := map[string]bool{}
+
+	go func() {
+		defer close(done)
+		defer called.Close()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-called.Ready():
+			}
+
+			ev, err := called.Recv()
+			if err != nil {
+				return
+			}
+
+			if ev.Name != unloadBinding {
+				continue
+			}
+
+			m.Lock()
+			seen[ev.Payload] = true
+			m.Unlock()
+		}
+	}()
+
+	return func() (bool, bool, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return false, false, ctx.Err()
+		case <-done:
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		return seen["beforeunload"], seen["unload"], nil
+	}, nil
+}
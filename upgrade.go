@@ -0,0 +1,99 @@
+package kraaler
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// UpgradeHSTS is an upgrade to https by the browser, as the host is
+	// known (or preloaded) to require it
+	UpgradeHSTS = "hsts"
+
+	// UpgradeRedirect is an upgrade to https by a redirect of the server
+	UpgradeRedirect = "redirect"
+)
+
+// documentChain returns the first action of actions followed by the
+// actions it was redirected to
+func documentChain(actions []*CrawlAction) []*CrawlAction {
+	if len(actions) == 0 {
+		return nil
+	}
+
+	chain := []*CrawlAction{actions[0]}
+	for {
+		var next *CrawlAction
+		for _, a := range actions {
+			if a.Parent == chain[len(chain)-1] {
+				next = a
+				break
+			}
+		}
+
+		if next == nil {
+			return chain
+		}
+		chain = append(chain, next)
+	}
+}
+
+// finalURL is the url the first document of actions was eventually
+// redirected to
+func finalURL(actions []*CrawlAction) *url.URL {
+	chain := documentChain(actions)
+	if len(chain) == 0 {
+		return nil
+	}
+
+	u, err := url.Parse(chain[len(chain)-1].Request.URL)
+	if err != nil {
+		return nil
+	}
+
+	return u
+}
+
+// SchemeUpgrade follows the redirects of the first document of actions,
+// and reports the scheme it was requested with, the scheme it was
+// upgraded to and whether the upgrade was by HSTS or a redirect. The
+// upgraded scheme is empty if the document was never upgraded.
+func SchemeUpgrade(actions []*CrawlAction) (requested, upgraded, upgrade string) {
+	chain := documentChain(actions)
+	if len(chain) == 0 {
+		return "", "", ""
+	}
+
+	schemeOf := func(a *CrawlAction) string {
+		u, err := url.Parse(a.Request.URL)
+		if err != nil {
+			return ""
+		}
+
+		return u.Scheme
+	}
+
+	requested = schemeOf(chain[0])
+	for i := 1; i < len(chain); i++ {
+		from, to := schemeOf(chain[i-1]), schemeOf(chain[i])
+		if from != "http" || to != "https" {
+			continue
+		}
+
+		upgrade = UpgradeRedirect
+		if resp := chain[i-1].Response; resp != nil {
+			if headers, err := resp.Headers.Map(); err == nil {
+				for k, v := range headers {
+					// chrome marks its internal redirects with the reason
+					if strings.EqualFold(k, "Non-Authoritative-Reason") && strings.EqualFold(v, "HSTS") {
+						upgrade = UpgradeHSTS
+					}
+				}
+			}
+		}
+
+		return requested, to, upgrade
+	}
+
+	return requested, "", ""
+}
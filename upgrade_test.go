@@ -0,0 +1,79 @@
+package kraaler_test
+
+import (
+	"testing"
+
+	"github.com/aau-network-security/kraaler"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+func TestSchemeUpgrade(t *testing.T) {
+	// chain links actions as redirects, with the headers of the redirect
+	// responses given for all but the last action
+	chain := func(urls []string, headers ...string) []*kraaler.CrawlAction {
+		var actions []*kraaler.CrawlAction
+		var parent *kraaler.CrawlAction
+		for i, u := range urls {
+			a := &kraaler.CrawlAction{Parent: parent, Request: network.Request{URL: u}}
+			if i < len(headers) {
+				a.Response = &network.Response{Status: 307, Headers: network.Headers([]byte(headers[i]))}
+			}
+
+			actions = append(actions, a)
+			parent = a
+		}
+
+		return actions
+	}
+
+	tt := []struct {
+		name      string
+		actions   []*kraaler.CrawlAction
+		requested string
+		upgraded  string
+		upgrade   string
+	}{
+		{
+			name:      "hsts",
+			actions:   chain([]string{"http://site.com/", "https://site.com/"}, `{"Location": "https://site.com/", "Non-Authoritative-Reason": "HSTS"}`),
+			requested: "http",
+			upgraded:  "https",
+			upgrade:   kraaler.UpgradeHSTS,
+		},
+		{
+			name:      "redirect",
+			actions:   chain([]string{"http://site.com/", "http://www.site.com/", "https://www.site.com/"}, `{"Location": "http://www.site.com/"}`, `{"Location": "https://www.site.com/"}`),
+			requested: "http",
+			upgraded:  "https",
+			upgrade:   kraaler.UpgradeRedirect,
+		},
+		{
+			name:      "no upgrade",
+			actions:   chain([]string{"http://site.com/"}),
+			requested: "http",
+		},
+		{
+			name:      "already https",
+			actions:   chain([]string{"https://site.com/", "https://site.com/home"}, `{"Location": "/home"}`),
+			requested: "https",
+		},
+		{
+			name: "subresources are ignored",
+			actions: append(
+				chain([]string{"http://site.com/"}),
+				&kraaler.CrawlAction{Request: network.Request{URL: "https://cdn.com/app.js"}},
+			),
+			requested: "http",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			requested, upgraded, upgrade := kraaler.SchemeUpgrade(tc.actions)
+			if requested != tc.requested || upgraded != tc.upgraded || upgrade != tc.upgrade {
+				t.Fatalf("expected (%s, %s, %s), but received: (%s, %s, %s)",
+					tc.requested, tc.upgraded, tc.upgrade, requested, upgraded, upgrade)
+			}
+		})
+	}
+}
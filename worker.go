@@ -4,26 +4,32 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/google/uuid"
 	"github.com/mafredri/cdp"
 	"github.com/mafredri/cdp/devtool"
+	"github.com/mafredri/cdp/protocol/emulation"
 	"github.com/mafredri/cdp/protocol/network"
 	"github.com/mafredri/cdp/protocol/page"
+	"github.com/mafredri/cdp/protocol/runtime"
+	"github.com/mafredri/cdp/protocol/serviceworker"
 	"github.com/mafredri/cdp/protocol/target"
+	"github.com/mafredri/cdp/protocol/tracing"
 	"github.com/mafredri/cdp/rpcc"
 	"github.com/mafredri/cdp/session"
-	"github.com/patrickmn/go-cache"
 	"github.com/raff/godet"
 	"go.uber.org/zap"
 )
@@ -37,12 +43,88 @@ const (
 )
 
 var (
-	ErrFuncTimeout = errors.New("timeout")
-	ErrNameServer  = errors.New("unable to get name servers")
-	ErrDockerConn  = errors.New("docker connection not responding")
-	ErrTimeoutDOM  = errors.New("timeout loading document object model")
+	ErrFuncTimeout       = errors.New("timeout")
+	ErrNameServer        = errors.New("unable to get name servers")
+	ErrDockerConn        = errors.New("docker connection not responding")
+	ErrTimeoutDOM        = errors.New("timeout loading document object model")
+	ErrBrowserCrash      = errors.New("browser crashed")
+	ErrNoWorkers         = errors.New("no workers to remove")
+	ErrRedirectLoop      = errors.New("navigation loops without reaching status")
+	ErrHostLookupTimeout = errors.New("host lookup timed out")
+	ErrTooManyRedirects  = errors.New("navigation stopped after too many redirects")
 )
 
+const (
+	browserCrashRetries = 1
+	maxSampleAttempts   = 10
+
+	// deadlineRetries is the amount of times a crawl exceeding its deadline
+	// is retried in a new container
+	deadlineRetries = 1
+
+	// fetchOverhead is the time given to a visit of a page beyond loading
+	// it, for preparing the browser and capturing the page
+	fetchOverhead = 5 * time.Second
+
+	// traceOverhead is the time given to stop a trace and read it
+	traceOverhead = 5 * time.Second
+
+	// maxReleases is the amount of times a url failing with a transient
+	// error is released to be crawled again
+	maxReleases = 3
+)
+
+var browserCrashErrs = []string{
+	"rpcc: the connection is closing",
+	"connection reset by peer",
+	"broken pipe",
+	"use of closed network connection",
+	"websocket: close",
+	"unexpected EOF",
+}
+
+func isBrowserCrash(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch cdp.ErrorCause(err) {
+	case ErrBrowserCrash, rpcc.ErrConnClosing, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+
+	for _, s := range browserCrashErrs {
+		if strings.Contains(err.Error(), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var retryableErrs = []string{
+	"net::ERR_CONNECTION_RESET",
+	"net::ERR_CONNECTION_CLOSED",
+	"net::ERR_CONNECTION_TIMED_OUT",
+	"net::ERR_TIMED_OUT",
+	"net::ERR_EMPTY_RESPONSE",
+	"net::ERR_NETWORK_CHANGED",
+}
+
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, s := range retryableErrs {
+		if strings.Contains(err.Error(), s) {
+			return true
+		}
+	}
+
+	return false
+}
+
 var DefaultResolution = &Resolution{
 	Width:  1366,
 	Height: 768,
@@ -65,10 +147,11 @@ type Worker interface {
 
 type worker struct {
 	id        string
-	container *docker.Container
+	container *Container
 	endpoint  string
 	killC     chan struct{}
-	hostInfo  *cache.Cache
+	stoppedC  chan struct{}
+	running   int32
 	logger    *zap.Logger
 
 	rpccConn       *rpcc.Conn
@@ -80,27 +163,53 @@ type worker struct {
 
 type WorkerConfig struct {
 	DockerClient *docker.Client
+	Runtime      ContainerRuntime
 	UseInstance  string
 	Resolution   *Resolution
 	LoadTimeout  *time.Duration
+	DrainTimeout time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
+	Trackers     TrackerList
+	HostResolver *HostResolver
 	Logger       *zap.Logger
+
+	// EgressIP binds the container of the worker to a source address of
+	// the host, requiring Runtime to be an EgressRuntime
+	EgressIP string
 }
 
 func NewWorker(conf WorkerConfig) (*worker, error) {
 	werr := func(err error) (*worker, error) { return nil, err }
-	if conf.DockerClient == nil && conf.UseInstance == "" {
-		return werr(fmt.Errorf("docker client and existing instance cannot be nil at the same time"))
+	if conf.DockerClient == nil && conf.Runtime == nil && conf.UseInstance == "" {
+		return werr(fmt.Errorf("docker client, runtime and existing instance cannot be nil at the same time"))
 	}
 
 	if conf.Resolution == nil {
 		conf.Resolution = DefaultResolution
 	}
 
+	if conf.Runtime == nil && conf.DockerClient != nil {
+		conf.Runtime = NewDockerRuntime(conf.DockerClient, conf.Resolution)
+	}
+
 	if conf.LoadTimeout == nil {
 		timeout := 15 * time.Second
 		conf.LoadTimeout = &timeout
 	}
 
+	if conf.RetryBackoff == 0 {
+		conf.RetryBackoff = time.Second
+	}
+
+	if conf.Trackers == nil {
+		conf.Trackers = DefaultTrackerList
+	}
+
+	if conf.HostResolver == nil {
+		conf.HostResolver = NewHostResolver()
+	}
+
 	id := uuid.New().String()[0:8]
 
 	var logger *zap.Logger
@@ -112,9 +221,9 @@ func NewWorker(conf WorkerConfig) (*worker, error) {
 		id:       id,
 		logger:   logger,
 		killC:    make(chan struct{}),
+		stoppedC: make(chan struct{}),
 		conf:     conf,
 		endpoint: conf.UseInstance,
-		hostInfo: cache.New(2*time.Minute, 30*time.Second),
 	}
 
 	if w.endpoint == "" {
@@ -149,25 +258,58 @@ func (w *worker) Run(queue <-chan CrawlRequest, results chan<- Page) error {
 	}
 
 	fetch := func(req CrawlRequest) Page {
-		errForReset := errCheck(context.DeadlineExceeded, ErrDockerConn)
+		errForReset := errCheck(context.DeadlineExceeded, ErrDockerConn, ErrBrowserCrash)
 
+		var crashes, deadlines, retries, attempts int
 		for {
 			ctx := context.Background()
 			if w.conf.Logger != nil {
 				ctx = context.WithValue(ctx, CTXLOGGER{}, w.conf.Logger)
 			}
-			ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+			ctx, cancel := context.WithTimeout(ctx, w.fetchTimeout(req))
 
 			resp := w.fetch(ctx, req)
 			cancel()
 
+			attempts++
+			resp.Attempts = attempts
+			resp.EgressIP = w.conf.EgressIP
+
 			if err := resp.Error; errForReset(err) {
-				w.removeContainer(w.container)
-				var err error
+				switch err {
+				case ErrBrowserCrash:
+					w.logger.Info("worker_browser_crash", zap.String("url", req.Url.String()))
+
+					crashes++
+					if crashes > browserCrashRetries {
+						return resp
+					}
+				case context.DeadlineExceeded:
+					deadlines++
+					if deadlines > deadlineRetries {
+						// the next crawl should not get a browser stuck on this page
+						w.resetContainer()
+						return resp
+					}
+				}
+
+				w.resetContainer()
+				continue
+			}
 
-				w.container, err = w.createContainer()
-				for err != nil {
-					w.container, err = w.createContainer()
+			if isRetryable(resp.Error) && retries < w.conf.MaxRetries {
+				// backoff grows linearly with the amount of retries
+				retries++
+				w.logger.Info("worker_fetch_retry",
+					zap.String("url", req.Url.String()),
+					zap.String("error", resp.Error.Error()),
+					zap.Int("retry", retries),
+				)
+
+				select {
+				case <-w.killC:
+					return resp
+				case <-time.After(time.Duration(retries) * w.conf.RetryBackoff):
 				}
 
 				continue
@@ -178,8 +320,17 @@ func (w *worker) Run(queue <-chan CrawlRequest, results chan<- Page) error {
 	}
 
 	w.logger.Info("worker_running")
+	atomic.StoreInt32(&w.running, 1)
+	defer close(w.stoppedC)
 
 	for {
+		// prioritize being killed over picking up new requests
+		select {
+		case <-w.killC:
+			return nil
+		default:
+		}
+
 		select {
 		case <-w.killC:
 			return nil
@@ -191,95 +342,98 @@ func (w *worker) Run(queue <-chan CrawlRequest, results chan<- Page) error {
 	}
 }
 
-func (w *worker) getHostInfo(domain string) Host {
-	if h, ok := w.hostInfo.Get(domain); ok {
-		if host, ok := h.(Host); ok {
-			return host
-		}
+// fetchTimeout is the deadline of crawling req, covering every visit of the
+// page along with the waits enabled by req
+func (w *worker) fetchTimeout(req CrawlRequest) time.Duration {
+	visits := 1
+	if req.WarmVisit {
+		visits = 2
 	}
+	d := time.Duration(visits) * (*w.conf.LoadTimeout + fetchOverhead)
 
-	host, _ := GetHostInfo(Domain(domain))
-	w.hostInfo.Set(domain, host, cache.DefaultExpiration)
-	return host
-}
+	if req.AutoScroll {
+		// the network is awaited to be idle again after scrolling
+		d += autoScrollMaxSteps*autoScrollPause + *w.conf.LoadTimeout
+	}
 
-func (w *worker) createContainer() (*docker.Container, error) {
-	port := GetAvailablePort()
-	w.endpoint = fmt.Sprintf("http://127.0.0.1:%d", port)
+	if req.Click != nil {
+		wait := req.Click.Wait
+		if wait == 0 {
+			wait = DefaultClickWait
+		}
+		d += wait
+	}
 
-	img := "chromedp/headless-shell"
-	var swap int64 = 0
-	opts := docker.CreateContainerOptions{
-		Name: fmt.Sprintf("kraaler-worker-%s", w.id),
-		Config: &docker.Config{
-			Image: img,
-			Cmd:   []string{fmt.Sprintf("--window-size=%s", w.conf.Resolution), "--no-sandbox", "--disable-gpu"},
-		},
-		HostConfig: &docker.HostConfig{
-			MemorySwap:       0,
-			MemorySwappiness: swap,
-			Memory:           768 * 1024 * 1024,
-			CPUPeriod:        100000,
-			CPUQuota:         100000, // one core
-			DNS:              []string{"1.1.1.1"},
-			PortBindings: map[docker.Port][]docker.PortBinding{
-				docker.Port("9222/tcp"): {{
-					HostIP:   "127.0.0.1",
-					HostPort: fmt.Sprintf("%d", port),
-				}},
-			},
-		},
+	if req.Trace {
+		d += traceOverhead
 	}
 
-	c, err := w.conf.DockerClient.CreateContainer(opts)
-	if err != nil {
-		if err.Error() != "no such image" {
-			return nil, err
+	var last time.Duration
+	for _, delay := range req.Screenshots {
+		if delay > last {
+			last = delay
 		}
+	}
 
-		if err := PullImage(w.conf.DockerClient, img); err != nil {
-			return nil, err
-		}
+	return d + last
+}
 
-		c, err = w.conf.DockerClient.CreateContainer(opts)
-		if err != nil {
-			return nil, err
+func (w *worker) createContainer() (*Container, error) {
+	start := w.conf.Runtime.Start
+	if w.conf.EgressIP != "" {
+		er, ok := w.conf.Runtime.(EgressRuntime)
+		if !ok {
+			return nil, ErrNoEgressSupport
 		}
+		start = func() (*Container, error) { return er.StartFrom(w.conf.EgressIP) }
 	}
 
-	stop := func(err error) (*docker.Container, error) {
-		w.removeContainer(c)
+	c, err := start()
+	if err != nil {
 		return nil, err
 	}
+	w.endpoint = c.Endpoint
+
+	return c, nil
+}
+
+func (w *worker) resetContainer() {
+	w.resetConn()
 
-	if err := w.conf.DockerClient.StartContainer(c.ID, nil); err != nil {
-		return stop(err)
+	// an existing instance (UseInstance) cannot be recreated
+	if w.conf.Runtime == nil {
+		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	if err := WaitForEndpoint(ctx, w.endpoint); err != nil {
-		return stop(err)
+	w.removeContainer(w.container)
+
+	c, err := w.createContainer()
+	for err != nil {
+		c, err = w.createContainer()
 	}
+	w.container = c
+}
 
-	return c, nil
+func (w *worker) resetConn() {
+	if w.sessionManager != nil {
+		w.sessionManager.Close()
+		w.sessionManager = nil
+	}
+
+	if w.rpccConn != nil {
+		w.rpccConn.Close()
+		w.rpccConn = nil
+	}
+
+	w.cdpClient = nil
 }
 
-func (w *worker) removeContainer(c *docker.Container) error {
+func (w *worker) removeContainer(c *Container) error {
 	if c == nil {
 		return nil
 	}
 
-	w.conf.DockerClient.StopContainer(
-		c.ID,
-		1,
-	)
-
-	return w.conf.DockerClient.RemoveContainer(
-		docker.RemoveContainerOptions{
-			ID: c.ID,
-		},
-	)
+	return w.conf.Runtime.Remove(c)
 }
 
 type ChromeEventParam struct {
@@ -293,16 +447,9 @@ type Causer interface {
 
 func (w *worker) client(ctx context.Context) (*cdp.Client, func() error, error) {
 	handleErr := func(err error) (*cdp.Client, func() error, error) {
-		if strings.HasSuffix(err.Error(), "rpcc: the connection is closing") {
-			w.rpccConn.Close()
-			w.rpccConn = nil
-
-			w.cdpClient = nil
-
-			w.sessionManager.Close()
-			w.sessionManager = nil
-
-			return nil, nil, rpcc.ErrConnClosing
+		if isBrowserCrash(err) {
+			w.resetConn()
+			return nil, nil, ErrBrowserCrash
 		}
 
 		return nil, nil, err
@@ -352,12 +499,13 @@ func (w *worker) client(ctx context.Context) (*cdp.Client, func() error, error)
 	}
 
 	c := cdp.NewClient(conn)
+	bc := w.cdpClient
 	closer := func() error {
 		if err := conn.Close(); err != nil {
 			return err
 		}
 
-		closeReply, err := w.cdpClient.Target.CloseTarget(ctx, target.NewCloseTargetArgs(createTarget.TargetID))
+		closeReply, err := bc.Target.CloseTarget(ctx, target.NewCloseTargetArgs(createTarget.TargetID))
 		if err != nil {
 			return err
 		}
@@ -365,7 +513,7 @@ func (w *worker) client(ctx context.Context) (*cdp.Client, func() error, error)
 			return errors.New("could not close target: " + string(createTarget.TargetID))
 		}
 
-		err = w.cdpClient.Target.DisposeBrowserContext(ctx, target.NewDisposeBrowserContextArgs(createCtx.BrowserContextID))
+		err = bc.Target.DisposeBrowserContext(ctx, target.NewDisposeBrowserContextArgs(createCtx.BrowserContextID))
 		if err != nil {
 			return err
 		}
@@ -501,10 +649,21 @@ func (w *worker) fetch(ctx context.Context, req CrawlRequest) Page {
 	result := Page{
 		InitialURL:    req.Url,
 		Resolution:    w.conf.Resolution.String(),
+		QueuedTime:    req.QueuedTime,
 		InitiatedTime: time.Now(),
+		Depth:         req.Depth,
+		LinkPolicy:    req.LinkPolicy,
+		Source:        req.Source,
 	}
 
 	replyErr := func(err error) Page {
+		if isBrowserCrash(err) {
+			w.resetConn()
+			result.Error = ErrBrowserCrash
+			w.logger.Info("worker_fetch_error", zap.String("error", result.Error.Error()))
+			return result
+		}
+
 		if cdp.ErrorCause(err) == context.DeadlineExceeded {
 			if strings.HasPrefix(err.Error(), "cdp.Page:") {
 				result.Error = ErrTimeoutDOM
@@ -528,7 +687,7 @@ func (w *worker) fetch(ctx context.Context, req CrawlRequest) Page {
 
 	c, clientClose, err := w.client(ctx)
 	if err != nil {
-		if err == rpcc.ErrConnClosing {
+		if err == ErrBrowserCrash {
 			c, clientClose, err = w.client(ctx)
 			if err != nil {
 				return replyErr(err)
@@ -538,17 +697,17 @@ func (w *worker) fetch(ctx context.Context, req CrawlRequest) Page {
 		}
 	}
 	defer func() {
+		// the connection is already gone, the container is reset by Run
+		if result.Error == ErrBrowserCrash {
+			return
+		}
+
 		if err := clientClose(); err != nil {
-			w.removeContainer(w.container)
-			c, err := w.createContainer()
-			if err != nil {
-				return
-			}
-			w.container = c
+			w.resetContainer()
 		}
 	}()
 
-	_, err = c.Page.Navigate(ctx, page.NewNavigateArgs("about:blank"))
+	blank, err := c.Page.Navigate(ctx, page.NewNavigateArgs("about:blank"))
 	if err != nil {
 		return replyErr(err)
 	}
@@ -559,11 +718,12 @@ func (w *worker) fetch(ctx context.Context, req CrawlRequest) Page {
 	}
 	defer dom.Close()
 
-	readRequests := requestsReader(ctx, c.Network)
-	readResponses := responsesReader(ctx, c.Network)
-	readRequestErrors := requestErrorsReader(ctx, c.Network)
-	readBodies := responseBodyReader(ctx, c.Network)
+	readNetwork := networkReader(ctx, c.Network)
 	readConsole := consoleReader(ctx, c.Runtime)
+	readDialogs := dialogReader(ctx, c.Page)
+	readServiceWorkers := serviceWorkerReader(ctx, c.ServiceWorker)
+	readWebSockets := webSocketReader(ctx, c.Network)
+	readFrames := webSocketFrameReader(ctx, c.Network)
 
 	if err = c.Page.Enable(ctx); err != nil {
 		return replyErr(err)
@@ -577,183 +737,1178 @@ func (w *worker) fetch(ctx context.Context, req CrawlRequest) Page {
 		return replyErr(err)
 	}
 
-	result.NavigateTime = time.Now()
-	_, err = c.Page.Navigate(ctx, page.NewNavigateArgs(req.Url.String()))
-	if err != nil {
-		return replyErr(err)
-	}
-
-	if _, err := dom.Recv(); err != nil {
+	if err = c.ServiceWorker.Enable(ctx); err != nil {
 		return replyErr(err)
 	}
-	result.LoadedTime = time.Now()
-	screenshotC := w.captureScreenshots(ctx, c.Page, req.Screenshots...)
-
-loop:
-	for {
-		select {
-		case <-ctx.Done():
-			return replyErr(ctx.Err())
-		case screens := <-screenshotC:
-			result.Screenshots = screens
-			result.TerminatedTime = time.Now()
-			break loop
-		}
-	}
 
-	requests, err := readRequests()
+	readPermissions, err := permissionReader(ctx, c.Runtime, c.Page)
 	if err != nil {
 		return replyErr(err)
 	}
 
-	responses, err := readResponses()
+	readUnload, err := unloadReader(ctx, c.Runtime, c.Page)
 	if err != nil {
 		return replyErr(err)
 	}
 
-	rerrs, err := readRequestErrors()
-	if err != nil {
-		return replyErr(err)
+	if req.PerformanceMetrics {
+		if err = c.Performance.Enable(ctx); err != nil {
+			return replyErr(err)
+		}
 	}
 
-	bodies, err := readBodies()
-	if err != nil {
-		return replyErr(err)
+	var lifecycle page.LifecycleEventClient
+	if req.WaitEvent != "" {
+		if err = c.Page.SetLifecycleEventsEnabled(ctx, page.NewSetLifecycleEventsEnabledArgs(true)); err != nil {
+			return replyErr(err)
+		}
+
+		lifecycle, err = c.Page.LifecycleEvent(ctx)
+		if err != nil {
+			return replyErr(err)
+		}
+		defer lifecycle.Close()
 	}
 
-	result.Actions = ActionsFromEvents(&BrowserEvents{
-		requests:  requests,
-		responses: responses,
-		errors:    rerrs,
-		bodies:    bodies,
-	})
+	var load page.LoadEventFiredClient
+	var activity *networkActivity
+	if req.WaitEvent == "" {
+		switch req.WaitUntil {
+		case WaitLoad:
+			load, err = c.Page.LoadEventFired(ctx)
+			if err != nil {
+				return replyErr(err)
+			}
+			defer load.Close()
+		case WaitNetworkIdle:
+			var stopActivity func()
+			activity, stopActivity, err = trackNetworkActivity(ctx, c.Network)
+			if err != nil {
+				return replyErr(err)
+			}
+			defer stopActivity()
+		}
+	}
 
-	for _, a := range result.Actions {
-		u, err := url.Parse(a.Request.URL)
+	var docs <-chan documentResponse
+	if req.WaitForStatus != 0 {
+		var closeDocs func()
+		docs, closeDocs, err = documentResponses(ctx, c.Network, blank.FrameID)
 		if err != nil {
-			continue
+			return replyErr(err)
 		}
+		defer closeDocs()
+	}
 
-		a.Host = w.getHostInfo(u.Host)
+	if len(req.Cookies) > 0 {
+		if err := c.Network.SetCookies(ctx, network.NewSetCookiesArgs(cookieParams(req.Url, req.Cookies))); err != nil {
+			return replyErr(err)
+		}
 	}
-	if len(result.Actions) > 0 {
-		if err := result.Actions[0].Error; err != nil {
-			result.Error = fmt.Errorf(*err)
+
+	var redirects *redirectLimiter
+	if req.MaxRedirects > 0 {
+		var stopRedirects func()
+		redirects, stopRedirects, err = limitRedirects(ctx, c.Network, c.Page, blank.FrameID, req.MaxRedirects)
+		if err != nil {
+			return replyErr(err)
 		}
+		defer stopRedirects()
+	}
 
-		if body := result.Actions[0].Body; body != nil {
-			result.DocumentURLs = LinksFromBodies(req.Url, body)
+	var trace tracing.CompleteClient
+	if req.Trace {
+		trace, err = startTrace(ctx, c.Tracing)
+		if err != nil {
+			return replyErr(err)
 		}
 	}
 
-	console, err := readConsole()
+	result.NavigateTime = time.Now()
+	nav, err := c.Page.Navigate(ctx, page.NewNavigateArgs(req.Url.String()))
 	if err != nil {
 		return replyErr(err)
 	}
-	result.Console = console
 
-	return result
-}
+	if redirects != nil {
+		result.Redirects, result.RedirectLimitExceeded = redirects.counts()
+	}
 
-func requestsReader(ctx context.Context, net cdp.Network) func() ([]*network.RequestWillBeSentReply, error) {
-	stop := make(chan struct{})
-	var requests []*network.RequestWillBeSentReply
-	var replyErr error
+	switch {
+	case result.RedirectLimitExceeded:
+		// a stopped navigation never loads, the blank page stays loaded
+	case lifecycle != nil:
+		var loader network.LoaderID
+		if nav.LoaderID != nil {
+			loader = *nav.LoaderID
+		}
 
-	go func() {
-		reqs, err := net.RequestWillBeSent(ctx)
+		ev, err := waitForLifecycle(lifecycle, nav.FrameID, loader, req.WaitEvent)
 		if err != nil {
-			replyErr = err
-			return
+			return replyErr(err)
+		}
+		result.LifecycleEvent = ev.Name
+		result.LifecycleTimestamp = float64(ev.Timestamp)
+	case load != nil:
+		if _, err := load.Recv(); err != nil {
+			return replyErr(err)
+		}
+	default:
+		if _, err := dom.Recv(); err != nil {
+			return replyErr(err)
 		}
-		defer reqs.Close()
 
-		for {
-			req, err := reqs.Recv()
-			if err != nil {
-				return
+		if activity != nil {
+			if err := activity.waitIdle(ctx, quietOrDefault(req.NetworkQuiet), *w.conf.LoadTimeout); err != nil {
+				return replyErr(err)
 			}
+		}
+	}
 
-			select {
-			case <-ctx.Done():
-				return
-			case <-stop:
-				return
-			default:
-				requests = append(requests, req)
-			}
+	if docs != nil && !result.RedirectLimitExceeded {
+		result.FinalStatus, result.RedirectHops, err = waitForStatus(ctx, docs, req.WaitForStatus, navigationQuietPeriod)
+		if err != nil {
+			return replyErr(err)
 		}
-	}()
+	}
+	result.LoadedTime = time.Now()
 
-	return func() ([]*network.RequestWillBeSentReply, error) {
-		close(stop)
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
+	if trace != nil {
+		result.Trace, err = stopTrace(ctx, c.Tracing, c.IO, trace)
+		if err != nil {
+			return replyErr(err)
 		}
+	}
 
-		if replyErr != nil {
-			return nil, replyErr
+	if req.AutoScroll {
+		if err := autoScroll(ctx, c.Runtime); err != nil {
+			return replyErr(err)
 		}
 
-		return requests, nil
+		// content fetched while scrolling should be recorded as well
+		if activity != nil {
+			if err := activity.waitIdle(ctx, quietOrDefault(req.NetworkQuiet), *w.conf.LoadTimeout); err != nil {
+				return replyErr(err)
+			}
+		}
 	}
-}
-
-func responsesReader(ctx context.Context, net cdp.Network) func() ([]*network.ResponseReceivedReply, error) {
-	stop := make(chan struct{})
-	var responses []*network.ResponseReceivedReply
-	var replyErr error
 
-	go func() {
-		resps, err := net.ResponseReceived(ctx)
+	if req.PreCaptureScript != "" {
+		result.ScriptResult, result.ScriptException, err = evaluateScript(ctx, c.Runtime, req.PreCaptureScript)
 		if err != nil {
-			replyErr = err
-			return
+			return replyErr(err)
 		}
-		defer resps.Close()
+	}
 
-		for {
-			resp, err := resps.Recv()
-			if err != nil {
-				return
-			}
+	if req.Click != nil {
+		result.Interaction, err = click(ctx, c.Runtime, c.Input, *req.Click)
+		if err != nil {
+			return replyErr(err)
+		}
 
-			select {
-			case <-ctx.Done():
-				return
-			case <-stop:
-				return
-			default:
-				responses = append(responses, resp)
-			}
+		wait := req.Click.Wait
+		if wait == 0 {
+			wait = DefaultClickWait
 		}
-	}()
 
-	return func() ([]*network.ResponseReceivedReply, error) {
-		close(stop)
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
-
-		if replyErr != nil {
-			return nil, replyErr
+			return replyErr(ctx.Err())
+		case <-time.After(wait):
 		}
+	}
 
-		return responses, nil
+	format := req.ScreenshotFormat
+	if format == "" {
+		format = DefaultScreenshotFormat
 	}
-}
 
-func requestErrorsReader(ctx context.Context, net cdp.Network) func() ([]*network.LoadingFailedReply, error) {
-	stop := make(chan struct{})
-	var errors []*network.LoadingFailedReply
-	var replyErr error
+	screenshotC := w.captureScreenshots(ctx, c.Page, format, req.Screenshots...)
 
-	go func() {
-		respErrs, err := net.LoadingFailed(ctx)
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			return replyErr(ctx.Err())
+		case screens := <-screenshotC:
+			result.Screenshots = screens
+			break loop
+		}
+	}
+
+	if req.CaptureDOM {
+		result.RenderedHTML, err = renderedHTML(ctx, c.Runtime)
+		if err != nil {
+			return replyErr(err)
+		}
+	}
+
+	// what complements the page is logged when failing to be captured,
+	// rather than discarding the page
+	captureErr := func(capture string, err error) {
+		w.logger.Info("worker_capture_error", zap.String("capture", capture), zap.String("error", err.Error()))
+	}
+
+	result.Manifest, err = appManifest(ctx, c.Page)
+	if err != nil {
+		captureErr("manifest", err)
+	}
+
+	if req.PerformanceMetrics {
+		metrics, err := c.Performance.GetMetrics(ctx)
+		if err != nil {
+			return replyErr(err)
+		}
+
+		result.PerformanceMetrics = map[string]float64{}
+		for _, m := range metrics.Metrics {
+			result.PerformanceMetrics[m.Name] = m.Value
+		}
+	}
+
+	// the navigation history includes navigations by scripts, which
+	// are not redirects of the document
+	history, err := c.Page.GetNavigationHistory(ctx)
+	if err != nil {
+		captureErr("navigation_history", err)
+	} else if i := history.CurrentIndex; i >= 0 && i < len(history.Entries) {
+		result.FinalURL, _ = url.Parse(history.Entries[i].URL)
+	}
+
+	cookies, err := c.Network.GetAllCookies(ctx)
+	if err != nil {
+		captureErr("cookies", err)
+	} else {
+		result.Cookies = cookiesFromBrowser(cookies.Cookies)
+	}
+
+	screens, err := w.captureViewports(ctx, c.Page, c.Emulation, format, req.Viewports...)
+	if err != nil {
+		return replyErr(err)
+	}
+	result.Screenshots = append(result.Screenshots, screens...)
+	result.TerminatedTime = time.Now()
+
+	events, err := readNetwork()
+	if err != nil {
+		return replyErr(err)
+	}
+
+	sockets, err := readWebSockets()
+	if err != nil {
+		return replyErr(err)
+	}
+	result.WebSockets = sockets
+
+	frames, err := readFrames()
+	if err != nil {
+		return replyErr(err)
+	}
+
+	socketsByID := map[network.RequestID]*WebSocket{}
+	for _, ws := range sockets {
+		socketsByID[ws.requestID] = ws
+	}
+	for _, f := range frames {
+		f.Socket = socketsByID[f.requestID]
+	}
+	result.WebSocketFrames = frames
+
+	result.Actions = ActionsFromEvents(events)
+	result.FailedRequests, result.BlockedRequests, result.FailedRequestBytes = FailuresFromEvents(events)
+	for _, ws := range result.WebSockets {
+		result.Actions = append(result.Actions, ws.Handshake)
+	}
+
+	w.resolveHosts(result.Actions)
+	result.Trackers = w.conf.Trackers.Requests(result.Actions)
+	result.SetCookies = SetCookieStats(result.Actions)
+	result.RequestedScheme, result.UpgradedScheme, result.SchemeUpgrade = SchemeUpgrade(result.Actions)
+	if result.FinalURL == nil {
+		result.FinalURL = finalURL(result.Actions)
+	}
+
+	if len(result.Actions) > 0 {
+		if err := result.Actions[0].Error; err != nil {
+			result.Error = fmt.Errorf(*err)
+		}
+
+		if body := result.Actions[0].Body; body != nil {
+			result.DocumentURLs = LinksFromBodies(req.Url, body)
+
+			if forms, err := RetrieveForms(req.Url, body.Body); err == nil {
+				result.Forms = forms
+				result.LikelyCredentialForm = LikelyCredentialForm(req.Url, forms)
+			}
+		}
+	}
+
+	// the document fails with an aborted navigation, the limit is the cause
+	if result.RedirectLimitExceeded {
+		result.Error = ErrTooManyRedirects
+	}
+
+	console, err := readConsole()
+	if err != nil {
+		return replyErr(err)
+	}
+	result.Console = console
+
+	dialogs, err := readDialogs()
+	if err != nil {
+		return replyErr(err)
+	}
+	result.Dialogs = dialogs
+
+	permissions, err := readPermissions()
+	if err != nil {
+		return replyErr(err)
+	}
+	result.Permissions = permissions
+
+	beforeUnload, unload, err := readUnload()
+	if err != nil {
+		return replyErr(err)
+	}
+	result.BeforeUnloadHandler = beforeUnload
+	result.UnloadHandler = unload
+
+	sws, err := readServiceWorkers()
+	if err != nil {
+		return replyErr(err)
+	}
+	result.ServiceWorkers = sws
+
+	if req.WarmVisit {
+		// the page of the first visit is kept when the warm visit fails
+		result.WarmActions, err = w.warmVisit(ctx, c, req.Url)
+		if err != nil {
+			result.WarmError = err
+			w.logger.Info("worker_warm_visit_error", zap.String("url", urlstr), zap.String("error", err.Error()))
+		}
+	}
+
+	return result
+}
+
+// renderedHTML serializes the current DOM of the page
+func renderedHTML(ctx context.Context, runt cdp.Runtime) ([]byte, error) {
+	args := runtime.NewEvaluateArgs("document.documentElement.outerHTML").SetReturnByValue(true)
+	reply, err := runt.Evaluate(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if exc := reply.ExceptionDetails; exc != nil {
+		return nil, fmt.Errorf("unable to serialize dom: %s", exc.Text)
+	}
+
+	var html string
+	if err := json.Unmarshal(reply.Result.Value, &html); err != nil {
+		return nil, err
+	}
+
+	return []byte(html), nil
+}
+
+func quietOrDefault(quiet time.Duration) time.Duration {
+	if quiet == 0 {
+		return DefaultNetworkQuiet
+	}
+
+	return quiet
+}
+
+const (
+	autoScrollPause    = 250 * time.Millisecond
+	autoScrollMaxSteps = 50
+)
+
+const autoScrollStep = `(() => {
+	window.scrollBy(0, window.innerHeight);
+	const height = document.documentElement.scrollHeight;
+	return {height: height, bottom: window.scrollY + window.innerHeight >= height};
+})()`
+
+// autoScroll scrolls the page a viewport at a time, until its bottom is
+// reached without it growing, and back to the top again
+func autoScroll(ctx context.Context, runt cdp.Runtime) error {
+	last := -1.0
+	for i := 0; i < autoScrollMaxSteps; i++ {
+		reply, err := runt.Evaluate(ctx, runtime.NewEvaluateArgs(autoScrollStep).SetReturnByValue(true))
+		if err != nil {
+			return err
+		}
+
+		if exc := reply.ExceptionDetails; exc != nil {
+			return fmt.Errorf("unable to scroll: %s", exc.Text)
+		}
+
+		var step struct {
+			Height float64 `json:"height"`
+			Bottom bool    `json:"bottom"`
+		}
+		if err := json.Unmarshal(reply.Result.Value, &step); err != nil {
+			return err
+		}
+
+		if step.Bottom && step.Height == last {
+			break
+		}
+		last = step.Height
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(autoScrollPause):
+		}
+	}
+
+	_, err := runt.Evaluate(ctx, runtime.NewEvaluateArgs("window.scrollTo(0, 0)"))
+	return err
+}
+
+// evaluateScript runs script in the page, awaiting its result if it is a
+// promise, and returns the result as JSON or the exception thrown
+func evaluateScript(ctx context.Context, runt cdp.Runtime, script string) (string, string, error) {
+	args := runtime.NewEvaluateArgs(script).
+		SetAwaitPromise(true).
+		SetReturnByValue(true).
+		SetUserGesture(true)
+	reply, err := runt.Evaluate(ctx, args)
+	if err != nil {
+		return "", "", err
+	}
+
+	if exc := reply.ExceptionDetails; exc != nil {
+		if exc.Exception != nil && exc.Exception.Description != nil {
+			return "", *exc.Exception.Description, nil
+		}
+
+		return "", exc.Text, nil
+	}
+
+	return string(reply.Result.Value), "", nil
+}
+
+// warmVisit navigates to u again in the same browser context, such that
+// resources cached by the first visit can be served from the cache
+func (w *worker) warmVisit(ctx context.Context, c *cdp.Client, u *url.URL) ([]*CrawlAction, error) {
+	load, err := c.Page.LoadEventFired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer load.Close()
+
+	readNetwork := networkReader(ctx, c.Network)
+
+	if _, err := c.Page.Navigate(ctx, page.NewNavigateArgs(u.String())); err != nil {
+		return nil, err
+	}
+
+	if _, err := load.Recv(); err != nil {
+		return nil, err
+	}
+
+	events, err := readNetwork()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := ActionsFromEvents(events)
+	w.resolveHosts(actions)
+
+	return actions, nil
+}
+
+// resolveHosts looks up the hosts of actions in parallel
+func (w *worker) resolveHosts(actions []*CrawlAction) {
+	domains := make([]string, len(actions))
+	for i, a := range actions {
+		if u, err := url.Parse(a.Request.URL); err == nil {
+			domains[i] = u.Host
+		}
+	}
+
+	hosts := w.conf.HostResolver.Resolve(domains...)
+	for i, a := range actions {
+		if domains[i] != "" {
+			a.Host = hosts[domains[i]]
+		}
+	}
+}
+
+// networkActivity tracks the requests of a page which are in flight
+type networkActivity struct {
+	m        sync.Mutex
+	inflight map[network.RequestID]struct{}
+	changed  chan struct{}
+}
+
+func trackNetworkActivity(ctx context.Context, net cdp.Network) (*networkActivity, func(), error) {
+	sent, err := net.RequestWillBeSent(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	finished, err := net.LoadingFinished(ctx)
+	if err != nil {
+		sent.Close()
+		return nil, nil, err
+	}
+
+	failed, err := net.LoadingFailed(ctx)
+	if err != nil {
+		sent.Close()
+		finished.Close()
+		return nil, nil, err
+	}
+
+	na := &networkActivity{
+		inflight: map[network.RequestID]struct{}{},
+		changed:  make(chan struct{}, 1),
+	}
+
+	update := func(id network.RequestID, done bool) {
+		na.m.Lock()
+		if done {
+			delete(na.inflight, id)
+		} else {
+			na.inflight[id] = struct{}{}
+		}
+		na.m.Unlock()
+
+		select {
+		case na.changed <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		for {
+			reply, err := sent.Recv()
+			if err != nil {
+				return
+			}
+			update(reply.RequestID, false)
+		}
+	}()
+
+	go func() {
+		for {
+			reply, err := finished.Recv()
+			if err != nil {
+				return
+			}
+			update(reply.RequestID, true)
+		}
+	}()
+
+	go func() {
+		for {
+			reply, err := failed.Recv()
+			if err != nil {
+				return
+			}
+			update(reply.RequestID, true)
+		}
+	}()
+
+	stop := func() {
+		sent.Close()
+		finished.Close()
+		failed.Close()
+	}
+
+	return na, stop, nil
+}
+
+// waitIdle waits until no requests have been in flight for the quiet
+// period, or at most timeout
+func (na *networkActivity) waitIdle(ctx context.Context, quiet, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		na.m.Lock()
+		n := len(na.inflight)
+		na.m.Unlock()
+
+		var quietC <-chan time.Time
+		if n == 0 {
+			quietC = time.After(quiet)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return nil
+		case <-quietC:
+			return nil
+		case <-na.changed:
+		}
+	}
+}
+
+// LifecycleEvents are the lifecycle events of a document which can end
+// the wait for a page to load
+var LifecycleEvents = []string{
+	"DOMContentLoaded",
+	"load",
+	"networkAlmostIdle",
+	"networkIdle",
+	"firstPaint",
+	"firstContentfulPaint",
+	"firstMeaningfulPaint",
+}
+
+// waitForLifecycle waits for the lifecycle event of the given name, fired
+// for the document of frame loaded by loader
+func waitForLifecycle(events page.LifecycleEventClient, frame page.FrameID, loader network.LoaderID, name string) (*page.LifecycleEventReply, error) {
+	for {
+		ev, err := events.Recv()
+		if err != nil {
+			return nil, err
+		}
+
+		if ev.FrameID != frame || ev.Name != name {
+			continue
+		}
+
+		if loader != "" && ev.LoaderID != loader {
+			continue
+		}
+
+		return ev, nil
+	}
+}
+
+// navigationQuietPeriod is the time without navigations of the main
+// document after which its redirect chain is considered stable
+const navigationQuietPeriod = time.Second
+
+type documentResponse struct {
+	url    string
+	status int
+}
+
+// documentResponses emits the responses of documents loaded by frame,
+// including the redirect responses leading to them
+func documentResponses(ctx context.Context, net cdp.Network, frame page.FrameID) (<-chan documentResponse, func(), error) {
+	requests, err := net.RequestWillBeSent(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responses, err := net.ResponseReceived(ctx)
+	if err != nil {
+		requests.Close()
+		return nil, nil, err
+	}
+
+	out := make(chan documentResponse, 32)
+	stop := make(chan struct{})
+	send := func(frameID *page.FrameID, kind network.ResourceType, resp *network.Response) {
+		if frameID == nil || *frameID != frame || kind != network.ResourceTypeDocument || resp == nil {
+			return
+		}
+
+		select {
+		case <-stop:
+		case out <- documentResponse{url: resp.URL, status: resp.Status}:
+		}
+	}
+
+	go func() {
+		for {
+			r, err := requests.Recv()
+			if err != nil {
+				return
+			}
+			send(r.FrameID, r.Type, r.RedirectResponse)
+		}
+	}()
+
+	go func() {
+		for {
+			r, err := responses.Recv()
+			if err != nil {
+				return
+			}
+			send(r.FrameID, r.Type, &r.Response)
+		}
+	}()
+
+	return out, func() {
+		close(stop)
+		requests.Close()
+		responses.Close()
+	}, nil
+}
+
+// redirectLimiter counts the redirects of a document, stopping its
+// navigation once they exceed a limit
+type redirectLimiter struct {
+	m        sync.Mutex
+	count    int
+	exceeded bool
+}
+
+func (rl *redirectLimiter) counts() (int, bool) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+
+	return rl.count, rl.exceeded
+}
+
+// limitRedirects stops loading the page once the document of frame has
+// been redirected more than max times. The limit is exceeded before the
+// navigation returns, as the navigation is stopped by the limit.
+func limitRedirects(ctx context.Context, net cdp.Network, pg cdp.Page, frame page.FrameID, max int) (*redirectLimiter, func(), error) {
+	sent, err := net.RequestWillBeSent(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rl := &redirectLimiter{}
+	go func() {
+		for {
+			r, err := sent.Recv()
+			if err != nil {
+				return
+			}
+
+			if r.FrameID == nil || *r.FrameID != frame || r.Type != network.ResourceTypeDocument || r.RedirectResponse == nil {
+				continue
+			}
+
+			rl.m.Lock()
+			rl.count += 1
+			stop := rl.count > max && !rl.exceeded
+			if stop {
+				rl.exceeded = true
+			}
+			rl.m.Unlock()
+
+			if stop {
+				pg.StopLoading(ctx)
+			}
+		}
+	}()
+
+	return rl, func() { sent.Close() }, nil
+}
+
+// waitForStatus follows the navigations of a document until it is served
+// with status, or until no navigation has happened within quiet. It returns
+// the last status seen and the amount of hops before it.
+func waitForStatus(ctx context.Context, docs <-chan documentResponse, status int, quiet time.Duration) (int, int, error) {
+	seen := map[documentResponse]bool{}
+	var final, hops int
+
+	timer := time.NewTimer(quiet)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return final, hops, ctx.Err()
+		case <-timer.C:
+			return final, hops, nil
+		case d := <-docs:
+			if seen[d] {
+				return final, hops, ErrRedirectLoop
+			}
+			seen[d] = true
+
+			if final != 0 {
+				hops += 1
+			}
+			final = d.status
+
+			if d.status == status {
+				return final, hops, nil
+			}
+
+			timer.Reset(quiet)
+		}
+	}
+}
+
+// RequestPostData is the post data of a request, without the file parts of
+// multipart/form-data bodies which Chrome does not hand out
+type RequestPostData struct {
+	RequestID network.RequestID
+	Data      []byte
+}
+
+// servedFromCacheReader collects the requests served from the memory cache
+// of the browser
+func servedFromCacheReader(ctx context.Context, net cdp.Network) func() ([]network.RequestID, error) {
+	stop := make(chan struct{})
+	var m sync.Mutex
+	var cached []network.RequestID
+	var replyErr error
+
+	served, err := net.RequestServedFromCache(ctx)
+	if err != nil {
+		replyErr = err
+	}
+
+	if replyErr == nil {
+		go func() {
+			defer served.Close()
+
+			for {
+				reply, err := served.Recv()
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					cached = append(cached, reply.RequestID)
+					m.Unlock()
+				}
+			}
+		}()
+	}
+
+	return func() ([]network.RequestID, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		return append([]network.RequestID(nil), cached...), nil
+	}
+}
+
+// dataReceivedReader sums the bytes received for each request, including
+// the bytes of requests failing before completing
+func dataReceivedReader(ctx context.Context, net cdp.Network) func() (map[network.RequestID]int64, error) {
+	stop := make(chan struct{})
+	var m sync.Mutex
+	received := map[network.RequestID]int64{}
+	var replyErr error
+
+	data, err := net.DataReceived(ctx)
+	if err != nil {
+		replyErr = err
+	}
+
+	if replyErr == nil {
+		go func() {
+			defer data.Close()
+
+			for {
+				reply, err := data.Recv()
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					received[reply.RequestID] += int64(reply.EncodedDataLength)
+					m.Unlock()
+				}
+			}
+		}()
+	}
+
+	return func() (map[network.RequestID]int64, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		res := make(map[network.RequestID]int64, len(received))
+		for id, n := range received {
+			res[id] = n
+		}
+
+		return res, nil
+	}
+}
+
+// networkReader collects the network events of the page, from which its
+// actions are created
+func networkReader(ctx context.Context, net cdp.Network) func() (*BrowserEvents, error) {
+	readRequests := requestsReader(ctx, net)
+	readResponses := responsesReader(ctx, net)
+	readRequestErrors := requestErrorsReader(ctx, net)
+	readBodies := responseBodyReader(ctx, net)
+	readPosts := postDataReader(ctx, net)
+	readCached := servedFromCacheReader(ctx, net)
+	readReceived := dataReceivedReader(ctx, net)
+
+	return func() (*BrowserEvents, error) {
+		requests, err := readRequests()
+		if err != nil {
+			return nil, err
+		}
+
+		responses, err := readResponses()
+		if err != nil {
+			return nil, err
+		}
+
+		rerrs, err := readRequestErrors()
+		if err != nil {
+			return nil, err
+		}
+
+		bodies, err := readBodies()
+		if err != nil {
+			return nil, err
+		}
+
+		posts, err := readPosts()
+		if err != nil {
+			return nil, err
+		}
+
+		cached, err := readCached()
+		if err != nil {
+			return nil, err
+		}
+
+		received, err := readReceived()
+		if err != nil {
+			return nil, err
+		}
+
+		return &BrowserEvents{
+			requests:  requests,
+			responses: responses,
+			errors:    rerrs,
+			bodies:    bodies,
+			posts:     posts,
+			cached:    cached,
+			received:  received,
+		}, nil
+	}
+}
+
+// postDataReader retrieves the complete post data of requests, as it is
+// omitted from the request event when it is too large. The post data is
+// fetched outside of the event loop, such that a slow reply does not hold
+// back the events following it.
+//
+// Chrome hands out the post data as a string, in which the file parts of
+// multipart/form-data bodies are omitted and bytes not forming valid UTF-8
+// are replaced, so binary post data cannot be recovered through the protocol
+func postDataReader(ctx context.Context, net cdp.Network) func() ([]*RequestPostData, error) {
+	var m sync.Mutex
+	var fetches sync.WaitGroup
+	var stopped bool
+	var posts []*RequestPostData
+	var replyErr error
+
+	reqs, err := net.RequestWillBeSent(ctx)
+	if err != nil {
+		replyErr = err
+	}
+
+	fetch := func(id network.RequestID) {
+		defer fetches.Done()
+
+		reply, err := net.GetRequestPostData(ctx, network.NewGetRequestPostDataArgs(id))
+		if err != nil {
+			return
+		}
+
+		m.Lock()
+		defer m.Unlock()
+		posts = append(posts, &RequestPostData{
+			RequestID: id,
+			Data:      []byte(reply.PostData),
+		})
+	}
+
+	if replyErr == nil {
+		go func() {
+			defer reqs.Close()
+
+			for {
+				req, err := reqs.Recv()
+				if err != nil {
+					return
+				}
+
+				if req.Request.HasPostData == nil || !*req.Request.HasPostData {
+					continue
+				}
+
+				m.Lock()
+				if stopped {
+					m.Unlock()
+					return
+				}
+				fetches.Add(1)
+				m.Unlock()
+
+				go fetch(req.RequestID)
+			}
+		}()
+	}
+
+	return func() ([]*RequestPostData, error) {
+		m.Lock()
+		stopped = true
+		m.Unlock()
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		fetched := make(chan struct{})
+		go func() {
+			fetches.Wait()
+			close(fetched)
+		}()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-fetched:
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		return append([]*RequestPostData(nil), posts...), nil
+	}
+}
+
+func requestsReader(ctx context.Context, net cdp.Network) func() ([]*network.RequestWillBeSentReply, error) {
+	stop := make(chan struct{})
+	var requests []*network.RequestWillBeSentReply
+	var replyErr error
+
+	go func() {
+		reqs, err := net.RequestWillBeSent(ctx)
+		if err != nil {
+			replyErr = err
+			return
+		}
+		defer reqs.Close()
+
+		for {
+			req, err := reqs.Recv()
+			if err != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			default:
+				requests = append(requests, req)
+			}
+		}
+	}()
+
+	return func() ([]*network.RequestWillBeSentReply, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		return requests, nil
+	}
+}
+
+func responsesReader(ctx context.Context, net cdp.Network) func() ([]*network.ResponseReceivedReply, error) {
+	stop := make(chan struct{})
+	var responses []*network.ResponseReceivedReply
+	var replyErr error
+
+	go func() {
+		resps, err := net.ResponseReceived(ctx)
+		if err != nil {
+			replyErr = err
+			return
+		}
+		defer resps.Close()
+
+		for {
+			resp, err := resps.Recv()
+			if err != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			default:
+				responses = append(responses, resp)
+			}
+		}
+	}()
+
+	return func() ([]*network.ResponseReceivedReply, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		return responses, nil
+	}
+}
+
+func requestErrorsReader(ctx context.Context, net cdp.Network) func() ([]*network.LoadingFailedReply, error) {
+	stop := make(chan struct{})
+	var errors []*network.LoadingFailedReply
+	var replyErr error
+
+	go func() {
+		respErrs, err := net.LoadingFailed(ctx)
 		if err != nil {
 			replyErr = err
 			return
@@ -767,17 +1922,337 @@ func requestErrorsReader(ctx context.Context, net cdp.Network) func() ([]*networ
 			}
 
 			select {
-			case <-stop:
-				return
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			default:
+				errors = append(errors, respErr)
+			}
+		}
+	}()
+
+	return func() ([]*network.LoadingFailedReply, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		return errors, nil
+	}
+}
+
+type ResponseBody struct {
+	RequestID      network.RequestID
+	Body           []byte
+	Links          []*url.URL
+	ChecksumSha256 string
+	Charset        string
+	EncodedSize    int64
+}
+
+func responseBodyReader(ctx context.Context, net cdp.Network) func() ([]*ResponseBody, error) {
+	stop := make(chan struct{})
+	var bodies []*ResponseBody
+	var replyErr error
+
+	go func() {
+		loadings, err := net.LoadingFinished(ctx)
+		if err != nil {
+			replyErr = err
+			return
+		}
+		defer loadings.Close()
+
+		for {
+			req, err := loadings.Recv()
+			if err != nil {
+				return
+			}
+
+			bodyReply, err := net.GetResponseBody(ctx, &network.GetResponseBodyArgs{req.RequestID})
+			if err != nil {
+				return
+			}
+
+			var body []byte
+			if bodyReply.Base64Encoded {
+				body, err = base64.StdEncoding.DecodeString(bodyReply.Body)
+				if err != nil {
+					body = []byte(bodyReply.Body)
+				}
+			} else {
+				body = []byte(bodyReply.Body)
+			}
+
+			checksum := fmt.Sprintf("%x", sha256.Sum256(body))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			default:
+				bodies = append(bodies, &ResponseBody{
+					RequestID:      req.RequestID,
+					Body:           body,
+					ChecksumSha256: checksum,
+					EncodedSize:    int64(req.EncodedDataLength),
+				})
+			}
+		}
+	}()
+
+	return func() ([]*ResponseBody, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		return bodies, nil
+	}
+}
+
+// ConsoleArg is an argument of a console call, its value is serialized as
+// JSON
+type ConsoleArg struct {
+	Type  string
+	Value string
+}
+
+type JavaScriptConsole struct {
+	Type     string
+	Level    string
+	Msg      string
+	Args     []ConsoleArg
+	Line     int
+	Column   int
+	Function string
+	URL      string
+}
+
+// consoleLevel is the severity of a console call of the given type, such
+// that e.g. console.table and console.log are both of level log
+func consoleLevel(kind string) string {
+	switch kind {
+	case "error", "assert":
+		return "error"
+	case "warning":
+		return "warn"
+	case "info", "debug":
+		return kind
+	}
+
+	return "log"
+}
+
+func consoleReader(ctx context.Context, runt cdp.Runtime) func() ([]*JavaScriptConsole, error) {
+	stop := make(chan struct{})
+	var console []*JavaScriptConsole
+	var replyErr error
+
+	go func() {
+		messages, err := runt.ConsoleAPICalled(ctx)
+		if err != nil {
+			return
+		}
+		defer messages.Close()
+
+		for {
+			msg, err := messages.Recv()
+			if err != nil {
+				return
+			}
+
+			cmsg := &JavaScriptConsole{
+				Type:  msg.Type,
+				Level: consoleLevel(msg.Type),
+			}
+
+			values := make([]string, len(msg.Args))
+			for i, o := range msg.Args {
+				arg := ConsoleArg{Type: o.Type, Value: consoleArgValue(o)}
+				if o.Subtype != nil {
+					arg.Type = *o.Subtype
+				}
+
+				cmsg.Args = append(cmsg.Args, arg)
+				values[i] = arg.Value
+			}
+			cmsg.Msg = strings.Join(values, " ")
+
+			if st := msg.StackTrace; st != nil && len(st.CallFrames) > 0 {
+				cf := st.CallFrames[0]
+				cmsg.Line = cf.LineNumber
+				cmsg.Column = cf.ColumnNumber
+				cmsg.Function = cf.FunctionName
+				cmsg.URL = cf.URL
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			default:
+				console = append(console, cmsg)
+			}
+		}
+	}()
+
+	return func() ([]*JavaScriptConsole, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		return console, nil
+	}
+}
+
+// consoleArgValue serializes an argument of a console call as JSON, the
+// properties of objects are only known from their preview
+func consoleArgValue(o runtime.RemoteObject) string {
+	switch {
+	case o.Value != nil:
+		return string(o.Value)
+	case o.UnserializableValue != nil:
+		return strconv.Quote(string(*o.UnserializableValue))
+	case o.Preview != nil:
+		return consolePreviewValue(o.Preview)
+	case o.Description != nil:
+		return strconv.Quote(*o.Description)
+	}
+
+	return "null"
+}
+
+func consolePreviewValue(p *runtime.ObjectPreview) string {
+	property := func(pp runtime.PropertyPreview) interface{} {
+		if pp.ValuePreview != nil {
+			return json.RawMessage(consolePreviewValue(pp.ValuePreview))
+		}
+
+		if pp.Value == nil {
+			return nil
+		}
+
+		switch pp.Type {
+		case "number", "boolean":
+			if json.Valid([]byte(*pp.Value)) {
+				return json.RawMessage(*pp.Value)
+			}
+		case "object":
+			if *pp.Value == "null" {
+				return nil
+			}
+		case "undefined":
+			return nil
+		}
+
+		return *pp.Value
+	}
+
+	var v interface{}
+	if p.Subtype != nil && *p.Subtype == "array" {
+		list := []interface{}{}
+		for _, pp := range p.Properties {
+			list = append(list, property(pp))
+		}
+		v = list
+	} else {
+		obj := map[string]interface{}{}
+		for _, pp := range p.Properties {
+			obj[pp.Name] = property(pp)
+		}
+		v = obj
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+
+	return string(raw)
+}
+
+type JavaScriptDialog struct {
+	Kind    string
+	Message string
+	URL     string
+	Opened  time.Time
+}
+
+// dialogReader records and dismisses javascript dialogs, as they would
+// otherwise stall the page execution, while beforeunload dialogs are accepted
+func dialogReader(ctx context.Context, pg cdp.Page) func() ([]*JavaScriptDialog, error) {
+	stop := make(chan struct{})
+	var m sync.Mutex
+	var dialogs []*JavaScriptDialog
+	var replyErr error
+
+	go func() {
+		opening, err := pg.JavascriptDialogOpening(ctx)
+		if err != nil {
+			m.Lock()
+			replyErr = err
+			m.Unlock()
+			return
+		}
+		defer opening.Close()
+
+		for {
+			d, err := opening.Recv()
+			if err != nil {
+				return
+			}
+
+			dialog := &JavaScriptDialog{
+				Kind:    string(d.Type),
+				Message: d.Message,
+				URL:     d.URL,
+				Opened:  time.Now(),
+			}
+
+			// leaving is confirmed, such that pages cannot keep the
+			// browser from navigating away
+			accept := d.Type == page.DialogTypeBeforeunload
+			if err := pg.HandleJavaScriptDialog(ctx, page.NewHandleJavaScriptDialogArgs(accept)); err != nil {
+				return
+			}
+
+			select {
 			case <-ctx.Done():
 				return
+			case <-stop:
+				return
 			default:
-				errors = append(errors, respErr)
+				m.Lock()
+				dialogs = append(dialogs, dialog)
+				m.Unlock()
 			}
 		}
 	}()
 
-	return func() ([]*network.LoadingFailedReply, error) {
+	return func() ([]*JavaScriptDialog, error) {
 		close(stop)
 		select {
 		case <-ctx.Done():
@@ -785,73 +2260,111 @@ func requestErrorsReader(ctx context.Context, net cdp.Network) func() ([]*networ
 		default:
 		}
 
+		m.Lock()
+		defer m.Unlock()
 		if replyErr != nil {
 			return nil, replyErr
 		}
 
-		return errors, nil
+		return dialogs, nil
 	}
 }
 
-type ResponseBody struct {
-	RequestID      network.RequestID
-	Body           []byte
-	Links          []*url.URL
-	ChecksumSha256 string
+type ServiceWorker struct {
+	RegistrationID string
+	ScopeURL       string
+	ScriptURL      string
+	Status         string
 }
 
-func responseBodyReader(ctx context.Context, net cdp.Network) func() ([]*ResponseBody, error) {
+func serviceWorkerReader(ctx context.Context, sw cdp.ServiceWorker) func() ([]*ServiceWorker, error) {
 	stop := make(chan struct{})
-	var bodies []*ResponseBody
+	var m sync.Mutex
+	workers := map[string]*ServiceWorker{}
+	var order []string
 	var replyErr error
 
-	go func() {
-		loadings, err := net.LoadingFinished(ctx)
+	get := func(id string) *ServiceWorker {
+		w, ok := workers[id]
+		if !ok {
+			w = &ServiceWorker{RegistrationID: id}
+			workers[id] = w
+			order = append(order, id)
+		}
+
+		return w
+	}
+
+	registrations, err := sw.WorkerRegistrationUpdated(ctx)
+	if err != nil {
+		replyErr = err
+	}
+
+	var versions serviceworker.WorkerVersionUpdatedClient
+	if replyErr == nil {
+		versions, err = sw.WorkerVersionUpdated(ctx)
 		if err != nil {
+			registrations.Close()
 			replyErr = err
-			return
 		}
-		defer loadings.Close()
-
-		for {
-			req, err := loadings.Recv()
-			if err != nil {
-				return
-			}
+	}
 
-			bodyReply, err := net.GetResponseBody(ctx, &network.GetResponseBodyArgs{req.RequestID})
-			if err != nil {
-				return
-			}
+	if replyErr == nil {
+		go func() {
+			defer registrations.Close()
 
-			var body []byte
-			if bodyReply.Base64Encoded {
-				body, err = base64.StdEncoding.DecodeString(bodyReply.Body)
+			for {
+				reply, err := registrations.Recv()
 				if err != nil {
-					body = []byte(bodyReply.Body)
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					for _, r := range reply.Registrations {
+						if r.IsDeleted {
+							continue
+						}
+						get(r.RegistrationID).ScopeURL = r.ScopeURL
+					}
+					m.Unlock()
 				}
-			} else {
-				body = []byte(bodyReply.Body)
 			}
+		}()
 
-			checksum := fmt.Sprintf("%x", sha256.Sum256(body))
+		go func() {
+			defer versions.Close()
 
-			select {
-			case <-ctx.Done():
-				return
-			case <-stop:
-				return
-			default:
-				bodies = append(bodies, &ResponseBody{
-					RequestID:      req.RequestID,
-					Body:           body,
-					ChecksumSha256: checksum,
-				})
+			for {
+				reply, err := versions.Recv()
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					for _, v := range reply.Versions {
+						w := get(v.RegistrationID)
+						w.ScriptURL = v.ScriptURL
+						w.Status = string(v.Status)
+					}
+					m.Unlock()
+				}
 			}
-		}
-	}()
+		}()
+	}
 
-	return func() ([]*ResponseBody, error) {
+	return func() ([]*ServiceWorker, error) {
 		close(stop)
 		select {
 		case <-ctx.Done():
@@ -863,70 +2376,250 @@ func responseBodyReader(ctx context.Context, net cdp.Network) func() ([]*Respons
 			return nil, replyErr
 		}
 
-		return bodies, nil
-	}
-}
+		m.Lock()
+		defer m.Unlock()
 
-type JavaScriptConsole struct {
-	Msg      string
-	Line     int
-	Column   int
-	Function string
-	URL      string
+		var res []*ServiceWorker
+		for _, id := range order {
+			res = append(res, workers[id])
+		}
+
+		return res, nil
+	}
 }
 
-func consoleReader(ctx context.Context, runt cdp.Runtime) func() ([]*JavaScriptConsole, error) {
+// webSocketReader records the upgrade handshake of each websocket as an
+// action, with the request and response headers of the handshake
+func webSocketReader(ctx context.Context, net cdp.Network) func() ([]*WebSocket, error) {
 	stop := make(chan struct{})
-	var console []*JavaScriptConsole
+	var m sync.Mutex
+	sockets := map[network.RequestID]*WebSocket{}
+	var order []network.RequestID
 	var replyErr error
 
-	go func() {
-		messages, err := runt.ConsoleAPICalled(ctx)
+	get := func(id network.RequestID) *WebSocket {
+		ws, ok := sockets[id]
+		if !ok {
+			ws = &WebSocket{
+				requestID: id,
+				Handshake: &CrawlAction{
+					Initiator: Initiator{Kind: "websocket"},
+					Request:   network.Request{Method: "GET"},
+				},
+			}
+			sockets[id] = ws
+			order = append(order, id)
+		}
+
+		return ws
+	}
+
+	created, err := net.WebSocketCreated(ctx)
+	if err != nil {
+		replyErr = err
+	}
+
+	var handshakes network.WebSocketWillSendHandshakeRequestClient
+	if replyErr == nil {
+		handshakes, err = net.WebSocketWillSendHandshakeRequest(ctx)
 		if err != nil {
-			return
+			created.Close()
+			replyErr = err
 		}
-		defer messages.Close()
+	}
 
-		for {
-			msg, err := messages.Recv()
-			if err != nil {
-				return
+	var upgrades network.WebSocketHandshakeResponseReceivedClient
+	if replyErr == nil {
+		upgrades, err = net.WebSocketHandshakeResponseReceived(ctx)
+		if err != nil {
+			created.Close()
+			handshakes.Close()
+			replyErr = err
+		}
+	}
+
+	if replyErr == nil {
+		go func() {
+			defer created.Close()
+
+			for {
+				reply, err := created.Recv()
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					ws := get(reply.RequestID)
+					ws.URL = reply.URL
+					ws.Handshake.Request.URL = reply.URL
+					m.Unlock()
+				}
 			}
+		}()
 
-			if msg.Type != "log" {
-				continue
+		go func() {
+			defer handshakes.Close()
+
+			for {
+				reply, err := handshakes.Recv()
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					a := get(reply.RequestID).Handshake
+					a.Request.Headers = reply.Request.Headers
+					a.Timings.StartTime = float64(reply.Timestamp)
+					m.Unlock()
+				}
 			}
+		}()
+
+		go func() {
+			defer upgrades.Close()
 
-			var txt string
-			for _, o := range msg.Args {
-				txt += fmt.Sprintf("%s ", o.Value)
+			for {
+				reply, err := upgrades.Recv()
+				if err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				default:
+					m.Lock()
+					a := get(reply.RequestID).Handshake
+					a.Response = &network.Response{
+						URL:                a.Request.URL,
+						Status:             reply.Response.Status,
+						StatusText:         reply.Response.StatusText,
+						Headers:            reply.Response.Headers,
+						HeadersText:        reply.Response.HeadersText,
+						RequestHeaders:     reply.Response.RequestHeaders,
+						RequestHeadersText: reply.Response.RequestHeadersText,
+					}
+					a.Timings.EndTime = float64(reply.Timestamp)
+					m.Unlock()
+				}
 			}
-			txt = txt[0 : len(txt)-1]
+		}()
+	}
 
-			cmsg := &JavaScriptConsole{
-				Msg: txt,
+	return func() ([]*WebSocket, error) {
+		close(stop)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if replyErr != nil {
+			return nil, replyErr
+		}
+
+		m.Lock()
+		defer m.Unlock()
+
+		var res []*WebSocket
+		for _, id := range order {
+			res = append(res, sockets[id])
+		}
+
+		return res, nil
+	}
+}
+
+// webSocketFrameReader collects the frames sent and received on the
+// websockets of the page, ordered by their timestamp
+func webSocketFrameReader(ctx context.Context, net cdp.Network) func() ([]*WebSocketFrame, error) {
+	stop := make(chan struct{})
+	var m sync.Mutex
+	var frames []*WebSocketFrame
+	var replyErr error
+
+	add := func(id network.RequestID, direction string, ts network.MonotonicTime, f network.WebSocketFrame) {
+		length := len(f.PayloadData)
+		if f.Opcode != 1 {
+			// non-text payloads are base64 encoded
+			if raw, err := base64.StdEncoding.DecodeString(f.PayloadData); err == nil {
+				length = len(raw)
 			}
+		}
 
-			if st := msg.StackTrace; st != nil && len(st.CallFrames) > 0 {
-				cf := st.CallFrames[0]
-				cmsg.Line = cf.LineNumber
-				cmsg.Column = cf.ColumnNumber
-				cmsg.Function = cf.FunctionName
-				cmsg.URL = cf.URL
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		default:
+			m.Lock()
+			frames = append(frames, &WebSocketFrame{
+				Direction:     direction,
+				Opcode:        int(f.Opcode),
+				PayloadLength: length,
+				Timestamp:     float64(ts),
+				requestID:     id,
+			})
+			m.Unlock()
+		}
+	}
+
+	sent, err := net.WebSocketFrameSent(ctx)
+	if err != nil {
+		replyErr = err
+	}
+
+	var received network.WebSocketFrameReceivedClient
+	if replyErr == nil {
+		received, err = net.WebSocketFrameReceived(ctx)
+		if err != nil {
+			sent.Close()
+			replyErr = err
+		}
+	}
+
+	if replyErr == nil {
+		go func() {
+			defer sent.Close()
+
+			for {
+				reply, err := sent.Recv()
+				if err != nil {
+					return
+				}
+
+				add(reply.RequestID, "sent", reply.Timestamp, reply.Response)
 			}
+		}()
 
-			select {
-			case <-ctx.Done():
-				return
-			case <-stop:
-				return
-			default:
-				console = append(console, cmsg)
+		go func() {
+			defer received.Close()
+
+			for {
+				reply, err := received.Recv()
+				if err != nil {
+					return
+				}
+
+				add(reply.RequestID, "received", reply.Timestamp, reply.Response)
 			}
-		}
-	}()
+		}()
+	}
 
-	return func() ([]*JavaScriptConsole, error) {
+	return func() ([]*WebSocketFrame, error) {
 		close(stop)
 		select {
 		case <-ctx.Done():
@@ -938,11 +2631,18 @@ func consoleReader(ctx context.Context, runt cdp.Runtime) func() ([]*JavaScriptC
 			return nil, replyErr
 		}
 
-		return console, nil
+		m.Lock()
+		defer m.Unlock()
+
+		res := make([]*WebSocketFrame, len(frames))
+		copy(res, frames)
+		sort.SliceStable(res, func(i, j int) bool { return res[i].Timestamp < res[j].Timestamp })
+
+		return res, nil
 	}
 }
 
-func (w *worker) captureScreenshots(ctx context.Context, pg cdp.Page, durations ...time.Duration) <-chan []*BrowserScreenshot {
+func (w *worker) captureScreenshots(ctx context.Context, pg cdp.Page, format string, durations ...time.Duration) <-chan []*BrowserScreenshot {
 	out := make(chan []*BrowserScreenshot)
 
 	go func() {
@@ -964,7 +2664,7 @@ func (w *worker) captureScreenshots(ctx context.Context, pg cdp.Page, durations
 				}
 
 				taken := time.Now()
-				encoded, err := pg.CaptureScreenshot(ctx, page.NewCaptureScreenshotArgs().SetFormat("png"))
+				encoded, err := pg.CaptureScreenshot(ctx, page.NewCaptureScreenshotArgs().SetFormat(format))
 				if err != nil {
 					return
 				}
@@ -979,7 +2679,7 @@ func (w *worker) captureScreenshots(ctx context.Context, pg cdp.Page, durations
 					Screenshot: screenshot,
 					Taken:      taken,
 					Resolution: *w.conf.Resolution,
-					Kind:       "png",
+					Kind:       format,
 				})
 				m.Unlock()
 
@@ -994,16 +2694,56 @@ func (w *worker) captureScreenshots(ctx context.Context, pg cdp.Page, durations
 	return out
 }
 
+// captureViewports takes a screenshot of the loaded page for each viewport,
+// by overriding the device metrics rather than navigating again
+func (w *worker) captureViewports(ctx context.Context, pg cdp.Page, emu cdp.Emulation, format string, viewports ...Viewport) ([]*BrowserScreenshot, error) {
+	if len(viewports) == 0 {
+		return nil, nil
+	}
+	defer emu.ClearDeviceMetricsOverride(ctx)
+
+	var screenshots []*BrowserScreenshot
+	for _, vp := range viewports {
+		if vp.ScaleFactor == 0 {
+			vp.ScaleFactor = 1
+		}
+
+		args := emulation.NewSetDeviceMetricsOverrideArgs(vp.Resolution.Width, vp.Resolution.Height, vp.ScaleFactor, vp.Mobile)
+		if err := emu.SetDeviceMetricsOverride(ctx, args); err != nil {
+			return nil, err
+		}
+
+		taken := time.Now()
+		encoded, err := pg.CaptureScreenshot(ctx, page.NewCaptureScreenshotArgs().SetFormat(format))
+		if err != nil {
+			return nil, err
+		}
+
+		screenshots = append(screenshots, &BrowserScreenshot{
+			Screenshot:  encoded.Data,
+			Taken:       taken,
+			Resolution:  vp.Resolution,
+			ScaleFactor: vp.ScaleFactor,
+			Mobile:      vp.Mobile,
+			Kind:        format,
+		})
+	}
+
+	return screenshots, nil
+}
+
 func (w *worker) Close() error {
 	close(w.killC)
 
-	if w.rpccConn != nil {
-		w.rpccConn.Close()
+	if atomic.LoadInt32(&w.running) == 1 && w.conf.DrainTimeout > 0 {
+		select {
+		case <-w.stoppedC:
+		case <-time.After(w.conf.DrainTimeout):
+			w.logger.Info("worker_drain_timeout")
+		}
 	}
 
-	if w.sessionManager != nil {
-		w.sessionManager.Close()
-	}
+	w.resetConn()
 
 	if w.container != nil {
 		w.removeContainer(w.container)
@@ -1017,6 +2757,28 @@ type BrowserEvents struct {
 	responses []*network.ResponseReceivedReply
 	errors    []*network.LoadingFailedReply
 	bodies    []*ResponseBody
+	posts     []*RequestPostData
+	cached    []network.RequestID
+	received  map[network.RequestID]int64
+}
+
+// renderBlocking tells whether a request blocks the first render of the
+// page. The protocol lacks the render blocking behaviour of requests, so
+// stylesheets and scripts of the parser requested with a high priority
+// (i.e. not deferred, async or for other media) are considered blocking.
+func renderBlocking(sent *network.RequestWillBeSentReply) bool {
+	if sent.Initiator.Type != "parser" {
+		return false
+	}
+
+	switch sent.Type {
+	case network.ResourceTypeStylesheet, network.ResourceTypeScript:
+	default:
+		return false
+	}
+
+	p := sent.Request.InitialPriority
+	return p == network.ResourcePriorityHigh || p == network.ResourcePriorityVeryHigh
 }
 
 func ActionsFromEvents(events *BrowserEvents) []*CrawlAction {
@@ -1038,10 +2800,19 @@ func ActionsFromEvents(events *BrowserEvents) []*CrawlAction {
 				Kind: sent.Initiator.Type,
 			},
 			Request: sent.Request,
+			Timings: BrowserTimes{
+				StartTime: float64(sent.Timestamp),
+			},
+			RenderBlocking: renderBlocking(sent),
+		}
+
+		if sent.Initiator.URL != nil {
+			ca.Initiator.URL = *sent.Initiator.URL
 		}
 
 		if parent, ok := requests[network.RequestID(sent.LoaderID)]; ok {
 			parent.Response = sent.RedirectResponse
+			parent.Timings.read(sent.RedirectResponse, float64(sent.Timestamp))
 			ca.Parent = parent
 		}
 
@@ -1056,6 +2827,25 @@ func ActionsFromEvents(events *BrowserEvents) []*CrawlAction {
 		}
 
 		req.Response = &recv.Response
+		req.Timings.read(&recv.Response, float64(recv.Timestamp))
+
+		if fc := recv.Response.FromDiskCache; fc != nil && *fc {
+			req.FromCache = true
+		}
+
+		if headers, err := recv.Response.Headers.Map(); err == nil {
+			for k, v := range headers {
+				if strings.EqualFold(k, CacheProxyHeader) {
+					req.ProxyCache = v
+				}
+			}
+		}
+	}
+
+	for _, id := range events.cached {
+		if req, ok := requests[id]; ok {
+			req.FromCache = true
+		}
 	}
 
 	for _, err := range events.errors {
@@ -1066,6 +2856,7 @@ func ActionsFromEvents(events *BrowserEvents) []*CrawlAction {
 
 		if req.Error == nil {
 			req.Error = &err.ErrorText
+			req.Timings.EndTime = float64(err.Timestamp)
 		}
 	}
 
@@ -1075,10 +2866,41 @@ func ActionsFromEvents(events *BrowserEvents) []*CrawlAction {
 			continue
 		}
 
+		var contentType string
+		if req.Response != nil {
+			if headers, err := req.Response.Headers.Map(); err == nil {
+				for k, v := range headers {
+					if strings.EqualFold(k, "Content-Type") {
+						contentType = v
+					}
+				}
+			}
+		}
+		body.Charset = RetrieveCharset(contentType, body.Body)
+
 		req.Body = body
 	}
 
+	for _, post := range events.posts {
+		req, ok := requests[post.RequestID]
+		if !ok {
+			continue
+		}
+
+		req.PostData = post.Data
+	}
+
 	for _, a := range actions {
+		if resp := a.Response; resp != nil {
+			if resp.RemoteIPAddress != nil {
+				a.RemoteIP = *resp.RemoteIPAddress
+			}
+
+			if resp.RemotePort != nil {
+				a.RemotePort = *resp.RemotePort
+			}
+		}
+
 		if a.Parent != nil && a.Parent.Response != nil {
 			sc := a.Parent.Response.Status
 			if sc >= 300 && sc < 400 {
@@ -1093,6 +2915,63 @@ func ActionsFromEvents(events *BrowserEvents) []*CrawlAction {
 	return actions
 }
 
+// FailuresFromEvents counts the requests which failed or were blocked, and
+// their intended size. The intended size of a request is the length
+// announced by its response, or the bytes received for it when its
+// response announced none, and is zero for requests failing before any
+// response
+func FailuresFromEvents(events *BrowserEvents) (failed int, blocked int, size int64) {
+	sent := map[network.RequestID]bool{}
+	for _, req := range events.requests {
+		u, err := url.Parse(req.Request.URL)
+		if err != nil || u.Scheme == "data" {
+			continue
+		}
+
+		sent[req.RequestID] = true
+	}
+
+	intended := map[network.RequestID]int64{}
+	for id, n := range events.received {
+		intended[id] = n
+	}
+
+	for _, recv := range events.responses {
+		headers, err := recv.Response.Headers.Map()
+		if err != nil {
+			continue
+		}
+
+		for k, v := range headers {
+			if !strings.EqualFold(k, "Content-Length") {
+				continue
+			}
+
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil && n > 0 {
+				intended[recv.RequestID] = n
+			}
+		}
+	}
+
+	seen := map[network.RequestID]bool{}
+	for _, e := range events.errors {
+		if !sent[e.RequestID] || seen[e.RequestID] {
+			continue
+		}
+		seen[e.RequestID] = true
+
+		if e.BlockedReason != "" {
+			blocked += 1
+		} else {
+			failed += 1
+		}
+
+		size += intended[e.RequestID]
+	}
+
+	return failed, blocked, size
+}
+
 func GetAvailablePort() uint {
 	l, _ := net.Listen("tcp", ":0")
 	parts := strings.Split(l.Addr().String(), ":")
@@ -1112,10 +2991,31 @@ func PullImage(c *docker.Client, img string) error {
 
 func LinksFromBodies(host *url.URL, bodies ...*ResponseBody) []*url.URL {
 	var links []*url.URL
-	// for _, b := range bodies {
-	// 	l, _ := RetrieveLinks(host, b.Body)
-	// 	links = append(links, l...)
-	// }
+	seen := map[string]struct{}{}
+	for _, b := range bodies {
+		if b == nil {
+			continue
+		}
+
+		found, err := RetrieveLinks(host, b.Body)
+		if err != nil {
+			continue
+		}
+
+		if refresh, _, err := RetrieveMetaRefresh(host, b.Body); err == nil && refresh != nil {
+			found = append(found, refresh)
+		}
+		found = append(found, RetrieveLocationRedirects(host, b.Body)...)
+
+		for _, l := range found {
+			if _, ok := seen[l.String()]; ok {
+				continue
+			}
+			seen[l.String()] = struct{}{}
+
+			links = append(links, l)
+		}
+	}
 
 	return links
 }
@@ -1168,10 +3068,51 @@ type URLStore interface {
 	Size() int
 }
 
+// DepthURLStore is implemented by url stores able to track the distance
+// of urls from the seeds they were discovered from
+type DepthURLStore interface {
+	URLStore
+	AddWithDepth(depth int, urls ...*url.URL) (int, error)
+	Depth(u *url.URL) int
+}
+
+// SourceURLStore is a url store which keeps the source (feed) each url
+// originates from
+type SourceURLStore interface {
+	DepthURLStore
+	AddWithSource(source string, depth int, urls ...*url.URL) (int, error)
+	Source(u *url.URL) string
+}
+
+// ReleasingURLStore is a url store which holds back sampled urls until
+// they are visited, urls which could not be crawled are released to be
+// sampled again
+type ReleasingURLStore interface {
+	URLStore
+	Release(u *url.URL) bool
+}
+
+// FailingURLStore is a url store which tells failed crawls apart from
+// visits, such that urls which keep failing can be dropped
+type FailingURLStore interface {
+	URLStore
+	Fail(u *url.URL, t time.Time) error
+}
+
+// PageStore saves the pages crawled by a WorkerController, which calls
+// SaveSession from a single goroutine. Stores used by several controllers
+// must be safe for concurrent use
 type PageStore interface {
 	SaveSession(Page) error
 }
 
+// ScreenshotPageStore is a page store which re-encodes screenshots, and can
+// only do so for some of the formats they are taken in
+type ScreenshotPageStore interface {
+	PageStore
+	AcceptScreenshotFormat(format string) error
+}
+
 type PageHandleFunc func(Page)
 type PageMiddleware func(PageHandleFunc) PageHandleFunc
 
@@ -1184,67 +3125,205 @@ func SkipURLsMiddleware(URLHandleFunc) URLHandleFunc {
 	}
 }
 
+// DefaultDockerConnections is the amount of connections to the docker
+// daemon, when not derived from the amount of workers
+const DefaultDockerConnections = 4
+
+// providerStatsInterval is the interval the stats of the url providers are
+// logged at during a run
+const providerStatsInterval = time.Minute
+
 type WorkerControllerConfig struct {
-	URLStore       URLStore
-	PageStore      PageStore
-	Logger         *zap.Logger
-	WorkerProducer func() (Worker, error)
-	PageMiddleware []PageMiddleware
-	URLMiddleware  []URLMiddleware
+	URLStore           URLStore
+	URLProviders       []URLProvider
+	PageStore          PageStore
+	Logger             *zap.Logger
+	DrainTimeout       time.Duration
+	MaxRetries         int
+	MaxDepth           int
+	LinkPolicy         func(*url.URL) LinkPolicy
+	HostRateLimiter    *HostRateLimiter
+	Robots             *RobotsCache
+	Trackers           TrackerList
+	WaitForStatus      int
+	WarmContainers     int
+	DockerConnections  int
+	Runtime            ContainerRuntime
+	EgressIPs          []string
+	CacheProxy         *CacheProxy
+	PerformanceMetrics bool
+	WarmVisit          bool
+	WaitEvent          string
+	CaptureDOM         bool
+	WaitUntil          WaitUntil
+	NetworkQuiet       time.Duration
+	PreCaptureScript   string
+	AutoScroll         bool
+	Trace              func(*url.URL) bool
+	MaxRedirects       int
+	Click              *Click
+	HostLookupTimeout  time.Duration
+	ReverseDNS         bool
+	ASNResolver        ASNResolver
+	DNSNameServer      string
+	Cookies            []Cookie
+	ScreenshotFormat   string
+	WorkerProducer     func() (Worker, error)
+	PageMiddleware     []PageMiddleware
+	URLMiddleware      []URLMiddleware
 }
 
 type WorkerController struct {
-	m         sync.Mutex
-	ctx       context.Context
-	conf      WorkerControllerConfig
-	workers   []Worker
-	ready     chan bool
-	tasks     chan CrawlRequest
-	responses chan Page
-	cancel    func()
+	m            sync.Mutex
+	ctx          context.Context
+	conf         WorkerControllerConfig
+	workers      []Worker
+	ready        chan bool
+	tasks        chan CrawlRequest
+	responses    chan Page
+	cancel       func()
+	queueStopped chan struct{}
+	inflight     sync.WaitGroup
+	removals     int32
+	deferred     []*url.URL
+	pool         *ContainerPool
+	summary      *summaryCounter
+
+	// crawling is guarded by its own lock, as m is held while handing out
+	// ready tokens and draining
+	crawlingM sync.Mutex
+	crawling  map[string]struct{}
+	releases  map[string]int
 }
 
 func NewWorkerController(ctx context.Context, conf WorkerControllerConfig) (*WorkerController, error) {
-	if conf.WorkerProducer == nil {
-		dclient, err := docker.NewClient("unix:///var/run/docker.sock")
-		if err != nil {
+	if ps, ok := conf.PageStore.(ScreenshotPageStore); ok {
+		format := conf.ScreenshotFormat
+		if format == "" {
+			format = DefaultScreenshotFormat
+		}
+
+		// every session would fail to be saved otherwise
+		if err := ps.AcceptScreenshotFormat(format); err != nil {
 			return nil, err
 		}
+	}
+
+	var pool *ContainerPool
+	if conf.WorkerProducer == nil {
+		rt := conf.Runtime
+		if rt == nil {
+			conns := conf.DockerConnections
+			if conns == 0 {
+				conns = DefaultDockerConnections
+			}
+
+			dclient, err := NewDockerClient(DefaultDockerEndpoint, conns)
+			if err != nil {
+				return nil, err
+			}
+
+			var dopts []DockerRuntimeOpt
+			if conf.CacheProxy != nil {
+				dopts = append(dopts, WithProxyPort(conf.CacheProxy.Port()))
+			}
+			rt = NewDockerRuntime(dclient, nil, dopts...)
+		}
+
+		// warm containers are not bound to the egress ip of a worker
+		if conf.WarmContainers > 0 && len(conf.EgressIPs) == 0 {
+			var err error
+			pool, err = NewContainerPool(rt, conf.WarmContainers, conf.Logger)
+			if err != nil {
+				return nil, err
+			}
+			rt = pool
+		}
+
+		// workers share the lookups of hosts
+		var ropts []HostResolverOpt
+		if conf.HostLookupTimeout > 0 {
+			ropts = append(ropts, WithLookupTimeout(conf.HostLookupTimeout))
+		}
+
+		if conf.ReverseDNS {
+			ropts = append(ropts, WithReverseDNS())
+		}
+
+		if conf.ASNResolver != nil {
+			ropts = append(ropts, WithASNResolver(conf.ASNResolver))
+		}
+
+		if conf.DNSNameServer != "" {
+			ropts = append(ropts, WithDNSRecords(conf.DNSNameServer))
+		}
+		resolver := NewHostResolver(ropts...)
 
+		// workers are bound to the egress ips round-robin
+		var produced uint32
 		conf.WorkerProducer = func() (Worker, error) {
+			var egress string
+			if n := len(conf.EgressIPs); n > 0 {
+				egress = conf.EgressIPs[int(atomic.AddUint32(&produced, 1)-1)%n]
+			}
+
 			return NewWorker(WorkerConfig{
-				DockerClient: dclient,
+				Runtime:      rt,
+				HostResolver: resolver,
+				DrainTimeout: conf.DrainTimeout,
+				MaxRetries:   conf.MaxRetries,
+				Trackers:     conf.Trackers,
 				Logger:       conf.Logger,
+				EgressIP:     egress,
 			})
 		}
 	}
 
-	_, cancel := context.WithCancel(ctx)
+	queueCtx, cancel := context.WithCancel(ctx)
 
 	tasks := make(chan CrawlRequest)
 	responses := make(chan Page)
 	ready := make(chan bool)
 
 	wc := &WorkerController{
-		ctx:       ctx,
-		conf:      conf,
-		tasks:     tasks,
-		responses: responses,
-		cancel:    cancel,
-		ready:     ready,
+		ctx:          queueCtx,
+		conf:         conf,
+		tasks:        tasks,
+		responses:    responses,
+		cancel:       cancel,
+		ready:        ready,
+		queueStopped: make(chan struct{}),
+		crawling:     map[string]struct{}{},
+		releases:     map[string]int{},
+		pool:         pool,
+		summary:      newSummaryCounter(),
 	}
 
 	go wc.startQueue()
+	if conf.Logger != nil && len(conf.URLProviders) > 0 {
+		go wc.logProviderStats(queueCtx, providerStatsInterval)
+	}
 	go func() {
 		for {
 			select {
 			case sess := <-responses:
+				wc.summary.add(sess)
 				if conf.PageStore != nil {
-					conf.PageStore.SaveSession(sess)
+					if err := conf.PageStore.SaveSession(sess); err != nil && conf.Logger != nil {
+						conf.Logger.Info("page_store_error",
+							zap.String("url", sess.InitialURL.String()),
+							zap.String("error", err.Error()))
+					}
+				}
+				wc.visit(sess)
+				wc.addDiscovered(sess)
+				wc.finished(sess.InitialURL)
+				wc.inflight.Done()
+
+				select {
+				case ready <- true:
+				case <-queueCtx.Done():
 				}
-				conf.URLStore.Visit(sess.InitialURL, time.Now())
-				conf.URLStore.Add(sess.DocumentURLs...)
-				ready <- true
 			case <-ctx.Done():
 				return
 			}
@@ -1256,26 +3335,247 @@ func NewWorkerController(ctx context.Context, conf WorkerControllerConfig) (*Wor
 }
 
 func (wc *WorkerController) startQueue() {
+	defer close(wc.queueStopped)
+
 	for {
 		var u *url.URL
-		var err error
 
 		select {
 		case <-wc.ctx.Done():
 			return
 		case <-wc.ready:
-			u, err = wc.conf.URLStore.Sample()
-			if err != nil {
+			// the token belonged to a removed worker
+			if atomic.LoadInt32(&wc.removals) > 0 {
+				atomic.AddInt32(&wc.removals, -1)
 				continue
 			}
+
+			for {
+				if u = wc.next(); u != nil {
+					break
+				}
+
+				select {
+				case <-wc.ctx.Done():
+					return
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
 		}
 
+		wc.inflight.Add(1)
 		select {
 		case <-wc.ctx.Done():
+			wc.release(u)
+			wc.finished(u)
+			wc.inflight.Done()
+			return
+		case wc.tasks <- wc.request(u):
+		}
+	}
+}
+
+func (wc *WorkerController) request(u *url.URL) CrawlRequest {
+	req := CrawlRequest{
+		Url:         u,
+		Screenshots: []time.Duration{time.Second},
+		QueuedTime:  time.Now(),
+		Depth:       wc.depth(u),
+	}
+
+	if wc.conf.LinkPolicy != nil {
+		req.LinkPolicy = wc.conf.LinkPolicy(u)
+	}
+
+	if ss, ok := wc.conf.URLStore.(SourceURLStore); ok {
+		req.Source = ss.Source(u)
+	}
+	req.WaitForStatus = wc.conf.WaitForStatus
+	req.PerformanceMetrics = wc.conf.PerformanceMetrics
+	req.WarmVisit = wc.conf.WarmVisit
+	req.WaitEvent = wc.conf.WaitEvent
+	req.CaptureDOM = wc.conf.CaptureDOM
+	req.WaitUntil = wc.conf.WaitUntil
+	req.NetworkQuiet = wc.conf.NetworkQuiet
+	req.PreCaptureScript = wc.conf.PreCaptureScript
+	req.AutoScroll = wc.conf.AutoScroll
+	if wc.conf.Trace != nil {
+		req.Trace = wc.conf.Trace(u)
+	}
+	req.MaxRedirects = wc.conf.MaxRedirects
+	req.Click = wc.conf.Click
+	req.Cookies = wc.conf.Cookies
+	req.ScreenshotFormat = wc.conf.ScreenshotFormat
+
+	return req
+}
+
+func (wc *WorkerController) depth(u *url.URL) int {
+	if ds, ok := wc.conf.URLStore.(DepthURLStore); ok {
+		return ds.Depth(u)
+	}
+
+	return 0
+}
+
+// addDiscovered adds the urls found on a page, which are allowed by its
+// link policy, one level deeper than the page itself, dropping them if they
+// exceed the max depth
+func (wc *WorkerController) addDiscovered(p Page) {
+	depth := p.Depth + 1
+	if wc.conf.MaxDepth > 0 && depth > wc.conf.MaxDepth {
+		return
+	}
+
+	links := p.LinkPolicy.Filter(p.InitialURL, p.DocumentURLs)
+	if len(links) == 0 {
+		return
+	}
+
+	// discovered links are attributed to the source of the page
+	if ss, ok := wc.conf.URLStore.(SourceURLStore); ok {
+		ss.AddWithSource(p.Source, depth, links...)
+		return
+	}
+
+	if ds, ok := wc.conf.URLStore.(DepthURLStore); ok {
+		ds.AddWithDepth(depth, links...)
+		return
+	}
+
+	wc.conf.URLStore.Add(links...)
+}
+
+// next samples a url which is not already being crawled and is allowed by
+// robots.txt (if respected) and the host rate limiter, urls of hosts visited
+// too recently are deferred to be picked up by a later call
+func (wc *WorkerController) next() *url.URL {
+	hrl := wc.conf.HostRateLimiter
+	allow := func(u *url.URL) bool { return hrl == nil || hrl.Allow(u) }
+
+	wc.crawlingM.Lock()
+	for i, u := range wc.deferred {
+		if _, ok := wc.crawling[u.String()]; ok {
+			continue
+		}
+
+		if allow(u) {
+			wc.deferred = append(wc.deferred[:i], wc.deferred[i+1:]...)
+			wc.crawling[u.String()] = struct{}{}
+			wc.crawlingM.Unlock()
+			return u
+		}
+	}
+
+	wc.crawlingM.Unlock()
+
+	for i := 0; i < maxSampleAttempts; i++ {
+		u, err := wc.conf.URLStore.Sample()
+		if err != nil {
+			return nil
+		}
+
+		// fetching robots.txt must not hold up visits of crawled pages
+		if rc := wc.conf.Robots; rc != nil && !rc.Allowed(u) {
+			wc.disallowed(u)
+			continue
+		}
+
+		wc.crawlingM.Lock()
+		if _, ok := wc.crawling[u.String()]; ok {
+			wc.crawlingM.Unlock()
+			continue
+		}
+
+		if !allow(u) {
+			wc.deferURL(u)
+			wc.crawlingM.Unlock()
+			continue
+		}
+
+		wc.crawling[u.String()] = struct{}{}
+		wc.crawlingM.Unlock()
+		return u
+	}
+
+	return nil
+}
+
+// disallowed marks a url disallowed by its robots.txt as visited, such that
+// the url store stops sampling it
+func (wc *WorkerController) disallowed(u *url.URL) {
+	if wc.conf.Logger != nil {
+		wc.conf.Logger.Info("robots_disallowed", zap.String("url", u.String()))
+	}
+
+	wc.conf.URLStore.Visit(u, time.Now())
+}
+
+// visit marks the url of the page as visited, unless crawling it failed
+// with a transient error, in which case it is released to be crawled again
+func (wc *WorkerController) visit(p Page) {
+	if isRetryable(p.Error) && wc.releaseFailed(p.InitialURL) {
+		return
+	}
+
+	if p.InitialURL != nil {
+		wc.crawlingM.Lock()
+		delete(wc.releases, p.InitialURL.String())
+		wc.crawlingM.Unlock()
+	}
+
+	if fs, ok := wc.conf.URLStore.(FailingURLStore); ok && p.Error != nil {
+		fs.Fail(p.InitialURL, time.Now())
+		return
+	}
+
+	wc.conf.URLStore.Visit(p.InitialURL, time.Now())
+}
+
+// releaseFailed releases the url of a failed crawl, unless it has been
+// released too many times already
+func (wc *WorkerController) releaseFailed(u *url.URL) bool {
+	if u == nil {
+		return false
+	}
+
+	wc.crawlingM.Lock()
+	defer wc.crawlingM.Unlock()
+
+	if wc.releases[u.String()] >= maxReleases || !wc.release(u) {
+		return false
+	}
+	wc.releases[u.String()] += 1
+
+	return true
+}
+
+func (wc *WorkerController) release(u *url.URL) bool {
+	if rs, ok := wc.conf.URLStore.(ReleasingURLStore); ok {
+		return rs.Release(u)
+	}
+
+	return false
+}
+
+func (wc *WorkerController) finished(u *url.URL) {
+	if u == nil {
+		return
+	}
+
+	wc.crawlingM.Lock()
+	delete(wc.crawling, u.String())
+	wc.crawlingM.Unlock()
+}
+
+func (wc *WorkerController) deferURL(u *url.URL) {
+	for _, d := range wc.deferred {
+		if d.String() == u.String() {
 			return
-		case wc.tasks <- CrawlRequest{Url: u, Screenshots: []time.Duration{time.Second}}:
 		}
 	}
+
+	wc.deferred = append(wc.deferred, u)
 }
 
 func (wc *WorkerController) AddWorker() error {
@@ -1290,20 +3590,95 @@ func (wc *WorkerController) AddWorker() error {
 	go w.Run(wc.tasks, wc.responses)
 
 	wc.workers = append(wc.workers, w)
-	wc.ready <- true
+
+	select {
+	case wc.ready <- true:
+	case <-wc.ctx.Done():
+	}
 
 	return nil
 }
 
+func (wc *WorkerController) RemoveWorker() error {
+	wc.m.Lock()
+	defer wc.m.Unlock()
+
+	if len(wc.workers) == 0 {
+		return ErrNoWorkers
+	}
+
+	last := len(wc.workers) - 1
+	w := wc.workers[last]
+	wc.workers = wc.workers[:last]
+
+	// each worker owns one ready token, which is discarded by the queue
+	// once it is returned
+	atomic.AddInt32(&wc.removals, 1)
+
+	return w.Close()
+}
+
+// ProviderStats aggregates the stats of the url providers of the controller
+func (wc *WorkerController) ProviderStats() ProviderStats {
+	return AggregateProviderStats(wc.conf.URLProviders...)
+}
+
+// logProviderStats logs the stats of the url providers every interval, such
+// that providers being done can be told apart from providers being stuck
+// during a run
+func (wc *WorkerController) logProviderStats(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			wc.conf.Logger.Info("provider_stats", wc.ProviderStats().Fields()...)
+		}
+	}
+}
+
+// Summary summarizes the pages crawled since the controller was created
+func (wc *WorkerController) Summary() RunSummary {
+	rs := wc.summary.get()
+	rs.Providers = wc.ProviderStats()
+
+	return rs
+}
+
 func (wc *WorkerController) Close() error {
 	wc.m.Lock()
 	defer wc.m.Unlock()
 
+	wc.cancel()
+	<-wc.queueStopped
+
+	var wg sync.WaitGroup
 	for _, w := range wc.workers {
-		w.Close()
+		wg.Add(1)
+		go func(w Worker) {
+			defer wg.Done()
+			w.Close()
+		}(w)
 	}
+	wg.Wait()
 
-	wc.cancel()
+	if d := wc.conf.DrainTimeout; d > 0 {
+		timeoutAction(func() error {
+			wc.inflight.Wait()
+			return nil
+		}, d)
+	}
+
+	if wc.pool != nil {
+		wc.pool.Close()
+	}
+
+	if wc.conf.Logger != nil {
+		wc.conf.Logger.Info("run_summary", wc.Summary().Fields()...)
+	}
 
 	return nil
 }
@@ -1334,7 +3709,19 @@ func errorFuncWithContext(ctx context.Context, f func() error) <-chan error {
 	return errc
 }
 
+// GetHostInfo looks up the host information of domain, giving up after
+// DefaultHostLookupTimeout
 func GetHostInfo(domain Domain) (Host, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultHostLookupTimeout)
+	defer cancel()
+
+	return GetHostInfoContext(ctx, net.DefaultResolver, domain)
+}
+
+// GetHostInfoContext looks up the name servers and address of domain using
+// r, giving up when ctx is done. When the deadline of ctx is exceeded, what
+// was resolved until then is returned along with ErrHostLookupTimeout.
+func GetHostInfoContext(ctx context.Context, r *net.Resolver, domain Domain) (Host, error) {
 	h := Host{
 		Domain: domain,
 	}
@@ -1342,21 +3729,23 @@ func GetHostInfo(domain Domain) (Host, error) {
 		return h, err
 	}
 
-	nss, _ := net.LookupNS(string(domain))
+	nss, _ := r.LookupNS(ctx, string(domain))
 	for _, ns := range nss {
 		h.NameServers = append(h.NameServers, ns.Host)
 	}
 
-	ips, err := net.LookupIP(string(domain))
+	addrs, err := r.LookupIPAddr(ctx, string(domain))
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return replyErr(ErrHostLookupTimeout)
+		}
+
 		return replyErr(err)
 	}
 
-	if len(ips) == 0 {
-		return replyErr(nil)
+	for _, addr := range addrs {
+		h.IPAddrs = append(h.IPAddrs, addr.IP.String())
 	}
 
-	h.IPAddr = ips[0].String()
-
 	return h, nil
 }
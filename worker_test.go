@@ -1,9 +1,13 @@
 package kraaler_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"image/png"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -13,13 +17,18 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aau-network-security/kraaler"
 	"github.com/aau-network-security/kraaler/store"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/gorilla/websocket"
+	"github.com/mafredri/cdp/protocol/network"
 	"go.uber.org/zap"
 )
 
@@ -51,7 +60,7 @@ func getAvailablePort() uint {
 	return uint(p)
 }
 
-func responseFromServerWithHandler(handler http.Handler, port uint, useTLS bool, dur *time.Duration) (*kraaler.Page, error) {
+func responseFromServerWithHandler(handler http.Handler, port uint, useTLS bool, req kraaler.CrawlRequest) (*kraaler.Page, error) {
 	ts := httptest.NewUnstartedServer(handler)
 	if handler != nil {
 		if useTLS {
@@ -91,15 +100,8 @@ func responseFromServerWithHandler(handler http.Handler, port uint, useTLS bool,
 		return nil, err
 	}
 
-	var screenshots []time.Duration
-	if dur != nil {
-		screenshots = []time.Duration{*dur}
-	}
-
-	q <- kraaler.CrawlRequest{
-		Url:         u,
-		Screenshots: screenshots,
-	}
+	req.Url = u
+	q <- req
 
 	r := <-resps
 	return &r, nil
@@ -167,6 +169,31 @@ func initiatorsAre(inits ...string) validator {
 	}
 }
 
+func initiatorURLsAre(paths ...string) validator {
+	return func(s kraaler.Page) error {
+		if len(paths) != len(s.Actions) {
+			return fmt.Errorf("expected %d initiator urls, but received: %d", len(paths), len(s.Actions))
+		}
+
+		for i, expected := range paths {
+			path := ""
+			if raw := s.Actions[i].Initiator.URL; raw != "" {
+				u, err := url.Parse(raw)
+				if err != nil {
+					return err
+				}
+				path = u.Path
+			}
+
+			if path != expected {
+				return fmt.Errorf("unexpected initiator url path (%s), expected: %s", path, expected)
+			}
+		}
+
+		return nil
+	}
+}
+
 func errorsAre(errors ...string) validator {
 	return func(s kraaler.Page) error {
 		if len(errors) != len(s.Actions) {
@@ -196,6 +223,51 @@ func errorsAre(errors ...string) validator {
 	}
 }
 
+// prioritiesAre validates the initial priority and render blocking of the
+// actions with the given paths
+func prioritiesAre(priorities map[string]network.ResourcePriority, blocking ...string) validator {
+	return func(s kraaler.Page) error {
+		isBlocking := map[string]bool{}
+		for _, p := range blocking {
+			isBlocking[p] = true
+		}
+
+		for _, a := range s.Actions {
+			u, err := url.Parse(a.Request.URL)
+			if err != nil {
+				return err
+			}
+
+			p, ok := priorities[u.Path]
+			if !ok {
+				continue
+			}
+
+			if a.Request.InitialPriority != p {
+				return fmt.Errorf("expected %s to have priority %s, but received: %s", u.Path, p, a.Request.InitialPriority)
+			}
+
+			if a.RenderBlocking != isBlocking[u.Path] {
+				return fmt.Errorf("expected %s to be render blocking (%t), but it was: %t", u.Path, isBlocking[u.Path], a.RenderBlocking)
+			}
+		}
+
+		return nil
+	}
+}
+
+func remoteAddrIsLocal() validator {
+	return func(s kraaler.Page) error {
+		for _, a := range s.Actions {
+			if a.RemoteIP != "127.0.0.1" || a.RemotePort == 0 {
+				return fmt.Errorf("expected response from a local address, but received: %s:%d", a.RemoteIP, a.RemotePort)
+			}
+		}
+
+		return nil
+	}
+}
+
 func mimeIs(str string) validator {
 	return func(s kraaler.Page) error {
 		actions := s.Actions
@@ -206,6 +278,119 @@ func mimeIs(str string) validator {
 	}
 }
 
+func charsetIs(str string) validator {
+	return func(s kraaler.Page) error {
+		body := s.Actions[0].Body
+		if body == nil {
+			return fmt.Errorf("expected a body")
+		}
+
+		if body.Charset != str {
+			return fmt.Errorf("unexpected charset (%s), expected: %s", body.Charset, str)
+		}
+		return nil
+	}
+}
+
+func encodedSmallerThanDecoded(s kraaler.Page) error {
+	body := s.Actions[0].Body
+	if body == nil {
+		return fmt.Errorf("expected a body")
+	}
+
+	if body.EncodedSize == 0 || body.EncodedSize >= int64(len(body.Body)) {
+		return fmt.Errorf("expected encoded size (%d) to be smaller than decoded size (%d)", body.EncodedSize, len(body.Body))
+	}
+	return nil
+}
+
+func finalStatusIs(status, hops int) validator {
+	return func(s kraaler.Page) error {
+		if s.FinalStatus != status || s.RedirectHops != hops {
+			return fmt.Errorf("expected final status %d after %d hops, but got: %d after %d hops", status, hops, s.FinalStatus, s.RedirectHops)
+		}
+		return nil
+	}
+}
+
+func clickedOn(selector string) validator {
+	return func(s kraaler.Page) error {
+		in := s.Interaction
+		if in == nil || in.Selector != selector {
+			return fmt.Errorf("expected click on %s, but got: %+v", selector, in)
+		}
+
+		if in.X <= 0 || in.Y <= 0 {
+			return fmt.Errorf("expected click at the element, but was at (%f, %f)", in.X, in.Y)
+		}
+		return nil
+	}
+}
+
+func permissionsRequested(names ...string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.Permissions); n != len(names) {
+			return fmt.Errorf("expected %d permission request(s), but received: %d", len(names), n)
+		}
+
+		for i, name := range names {
+			if p := s.Permissions[i]; p.Name != name {
+				return fmt.Errorf("unexpected permission (%s) requested by %s, expected: %s", p.Name, p.API, name)
+			}
+		}
+		return nil
+	}
+}
+
+func unloadHandlers(beforeUnload, unload bool) validator {
+	return func(s kraaler.Page) error {
+		if s.BeforeUnloadHandler != beforeUnload {
+			return fmt.Errorf("expected beforeunload handler to be %t, but was: %t", beforeUnload, s.BeforeUnloadHandler)
+		}
+
+		if s.UnloadHandler != unload {
+			return fmt.Errorf("expected unload handler to be %t, but was: %t", unload, s.UnloadHandler)
+		}
+		return nil
+	}
+}
+
+func manifestNamed(name string) validator {
+	return func(s kraaler.Page) error {
+		m := s.Manifest
+		if m == nil {
+			return fmt.Errorf("expected manifest to be fetched")
+		}
+
+		if m.Name != name || !strings.HasSuffix(m.URL, "/manifest.json") {
+			return fmt.Errorf("expected manifest named %s, but got: %s (%s)", name, m.Name, m.URL)
+		}
+
+		if len(m.Icons) != 1 || !strings.HasSuffix(m.Icons[0].Src, "/icon.png") {
+			return fmt.Errorf("expected the icon of the manifest, but got: %+v", m.Icons)
+		}
+		return nil
+	}
+}
+
+func redirectsStoppedAt(max int) validator {
+	return func(s kraaler.Page) error {
+		if !s.RedirectLimitExceeded || s.Redirects != max+1 {
+			return fmt.Errorf("expected navigation to stop after %d redirects, but got: %d (exceeded: %t)", max+1, s.Redirects, s.RedirectLimitExceeded)
+		}
+		return nil
+	}
+}
+
+func pageErrorIs(err error) validator {
+	return func(s kraaler.Page) error {
+		if s.Error != err {
+			return fmt.Errorf("expected page error (%v), but got: %v", err, s.Error)
+		}
+		return nil
+	}
+}
+
 func hasActionCount(n int) validator {
 	return func(s kraaler.Page) error {
 		if len(s.Actions) != n {
@@ -247,15 +432,209 @@ func consoleIs(c []string) validator {
 	}
 }
 
+func consoleArgTypesAre(types ...[]string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.Console); len(types) != n {
+			return fmt.Errorf("unexpected length of console: %d", n)
+		}
+
+		for i, expected := range types {
+			args := s.Console[i].Args
+			if len(args) != len(expected) {
+				return fmt.Errorf("expected %d arguments, but received: %d", len(expected), len(args))
+			}
+
+			for j, kind := range expected {
+				if args[j].Type != kind {
+					return fmt.Errorf("unexpected argument type (%s), expected: %s", args[j].Type, kind)
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func consoleTypesAre(types ...string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.Console); len(types) != n {
+			return fmt.Errorf("unexpected length of console: %d", n)
+		}
+
+		for i, expected := range types {
+			if kind := s.Console[i].Type; kind != expected {
+				return fmt.Errorf("unexpected console type (%s), expected: %s", kind, expected)
+			}
+		}
+
+		return nil
+	}
+}
+
+func warmVisitUsesCache(s kraaler.Page) error {
+	cached := func(actions []*kraaler.CrawlAction) int {
+		var n int
+		for _, a := range actions {
+			if a.FromCache {
+				n++
+			}
+		}
+		return n
+	}
+
+	if len(s.WarmActions) == 0 {
+		return fmt.Errorf("expected actions of the warm visit")
+	}
+
+	if cold, warm := cached(s.Actions), cached(s.WarmActions); warm <= cold {
+		return fmt.Errorf("expected more cached resources in warm visit (%d) than in cold visit (%d)", warm, cold)
+	}
+
+	return nil
+}
+
+func waitEndedAt(event string, after time.Duration) validator {
+	return func(s kraaler.Page) error {
+		if s.LifecycleEvent != event || s.LifecycleTimestamp == 0 {
+			return fmt.Errorf("expected wait to end at %s, but ended at: %s", event, s.LifecycleEvent)
+		}
+
+		if d := s.LoadedTime.Sub(s.NavigateTime); d < after {
+			return fmt.Errorf("expected wait to last at least %s, but lasted: %s", after, d)
+		}
+
+		return nil
+	}
+}
+
+func renderedHTMLContains(s string) validator {
+	return func(p kraaler.Page) error {
+		if !bytes.Contains(p.RenderedHTML, []byte(s)) {
+			return fmt.Errorf("expected rendered html to contain (%s), but received: %s", s, p.RenderedHTML)
+		}
+
+		return nil
+	}
+}
+
+func scriptResultIs(result, exception string) validator {
+	return func(p kraaler.Page) error {
+		if p.ScriptResult != result {
+			return fmt.Errorf("expected script result (%s), but received: %s", result, p.ScriptResult)
+		}
+
+		if !strings.Contains(p.ScriptException, exception) || (exception == "") != (p.ScriptException == "") {
+			return fmt.Errorf("expected script exception (%s), but received: %s", exception, p.ScriptException)
+		}
+
+		return nil
+	}
+}
+
+func traceHasEvents() validator {
+	return func(p kraaler.Page) error {
+		if len(p.Trace) == 0 {
+			return fmt.Errorf("expected a trace")
+		}
+
+		var trace struct {
+			TraceEvents []json.RawMessage `json:"traceEvents"`
+		}
+		if err := json.Unmarshal(p.Trace, &trace); err != nil {
+			return fmt.Errorf("unable to parse trace: %s", err)
+		}
+
+		if len(trace.TraceEvents) == 0 {
+			return fmt.Errorf("expected trace events")
+		}
+
+		return nil
+	}
+}
+
+func hasNoTrace(p kraaler.Page) error {
+	if p.Trace != nil {
+		return fmt.Errorf("expected no trace, but received %d bytes", len(p.Trace))
+	}
+
+	return nil
+}
+
+func finalPathIs(path string) validator {
+	return func(p kraaler.Page) error {
+		if p.FinalURL == nil || p.FinalURL.Path != path {
+			return fmt.Errorf("expected final url to have path (%s), but received: %v", path, p.FinalURL)
+		}
+
+		return nil
+	}
+}
+
+func browserCookiesAre(names ...string) validator {
+	return func(p kraaler.Page) error {
+		var found []string
+		for _, c := range p.Cookies {
+			found = append(found, c.Name+"="+c.Value)
+		}
+		sort.Strings(found)
+		sort.Strings(names)
+
+		if strings.Join(found, ";") != strings.Join(names, ";") {
+			return fmt.Errorf("expected browser cookies (%v), but received: %v", names, found)
+		}
+
+		return nil
+	}
+}
+
+func cookiesSetBy(host string, count int) validator {
+	return func(s kraaler.Page) error {
+		if n := s.SetCookies[host].Count; n != count {
+			return fmt.Errorf("expected %d cookies set by %s, but received: %d (%v)", count, host, n, s.SetCookies)
+		}
+
+		return nil
+	}
+}
+
+func consoleLevelsAre(levels ...string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.Console); len(levels) != n {
+			return fmt.Errorf("unexpected length of console: %d", n)
+		}
+
+		for i, expected := range levels {
+			if level := s.Console[i].Level; level != expected {
+				return fmt.Errorf("unexpected console level (%s), expected: %s", level, expected)
+			}
+		}
+
+		return nil
+	}
+}
+
+func postDataContains(strs ...string) validator {
+	return func(s kraaler.Page) error {
+		postdata := string(s.Actions[len(s.Actions)-1].RequestBody())
+		for _, str := range strs {
+			if !strings.Contains(postdata, str) {
+				return fmt.Errorf("expected post data to contain (%s), but received: %.256s", str, postdata)
+			}
+		}
+
+		return nil
+	}
+}
+
 func postDataIs(str string) validator {
 	return func(s kraaler.Page) error {
-		postdata := s.Actions[len(s.Actions)-1].Request.PostData
+		postdata := s.Actions[len(s.Actions)-1].RequestBody()
 		if postdata == nil {
 			return fmt.Errorf("expected post data to be (%s), but it is nil", str)
 		}
 
-		if *postdata != str {
-			return fmt.Errorf("expected post data to be (%s), but received: %s", str, *postdata)
+		if string(postdata) != str {
+			return fmt.Errorf("expected post data to be (%.32s), but received: %.32s (%d bytes)", str, postdata, len(postdata))
 		}
 
 		return nil
@@ -272,34 +651,228 @@ func securityDetailsPresent(s kraaler.Page) error {
 	return nil
 }
 
-func TestCrawl(t *testing.T) {
-	if chromeBinary == "" {
-		t.Fatal("unable to locate chrome binary")
+func failedRequestsAre(n int) validator {
+	return func(s kraaler.Page) error {
+		if s.FailedRequests != n {
+			return fmt.Errorf("expected %d failed requests, but received: %d", n, s.FailedRequests)
+		}
+		return nil
 	}
+}
 
-	txtHandler := func(s string, sc int) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(sc); fmt.Fprintln(w, s) })
+func failedRequestBytesAre(n int64) validator {
+	return func(s kraaler.Page) error {
+		if s.FailedRequestBytes != n {
+			return fmt.Errorf("expected %d bytes of failed requests, but received: %d", n, s.FailedRequestBytes)
+		}
+		return nil
 	}
+}
 
-	closerHandler := http.NewServeMux()
-	closerHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		hj, ok := w.(http.Hijacker)
-		if !ok {
-			http.Error(w, "can't hijack rw", http.StatusInternalServerError)
-			return
+func dialogsAre(kinds ...string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.Dialogs); len(kinds) != n {
+			return fmt.Errorf("expected %d dialogs, but received: %d", len(kinds), n)
 		}
 
-		conn, _, _ := hj.Hijack()
-		conn.Close()
-	})
+		for i, k := range kinds {
+			if kind := s.Dialogs[i].Kind; kind != k {
+				return fmt.Errorf("unexpected dialog (%s), expected: %s", kind, k)
+			}
+		}
 
-	redirectHandler := http.NewServeMux()
-	redirectHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/other", 301) })
-	redirectHandler.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/last", 301) })
-	redirectHandler.HandleFunc("/last", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "hello world") })
+		return nil
+	}
+}
+
+func serviceWorkersAre(scripts ...string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.ServiceWorkers); len(scripts) != n {
+			return fmt.Errorf("expected %d service workers, but received: %d", len(scripts), n)
+		}
+
+		for i, script := range scripts {
+			if u := s.ServiceWorkers[i].ScriptURL; !strings.HasSuffix(u, script) {
+				return fmt.Errorf("unexpected service worker script (%s), expected: %s", u, script)
+			}
+		}
+
+		return nil
+	}
+}
+
+func metricsInclude(names ...string) validator {
+	return func(s kraaler.Page) error {
+		for _, name := range names {
+			if _, ok := s.PerformanceMetrics[name]; !ok {
+				return fmt.Errorf("expected performance metrics to include: %s", name)
+			}
+		}
+
+		return nil
+	}
+}
+
+func webSocketFramesAre(directions []string, lengths []int) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.WebSocketFrames); len(directions) != n {
+			return fmt.Errorf("expected %d websocket frames, but received: %d", len(directions), n)
+		}
+
+		for i, f := range s.WebSocketFrames {
+			if f.Socket == nil {
+				return fmt.Errorf("expected websocket frame to be linked to its websocket")
+			}
+
+			if f.Direction != directions[i] || f.PayloadLength != lengths[i] {
+				return fmt.Errorf("unexpected websocket frame (%s, %d), expected: (%s, %d)", f.Direction, f.PayloadLength, directions[i], lengths[i])
+			}
+		}
+
+		return nil
+	}
+}
+
+func webSocketHandshakesAre(headers ...string) validator {
+	return func(s kraaler.Page) error {
+		if n := len(s.WebSockets); len(headers) != n {
+			return fmt.Errorf("expected %d websockets, but received: %d", len(headers), n)
+		}
+
+		for i, header := range headers {
+			a := s.WebSockets[i].Handshake
+			if a.Response == nil || a.Response.Status != http.StatusSwitchingProtocols {
+				return fmt.Errorf("expected websocket handshake to be answered with: %d", http.StatusSwitchingProtocols)
+			}
+
+			respHeaders, err := a.Response.Headers.Map()
+			if err != nil {
+				return err
+			}
+
+			if _, ok := respHeaders[header]; !ok {
+				return fmt.Errorf("expected handshake response to include header: %s", header)
+			}
+		}
+
+		return nil
+	}
+}
+
+func documentURLsInclude(paths ...string) validator {
+	return func(s kraaler.Page) error {
+		found := map[string]bool{}
+		for _, u := range s.DocumentURLs {
+			found[u.Path] = true
+		}
+
+		for _, p := range paths {
+			if !found[p] {
+				return fmt.Errorf("expected document urls to include: %s", p)
+			}
+		}
+
+		return nil
+	}
+}
+
+// screenshotSizesAre validates the pixel dimensions of the viewport
+// screenshots, which are taken after the timed screenshots
+func screenshotSizesAre(sizes ...kraaler.Resolution) validator {
+	return func(s kraaler.Page) error {
+		if len(s.Screenshots) < len(sizes) {
+			return fmt.Errorf("expected at least %d screenshots, but received: %d", len(sizes), len(s.Screenshots))
+		}
+
+		screens := s.Screenshots[len(s.Screenshots)-len(sizes):]
+		for i, size := range sizes {
+			cfg, err := png.DecodeConfig(bytes.NewReader(screens[i].Screenshot))
+			if err != nil {
+				return fmt.Errorf("unable to decode screenshot: %s", err)
+			}
+
+			if cfg.Width != size.Width || cfg.Height != size.Height {
+				return fmt.Errorf("unexpected screenshot size (%dx%d), expected: %s", cfg.Width, cfg.Height, size)
+			}
+		}
+
+		return nil
+	}
+}
+
+// screenshotsAreWebP validates that every screenshot is of the webp format
+func screenshotsAreWebP() validator {
+	return func(s kraaler.Page) error {
+		if len(s.Screenshots) == 0 {
+			return fmt.Errorf("expected screenshots")
+		}
+
+		for _, screen := range s.Screenshots {
+			if screen.Kind != "webp" {
+				return fmt.Errorf("unexpected screenshot kind: %s", screen.Kind)
+			}
+
+			img := screen.Screenshot
+			if len(img) < 12 || string(img[0:4]) != "RIFF" || string(img[8:12]) != "WEBP" {
+				return fmt.Errorf("expected screenshot to have a webp header")
+			}
+		}
+
+		return nil
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	if chromeBinary == "" {
+		t.Fatal("unable to locate chrome binary")
+	}
+
+	txtHandler := func(s string, sc int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(sc); fmt.Fprintln(w, s) })
+	}
+
+	closerHandler := http.NewServeMux()
+	closerHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "can't hijack rw", http.StatusInternalServerError)
+			return
+		}
+
+		conn, _, _ := hj.Hijack()
+		conn.Close()
+	})
+
+	gzipHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		fmt.Fprintf(gw, "<html><body>%s</body></html>", strings.Repeat("compressible ", 1000))
+		gw.Close()
+	})
+
+	redirectHandler := http.NewServeMux()
+	redirectHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/other", 301) })
+	redirectHandler.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/last", 301) })
+	redirectHandler.HandleFunc("/last", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "hello world") })
+
+	authHandler := http.NewServeMux()
+	authHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/login", http.StatusFound) })
+	authHandler.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, `<html><head><meta http-equiv="refresh" content="0; url=/auth"></head></html>`)
+	})
+	authHandler.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) { http.Redirect(w, r, "/home", http.StatusFound) })
+	authHandler.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) { fmt.Fprintln(w, "welcome") })
+
+	loopHandler := txtHandler(`<html><head><meta http-equiv="refresh" content="0; url=/"></head></html>`, http.StatusUnauthorized)
+
+	endlessHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.TrimSuffix(r.URL.Path, "/")+"/hop", http.StatusFound)
+	})
 
 	multiHandler := http.NewServeMux()
-	multiHandlerRootBody := `<html><body><img src="/img"/></body></html>`
+	multiHandlerRootBody := `<html><body><a href="/img">image</a><img src="/img"/></body></html>`
 	multiHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, multiHandlerRootBody)
 	})
@@ -308,12 +881,156 @@ func TestCrawl(t *testing.T) {
 		fmt.Fprintln(w, "not found")
 	})
 
+	swHandler := http.NewServeMux()
+	swHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<script>navigator.serviceWorker.register('/sw.js')</script>")
+	})
+	swHandler.HandleFunc("/sw.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		fmt.Fprintln(w, "self.addEventListener('fetch', function(e) {})")
+	})
+
+	wsHandler := http.NewServeMux()
+	wsHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<script>new WebSocket('ws://' + location.host + '/ws')</script>")
+	})
+	wsEchoHandler := http.NewServeMux()
+	wsEchoHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "<script>var ws = new WebSocket('ws://' + location.host + '/ws'); ws.onopen = function() { ws.send('hello') }</script>")
+	})
+	wsEchoHandler.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		if kind, msg, err := conn.ReadMessage(); err == nil {
+			conn.WriteMessage(kind, append(msg, " world"...))
+		}
+		conn.ReadMessage()
+	})
+	wsHandler.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, http.Header{"X-Kraaler": []string{"test"}})
+		if err != nil {
+			return
+		}
+		conn.Close()
+	})
+
+	cacheHandler := http.NewServeMux()
+	cacheHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><body><img src="/logo.png"/><script src="/app.js"></script></body></html>`)
+	})
+	cacheHandler.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+	cacheHandler.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Header().Set("Content-Type", "application/javascript")
+		fmt.Fprintln(w, "var loaded = true;")
+	})
+
+	manifestHandler := http.NewServeMux()
+	manifestHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><head><link rel="manifest" href="/manifest.json"></head><body>app</body></html>`)
+	})
+	manifestHandler.HandleFunc("/manifest.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/manifest+json")
+		fmt.Fprintln(w, `{"name": "Kraaler App", "start_url": "/start", "icons": [{"src": "/icon.png", "sizes": "192x192", "type": "image/png"}]}`)
+	})
+
+	slowImageHandler := http.NewServeMux()
+	slowImageHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><body><img src="/slow.png"/></body></html>`)
+	})
+	slowImageHandler.HandleFunc("/slow.png", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+
+	lateHandler := http.NewServeMux()
+	lateHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<script>setTimeout(function() { fetch('/late') }, 200)</script>`)
+	})
+	lateHandler.HandleFunc("/late", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprint(w, "late content")
+	})
+
+	cookieHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "42"})
+		if c, err := r.Cookie("consent"); err == nil {
+			fmt.Fprintf(w, "consent=%s", c.Value)
+		}
+	})
+
+	priorityHandler := http.NewServeMux()
+	priorityHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><link rel="stylesheet" href="/style.css"><script src="/sync.js"></script>
+<script defer src="/deferred.js"></script></head><body>meow</body></html>`)
+	})
+	priorityHandler.HandleFunc("/style.css", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		fmt.Fprint(w, "body { color: red; }")
+	})
+	for _, p := range []string{"/sync.js", "/deferred.js"} {
+		priorityHandler.HandleFunc(p, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/javascript")
+			fmt.Fprint(w, "var meow = 1;")
+		})
+	}
+
+	lazyHandler := http.NewServeMux()
+	lazyHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `<html><body><div style="height: 5000px"></div><div id="more"></div>
+<script>new IntersectionObserver(function(es) { if (es[0].isIntersecting) { fetch('/lazy') } }).observe(document.getElementById('more'))</script></body></html>`)
+	})
+	lazyHandler.HandleFunc("/lazy", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "lazy content")
+	})
+
+	thirdParty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "uid", Value: "42"})
+		http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1"})
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer thirdParty.Close()
+	thirdPartyURL, _ := url.Parse(thirdParty.URL)
+
+	missingHandlerRootBody := `<html><body><img src="http://127.0.0.1:1/missing.png"/></body></html>`
+	missingHandler := txtHandler(missingHandlerRootBody, http.StatusOK)
+
+	truncatedHandler := http.NewServeMux()
+	truncatedHandler.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><script src="/app.js"></script></body></html>`)
+	})
+	truncatedHandler.HandleFunc("/app.js", func(w http.ResponseWriter, r *http.Request) {
+		// the connection is closed before the announced length is sent
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: text/javascript\r\nContent-Length: 4096\r\n\r\nvar a = 1;")
+		buf.Flush()
+	})
+
 	tt := []struct {
-		name      string
-		handler   http.Handler
-		tls       bool
-		wait      time.Duration
-		validator validator
+		name       string
+		handler    http.Handler
+		tls        bool
+		wait       time.Duration
+		waitStatus int
+		viewports  []kraaler.Viewport
+		request    func(*kraaler.CrawlRequest)
+		validator  validator
 	}{
 		{
 			name:    "basic",
@@ -370,86 +1087,439 @@ func TestCrawl(t *testing.T) {
 			),
 		},
 		{
-			name:    "redirect",
-			handler: redirectHandler,
+			name:    "empty console message",
+			handler: txtHandler("<script>console.log()</script>", http.StatusOK),
 			validator: join(
-				hasActionCount(3),
-				initiatorsAre("user", "redirect", "redirect"),
-				codesAre(http.StatusMovedPermanently, http.StatusMovedPermanently, http.StatusOK),
-				bodiesAre("", "", "hello world"),
-				mimeIs("text/plain"),
+				hasActionCount(1),
+				consoleIs([]string{""}),
 			),
 		},
 		{
-			name:    "html parsing",
-			handler: multiHandler,
+			name:    "console args",
+			handler: txtHandler("<script>console.log({a:1});console.log();console.log('x', 1, [2, 'b'])</script>", http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				consoleIs([]string{`{"a":1}`, ``, `"x" 1 [2,"b"]`}),
+				consoleArgTypesAre([]string{"object"}, []string{}, []string{"string", "number", "array"}),
+			),
+		},
+		{
+			name: "console types",
+			handler: txtHandler(`<script>
+console.info('i');console.debug('d');console.table([1]);console.dir('x');
+console.group('g');console.groupEnd();
+</script>`, http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				consoleTypesAre("info", "debug", "table", "dir", "startGroup", "endGroup"),
+			),
+		},
+		{
+			name:    "wait for network idle",
+			handler: lateHandler,
+			request: func(req *kraaler.CrawlRequest) { req.WaitUntil = kraaler.WaitNetworkIdle },
 			validator: join(
 				hasActionCount(2),
-				initiatorsAre("user", "parser"),
-				bodiesAre(multiHandlerRootBody, "not found"),
-				codesAre(http.StatusOK, http.StatusNotFound),
-				mimeIs("text/plain"),
+				codesAre(http.StatusOK, http.StatusOK),
+				bodiesAre(`<script>setTimeout(function() { fetch('/late') }, 200)</script>`, "late content"),
 			),
 		},
 		{
-			name:    "post data",
-			handler: txtHandler("<script>function hest() { var xhr = new XMLHttpRequest(); xhr.open('POST', '/poster'); xhr.send('some_data'); }; hest()</script>", http.StatusOK),
-			wait:    500 * time.Millisecond,
+			name:    "priorities",
+			handler: priorityHandler,
+			validator: join(
+				hasActionCount(4),
+				prioritiesAre(map[string]network.ResourcePriority{
+					"/":            network.ResourcePriorityVeryHigh,
+					"/style.css":   network.ResourcePriorityVeryHigh,
+					"/sync.js":     network.ResourcePriorityHigh,
+					"/deferred.js": network.ResourcePriorityLow,
+				}, "/style.css", "/sync.js"),
+			),
+		},
+		{
+			name:    "webp screenshots",
+			handler: txtHandler(`<html><body>meow</body></html>`, http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) { req.ScreenshotFormat = "webp" },
+			validator: join(
+				hasActionCount(1),
+				screenshotsAreWebP(),
+			),
+		},
+		{
+			name:    "cookies before navigation",
+			handler: cookieHandler,
+			request: func(req *kraaler.CrawlRequest) {
+				req.Cookies = []kraaler.Cookie{{Name: "consent", Value: "yes"}}
+			},
+			validator: join(
+				hasActionCount(1),
+				bodiesAre("consent=yes"),
+				browserCookiesAre("consent=yes", "sid=42"),
+			),
+		},
+		{
+			name:    "auto scroll",
+			handler: lazyHandler,
+			request: func(req *kraaler.CrawlRequest) {
+				req.AutoScroll = true
+				req.WaitUntil = kraaler.WaitNetworkIdle
+			},
 			validator: join(
 				hasActionCount(2),
-				initiatorsAre("user", "script"),
 				codesAre(http.StatusOK, http.StatusOK),
-				mimeIs("text/html"),
-				postDataIs("some_data"),
 			),
 		},
-	}
-
-	for _, tc := range tt {
-		t.Run(tc.name, func(t *testing.T) {
-
-			port := getAvailablePort()
-			cmd := exec.Command(chromeBinary,
-				"--headless",
-				"--ignore-certificate-errors",
-				"--disable-gpu",
-				fmt.Sprintf("--remote-debugging-port=%d", port),
-				"http://localhost")
-
-			if err := cmd.Start(); err != nil {
-				t.Fatalf("unable to start chrome: %s", err)
-			}
-			defer func() {
-				if err := cmd.Process.Kill(); err != nil {
-					log.Fatal("failed to kill process: ", err)
-				}
-			}()
-
-			dur := 200 * time.Millisecond
-			if tc.wait > dur {
-				dur = tc.wait
-			}
-
-			resp, err := responseFromServerWithHandler(tc.handler, port, tc.tls, &dur)
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			if err := tc.validator(*resp); err != nil {
-				t.Fatal(err)
-			}
-
-		})
-	}
-}
-
-func randStr(len int) string {
-	bytes := make([]byte, len)
-	for i := 0; i < len; i++ {
-		bytes[i] = byte(65 + rand.Intn(25))
-	}
-	return string(bytes)
-}
+		{
+			name:    "without auto scroll",
+			handler: lazyHandler,
+			validator: join(
+				hasActionCount(1),
+				hasNoTrace,
+			),
+		},
+		{
+			name:    "trace",
+			handler: txtHandler("<html><body><script>document.title = 'traced'</script></body></html>", http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) {
+				req.Trace = true
+			},
+			validator: join(
+				hasActionCount(1),
+				traceHasEvents(),
+			),
+		},
+		{
+			name:    "third party cookies",
+			handler: txtHandler(fmt.Sprintf(`<html><body><img src="%s/pixel.png"/></body></html>`, thirdParty.URL), http.StatusOK),
+			validator: join(
+				hasActionCount(2),
+				cookiesSetBy(thirdPartyURL.Host, 2),
+			),
+		},
+		{
+			name:    "rendered html",
+			handler: txtHandler(`<html><body><script>document.body.appendChild(document.createElement('article')).textContent = 'rendered by js'</script></body></html>`, http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) { req.CaptureDOM = true },
+			validator: join(
+				hasActionCount(1),
+				renderedHTMLContains("<article>rendered by js</article>"),
+			),
+		},
+		{
+			name:    "pre-capture script",
+			handler: txtHandler(`<html><head><title>meow</title></head><body></body></html>`, http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) {
+				req.PreCaptureScript = `new Promise(r => setTimeout(() => r({title: document.title}), 100))`
+			},
+			validator: join(
+				hasActionCount(1),
+				scriptResultIs(`{"title":"meow"}`, ""),
+			),
+		},
+		{
+			name:    "pre-capture script exception",
+			handler: txtHandler(`<html><body></body></html>`, http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) { req.PreCaptureScript = `throw new Error('meow')` },
+			validator: join(
+				hasActionCount(1),
+				scriptResultIs("", "Error: meow"),
+			),
+		},
+		{
+			name:    "wait for load event",
+			handler: slowImageHandler,
+			request: func(req *kraaler.CrawlRequest) { req.WaitEvent = "load" },
+			validator: join(
+				hasActionCount(2),
+				waitEndedAt("load", 500*time.Millisecond),
+			),
+		},
+		{
+			name:      "warm visit",
+			handler:   cacheHandler,
+			request:   func(req *kraaler.CrawlRequest) { req.WarmVisit = true },
+			validator: warmVisitUsesCache,
+		},
+		{
+			name:    "console levels",
+			handler: txtHandler(`<script>console.log('l');console.info('i');console.debug('d');console.warn('w');console.error('e');console.table([1])</script>`, http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				consoleLevelsAre("log", "info", "debug", "warn", "error", "log"),
+			),
+		},
+		{
+			name:    "charset",
+			handler: txtHandler(`<html><head><meta charset="iso-8859-1"></head><body>caf\xe9</body></html>`, http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				codesAre(http.StatusOK),
+				charsetIs("iso-8859-1"),
+			),
+		},
+		{
+			name:       "wait for status",
+			handler:    authHandler,
+			waitStatus: http.StatusOK,
+			validator:  finalStatusIs(http.StatusOK, 3),
+		},
+		{
+			name:       "wait for status loop",
+			handler:    loopHandler,
+			waitStatus: http.StatusOK,
+			validator:  pageErrorIs(kraaler.ErrRedirectLoop),
+		},
+		{
+			name:    "click",
+			handler: txtHandler(`<html><body><button id="enter" onclick="document.getElementById('gate').textContent = 'revealed content'">enter</button><div id="gate"></div></body></html>`, http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) {
+				req.CaptureDOM = true
+				req.Click = &kraaler.Click{Selector: "#enter", Wait: 100 * time.Millisecond}
+			},
+			validator: join(
+				clickedOn("#enter"),
+				renderedHTMLContains("revealed content"),
+			),
+		},
+		{
+			name:    "notification permission",
+			handler: txtHandler(`<html><body><script>Notification.requestPermission().then(p => document.title = p)</script></body></html>`, http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				permissionsRequested("notifications"),
+			),
+		},
+		{
+			name:    "beforeunload handler",
+			handler: txtHandler(`<html><body><script>window.addEventListener("beforeunload", e => { e.preventDefault(); e.returnValue = ""; })</script></body></html>`, http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				unloadHandlers(true, false),
+			),
+		},
+		{
+			name:      "unload attribute",
+			handler:   txtHandler(`<html><body onunload="document.title = 'bye'"></body></html>`, http.StatusOK),
+			validator: unloadHandlers(false, true),
+		},
+		{
+			name:      "manifest",
+			handler:   manifestHandler,
+			validator: manifestNamed("Kraaler App"),
+		},
+		{
+			name:    "redirect limit",
+			handler: endlessHandler,
+			request: func(req *kraaler.CrawlRequest) {
+				req.MaxRedirects = 5
+			},
+			validator: join(
+				redirectsStoppedAt(5),
+				pageErrorIs(kraaler.ErrTooManyRedirects),
+			),
+		},
+		{
+			name:    "transfer size",
+			handler: gzipHandler,
+			validator: join(
+				hasActionCount(1),
+				codesAre(http.StatusOK),
+				encodedSmallerThanDecoded,
+			),
+		},
+		{
+			name:    "redirect",
+			handler: redirectHandler,
+			validator: join(
+				hasActionCount(3),
+				initiatorsAre("user", "redirect", "redirect"),
+				codesAre(http.StatusMovedPermanently, http.StatusMovedPermanently, http.StatusOK),
+				bodiesAre("", "", "hello world"),
+				mimeIs("text/plain"),
+				finalPathIs("/last"),
+				remoteAddrIsLocal(),
+			),
+		},
+		{
+			name:    "html parsing",
+			handler: multiHandler,
+			validator: join(
+				hasActionCount(2),
+				initiatorsAre("user", "parser"),
+				initiatorURLsAre("", "/"),
+				bodiesAre(multiHandlerRootBody, "not found"),
+				codesAre(http.StatusOK, http.StatusNotFound),
+				mimeIs("text/plain"),
+				documentURLsInclude("/img"),
+			),
+		},
+		{
+			name:    "failed resource",
+			handler: missingHandler,
+			validator: join(
+				hasActionCount(2),
+				errorsAre("", "net::ERR_CONNECTION_REFUSED"),
+				failedRequestsAre(1),
+				failedRequestBytesAre(0),
+			),
+		},
+		{
+			name:    "truncated resource",
+			handler: truncatedHandler,
+			validator: join(
+				hasActionCount(2),
+				failedRequestsAre(1),
+				failedRequestBytesAre(4096),
+			),
+		},
+		{
+			name:    "post data",
+			handler: txtHandler("<script>function hest() { var xhr = new XMLHttpRequest(); xhr.open('POST', '/poster'); xhr.send('some_data'); }; hest()</script>", http.StatusOK),
+			wait:    500 * time.Millisecond,
+			validator: join(
+				hasActionCount(2),
+				initiatorsAre("user", "script"),
+				codesAre(http.StatusOK, http.StatusOK),
+				mimeIs("text/html"),
+				postDataIs("some_data"),
+			),
+		},
+		{
+			name:    "large post data",
+			handler: txtHandler("<script>var xhr = new XMLHttpRequest(); xhr.open('POST', '/poster'); xhr.send('x'.repeat(200000));</script>", http.StatusOK),
+			wait:    500 * time.Millisecond,
+			validator: join(
+				hasActionCount(2),
+				postDataIs(strings.Repeat("x", 200000)),
+			),
+		},
+		{
+			name:    "multipart post data",
+			handler: txtHandler("<script>var fd = new FormData(); fd.append('user', 'admin'); fd.append('upload', new Blob([new Uint8Array([0, 255, 1])]), 'bin'); var xhr = new XMLHttpRequest(); xhr.open('POST', '/poster'); xhr.send(fd);</script>", http.StatusOK),
+			wait:    500 * time.Millisecond,
+			validator: join(
+				hasActionCount(2),
+				postDataContains("Content-Disposition: form-data; name=\"user\"", "admin"),
+			),
+		},
+		{
+			name:    "alert dialog",
+			handler: txtHandler("<script>alert('hello');console.log('after')</script>", http.StatusOK),
+			validator: join(
+				hasActionCount(1),
+				codesAre(http.StatusOK),
+				dialogsAre("alert"),
+				consoleIs([]string{`"after"`}),
+			),
+		},
+		{
+			name:    "viewports",
+			handler: txtHandler("hello world", http.StatusOK),
+			viewports: []kraaler.Viewport{
+				{Resolution: kraaler.Resolution{Width: 375, Height: 667}, ScaleFactor: 2, Mobile: true},
+				{Resolution: kraaler.Resolution{Width: 1920, Height: 1080}},
+			},
+			validator: join(
+				hasActionCount(1),
+				screenshotSizesAre(
+					kraaler.Resolution{Width: 750, Height: 1334},
+					kraaler.Resolution{Width: 1920, Height: 1080},
+				),
+			),
+		},
+		{
+			name:    "service worker",
+			handler: swHandler,
+			wait:    500 * time.Millisecond,
+			validator: join(
+				codesAre(http.StatusOK, http.StatusOK),
+				serviceWorkersAre("/sw.js"),
+			),
+		},
+		{
+			name:    "websocket handshake",
+			handler: wsHandler,
+			wait:    500 * time.Millisecond,
+			validator: join(
+				hasActionCount(2),
+				initiatorsAre("user", "websocket"),
+				webSocketHandshakesAre("X-Kraaler"),
+			),
+		},
+		{
+			name:    "websocket frames",
+			handler: wsEchoHandler,
+			wait:    500 * time.Millisecond,
+			validator: join(
+				webSocketFramesAre([]string{"sent", "received"}, []int{5, 11}),
+			),
+		},
+		{
+			name:    "performance metrics",
+			handler: txtHandler("<p>hello world</p>", http.StatusOK),
+			request: func(req *kraaler.CrawlRequest) { req.PerformanceMetrics = true },
+			validator: join(
+				hasActionCount(1),
+				metricsInclude("Timestamp", "Nodes", "JSHeapUsedSize"),
+			),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+
+			port := getAvailablePort()
+			cmd := exec.Command(chromeBinary,
+				"--headless",
+				"--ignore-certificate-errors",
+				"--disable-gpu",
+				fmt.Sprintf("--remote-debugging-port=%d", port),
+				"http://localhost")
+
+			if err := cmd.Start(); err != nil {
+				t.Fatalf("unable to start chrome: %s", err)
+			}
+			defer func() {
+				if err := cmd.Process.Kill(); err != nil {
+					log.Fatal("failed to kill process: ", err)
+				}
+			}()
+
+			dur := 200 * time.Millisecond
+			if tc.wait > dur {
+				dur = tc.wait
+			}
+
+			req := kraaler.CrawlRequest{
+				Screenshots:   []time.Duration{dur},
+				Viewports:     tc.viewports,
+				WaitForStatus: tc.waitStatus,
+			}
+			if tc.request != nil {
+				tc.request(&req)
+			}
+
+			resp, err := responseFromServerWithHandler(tc.handler, port, tc.tls, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tc.validator(*resp); err != nil {
+				t.Fatal(err)
+			}
+
+		})
+	}
+}
+
+func randStr(len int) string {
+	bytes := make([]byte, len)
+	for i := 0; i < len; i++ {
+		bytes[i] = byte(65 + rand.Intn(25))
+	}
+	return string(bytes)
+}
 
 type testWorker struct {
 	m *http.ServeMux
@@ -490,6 +1560,18 @@ func (tw *testWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraa
 	return nil
 }
 
+func getDB(name string) (*sql.DB, string, error) {
+	tmpfile, err := ioutil.TempFile("", name)
+	if err != nil {
+		return nil, "", err
+	}
+	f := tmpfile.Name()
+	os.Remove(f)
+
+	db, err := sql.Open("sqlite3", f)
+	return db, f, err
+}
+
 func TestWorkerController(t *testing.T) {
 	genServer := func(n int) (*http.ServeMux, <-chan bool) {
 		m := http.NewServeMux()
@@ -529,18 +1611,6 @@ func TestWorkerController(t *testing.T) {
 		return m, done
 	}
 
-	getDB := func(name string) (*sql.DB, string, error) {
-		tmpfile, err := ioutil.TempFile("", name)
-		if err != nil {
-			return nil, "", err
-		}
-		f := tmpfile.Name()
-		os.Remove(f)
-
-		db, err := sql.Open("sqlite3", f)
-		return db, f, err
-	}
-
 	serv, done := genServer(100)
 	prodWorker := func() (kraaler.Worker, error) {
 		return &testWorker{serv}, nil
@@ -581,3 +1651,1213 @@ func TestWorkerController(t *testing.T) {
 		t.Fatalf("expected to have visited every endpoint")
 	}
 }
+
+type drainingWorker struct {
+	started chan struct{}
+	stopped chan struct{}
+	kill    chan struct{}
+}
+
+func (dw *drainingWorker) Close() error {
+	close(dw.kill)
+	<-dw.stopped
+	return nil
+}
+
+func (dw *drainingWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	defer close(dw.stopped)
+
+	for {
+		select {
+		case <-dw.kill:
+			return nil
+		case r := <-queue:
+			dw.started <- struct{}{}
+			time.Sleep(200 * time.Millisecond)
+			results <- kraaler.Page{InitialURL: r.Url}
+		}
+	}
+}
+
+type countingPageStore struct {
+	m     sync.Mutex
+	pages int
+}
+
+func (cps *countingPageStore) SaveSession(kraaler.Page) error {
+	cps.m.Lock()
+	cps.pages += 1
+	cps.m.Unlock()
+	return nil
+}
+
+func TestWorkerControllerDrain(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-drain")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db)
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("http://aau.dk")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	dw := &drainingWorker{
+		started: make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+		kill:    make(chan struct{}),
+	}
+	ps := &countingPageStore{}
+
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:       us,
+			PageStore:      ps,
+			DrainTimeout:   5 * time.Second,
+			WorkerProducer: func() (kraaler.Worker, error) { return dw, nil },
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+
+	if err := wc.AddWorker(); err != nil {
+		t.Fatalf("unable to add worker: %s", err)
+	}
+
+	select {
+	case <-dw.started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected worker to start fetching")
+	}
+
+	wc.Close()
+
+	ps.m.Lock()
+	defer ps.m.Unlock()
+	if ps.pages != 1 {
+		t.Fatalf("expected in-flight page to be saved on close, but saved: %d", ps.pages)
+	}
+}
+
+type fakeBrowser struct {
+	m     sync.Mutex
+	dials int
+	url   string
+}
+
+type fakeCDPMsg struct {
+	ID     uint64          `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result interface{}     `json:"result,omitempty"`
+}
+
+func (fb *fakeBrowser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/json/version" {
+		fmt.Fprintf(w, `{"webSocketDebuggerUrl": "ws://%s/devtools/browser"}`, r.Host)
+		return
+	}
+
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fb.m.Lock()
+	fb.dials++
+	crash := fb.dials == 1
+	fb.m.Unlock()
+
+	send := func(sessID string, msg fakeCDPMsg) error {
+		raw, _ := json.Marshal(msg)
+		return conn.WriteJSON(fakeCDPMsg{
+			Method: "Target.receivedMessageFromTarget",
+			Params: json.RawMessage(fmt.Sprintf(`{"sessionId": %q, "message": %q}`, sessID, raw)),
+		})
+	}
+
+	for {
+		var msg fakeCDPMsg
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		var result interface{} = struct{}{}
+		switch msg.Method {
+		case "Target.createBrowserContext":
+			result = map[string]string{"browserContextId": "ctx"}
+		case "Target.createTarget":
+			result = map[string]string{"targetId": "target"}
+		case "Target.attachToTarget":
+			result = map[string]string{"sessionId": "session"}
+		case "Target.closeTarget":
+			result = map[string]bool{"success": true}
+		case "Target.sendMessageToTarget":
+			var params struct {
+				Message   string `json:"message"`
+				SessionID string `json:"sessionId"`
+			}
+			json.Unmarshal(msg.Params, &params)
+
+			var inner fakeCDPMsg
+			json.Unmarshal([]byte(params.Message), &inner)
+
+			var navigate struct {
+				URL string `json:"url"`
+			}
+			json.Unmarshal(inner.Params, &navigate)
+
+			if inner.Method == "Page.navigate" && navigate.URL == fb.url {
+				if crash {
+					// simulate the browser dying mid-fetch
+					conn.UnderlyingConn().Close()
+					return
+				}
+
+				send(params.SessionID, fakeCDPMsg{ID: inner.ID, Result: map[string]string{"frameId": "frame"}})
+				send(params.SessionID, fakeCDPMsg{
+					Method: "Page.domContentEventFired",
+					Params: json.RawMessage(`{"timestamp": 1}`),
+				})
+				break
+			}
+
+			send(params.SessionID, fakeCDPMsg{ID: inner.ID, Result: struct{}{}})
+		}
+
+		if err := conn.WriteJSON(fakeCDPMsg{ID: msg.ID, Result: result}); err != nil {
+			return
+		}
+	}
+}
+
+func TestWorkerBrowserCrash(t *testing.T) {
+	u, _ := url.Parse("http://aau.dk/")
+	fb := &fakeBrowser{url: u.String()}
+	ts := httptest.NewServer(fb)
+	defer ts.Close()
+
+	w, err := kraaler.NewWorker(kraaler.WorkerConfig{
+		UseInstance: ts.URL,
+		Logger:      zap.NewNop(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create worker: %s", err)
+	}
+
+	queue := make(chan kraaler.CrawlRequest, 1)
+	results := make(chan kraaler.Page, 1)
+	go w.Run(queue, results)
+	defer w.Close()
+
+	queue <- kraaler.CrawlRequest{Url: u}
+
+	select {
+	case p := <-results:
+		if p.Error != nil {
+			t.Fatalf("expected worker to recover from crash, but received error: %s", p.Error)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for worker to recover from crash")
+	}
+
+	fb.m.Lock()
+	defer fb.m.Unlock()
+	if fb.dials != 2 {
+		t.Fatalf("expected browser to be dialed twice, but was dialed: %d", fb.dials)
+	}
+}
+
+// fakeRuntime hands out containers of a single endpoint, blocking every
+// start beyond the first few until released
+type fakeRuntime struct {
+	m        sync.Mutex
+	endpoint string
+	started  int
+	removed  []string
+	free     int
+	release  chan struct{}
+}
+
+func (fr *fakeRuntime) Start() (*kraaler.Container, error) {
+	fr.m.Lock()
+	fr.started++
+	n := fr.started
+	fr.m.Unlock()
+
+	if n > fr.free {
+		<-fr.release
+	}
+
+	return &kraaler.Container{ID: strconv.Itoa(n), Endpoint: fr.endpoint}, nil
+}
+
+func (fr *fakeRuntime) Remove(c *kraaler.Container) error {
+	fr.m.Lock()
+	defer fr.m.Unlock()
+	fr.removed = append(fr.removed, c.ID)
+	return nil
+}
+
+func (fr *fakeRuntime) startedAmount() int {
+	fr.m.Lock()
+	defer fr.m.Unlock()
+	return fr.started
+}
+
+func TestWorkerContainerPool(t *testing.T) {
+	// a browser closing the connection mid response is considered crashed
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("{"))
+	}))
+	defer ts.Close()
+
+	rt := &fakeRuntime{endpoint: ts.URL, free: 2, release: make(chan struct{})}
+	pool, err := kraaler.NewContainerPool(rt, 2, nil)
+	if err != nil {
+		t.Fatalf("unable to create container pool: %s", err)
+	}
+	defer pool.Close()
+	defer close(rt.release)
+
+	for rt.startedAmount() < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w, err := kraaler.NewWorker(kraaler.WorkerConfig{
+		Runtime: pool,
+		Logger:  zap.NewNop(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create worker: %s", err)
+	}
+
+	queue := make(chan kraaler.CrawlRequest, 1)
+	results := make(chan kraaler.Page, 1)
+	go w.Run(queue, results)
+	defer w.Close()
+
+	u, _ := url.Parse("http://127.0.0.1/")
+	queue <- kraaler.CrawlRequest{Url: u}
+
+	select {
+	case p := <-results:
+		if p.Error != kraaler.ErrBrowserCrash {
+			t.Fatalf("expected browser crash, but received: %v", p.Error)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for reset, expected it to use a warm container")
+	}
+
+	rt.m.Lock()
+	defer rt.m.Unlock()
+	if len(rt.removed) != 1 || rt.removed[0] != "1" {
+		t.Fatalf("expected the crashed container to be removed, but removed: %v", rt.removed)
+	}
+}
+
+func TestDockerClientConcurrentCreates(t *testing.T) {
+	tt := []struct {
+		name     string
+		conns    int
+		creates  int
+		expected int
+	}{
+		{name: "parallel", conns: 4, creates: 4, expected: 4},
+		{name: "limited", conns: 1, creates: 2, expected: 1},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "kraaler-docker")
+			if err != nil {
+				t.Fatalf("unable to create temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			l, err := net.Listen("unix", dir+"/docker.sock")
+			if err != nil {
+				t.Fatalf("unable to listen on socket: %s", err)
+			}
+
+			// the fake daemon holds creates until all of them are in
+			// flight, or a short while has passed
+			var m sync.Mutex
+			var arrived, inflight, max int
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/containers/create") {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				m.Lock()
+				arrived++
+				inflight++
+				if inflight > max {
+					max = inflight
+				}
+				m.Unlock()
+
+				deadline := time.Now().Add(500 * time.Millisecond)
+				for time.Now().Before(deadline) {
+					m.Lock()
+					n := arrived
+					m.Unlock()
+					if n >= tc.creates {
+						break
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				fmt.Fprintf(w, `{"Id": "%s"}`, randStr(8))
+
+				m.Lock()
+				inflight--
+				m.Unlock()
+			})}
+			go srv.Serve(l)
+			defer srv.Close()
+
+			c, err := kraaler.NewDockerClient("unix://"+dir+"/docker.sock", tc.conns)
+			if err != nil {
+				t.Fatalf("unable to create docker client: %s", err)
+			}
+			c.SkipServerVersionCheck = true
+
+			var wg sync.WaitGroup
+			for i := 0; i < tc.creates; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := c.CreateContainer(docker.CreateContainerOptions{Config: &docker.Config{Image: "meow"}}); err != nil {
+						t.Errorf("unable to create container: %s", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if max != tc.expected {
+				t.Fatalf("expected %d concurrent create(s), but received: %d", tc.expected, max)
+			}
+		})
+	}
+}
+
+func TestWorkerControllerRemoveWorker(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-remove")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db)
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("http://aau.dk")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	started := make(chan struct{}, 10)
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore: us,
+			WorkerProducer: func() (kraaler.Worker, error) {
+				return &drainingWorker{
+					started: started,
+					stopped: make(chan struct{}),
+					kill:    make(chan struct{}),
+				}, nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := wc.AddWorker(); err != nil {
+			t.Fatalf("unable to add worker: %s", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := wc.RemoveWorker(); err != nil {
+			t.Fatalf("unable to remove worker: %s", err)
+		}
+	}
+
+	if err := wc.RemoveWorker(); err != kraaler.ErrNoWorkers {
+		t.Fatalf("expected error (%s) when removing from empty pool, but received: %v", kraaler.ErrNoWorkers, err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		wc.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected controller to close after removing every worker")
+	}
+}
+
+// egressRuntime records the egress ips containers are started from
+type egressRuntime struct {
+	fakeRuntime
+	egress []string
+}
+
+func (er *egressRuntime) StartFrom(ip string) (*kraaler.Container, error) {
+	er.m.Lock()
+	er.egress = append(er.egress, ip)
+	er.m.Unlock()
+
+	return er.Start()
+}
+
+func TestWorkerControllerEgressIPs(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-egress")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db)
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}
+	rt := &egressRuntime{fakeRuntime: fakeRuntime{endpoint: "http://127.0.0.1:1", free: len(ips)}}
+
+	// workers are only created, as the queue is stopped up front
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	wc, err := kraaler.NewWorkerController(
+		ctx,
+		kraaler.WorkerControllerConfig{
+			URLStore:       us,
+			Runtime:        rt,
+			EgressIPs:      ips,
+			WarmContainers: 2,
+			Logger:         zap.NewNop(),
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+	defer wc.Close()
+
+	for range ips {
+		if err := wc.AddWorker(); err != nil {
+			t.Fatalf("unable to add worker: %s", err)
+		}
+	}
+
+	rt.m.Lock()
+	defer rt.m.Unlock()
+	if len(rt.egress) != len(ips) {
+		t.Fatalf("expected %d container(s) bound to an egress ip, but received: %v", len(ips), rt.egress)
+	}
+
+	bound := map[string]bool{}
+	for _, ip := range rt.egress {
+		bound[ip] = true
+	}
+
+	for _, ip := range ips {
+		if !bound[ip] {
+			t.Fatalf("expected a worker bound to %s, but bound: %v", ip, rt.egress)
+		}
+	}
+}
+
+type linkingWorker struct {
+	link *url.URL
+	kill chan struct{}
+}
+
+func (lw *linkingWorker) Close() error {
+	close(lw.kill)
+	return nil
+}
+
+func (lw *linkingWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-lw.kill:
+			return nil
+		case r := <-queue:
+			results <- kraaler.Page{
+				InitialURL:   r.Url,
+				DocumentURLs: []*url.URL{lw.link},
+				LinkPolicy:   r.LinkPolicy,
+			}
+		}
+	}
+}
+
+type recordingURLStore struct {
+	m       sync.Mutex
+	seed    *url.URL
+	samples int
+	added   []*url.URL
+	done    chan struct{}
+}
+
+func (rus *recordingURLStore) Sample() (*url.URL, error) {
+	rus.m.Lock()
+	defer rus.m.Unlock()
+
+	rus.samples += 1
+	if rus.samples == 1 {
+		return rus.seed, nil
+	}
+
+	select {
+	case rus.done <- struct{}{}:
+	default:
+	}
+
+	return nil, store.StoreIsEmptyErr
+}
+
+func (rus *recordingURLStore) Add(urls ...*url.URL) (int, error) {
+	rus.m.Lock()
+	defer rus.m.Unlock()
+
+	rus.added = append(rus.added, urls...)
+	return len(urls), nil
+}
+
+func (rus *recordingURLStore) Visit(*url.URL, time.Time) error { return nil }
+func (rus *recordingURLStore) Size() int                       { return 1 }
+
+func TestWorkerControllerLinkPolicy(t *testing.T) {
+	seed, _ := url.Parse("http://aau.dk/")
+	sameSite, _ := url.Parse("http://es.aau.dk/page")
+	otherSite, _ := url.Parse("http://google.com/")
+
+	tt := []struct {
+		name     string
+		link     *url.URL
+		policy   kraaler.LinkPolicy
+		expected int
+	}{
+		{name: "all", link: otherSite, policy: kraaler.LinkPolicy{Kind: kraaler.FollowAll}, expected: 1},
+		{name: "none", link: sameSite, policy: kraaler.LinkPolicy{Kind: kraaler.FollowNone}, expected: 0},
+		{name: "same site", link: sameSite, policy: kraaler.LinkPolicy{Kind: kraaler.FollowSameSite}, expected: 1},
+		{name: "other site", link: otherSite, policy: kraaler.LinkPolicy{Kind: kraaler.FollowSameSite}, expected: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			us := &recordingURLStore{seed: seed, done: make(chan struct{}, 1)}
+			wc, err := kraaler.NewWorkerController(
+				context.Background(),
+				kraaler.WorkerControllerConfig{
+					URLStore:   us,
+					LinkPolicy: func(*url.URL) kraaler.LinkPolicy { return tc.policy },
+					WorkerProducer: func() (kraaler.Worker, error) {
+						return &linkingWorker{link: tc.link, kill: make(chan struct{})}, nil
+					},
+				},
+			)
+			if err != nil {
+				t.Fatalf("unable to create worker controller: %s", err)
+			}
+			defer wc.Close()
+
+			if err := wc.AddWorker(); err != nil {
+				t.Fatalf("unable to add worker: %s", err)
+			}
+
+			select {
+			case <-us.done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected page to be processed")
+			}
+
+			us.m.Lock()
+			defer us.m.Unlock()
+			if n := len(us.added); n != tc.expected {
+				t.Fatalf("expected %d discovered link(s) to be added, but added: %d", tc.expected, n)
+			}
+		})
+	}
+}
+
+type requestWorker struct {
+	requests chan kraaler.CrawlRequest
+	kill     chan struct{}
+}
+
+func (rw *requestWorker) Close() error {
+	close(rw.kill)
+	return nil
+}
+
+func (rw *requestWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-rw.kill:
+			return nil
+		case r := <-queue:
+			rw.requests <- r
+			results <- kraaler.Page{InitialURL: r.Url}
+		}
+	}
+}
+
+func TestWorkerControllerTrace(t *testing.T) {
+	seed, _ := url.Parse("http://aau.dk/")
+
+	tt := []struct {
+		name     string
+		trace    func(*url.URL) bool
+		expected bool
+	}{
+		{name: "no trace", expected: false},
+		{name: "traced url", trace: func(u *url.URL) bool { return u.Host == "aau.dk" }, expected: true},
+		{name: "other url", trace: func(u *url.URL) bool { return u.Host == "google.com" }, expected: false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			us := &recordingURLStore{seed: seed, done: make(chan struct{}, 1)}
+			requests := make(chan kraaler.CrawlRequest, 1)
+			wc, err := kraaler.NewWorkerController(
+				context.Background(),
+				kraaler.WorkerControllerConfig{
+					URLStore: us,
+					Trace:    tc.trace,
+					WorkerProducer: func() (kraaler.Worker, error) {
+						return &requestWorker{requests: requests, kill: make(chan struct{})}, nil
+					},
+				},
+			)
+			if err != nil {
+				t.Fatalf("unable to create worker controller: %s", err)
+			}
+			defer wc.Close()
+
+			if err := wc.AddWorker(); err != nil {
+				t.Fatalf("unable to add worker: %s", err)
+			}
+
+			select {
+			case r := <-requests:
+				if r.Trace != tc.expected {
+					t.Fatalf("expected trace of request to be %t, but was: %t", tc.expected, r.Trace)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected url to be requested")
+			}
+		})
+	}
+}
+
+func TestWorkerControllerScreenshotFormat(t *testing.T) {
+	tt := []struct {
+		name   string
+		format string
+		err    bool
+	}{
+		{name: "as stored", format: "png"},
+		{name: "re-encoded", format: "jpeg"},
+		{name: "webp", format: "webp", err: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, fn, err := getDB("kraaler-screenshot-format")
+			if err != nil {
+				t.Fatalf("unable to create db: %s", err)
+			}
+			defer os.RemoveAll(fn)
+
+			dir, err := ioutil.TempDir("", "kraaler-screenshot-format")
+			if err != nil {
+				t.Fatalf("unable to create temp dir: %s", err)
+			}
+			defer os.RemoveAll(dir)
+
+			ps, err := store.NewStore(db, dir, dir, store.WithScreenshotFormat("png"))
+			if err != nil {
+				t.Fatalf("unable to create page store: %s", err)
+			}
+
+			wc, err := kraaler.NewWorkerController(
+				context.Background(),
+				kraaler.WorkerControllerConfig{
+					URLStore:         &recordingURLStore{done: make(chan struct{}, 1)},
+					PageStore:        ps,
+					ScreenshotFormat: tc.format,
+					WorkerProducer: func() (kraaler.Worker, error) {
+						return &requestWorker{kill: make(chan struct{})}, nil
+					},
+				},
+			)
+			if (err != nil) != tc.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if wc != nil {
+				wc.Close()
+			}
+		})
+	}
+}
+
+func TestWorkerControllerRobots(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+		}
+	}))
+	defer ts.Close()
+
+	db, fn, err := getDB("kraaler-url-store-robots")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db, store.WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	private, _ := url.Parse(ts.URL + "/private")
+	public, _ := url.Parse(ts.URL + "/public")
+	if _, err := us.Add(private, public); err != nil {
+		t.Fatalf("unable to add urls: %s", err)
+	}
+
+	requests := make(chan kraaler.CrawlRequest, 2)
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore: us,
+			Robots:   kraaler.NewRobotsCache("kraaler"),
+			WorkerProducer: func() (kraaler.Worker, error) {
+				return &requestWorker{requests: requests, kill: make(chan struct{})}, nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+	defer wc.Close()
+
+	if err := wc.AddWorker(); err != nil {
+		t.Fatalf("unable to add worker: %s", err)
+	}
+
+	select {
+	case r := <-requests:
+		if r.Url.String() != public.String() {
+			t.Fatalf("expected only allowed url to be requested, but got: %s", r.Url)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected url to be requested")
+	}
+
+	// the disallowed url is visited, such that it is no longer sampled
+	deadline := time.After(5 * time.Second)
+	for {
+		var visit sql.NullInt64
+		if err := db.QueryRow("select last_visit from url_visits where url = ?", private.String()).Scan(&visit); err != nil {
+			t.Fatalf("unable to read visit: %s", err)
+		}
+
+		if visit.Valid && us.Size() == 0 {
+			break
+		}
+
+		select {
+		case <-deadline:
+			t.Fatalf("expected disallowed url to be visited, but %d url(s) are left", us.Size())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+type concurrencyWorker struct {
+	m      *sync.Mutex
+	active map[string]int
+	max    *int
+	kill   chan struct{}
+}
+
+func (cw *concurrencyWorker) Close() error {
+	close(cw.kill)
+	return nil
+}
+
+func (cw *concurrencyWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-cw.kill:
+			return nil
+		case r := <-queue:
+			cw.m.Lock()
+			cw.active[r.Url.String()] += 1
+			if n := cw.active[r.Url.String()]; n > *cw.max {
+				*cw.max = n
+			}
+			cw.m.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+
+			cw.m.Lock()
+			cw.active[r.Url.String()] -= 1
+			cw.m.Unlock()
+
+			results <- kraaler.Page{InitialURL: r.Url}
+		}
+	}
+}
+
+type singleURLStore struct {
+	u *url.URL
+}
+
+func (sus singleURLStore) Sample() (*url.URL, error)         { return sus.u, nil }
+func (sus singleURLStore) Add(urls ...*url.URL) (int, error) { return 0, nil }
+func (sus singleURLStore) Visit(*url.URL, time.Time) error   { return nil }
+func (sus singleURLStore) Size() int                         { return 1 }
+
+func TestWorkerControllerInflightDedup(t *testing.T) {
+	u, _ := url.Parse("http://aau.dk/")
+	pages := &countingPageStore{}
+
+	var m sync.Mutex
+	var max int
+	active := map[string]int{}
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:  singleURLStore{u},
+			PageStore: pages,
+			WorkerProducer: func() (kraaler.Worker, error) {
+				return &concurrencyWorker{m: &m, active: active, max: &max, kill: make(chan struct{})}, nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := wc.AddWorker(); err != nil {
+			t.Fatalf("unable to add worker: %s", err)
+		}
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	wc.Close()
+
+	m.Lock()
+	defer m.Unlock()
+	if max != 1 {
+		t.Fatalf("expected url to be crawled by one worker at a time, but was crawled by: %d", max)
+	}
+
+	pages.m.Lock()
+	defer pages.m.Unlock()
+	if pages.pages < 2 {
+		t.Fatalf("expected url to be crawled again once finished, but was crawled: %d time(s)", pages.pages)
+	}
+}
+
+// flakyWorker fails the first crawl of every url with a transient error
+type flakyWorker struct {
+	m        sync.Mutex
+	attempts map[string]int
+	visited  chan string
+	kill     chan struct{}
+}
+
+func (fw *flakyWorker) Close() error {
+	close(fw.kill)
+	return nil
+}
+
+func (fw *flakyWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-fw.kill:
+			return nil
+		case r := <-queue:
+			fw.m.Lock()
+			fw.attempts[r.Url.String()] += 1
+			n := fw.attempts[r.Url.String()]
+			fw.m.Unlock()
+
+			if n == 1 {
+				results <- kraaler.Page{InitialURL: r.Url, Error: fmt.Errorf("net::ERR_CONNECTION_RESET")}
+				continue
+			}
+
+			results <- kraaler.Page{InitialURL: r.Url}
+			fw.visited <- r.Url.String()
+		}
+	}
+}
+
+func TestWorkerControllerReleaseFailed(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-release")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db, store.WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("http://aau.dk/")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	fw := &flakyWorker{
+		attempts: map[string]int{},
+		visited:  make(chan string, 1),
+		kill:     make(chan struct{}),
+	}
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:       us,
+			WorkerProducer: func() (kraaler.Worker, error) { return fw, nil },
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+	defer wc.Close()
+
+	if err := wc.AddWorker(); err != nil {
+		t.Fatalf("unable to add worker: %s", err)
+	}
+
+	select {
+	case v := <-fw.visited:
+		if v != u.String() {
+			t.Fatalf("expected %s to be visited, but visited: %s", u, v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected url of failed crawl to be crawled again")
+	}
+
+	fw.m.Lock()
+	defer fw.m.Unlock()
+	if n := fw.attempts[u.String()]; n != 2 {
+		t.Fatalf("expected url to be crawled twice, but was crawled: %d time(s)", n)
+	}
+}
+
+// failingWorker fails every crawl
+type failingWorker struct {
+	m        sync.Mutex
+	attempts int
+	kill     chan struct{}
+}
+
+func (fw *failingWorker) Close() error {
+	close(fw.kill)
+	return nil
+}
+
+func (fw *failingWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-fw.kill:
+			return nil
+		case r := <-queue:
+			fw.m.Lock()
+			fw.attempts += 1
+			fw.m.Unlock()
+
+			results <- kraaler.Page{InitialURL: r.Url, Error: fmt.Errorf("net::ERR_NAME_NOT_RESOLVED")}
+		}
+	}
+}
+
+func TestWorkerControllerFailureThreshold(t *testing.T) {
+	db, fn, err := getDB("kraaler-url-store-failure-threshold")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db, store.WithFailureThreshold(2))
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	u, _ := url.Parse("http://dead.aau.dk/")
+	if _, err := us.Add(u); err != nil {
+		t.Fatalf("unable to add url: %s", err)
+	}
+
+	fw := &failingWorker{kill: make(chan struct{})}
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:       us,
+			WorkerProducer: func() (kraaler.Worker, error) { return fw, nil },
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+	defer wc.Close()
+
+	if err := wc.AddWorker(); err != nil {
+		t.Fatalf("unable to add worker: %s", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	fw.m.Lock()
+	defer fw.m.Unlock()
+	if fw.attempts != 2 {
+		t.Fatalf("expected failing url to be dropped after two attempts, but was crawled: %d time(s)", fw.attempts)
+	}
+
+	if n := us.Size(); n != 0 {
+		t.Fatalf("expected failing url to be dropped, but size is: %d", n)
+	}
+}
+
+// outcomeWorker crawls every url successfully, except urls of hosts named
+// error and timeout, which fail accordingly
+type outcomeWorker struct {
+	kill chan struct{}
+}
+
+func (ow *outcomeWorker) Close() error {
+	close(ow.kill)
+	return nil
+}
+
+func (ow *outcomeWorker) Run(queue <-chan kraaler.CrawlRequest, results chan<- kraaler.Page) error {
+	for {
+		select {
+		case <-ow.kill:
+			return nil
+		case r := <-queue:
+			p := kraaler.Page{InitialURL: r.Url}
+			switch r.Url.Hostname() {
+			case "error":
+				p.Error = fmt.Errorf("net::ERR_NAME_NOT_RESOLVED")
+			case "timeout":
+				p.Error = context.DeadlineExceeded
+			default:
+				p.Actions = []*kraaler.CrawlAction{{Body: &kraaler.ResponseBody{Body: []byte("meow")}}}
+			}
+
+			results <- p
+		}
+	}
+}
+
+func TestWorkerControllerSummary(t *testing.T) {
+	db, fn, err := getDB("kraaler-controller-summary")
+	if err != nil {
+		t.Fatalf("unable to create db: %s", err)
+	}
+	defer os.RemoveAll(fn)
+
+	us, err := store.NewURLStore(db, store.WithNoResampling())
+	if err != nil {
+		t.Fatalf("unable to create url store: %s", err)
+	}
+
+	for _, s := range []string{"http://a.dk/", "http://a.dk/other", "http://b.dk/", "http://error/", "http://timeout/"} {
+		u, _ := url.Parse(s)
+		if _, err := us.Add(u); err != nil {
+			t.Fatalf("unable to add url: %s", err)
+		}
+	}
+
+	ow := &outcomeWorker{kill: make(chan struct{})}
+	providers := []kraaler.URLProvider{
+		fixedStatsProvider{kraaler.ProviderStats{Emitted: 3, Done: true}},
+		fixedStatsProvider{kraaler.ProviderStats{Emitted: 2, Errors: 1}},
+	}
+	wc, err := kraaler.NewWorkerController(
+		context.Background(),
+		kraaler.WorkerControllerConfig{
+			URLStore:       us,
+			URLProviders:   providers,
+			WorkerProducer: func() (kraaler.Worker, error) { return ow, nil },
+		},
+	)
+	if err != nil {
+		t.Fatalf("unable to create worker controller: %s", err)
+	}
+
+	if err := wc.AddWorker(); err != nil {
+		t.Fatalf("unable to add worker: %s", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for wc.Summary().Sessions < 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected five sessions, but summary is: %+v", wc.Summary())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	wc.Close()
+
+	rs := wc.Summary()
+	if rs.Sessions != 5 || rs.Successes != 3 || rs.Errors != 1 || rs.Timeouts != 1 {
+		t.Fatalf("unexpected outcomes of sessions: %+v", rs)
+	}
+
+	if rs.Bytes != 3*int64(len("meow")) {
+		t.Fatalf("expected %d bytes, but summary has: %d", 3*len("meow"), rs.Bytes)
+	}
+
+	if rs.Hosts != 4 {
+		t.Fatalf("expected four distinct hosts, but summary has: %d", rs.Hosts)
+	}
+
+	if rs.Duration <= 0 {
+		t.Fatalf("expected duration of run, but was: %s", rs.Duration)
+	}
+
+	if p := rs.Providers; p.Emitted != 5 || p.Errors != 1 || p.Done {
+		t.Fatalf("expected stats of the providers, one still providing, but summary has: %+v", p)
+	}
+}
+
+type fixedStatsProvider struct {
+	stats kraaler.ProviderStats
+}
+
+func (fsp fixedStatsProvider) UrlsC() <-chan *url.URL       { return nil }
+func (fsp fixedStatsProvider) Stats() kraaler.ProviderStats { return fsp.stats }